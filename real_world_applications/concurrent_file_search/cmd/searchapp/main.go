@@ -7,10 +7,11 @@ package main
 
 import (
 	"concurrent_file_search/pkg/search"
+	"concurrent_file_search/pkg/walk"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
 )
 
 func main() {
@@ -18,38 +19,77 @@ func main() {
 	rootDir := flag.String("root", ".", "Root directory to start the search from")
 	pattern := flag.String("pattern", "", "Search pattern")
 	searchMode := flag.String("mode", "plain", "Search mode: simple|regex")
+	context := flag.Int("context", 0, "Lines of context to print before and after each match")
+	include := flag.String("include", "", "Comma-separated globs; only matching files are searched")
+	exclude := flag.String("exclude", "", "Comma-separated globs of files and directories to skip")
+	types := flag.String("type", "", "Comma-separated file types to search: "+strings.Join(walk.TypeNames(), "|"))
+	maxSize := flag.String("max-size", "", "Skip files larger than this, e.g. 512K or 10M")
+	hidden := flag.Bool("hidden", false, "Search hidden files and directories")
+	noIgnore := flag.Bool("no-ignore", false, "Search files ignored by .gitignore and .ignore files")
+	binary := flag.Bool("binary", false, "Search binary files")
 	flag.Parse()
 
 	if *pattern == "" {
 		fmt.Println("Search pattern must not be empty")
 		os.Exit(1)
 	}
+	if *context < 0 {
+		fmt.Println("Context must not be negative")
+		os.Exit(1)
+	}
+	opts := walk.Options{
+		Include:  splitList(*include),
+		Exclude:  splitList(*exclude),
+		Types:    splitList(*types),
+		Hidden:   *hidden,
+		NoIgnore: *noIgnore,
+		Binary:   *binary,
+	}
+	if *maxSize != "" {
+		size, err := walk.ParseSize(*maxSize)
+		if err != nil {
+			fmt.Println("Invalid max size:", err)
+			os.Exit(1)
+		}
+		opts.MaxSize = size
+	}
 
 	// initialize dispatcher
 	jobs, results := search.StartDispatcher(5) // starting with 5 workers
 
-	// walk through directory structure and send jobs to workers
+	// walk through directory structure and send the selected files to workers
 	go func() {
-		filepath.Walk(*rootDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				fmt.Println("Error accessing path:", path, ":", err)
-				return err
-			}
-
-			if !info.IsDir() {
-				jobs <- search.Job{FilePath: path, SearchPattern: *pattern, SearchMode: *searchMode}
-			}
+		err := walk.Walk(*rootDir, opts, func(path string) error {
+			jobs <- search.Job{FilePath: path, SearchPattern: *pattern, SearchMode: *searchMode, Context: *context}
 			return nil
 		})
+		if err != nil {
+			fmt.Println("Error walking", *rootDir, ":", err)
+		}
 		close(jobs)
 	}()
 
-	// Collect and display the results
+	// Collect and display the results grep-style, one file at a time
+	out := &search.GrepWriter{W: os.Stdout, Context: *context > 0}
 	for result := range results {
 		if result.Found {
-			fmt.Printf("Match found: %v\n", result.Matches)
+			if err := out.Write(result.Matches); err != nil {
+				fmt.Fprintln(os.Stderr, "Error writing results:", err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
 }
 
-// go run main.go --pattern="searchPattern" --searchMode="mode"
+// go run main.go --pattern="searchPattern" --mode="mode" --context=2 --type=go --exclude="vendor/"
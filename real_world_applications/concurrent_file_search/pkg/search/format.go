@@ -0,0 +1,75 @@
+package search
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// GrepWriter prints matches the way grep -n --column does: "path:line:column:text" for a
+// matching line and "path-line-text" for a context line. When context is shown, groups of
+// lines that are not adjacent are separated by a "--" line.
+type GrepWriter struct {
+	W       io.Writer
+	Context bool // separate groups with "--"
+
+	printed  bool   // whether any line was printed yet
+	lastPath string // path and line number of the last line printed
+	lastLine int
+}
+
+// grepLine is a line to print, either a match or context around one.
+type grepLine struct {
+	text   string
+	column int // 0 for context lines
+}
+
+// Write prints the matches of one file in line order. Context lines shared by neighbouring
+// matches are printed once.
+func (g *GrepWriter) Write(matches []Match) error {
+	if len(matches) == 0 {
+		return nil
+	}
+	path := matches[0].Path
+	lines := make(map[int]grepLine)
+	for _, m := range matches {
+		for i, text := range m.Before {
+			n := m.Line - len(m.Before) + i
+			if _, ok := lines[n]; !ok {
+				lines[n] = grepLine{text: text}
+			}
+		}
+		for i, text := range m.After {
+			n := m.Line + 1 + i
+			if _, ok := lines[n]; !ok {
+				lines[n] = grepLine{text: text}
+			}
+		}
+		lines[m.Line] = grepLine{text: m.Content, column: m.Column}
+	}
+	numbers := make([]int, 0, len(lines))
+	for n := range lines {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		if g.Context && g.printed && (path != g.lastPath || n != g.lastLine+1) {
+			if _, err := fmt.Fprintln(g.W, "--"); err != nil {
+				return err
+			}
+		}
+		line := lines[n]
+		var err error
+		if line.column > 0 {
+			_, err = fmt.Fprintf(g.W, "%s:%d:%d:%s\n", path, n, line.column, line.text)
+		} else {
+			_, err = fmt.Fprintf(g.W, "%s-%d-%s\n", path, n, line.text)
+		}
+		if err != nil {
+			return err
+		}
+		g.printed, g.lastPath, g.lastLine = true, path, n
+	}
+	return nil
+}
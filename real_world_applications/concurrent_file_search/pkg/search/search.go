@@ -9,64 +9,105 @@ import (
 	"strings"
 )
 
-// SearchFile searches for a given pattern within a file.
-// It returns a slice of strings containing the file path if the pattern is found,
-// and a boolean indicating whether any matches were found.
-func SearchFile(filePath, searchPattern string) ([]string, bool) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		utils.LogMessage(utils.ERROR, fmt.Sprintf("Error opening file %s: %v", filePath, err))
-		return nil, false
-	}
+// maxLineLength is the longest line a file may contain; longer lines stop the scan.
+const maxLineLength = 1024 * 1024
 
-	scanner := bufio.NewScanner(file)
-	found := false
-	for scanner.Scan() {
-		if strings.Contains(scanner.Text(), searchPattern) {
-			found = true
-			break // found the pattern, no need to continue scanning
+// Match is a line of a file that matches the search pattern.
+type Match struct {
+	Path   string
+	Line   int    // 1-based line number
+	Column int    // 1-based byte offset of the first match in the line
+	Text   string // the matched text
+	// Content is the whole matching line.
+	Content string
+	// Before and After hold up to the requested number of lines around the match.
+	Before []string
+	After  []string
+}
+
+// SearchFile searches for a plain text pattern within a file.
+// It returns every matching line with up to context lines before and after it,
+// and a boolean indicating whether any matches were found.
+func SearchFile(filePath, searchPattern string, context int) ([]Match, bool) {
+	return searchLines(filePath, context, func(line string) (int, int) {
+		i := strings.Index(line, searchPattern)
+		if i < 0 {
+			return -1, -1
 		}
-	}
+		return i, i + len(searchPattern)
+	})
+}
 
-	if err := scanner.Err(); err != nil {
-		fmt.Println("Error scanning file: ", err)
-		utils.LogMessage(utils.ERROR, fmt.Sprintf("Error scanning file %s: %v", filePath, err))
-		return nil, false
-	}
-	if found {
-		return []string{filePath}, true
-	} else {
-		return []string{}, false
+// RegexpSearchFile searches for a given regular expression pattern in a file.
+// It returns every matching line with up to context lines before and after it,
+// and a boolean indicating whether any matches were found.
+func RegexpSearchFile(filePath, pattern string, context int) ([]Match, bool) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		utils.LogMessage(utils.ERROR, fmt.Sprintf("Error compiling regular expression pattern %s: %v", pattern, err))
+		return []Match{}, false // Invalid regular expression pattern
 	}
+	return searchLines(filePath, context, func(line string) (int, int) {
+		loc := regex.FindStringIndex(line)
+		if loc == nil {
+			return -1, -1
+		}
+		return loc[0], loc[1]
+	})
 }
 
-// RegexpSearchFile searches for a given regular expression pattern in a file.
-// It returns matches with context: the matching line along with the line number.
-func RegexpSearchFile(filePath, pattern string) ([]string, bool) {
+// searchLines scans a file line by line. find returns the byte range of the first match
+// in a line, or -1, -1 when the line does not match.
+func searchLines(filePath string, context int, find func(line string) (int, int)) ([]Match, bool) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		utils.LogMessage(utils.ERROR, fmt.Sprintf("Error opening file %s: %v", filePath, err))
-		return []string{}, false
+		return []Match{}, false
 	}
 	defer file.Close()
 
-	var matches []string
+	var matches []Match
+	var before []string // the last context lines, oldest first
+	pending := 0        // matches at the end of matches still collecting after context
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
 	lineNum := 0
-	regex, err := regexp.Compile(pattern)
-	if err != nil {
-		utils.LogMessage(utils.ERROR, fmt.Sprintf("Error compiling regular expression pattern %s: %v", pattern, err))
-		return []string{}, false // Invalid regular expression pattern
-	}
-
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Text()
-		if regex.MatchString(line) {
-			match := "Line " + string(lineNum) + ": " + line
-			matches = append(matches, match)
+
+		for i := len(matches) - pending; i < len(matches); i++ {
+			matches[i].After = append(matches[i].After, line)
+		}
+		if pending > 0 && len(matches[len(matches)-pending].After) == context {
+			pending--
+		}
+
+		if start, end := find(line); start >= 0 {
+			matches = append(matches, Match{
+				Path:    filePath,
+				Line:    lineNum,
+				Column:  start + 1,
+				Text:    line[start:end],
+				Content: line,
+				Before:  append([]string(nil), before...),
+			})
+			if context > 0 {
+				pending++
+			}
+		}
+
+		if context > 0 {
+			if len(before) == context {
+				before = before[1:]
+			}
+			before = append(before, line)
 		}
 	}
 
+	if err := scanner.Err(); err != nil {
+		utils.LogMessage(utils.ERROR, fmt.Sprintf("Error scanning file %s: %v", filePath, err))
+		return []Match{}, false
+	}
 	return matches, len(matches) > 0
 }
@@ -1,7 +1,6 @@
 package search
 
 import (
-	"fmt"
 	"sync"
 )
 
@@ -9,29 +8,32 @@ type Job struct {
 	FilePath      string
 	SearchPattern string
 	SearchMode    string
+	// Context is how many lines before and after each match are returned with it.
+	Context int
 }
 
 type Result struct {
-	Matches []string
-	Found   bool
+	FilePath string
+	Matches  []Match
+	Found    bool
 }
 
 func Worker(workerId int, jobs <-chan Job, results chan<- Result, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for job := range jobs {
-		fmt.Printf("Worker %d started job for %s\n", workerId, job.FilePath)
-		var matches []string
+		var matches []Match
 		var found bool
 
 		if job.SearchMode == "regex" {
-			matches, found = RegexpSearchFile(job.FilePath, job.SearchPattern)
+			matches, found = RegexpSearchFile(job.FilePath, job.SearchPattern, job.Context)
 		} else {
-			matches, found = SearchFile(job.FilePath, job.SearchPattern)
+			matches, found = SearchFile(job.FilePath, job.SearchPattern, job.Context)
 		}
 
 		result := Result{
-			Matches: matches,
-			Found:   found,
+			FilePath: job.FilePath,
+			Matches:  matches,
+			Found:    found,
 		}
 		results <- result
 	}
@@ -0,0 +1,172 @@
+package walk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// rule is one pattern of an ignore file or one glob given on the command line.
+type rule struct {
+	re      *regexp.Regexp
+	negate  bool // the pattern started with "!", so it re-includes what earlier rules ignored
+	dirOnly bool // the pattern ended with "/", so it only matches directories
+}
+
+// ruleList holds the rules of one ignore file, in file order. Their patterns are relative
+// to dir, a slash-separated path from the walk root ("" for the root itself).
+type ruleList struct {
+	dir   string
+	rules []rule
+}
+
+// parseRules reads .gitignore syntax: one pattern per line, "#" starting a comment, "!"
+// negating a pattern and "\" escaping a leading "#" or "!". Lines that are not valid
+// patterns are skipped and reported through warn.
+func parseRules(dir string, r io.Reader, warn func(line int, err error)) (*ruleList, error) {
+	list := &ruleList{dir: dir}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := trimTrailingSpaces(strings.TrimSuffix(scanner.Text(), "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		negate := strings.HasPrefix(line, "!")
+		if negate {
+			line = line[1:]
+		}
+		r, err := compileRule(line)
+		if err != nil {
+			warn(lineNum, err)
+			continue
+		}
+		r.negate = negate
+		list.rules = append(list.rules, r)
+	}
+	return list, scanner.Err()
+}
+
+// trimTrailingSpaces removes the spaces at the end of line unless they are escaped with "\".
+func trimTrailingSpaces(line string) string {
+	trimmed := strings.TrimRight(line, " ")
+	if strings.HasSuffix(trimmed, "\\") && len(trimmed) < len(line) {
+		trimmed += " "
+	}
+	return trimmed
+}
+
+// compileRule turns a gitignore-style glob into a rule. A pattern containing a "/" other
+// than a trailing one is anchored to its list's directory; any other pattern matches a
+// name at any depth. "*" and "?" do not match "/", while "**" matches across directories.
+func compileRule(pattern string) (rule, error) {
+	var r rule
+	r.dirOnly = strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return r, fmt.Errorf("empty pattern")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				segment := (i == 0 || pattern[i-1] == '/') && (i+2 == len(pattern) || pattern[i+2] == '/')
+				switch {
+				case segment && i+2 == len(pattern):
+					b.WriteString(".*")
+					i++
+				case segment:
+					b.WriteString("(?:.*/)?")
+					i += 2
+				default:
+					b.WriteString("[^/]*")
+					i++
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := classEnd(pattern, i)
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i = end
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				c = pattern[i]
+			}
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return r, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	r.re = re
+	return r, nil
+}
+
+// classEnd returns the index of the "]" closing the character class opened at start, or
+// -1 if it is not closed. A "]" right after the opening "[" or "[!" is part of the class.
+func classEnd(pattern string, start int) int {
+	i := start + 1
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		i++
+	}
+	if i < len(pattern) && pattern[i] == ']' {
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		if pattern[i] == ']' {
+			return i
+		}
+	}
+	return -1
+}
+
+// match reports whether any rule of l matches rel, a slash-separated path from the walk
+// root, and if so whether the last matching rule ignores it.
+func (l *ruleList) match(rel string, isDir bool) (matched, ignored bool) {
+	if l.dir != "" {
+		if !strings.HasPrefix(rel, l.dir+"/") {
+			return false, false
+		}
+		rel = rel[len(l.dir)+1:]
+	}
+	for i := len(l.rules) - 1; i >= 0; i-- {
+		r := l.rules[i]
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(rel) {
+			return true, !r.negate
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,288 @@
+package walk
+
+import (
+	"bytes"
+	"concurrent_file_search/pkg/utils"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ignoreFiles are read in every directory, in this order; rules of later files win.
+var ignoreFiles = []string{".gitignore", ".ignore"}
+
+// binarySniffLength is how much of a file is read to tell whether it is binary.
+const binarySniffLength = 8000
+
+// TypePresets maps the file type names accepted in Options.Types to their globs.
+var TypePresets = map[string][]string{
+	"c":      {"*.c", "*.h"},
+	"config": {"*.toml", "*.ini", "*.cfg", "*.conf"},
+	"cpp":    {"*.cpp", "*.cc", "*.cxx", "*.hpp", "*.hh", "*.hxx", "*.h"},
+	"css":    {"*.css", "*.scss", "*.sass", "*.less"},
+	"go":     {"*.go", "go.mod", "go.sum"},
+	"html":   {"*.html", "*.htm"},
+	"java":   {"*.java"},
+	"js":     {"*.js", "*.jsx", "*.mjs", "*.cjs"},
+	"json":   {"*.json"},
+	"md":     {"*.md", "*.markdown"},
+	"py":     {"*.py", "*.pyi"},
+	"rust":   {"*.rs", "Cargo.toml"},
+	"sh":     {"*.sh", "*.bash", "*.zsh"},
+	"ts":     {"*.ts", "*.tsx", "*.mts", "*.cts"},
+	"yaml":   {"*.yaml", "*.yml"},
+}
+
+// Options selects the files a walk returns. The zero value returns every regular text
+// file that is neither hidden nor ignored by a .gitignore or .ignore file.
+type Options struct {
+	// Include, when not empty, keeps only the files matching one of these globs.
+	Include []string
+	// Exclude skips the files and directories matching any of these globs.
+	Exclude []string
+	// Types adds the globs of these TypePresets to Include.
+	Types []string
+	// MaxSize skips files larger than this many bytes; 0 means no limit.
+	MaxSize int64
+	// Hidden also walks files and directories whose name starts with a dot.
+	// .git directories are always skipped.
+	Hidden bool
+	// NoIgnore walks the files ignored by .gitignore and .ignore files too.
+	NoIgnore bool
+	// Binary also returns files that look binary, i.e. contain a NUL byte near the start.
+	Binary bool
+}
+
+// walker applies Options during one walk.
+type walker struct {
+	root    string
+	opts    Options
+	include *ruleList
+	exclude *ruleList
+	// ignores holds the ignore files read so far, by directory relative to the root.
+	ignores map[string][]*ruleList
+}
+
+// Walk walks the file tree rooted at root and calls fn for every regular file that opts
+// selects. Ignored, excluded and hidden directories are not entered at all. Entries that
+// cannot be read are logged and skipped; an error from fn stops the walk and is returned.
+//
+// Globs use .gitignore syntax relative to root: "*.go" matches at any depth, while
+// "cmd/*.go" or "/main.go" are anchored to root and "**" matches across directories.
+func Walk(root string, opts Options, fn func(path string) error) error {
+	w := &walker{root: root, opts: opts, ignores: make(map[string][]*ruleList)}
+	include := append([]string(nil), opts.Include...)
+	for _, name := range opts.Types {
+		globs, ok := TypePresets[name]
+		if !ok {
+			return fmt.Errorf("unknown file type %q, known types: %s", name, strings.Join(TypeNames(), ", "))
+		}
+		include = append(include, globs...)
+	}
+	var err error
+	if w.include, err = globRules(include); err != nil {
+		return err
+	}
+	if w.exclude, err = globRules(opts.Exclude); err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			utils.LogMessage(utils.WARN, fmt.Sprintf("Skipping %s: %v", p, err))
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel != "." && w.skipDir(rel, d.Name()) {
+				return filepath.SkipDir
+			}
+			w.readIgnores(p, rel)
+			return nil
+		}
+		if rel != "." && w.skipFile(rel, d.Name()) {
+			return nil
+		}
+		if !w.keepContent(p, d) {
+			return nil
+		}
+		return fn(p)
+	})
+}
+
+// TypeNames returns the names of the file type presets, sorted.
+func TypeNames() []string {
+	names := make([]string, 0, len(TypePresets))
+	for name := range TypePresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// globRules compiles command line globs into a rule list anchored at the walk root.
+func globRules(globs []string) (*ruleList, error) {
+	list := &ruleList{}
+	for _, glob := range globs {
+		r, err := compileRule(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", glob, err)
+		}
+		list.rules = append(list.rules, r)
+	}
+	return list, nil
+}
+
+func (w *walker) skipDir(rel, name string) bool {
+	if name == ".git" || (!w.opts.Hidden && strings.HasPrefix(name, ".")) {
+		return true
+	}
+	if matched, _ := w.exclude.match(rel, true); matched {
+		return true
+	}
+	return w.ignored(rel, true)
+}
+
+func (w *walker) skipFile(rel, name string) bool {
+	if !w.opts.Hidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if matched, _ := w.exclude.match(rel, false); matched {
+		return true
+	}
+	if len(w.include.rules) > 0 {
+		if matched, _ := w.include.match(rel, false); !matched {
+			return true
+		}
+	}
+	return w.ignored(rel, false)
+}
+
+// ignored reports whether the ignore files decide to skip rel. The ignore files of the
+// deepest directory that has a matching pattern decide, and within a directory the last
+// matching pattern does.
+func (w *walker) ignored(rel string, isDir bool) bool {
+	if w.opts.NoIgnore {
+		return false
+	}
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		key := dir
+		if dir == "." {
+			key = ""
+		}
+		lists := w.ignores[key]
+		for i := len(lists) - 1; i >= 0; i-- {
+			if matched, ignored := lists[i].match(rel, isDir); matched {
+				return ignored
+			}
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// readIgnores loads the ignore files of the directory dir, which is rel from the root.
+func (w *walker) readIgnores(dir, rel string) {
+	if w.opts.NoIgnore {
+		return
+	}
+	if rel == "." {
+		rel = ""
+	}
+	for _, name := range ignoreFiles {
+		file := filepath.Join(dir, name)
+		f, err := os.Open(file)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				utils.LogMessage(utils.WARN, fmt.Sprintf("Error opening ignore file %s: %v", file, err))
+			}
+			continue
+		}
+		list, err := parseRules(rel, f, func(line int, err error) {
+			utils.LogMessage(utils.WARN, fmt.Sprintf("Skipping %s:%d: %v", file, line, err))
+		})
+		f.Close()
+		if err != nil {
+			utils.LogMessage(utils.WARN, fmt.Sprintf("Error reading ignore file %s: %v", file, err))
+			continue
+		}
+		w.ignores[rel] = append(w.ignores[rel], list)
+	}
+}
+
+// keepContent checks what can only be known from the file itself: that it is a regular
+// file, its size and whether it is binary.
+func (w *walker) keepContent(p string, d fs.DirEntry) bool {
+	if !d.Type().IsRegular() {
+		return false
+	}
+	if w.opts.MaxSize > 0 {
+		info, err := d.Info()
+		if err != nil {
+			utils.LogMessage(utils.WARN, fmt.Sprintf("Skipping %s: %v", p, err))
+			return false
+		}
+		if info.Size() > w.opts.MaxSize {
+			return false
+		}
+	}
+	if w.opts.Binary {
+		return true
+	}
+	binary, err := IsBinary(p)
+	if err != nil {
+		utils.LogMessage(utils.WARN, fmt.Sprintf("Skipping %s: %v", p, err))
+		return false
+	}
+	return !binary
+}
+
+// IsBinary reports whether the file at path looks binary, as git decides it: a NUL byte
+// in the first 8000 bytes.
+func IsBinary(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, binarySniffLength)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
+
+// ParseSize parses a file size such as "512", "64K", "10M" or "1G" into bytes.
+func ParseSize(s string) (int64, error) {
+	digits := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(digits, suffix) {
+			digits, multiplier = strings.TrimSuffix(digits, suffix), m
+			break
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * multiplier, nil
+}
@@ -1,7 +1,7 @@
 #!/bin/bash
 
 # Run the test with verbose output
-go test -v ../test/search
+go test -v ../test/...
 
 # Check if the test passed
 if [ $? -eq 0 ]; then
@@ -1,9 +1,11 @@
 package search
 
 import (
+	"bytes"
 	"concurrent_file_search/pkg/search"
 	"io/ioutil"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -58,7 +60,7 @@ Fourth line`
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			matches, ok := search.RegexpSearchFile(filePath, tt.pattern)
+			matches, ok := search.RegexpSearchFile(filePath, tt.pattern, 0)
 			if (ok != tt.wantMatch) || (len(matches) > 0 != tt.wantMatch) {
 				t.Errorf("RegexpSearchFile() got = %v, want %v", ok, tt.wantMatch)
 			}
@@ -66,3 +68,68 @@ Fourth line`
 		})
 	}
 }
+
+func TestSearchFileReportsLinesAndContext(t *testing.T) {
+	content := `one
+two needle
+three
+four
+five
+six needle needle
+seven`
+	filePath, cleanup, err := createTempFile(content)
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer cleanup()
+
+	matches, ok := search.SearchFile(filePath, "needle", 1)
+	if !ok || len(matches) != 2 {
+		t.Fatalf("SearchFile() = %v, %v; want 2 matches", matches, ok)
+	}
+	want := search.Match{
+		Path: filePath, Line: 2, Column: 5, Text: "needle", Content: "two needle",
+		Before: []string{"one"}, After: []string{"three"},
+	}
+	if !reflect.DeepEqual(matches[0], want) {
+		t.Errorf("first match = %+v, want %+v", matches[0], want)
+	}
+	if m := matches[1]; m.Line != 6 || m.Column != 5 || !reflect.DeepEqual(m.Before, []string{"five"}) || !reflect.DeepEqual(m.After, []string{"seven"}) {
+		t.Errorf("second match = %+v", m)
+	}
+
+	// Line numbers are decimal, not runes, and the matched text comes from the regex.
+	matches, _ = search.RegexpSearchFile(filePath, `s\w+ n`, 0)
+	if len(matches) != 1 || matches[0].Line != 6 || matches[0].Text != "six n" || matches[0].Before != nil {
+		t.Errorf("RegexpSearchFile() = %+v", matches)
+	}
+}
+
+func TestGrepWriter(t *testing.T) {
+	matches := []search.Match{
+		{Path: "a.go", Line: 2, Column: 1, Content: "x := 1", Before: []string{"package a"}, After: []string{"y := x"}},
+		{Path: "a.go", Line: 3, Column: 6, Content: "y := x", Before: []string{"x := 1"}, After: []string{"}"}},
+		{Path: "a.go", Line: 9, Column: 2, Content: "	x++", Before: []string{"for {"}},
+	}
+	var buf bytes.Buffer
+	out := &search.GrepWriter{W: &buf, Context: true}
+	if err := out.Write(matches); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := out.Write([]search.Match{{Path: "b.go", Line: 1, Column: 1, Content: "x"}}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := `a.go-1-package a
+a.go:2:1:x := 1
+a.go:3:6:y := x
+a.go-4-}
+--
+a.go-8-for {
+a.go:9:2:	x++
+--
+b.go:1:1:x
+`
+	if buf.String() != want {
+		t.Errorf("output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,134 @@
+package walk
+
+import (
+	"concurrent_file_search/pkg/walk"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// createTree writes files, given by slash-separated path, under a new temp directory.
+func createTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// walkTree returns the files Walk selects, relative to root and sorted.
+func walkTree(t *testing.T, root string, opts walk.Options) []string {
+	t.Helper()
+	var files []string
+	err := walk.Walk(root, opts, func(path string) error {
+		rel, _ := filepath.Rel(root, path)
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func testTree(t *testing.T) string {
+	return createTree(t, map[string]string{
+		".gitignore":               "# dependencies\nnode_modules/\n*.log\n!keep.log\n/build\n",
+		".ignore":                  "docs/**/*.tmp\n",
+		"a.go":                     "package a",
+		"b.txt":                    "text",
+		"big.txt":                  strings.Repeat("x", 100),
+		"x.log":                    "log",
+		"keep.log":                 "log",
+		"bin.dat":                  "ELF\x00\x01",
+		".env":                     "SECRET=1",
+		".git/HEAD":                "ref: refs/heads/main",
+		".hidden/h.txt":            "hidden",
+		"node_modules/m/index.js":  "module.exports = 1",
+		"build/out.txt":            "built",
+		"sub/build/kept.txt":       "not the root build directory",
+		"sub/.gitignore":           "!*.log\nsecret.txt\n",
+		"sub/x.log":                "log",
+		"sub/secret.txt":           "secret",
+		"sub/c.go":                 "package sub",
+		"docs/readme.md":           "# docs",
+		"docs/a/b/c.tmp":           "tmp",
+		"cmd/app/main.go":          "package main",
+		"cmd/app/internal/util.go": "package internal",
+	})
+}
+
+func TestWalkDefaults(t *testing.T) {
+	got := walkTree(t, testTree(t), walk.Options{})
+	want := []string{
+		"a.go", "b.txt", "big.txt", "cmd/app/internal/util.go", "cmd/app/main.go", "docs/readme.md",
+		"keep.log", "sub/build/kept.txt", "sub/c.go", "sub/x.log",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() = %v\nwant %v", got, want)
+	}
+}
+
+func TestWalkFilters(t *testing.T) {
+	root := testTree(t)
+	tests := []struct {
+		name string
+		opts walk.Options
+		want []string
+	}{
+		{"type preset", walk.Options{Types: []string{"go"}},
+			[]string{"a.go", "cmd/app/internal/util.go", "cmd/app/main.go", "sub/c.go"}},
+		{"anchored include", walk.Options{Include: []string{"cmd/**/*.go"}},
+			[]string{"cmd/app/internal/util.go", "cmd/app/main.go"}},
+		{"exclude", walk.Options{Types: []string{"go"}, Exclude: []string{"sub/", "internal"}},
+			[]string{"a.go", "cmd/app/main.go"}},
+		{"max size", walk.Options{Include: []string{"*.txt"}, MaxSize: 50},
+			[]string{"b.txt", "sub/build/kept.txt"}},
+		{"hidden", walk.Options{Include: []string{".*", "*.txt"}, Hidden: true},
+			[]string{".env", ".gitignore", ".hidden/h.txt", ".ignore", "b.txt", "big.txt", "sub/.gitignore", "sub/build/kept.txt"}},
+		{"no ignore", walk.Options{Include: []string{"*.log", "*.js", "*.tmp", "out.txt", "secret.txt"}, NoIgnore: true},
+			[]string{"build/out.txt", "docs/a/b/c.tmp", "keep.log", "node_modules/m/index.js", "sub/secret.txt", "sub/x.log", "x.log"}},
+		{"binary", walk.Options{Include: []string{"*.dat"}, Binary: true}, []string{"bin.dat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := walkTree(t, root, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Walk() = %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkRejectsBadOptions(t *testing.T) {
+	root := t.TempDir()
+	noop := func(string) error { return nil }
+	if err := walk.Walk(root, walk.Options{Types: []string{"cobol"}}, noop); err == nil {
+		t.Error("Walk() with an unknown type did not fail")
+	}
+	if err := walk.Walk(filepath.Join(root, "missing"), walk.Options{}, noop); err == nil {
+		t.Error("Walk() of a missing root did not fail")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"512": 512, "64k": 64 << 10, "10M": 10 << 20, "1G": 1 << 30}
+	for in, want := range tests {
+		if got, err := walk.ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := walk.ParseSize("ten"); err == nil {
+		t.Error("ParseSize(\"ten\") did not fail")
+	}
+}
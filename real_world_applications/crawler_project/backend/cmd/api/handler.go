@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web_crawler/middleware"
 	"web_crawler/models"
+	"web_crawler/pkg"
 	"web_crawler/utils"
 
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
 )
 
 // pingHandler handles the ping request and returns a success message.
@@ -15,11 +25,27 @@ func (app *Config) pingHandler(c echo.Context) error {
 	return c.String(http.StatusOK, "The system is working fine")
 }
 
+// healthzHandler is the liveness probe. It answers 200 as long as the process can serve requests
+// and includes the state of each dependency for diagnosis.
+func (app *Config) healthzHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, app.Health.Dependencies(c.Request().Context()))
+}
+
+// readyzHandler is the readiness probe. It answers 503 while a dependency is down
+// or the frontier or indexer is backed up past its threshold.
+func (app *Config) readyzHandler(c echo.Context) error {
+	report := app.Health.Readiness(c.Request().Context())
+	if !report.Healthy() {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
 func (app *Config) signupHandler(c echo.Context) error {
 	var user models.User
 
 	if err := c.Bind(&user); err != nil {
-		app.Logger.Error("error binding user data%s", err)
+		middleware.Logger(c).WithError(err).Error("error binding user data")
 		return c.String(http.StatusBadRequest, "Invalid user data")
 	}
 	if user.Email == "" || user.Password == "" || user.Username == "" {
@@ -28,20 +54,163 @@ func (app *Config) signupHandler(c echo.Context) error {
 
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
-		app.Logger.Error("error hashing password: %s", err)
+		middleware.Logger(c).WithError(err).Error("error hashing password")
 		return c.String(http.StatusInternalServerError, "Error creating user")
 
 	}
 
 	user.Password = hashedPassword
 	if err := user.Insert(); err != nil {
-		app.Logger.Error("error inserting user: %v", err)
+		middleware.Logger(c).WithError(err).Error("error inserting user")
 		return c.String(http.StatusInternalServerError, "Error creating user")
 
 	}
+	middleware.SetAudit(c, "user.signup", "user:"+user.ID, userChanges(models.User{}, user))
+
+	if err := app.sendVerificationEmail(&user); err != nil {
+		// The account exists at this point, the user can ask for a new link via /verify/resend.
+		middleware.Logger(c).WithError(err).Error("error sending verification email")
+	}
+
+	return c.JSON(http.StatusCreated, "user created successfully, check your email to verify your account")
+
+}
+
+// sendVerificationEmail mails a signed verification link to a newly registered user.
+func (app *Config) sendVerificationEmail(user *models.User) error {
+	token, err := utils.GenerateVerificationToken(user.ID, user.Email)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify?token=%s", app.Settings.Server.PublicURL, url.QueryEscape(token))
+	return app.Mailer.Send(utils.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, link, utils.EmailVerificationTTL),
+	})
+}
+
+// verifyEmailHandler confirms a user's email address using the token from the verification link.
+func (app *Config) verifyEmailHandler(c echo.Context) error {
+	token := c.QueryParam("token")
+	if token == "" {
+		return c.String(http.StatusBadRequest, "Token is required")
+	}
+	userID, email, err := utils.ParseVerificationToken(token)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "Invalid or expired token")
+	}
+	if err := app.Model.User.MarkVerified(userID, email); err != nil {
+		middleware.Logger(c).WithError(err).Error("error verifying user")
+		if err.Error() == "user not found" {
+			return c.String(http.StatusBadRequest, "Invalid or expired token")
+		}
+		return c.String(http.StatusInternalServerError, "Error verifying email")
+	}
+	return c.JSON(http.StatusOK, "email verified successfully")
+}
+
+// resendVerificationHandler sends a new verification link to an unverified account.
+// It answers the same way whether or not the email is registered.
+func (app *Config) resendVerificationHandler(c echo.Context) error {
+	type Body struct {
+		Email string `json:"email"`
+	}
+	var body Body
+	if err := c.Bind(&body); err != nil || body.Email == "" {
+		return c.String(http.StatusBadRequest, "Email is required")
+	}
+
+	user, err := app.Model.User.GetUserByEmail(body.Email)
+	if err == nil && !user.Verified {
+		if err := app.sendVerificationEmail(user); err != nil {
+			middleware.Logger(c).WithError(err).Error("error sending verification email")
+		}
+	} else if err != nil && err.Error() != "user not found" {
+		middleware.Logger(c).WithError(err).Error("error getting user by email")
+	}
+	return c.JSON(http.StatusOK, "if the account exists and is not verified, a new link has been sent")
+}
+
+// forgotPasswordHandler emails a single-use password reset token.
+// It answers the same way whether or not the email is registered.
+func (app *Config) forgotPasswordHandler(c echo.Context) error {
+	type Body struct {
+		Email string `json:"email"`
+	}
+	var body Body
+	if err := c.Bind(&body); err != nil || body.Email == "" {
+		return c.String(http.StatusBadRequest, "Email is required")
+	}
+	response := "if the account exists, a password reset link has been sent"
+
+	user, err := app.Model.User.GetUserByEmail(body.Email)
+	if err != nil {
+		if err.Error() != "user not found" {
+			middleware.Logger(c).WithError(err).Error("error getting user by email")
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+
+	middleware.SetAudit(c, "user.password_forgot", "user:"+user.ID, nil)
+	token, tokenHash, err := utils.GenerateResetToken()
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error generating reset token")
+		return c.String(http.StatusInternalServerError, "Error creating reset token")
+	}
+	if err := models.CreatePasswordReset(c.Request().Context(), user.ID, tokenHash, utils.PasswordResetTTL); err != nil {
+		middleware.Logger(c).WithError(err).Error("error storing reset token")
+		return c.String(http.StatusInternalServerError, "Error creating reset token")
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", app.Settings.Server.PublicURL, url.QueryEscape(token))
+	err = app.Mailer.Send(utils.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password:\n\n%s\n\nThe link can be used once and expires in %s. If you did not ask for a reset you can ignore this email.\n",
+			user.Username, link, utils.PasswordResetTTL),
+	})
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error sending reset email")
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// resetPasswordHandler sets a new password using a token issued by forgotPasswordHandler.
+func (app *Config) resetPasswordHandler(c echo.Context) error {
+	type Body struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	var body Body
+	if err := c.Bind(&body); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid reset data")
+	}
+	if body.Token == "" || body.Password == "" {
+		return c.String(http.StatusBadRequest, "Token and password are required")
+	}
 
-	return c.JSON(http.StatusCreated, "user created successfully")
+	hashedPassword, err := utils.HashPassword(body.Password)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error hashing password")
+		return c.String(http.StatusInternalServerError, "Error resetting password")
+	}
 
+	userID, err := models.ConsumePasswordReset(c.Request().Context(), utils.HashToken(body.Token))
+	if err != nil {
+		if err.Error() == "invalid or expired token" {
+			return c.String(http.StatusBadRequest, "Invalid or expired token")
+		}
+		middleware.Logger(c).WithError(err).Error("error consuming reset token")
+		return c.String(http.StatusInternalServerError, "Error resetting password")
+	}
+	middleware.SetAudit(c, "user.password_reset", "user:"+userID, []string{"password: changed"})
+	if err := app.Model.User.UpdatePassword(userID, hashedPassword); err != nil {
+		middleware.Logger(c).WithError(err).Error("error updating password")
+		return c.String(http.StatusInternalServerError, "Error resetting password")
+	}
+	return c.JSON(http.StatusOK, "password reset successfully")
 }
 
 func (app *Config) loginHandler(c echo.Context) error {
@@ -51,7 +220,7 @@ func (app *Config) loginHandler(c echo.Context) error {
 	}
 	var credentials LoginCredentials
 	if err := c.Bind(&credentials); err != nil {
-		app.Logger.Error("error binding login credentials: %v", err)
+		middleware.Logger(c).WithError(err).Error("error binding login credentials")
 		return c.String(http.StatusBadRequest, "Invalid login credentials")
 
 	}
@@ -61,7 +230,7 @@ func (app *Config) loginHandler(c echo.Context) error {
 	}
 	user, err := app.Model.User.GetUserByEmail(credentials.Email)
 	if err != nil {
-		app.Logger.Error("error getting user by email: %v", err)
+		middleware.Logger(c).WithError(err).Error("error getting user by email")
 
 		if err.Error() == "user not found" {
 			return c.String(http.StatusNotFound, "User not found")
@@ -69,15 +238,19 @@ func (app *Config) loginHandler(c echo.Context) error {
 		return c.String(http.StatusInternalServerError, "Error getting user")
 
 	}
+	middleware.SetAudit(c, "user.login", "user:"+user.ID, nil)
 	if err := utils.ComparePasswords(user.Password, credentials.Password); err != nil {
-		app.Logger.Error("error comparing passwords: %v", err)
+		middleware.Logger(c).WithError(err).Error("error comparing passwords")
 		return c.String(http.StatusUnauthorized, "Wrong password")
 
 	}
+	if !user.Verified {
+		return c.String(http.StatusForbidden, "Email not verified")
+	}
 	token, err := utils.GenerateJWT(user.ID, user.Username)
 
 	if err != nil {
-		app.Logger.Error("error generating JWT: %v", err)
+		middleware.Logger(c).WithError(err).Error("error generating JWT")
 		return c.String(http.StatusInternalServerError, "Error generating JWT")
 
 	}
@@ -88,7 +261,7 @@ func (app *Config) getUserHandler(c echo.Context) error {
 	userId := c.Get("userID").(string)
 	user, err := app.Model.User.GetUserByID(userId)
 	if err != nil {
-		app.Logger.Error("error getting user by id: %v", err)
+		middleware.Logger(c).WithError(err).Error("error getting user by id")
 		if err.Error() == "user not found" {
 			return c.String(http.StatusNotFound, "User not found")
 		}
@@ -102,20 +275,34 @@ func (app *Config) updateUserHandler(c echo.Context) error {
 	var user models.User
 	userId := c.Get("userID").(string) // Assuming userID is correctly retrieved and casted
 	if err := c.Bind(&user); err != nil {
-		app.Logger.Error("error binding user data: %v", err)
+		middleware.Logger(c).WithError(err).Error("error binding user data")
 		return c.String(http.StatusBadRequest, "Invalid user data")
 	}
 
+	middleware.SetAudit(c, "user.update", "user:"+userId, nil)
+	before, err := app.Model.User.GetUserByID(userId)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Warn("error reading user before update")
+	}
+
 	updateResult, err := user.Update(userId) // Update function now returns *mongo.UpdateResult and error
 	if err != nil {
-		app.Logger.Error("error updating user: %v", err)
+		middleware.Logger(c).WithError(err).Error("error updating user")
 		if err.Error() == "user not found" {
 			return c.String(http.StatusNotFound, "User not found")
 		}
 		return c.String(http.StatusInternalServerError, "Error updating user")
 	}
 
-	app.Logger.Info("update operation result: matched %v, modified %v", updateResult.MatchedCount, updateResult.ModifiedCount)
+	middleware.Logger(c).WithFields(logrus.Fields{
+		"matched":  updateResult.MatchedCount,
+		"modified": updateResult.ModifiedCount,
+	}).Info("user update completed")
+	if before != nil {
+		after := *before
+		after.Username = user.Username
+		middleware.SetAudit(c, "user.update", "user:"+userId, userChanges(*before, after))
+	}
 
 	return c.JSON(http.StatusOK, "username updated successfully")
 }
@@ -124,19 +311,40 @@ func (app *Config) deleteUserHandler(c echo.Context) error {
 	var user models.User
 	userId := c.Get("userID").(string)
 	if err := c.Bind(&user); err != nil {
-		app.Logger.Error("error binding user data: %v", err)
+		middleware.Logger(c).WithError(err).Error("error binding user data")
 		return c.String(http.StatusBadRequest, "Invalid user data")
 	}
+	middleware.SetAudit(c, "user.delete", "user:"+userId, nil)
+	before, err := app.Model.User.GetUserByID(userId)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Warn("error reading user before delete")
+	}
 	if err := user.Delete(userId); err != nil {
-		app.Logger.Error("error deleting user: %v", err)
+		middleware.Logger(c).WithError(err).Error("error deleting user")
 		if err.Error() == "user not found" {
 			return c.String(http.StatusNotFound, "User not found")
 		}
 		return c.String(http.StatusInternalServerError, "Error deleting user")
 	}
+	if before != nil {
+		middleware.SetAudit(c, "user.delete", "user:"+userId, userChanges(*before, models.User{}))
+	}
 	return c.String(http.StatusOK, "User deleted successfully")
 }
 
+// userChanges describes how the profile fields of next differ from prev for the audit log.
+// Passwords are never included.
+func userChanges(prev, next models.User) []string {
+	var changes []string
+	if prev.Username != next.Username {
+		changes = append(changes, fmt.Sprintf("username: %q -> %q", prev.Username, next.Username))
+	}
+	if prev.Email != next.Email {
+		changes = append(changes, fmt.Sprintf("email: %q -> %q", prev.Email, next.Email))
+	}
+	return changes
+}
+
 func (app *Config) AddUrlHandler(c echo.Context) error {
 
 	type Body struct {
@@ -144,36 +352,51 @@ func (app *Config) AddUrlHandler(c echo.Context) error {
 	}
 	var body Body
 	if err := c.Bind(&body); err != nil {
-		app.Logger.Error("error binding user data: %v", err)
+		middleware.Logger(c).WithError(err).Error("error binding user data")
 		return c.String(http.StatusBadRequest, "Invalid user data")
 	}
 
 	if body.URL == "" {
 		return c.String(http.StatusBadRequest, "URL is required")
 	}
+	middleware.SetAudit(c, "page.add", body.URL, nil)
 
-	isValidURL := func(inputURL string) bool {
-		_, err := url.ParseRequestURI(inputURL)
-		if err != nil {
-			return false
+	if _, err := url.ParseRequestURI(body.URL); err != nil {
+		return c.String(http.StatusBadRequest, "Invalid URL")
+	}
+	// Refuse URLs the crawler must not reach, such as internal services
+	if err := pkg.CheckFetchURL(c.Request().Context(), body.URL); err != nil {
+		middleware.Logger(c).WithError(err).WithField("url", body.URL).Warn("url rejected")
+		return c.String(http.StatusBadRequest, "URL not allowed: "+err.Error())
+	}
+	if app.Cluster != nil && !app.Cluster.Owns(body.URL) {
+		if err := app.Cluster.Route(c.Request().Context(), []string{body.URL}); err != nil {
+			middleware.Logger(c).WithError(err).WithField("url", body.URL).Warn("error forwarding url")
 		}
-		return true
+		middleware.Logger(c).WithField("url", body.URL).Info("url forwarded to its node")
+		return c.String(http.StatusOK, "URL added to the queue")
 	}
-
-	if !isValidURL(body.URL) {
-		return c.String(http.StatusBadRequest, "Invalid URL")
+	jobID, err := app.submit(c.Request().Context(), body.URL)
+	if err != nil {
+		middleware.Logger(c).WithError(err).WithField("url", body.URL).Error("error queueing url")
+		return c.String(http.StatusServiceUnavailable, "Crawler is not accepting URLs")
 	}
-	app.Scheduler.Submit(body.URL)
+	middleware.Logger(c).WithFields(logrus.Fields{"url": body.URL, "job_id": jobID}).Info("url queued")
+	// The job ID selects the crawl's events on GET /events and in webhooks.
+	c.Response().Header().Set("X-Crawl-Job-ID", jobID)
 	return c.String(http.StatusOK, "URL added to the queue")
 }
 
+// SearchPageHandler runs a full-text search. The optional language, given in the body or
+// as the "lang" query parameter, restricts results to pages detected in that language.
 func (app *Config) SearchPageHandler(c echo.Context) error {
 	type Body struct {
-		Query string
+		Query    string
+		Language string
 	}
 	var body Body
 	if err := c.Bind(&body); err != nil {
-		app.Logger.Error("error binding search data: %v", err)
+		middleware.Logger(c).WithError(err).Error("error binding search data")
 		return c.String(http.StatusBadRequest, "Invalid search data")
 
 	}
@@ -183,10 +406,18 @@ func (app *Config) SearchPageHandler(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Query is required")
 	}
 
-	pages, err := models.SearchWebPage(ctx, body.Query)
+	if body.Language == "" {
+		body.Language = c.QueryParam("lang")
+	}
+	body.Language = strings.ToLower(body.Language)
+	if body.Language != "" && !slices.Contains(pkg.Languages(), body.Language) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "unsupported language", "supported": pkg.Languages()})
+	}
+
+	pages, err := models.SearchWebPage(ctx, body.Query, body.Language)
 
 	if err != nil {
-		app.Logger.Error("error searching web page: %v", err)
+		middleware.Logger(c).WithError(err).Error("error searching web page")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 
 	}
@@ -194,28 +425,119 @@ func (app *Config) SearchPageHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, pages)
 }
 
+// maxSuggestQueryLength bounds suggestion queries; titles are completed from their words,
+// so longer input cannot match.
+const maxSuggestQueryLength = 100
+
+// SuggestPageHandler returns title completions and spelling corrections for a partially
+// typed query given as "q", with up to "size" completions (default 5, at most 10). A lookup
+// that runs over the latency budget returns empty suggestions with timed_out set rather
+// than an error, so the client just waits for the next keystroke.
+func (app *Config) SuggestPageHandler(c echo.Context) error {
+	query := c.QueryParam("q")
+	if strings.TrimSpace(query) == "" {
+		return c.String(http.StatusBadRequest, "q is required")
+	}
+	if len(query) > maxSuggestQueryLength {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("q must be at most %d bytes", maxSuggestQueryLength))
+	}
+	size := 5
+	if v := c.QueryParam("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 10 {
+			return c.String(http.StatusBadRequest, "size must be between 1 and 10")
+		}
+		size = n
+	}
+
+	suggestions, err := app.Suggester.Get(c.Request().Context(), query, size)
+	if errors.Is(err, context.DeadlineExceeded) {
+		middleware.Logger(c).WithField("query", query).Warn("suggestions ran over the latency budget")
+		return c.JSON(http.StatusOK, echo.Map{"completions": []models.PageCompletion{}, "corrections": []string{}, "timed_out": true})
+	}
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error suggesting pages")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	// Let the client reuse the answer too, e.g. when the user deletes back to it.
+	if ttl := app.Settings.Suggest.CacheTTL.Duration; ttl > 0 {
+		c.Response().Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds())))
+	}
+	return c.JSON(http.StatusOK, suggestions)
+}
+
 func (app *Config) GetPageHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	id := c.Param("id")
 
 	page, err := models.ReadWebPage(ctx, id)
 	if err != nil {
-		app.Logger.Error("error getting web page: %v", err)
+		middleware.Logger(c).WithError(err).Error("error getting web page")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 
 	}
 	return c.JSON(http.StatusOK, page)
 }
 
+// GetPageLinksHandler returns the inbound and outbound links of a page.
+// The optional "limit" query parameter caps each list (default 100, max 1000).
+func (app *Config) GetPageLinksHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+
+	limit := int64(100)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > 1000 {
+			return c.String(http.StatusBadRequest, "limit must be between 1 and 1000")
+		}
+		limit = n
+	}
+
+	page, err := models.ReadWebPage(ctx, id)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error getting web page")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	outlinks, err := models.GetOutlinks(ctx, page.URL, limit)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error getting outlinks")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	inlinks, err := models.GetInlinks(ctx, page.URL, limit)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error getting inlinks")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"url":      page.URL,
+		"pagerank": page.PageRank,
+		"outlinks": outlinks,
+		"inlinks":  inlinks,
+	})
+}
+
 func (app *Config) DeletePageHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	id := c.Param("id")
-	err := models.DeleteWebPage(ctx, id)
+	middleware.SetAudit(c, "page.delete", "page:"+id, nil)
+	before, err := models.ReadWebPage(ctx, id)
 	if err != nil {
-		app.Logger.Error("error deleting web page: %v", err)
+		middleware.Logger(c).WithError(err).Warn("error reading web page before delete")
+	}
+	err = models.DeleteWebPage(ctx, id)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error deleting web page")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 
 	}
+	if before != nil {
+		middleware.SetAudit(c, "page.delete", "page:"+id, models.DiffWebPages(*before, models.WebPage{}))
+	}
+	if err := models.DeletePageVersions(ctx, id); err != nil {
+		middleware.Logger(c).WithError(err).Error("error deleting page versions")
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "page deleted successfully"})
 }
@@ -226,29 +548,600 @@ func (app *Config) UpdatePageHandler(c echo.Context) error {
 
 	var page models.WebPage
 	if err := c.Bind(&page); err != nil {
-		app.Logger.Error("error binding page data: %v", err)
+		middleware.Logger(c).WithError(err).Error("error binding page data")
 		return c.String(http.StatusBadRequest, "Invalid page data")
 
 	}
+	if page.Content != "" && page.Language == "" {
+		page.Language = pkg.DetectLanguage(page.Title + "\n" + page.Desription + "\n" + page.Content)
+	}
+
+	middleware.SetAudit(c, "page.update", "page:"+id, nil)
+	before, err := models.ReadWebPage(ctx, id)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Warn("error reading web page before update")
+	}
 
-	err := models.UpdateWebPage(ctx, id, page)
+	err = models.UpdateWebPage(ctx, id, page)
 
 	if err != nil {
-		app.Logger.Error("error updating web page: %v", err)
+		middleware.Logger(c).WithError(err).Error("error updating web page")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
+	// Fields left out of the body may keep their values, so read the page back.
+	if after, err := models.ReadWebPage(ctx, id); err != nil {
+		middleware.Logger(c).WithError(err).Warn("error reading web page after update")
+	} else {
+		app.savePageVersion(c, models.PageVersion{PageID: id, Page: after, Source: models.VersionEdit}, before)
+		if before != nil {
+			middleware.SetAudit(c, "page.update", "page:"+id, models.DiffWebPages(*before, *after))
+		}
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "page updated successfully"})
 
 }
 
+// savePageVersion adds v, an edit of a page by the current user, to the page's history,
+// backfilling before as PageHistory.Record does. Failures are logged, not returned, since
+// the edit itself already succeeded.
+func (app *Config) savePageVersion(c echo.Context, v models.PageVersion, before *models.WebPage) *models.PageVersion {
+	v.ActorID = c.Get("userID").(string)
+	saved, err := app.History.Record(c.Request().Context(), v, before)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error saving page version")
+	}
+	return saved
+}
+
+// pageVersionParam parses the version number in the path.
+func pageVersionParam(c echo.Context) (int, bool) {
+	version, err := strconv.Atoi(c.Param("version"))
+	return version, err == nil && version > 0
+}
+
+// ListPageVersionsHandler returns the versions kept for a page, newest first, without
+// their content.
+func (app *Config) ListPageVersionsHandler(c echo.Context) error {
+	versions, err := models.ListPageVersions(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error listing page versions")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+// GetPageVersionHandler returns one version of a page with the page as it was then.
+func (app *Config) GetPageVersionHandler(c echo.Context) error {
+	version, ok := pageVersionParam(c)
+	if !ok {
+		return c.String(http.StatusBadRequest, "version must be a positive integer")
+	}
+	v, err := models.GetPageVersion(c.Request().Context(), c.Param("id"), version)
+	if errors.Is(err, models.ErrPageVersionNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+	}
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error getting page version")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, v)
+}
+
+// RestorePageVersionHandler writes an older version of a page back to the index. The
+// restore is itself added to the history as the newest version.
+func (app *Config) RestorePageVersionHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	id := c.Param("id")
+	version, ok := pageVersionParam(c)
+	if !ok {
+		return c.String(http.StatusBadRequest, "version must be a positive integer")
+	}
+	middleware.SetAudit(c, "page.restore", "page:"+id, nil)
+	before, after, saved, err := app.History.Restore(ctx, id, version, c.Get("userID").(string))
+	if errors.Is(err, models.ErrPageVersionNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+	}
+	if after == nil { // nothing was written
+		middleware.Logger(c).WithError(err).Error("error restoring page version")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	middleware.SetAudit(c, "page.restore", "page:"+id, models.DiffWebPages(*before, *after))
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error saving page version")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "page restored, but the restore was not added to its history: " + err.Error()})
+	}
+	if saved == nil {
+		return c.JSON(http.StatusOK, echo.Map{"message": "page already matches version " + strconv.Itoa(version)})
+	}
+	saved.Page = nil
+	return c.JSON(http.StatusOK, saved)
+}
+
 func (app *Config) GetPagesHandler(c echo.Context) error {
 	ctx := c.Request().Context()
 	pages, err := models.GetWebPages(ctx)
 	if err != nil {
-		fmt.Println(err, pages)
-		app.Logger.Error("error getting web pages: %v", err)
+		middleware.Logger(c).WithError(err).Error("error getting web pages")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 	}
 	return c.JSON(http.StatusOK, pages)
 }
+
+// validErrorClass reports whether class is empty or one of the fetch error classes.
+func validErrorClass(class string) bool {
+	if class == "" {
+		return true
+	}
+	for _, c := range pkg.ErrorClasses {
+		if string(c) == class {
+			return true
+		}
+	}
+	return false
+}
+
+// ListDeadLettersHandler returns URLs whose fetch failed permanently, most recent first.
+// Optional query parameters: class (an error class), limit (1..1000, default 100) and offset.
+func (app *Config) ListDeadLettersHandler(c echo.Context) error {
+	ctx := c.Request().Context()
+	class := c.QueryParam("class")
+	if !validErrorClass(class) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "unknown error class", "classes": pkg.ErrorClasses})
+	}
+	limit := int64(100)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > 1000 {
+			return c.String(http.StatusBadRequest, "limit must be between 1 and 1000")
+		}
+		limit = n
+	}
+	var offset int64
+	if v := c.QueryParam("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return c.String(http.StatusBadRequest, "offset must not be negative")
+		}
+		offset = n
+	}
+
+	letters, total, err := models.ListDeadLetters(ctx, class, limit, offset)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error listing dead letters")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"total": total, "dead_letters": letters})
+}
+
+// RequeueDeadLettersHandler removes dead letters and submits their URLs for crawling again.
+// The body names either the URLs to requeue or an error class; at most limit URLs
+// (default 1000) are requeued per call. URLs the queue refuses are restored as dead letters.
+func (app *Config) RequeueDeadLettersHandler(c echo.Context) error {
+	type Body struct {
+		URLs  []string `json:"urls"`
+		Class string   `json:"class"`
+		Limit int64    `json:"limit"`
+	}
+	var body Body
+	if err := c.Bind(&body); err != nil {
+		middleware.Logger(c).WithError(err).Error("error binding requeue data")
+		return c.String(http.StatusBadRequest, "Invalid requeue data")
+	}
+	if len(body.URLs) == 0 && body.Class == "" {
+		return c.String(http.StatusBadRequest, "urls or class is required")
+	}
+	if !validErrorClass(body.Class) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "unknown error class", "classes": pkg.ErrorClasses})
+	}
+	if body.Limit <= 0 || body.Limit > 1000 {
+		body.Limit = 1000
+	}
+
+	letters, err := models.TakeDeadLetters(c.Request().Context(), body.URLs, body.Class, body.Limit)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error taking dead letters")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	urls := make([]string, len(letters))
+	changes := make([]string, len(letters))
+	for i, dl := range letters {
+		urls[i] = dl.URL
+		changes[i] = "requeued: " + dl.URL
+	}
+	middleware.SetAudit(c, "dead_letter.requeue", body.Class, changes)
+	// Submit waits for room in the queue, so hand the URLs over in the background. If the
+	// queue refuses one, it and the rest go back to the dead letters rather than being lost.
+	go func() {
+		for i, dl := range letters {
+			if _, err := app.submit(context.Background(), dl.URL); err != nil {
+				log := app.Logger.WithError(err).WithField("url", dl.URL)
+				log.Error("error requeueing dead letter")
+				if err := models.RestoreDeadLetters(context.Background(), letters[i:]); err != nil {
+					log.WithError(err).WithField("count", len(letters)-i).Error("error restoring dead letters")
+				}
+				return
+			}
+		}
+	}()
+	middleware.Logger(c).WithField("count", len(urls)).Info("dead letters requeued")
+	return c.JSON(http.StatusAccepted, echo.Map{"requeued": urls})
+}
+
+// CreateSavedSearchHandler saves a search to be re-run on a schedule. Pages that are new to
+// its results or changed since the previous run are POSTed to the webhook, signed with a
+// secret that is only returned here, or logged when there is no webhook.
+func (app *Config) CreateSavedSearchHandler(c echo.Context) error {
+	type Body struct {
+		Name       string `json:"name"`
+		Query      string `json:"query"`
+		Language   string `json:"language"`
+		Schedule   string `json:"schedule"`
+		WebhookURL string `json:"webhook_url"`
+	}
+	var body Body
+	if err := c.Bind(&body); err != nil {
+		middleware.Logger(c).WithError(err).Error("error binding saved search data")
+		return c.String(http.StatusBadRequest, "Invalid saved search data")
+	}
+	if body.Query == "" {
+		return c.String(http.StatusBadRequest, "Query is required")
+	}
+	if body.Name == "" {
+		body.Name = body.Query
+	}
+	body.Language = strings.ToLower(body.Language)
+	if body.Language != "" && !slices.Contains(pkg.Languages(), body.Language) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "unsupported language", "supported": pkg.Languages()})
+	}
+	if body.Schedule == "" {
+		body.Schedule = "24h"
+	}
+	minSchedule := app.Settings.SavedSearches.MinSchedule.Duration
+	if interval, err := time.ParseDuration(body.Schedule); err != nil || interval < minSchedule {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("schedule must be a duration of at least %s", minSchedule))
+	}
+
+	ctx := c.Request().Context()
+	search := models.SavedSearch{
+		UserID:   c.Get("userID").(string),
+		Name:     body.Name,
+		Query:    body.Query,
+		Language: body.Language,
+		Schedule: body.Schedule,
+	}
+	if body.WebhookURL != "" {
+		// The webhook is called from the crawler, so it must not reach internal services
+		if err := pkg.CheckFetchURL(ctx, body.WebhookURL); err != nil {
+			return c.String(http.StatusBadRequest, "Webhook URL not allowed: "+err.Error())
+		}
+		secret, err := utils.NewSecret()
+		if err != nil {
+			middleware.Logger(c).WithError(err).Error("error generating webhook secret")
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		}
+		search.WebhookURL, search.WebhookSecret = body.WebhookURL, secret
+	}
+	if err := models.CreateSavedSearch(ctx, &search); err != nil {
+		middleware.Logger(c).WithError(err).Error("error creating saved search")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	middleware.Logger(c).WithField("search_id", search.ID.Hex()).Info("saved search created")
+	middleware.SetAudit(c, "saved_search.create", "saved_search:"+search.ID.Hex(), []string{
+		fmt.Sprintf("query: %q", search.Query),
+		fmt.Sprintf("schedule: %q", search.Schedule),
+		fmt.Sprintf("webhook_url: %q", search.WebhookURL),
+	})
+	if search.WebhookSecret == "" {
+		return c.JSON(http.StatusCreated, search)
+	}
+	return c.JSON(http.StatusCreated, struct {
+		models.SavedSearch
+		WebhookSecret string `json:"webhook_secret"`
+	}{search, search.WebhookSecret})
+}
+
+// ListSavedSearchesHandler returns the user's saved searches, newest first.
+func (app *Config) ListSavedSearchesHandler(c echo.Context) error {
+	searches, err := models.ListSavedSearches(c.Request().Context(), c.Get("userID").(string))
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error listing saved searches")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, searches)
+}
+
+// savedSearchError answers a failed saved search lookup.
+func savedSearchError(c echo.Context, err error, msg string) error {
+	if errors.Is(err, models.ErrSavedSearchNotFound) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": err.Error()})
+	}
+	middleware.Logger(c).WithError(err).Error(msg)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+}
+
+// GetSavedSearchHandler returns one of the user's saved searches.
+func (app *Config) GetSavedSearchHandler(c echo.Context) error {
+	search, err := models.GetSavedSearch(c.Request().Context(), c.Param("id"), c.Get("userID").(string))
+	if err != nil {
+		return savedSearchError(c, err, "error getting saved search")
+	}
+	return c.JSON(http.StatusOK, search)
+}
+
+// DeleteSavedSearchHandler deletes one of the user's saved searches.
+func (app *Config) DeleteSavedSearchHandler(c echo.Context) error {
+	middleware.SetAudit(c, "saved_search.delete", "saved_search:"+c.Param("id"), nil)
+	if err := models.DeleteSavedSearch(c.Request().Context(), c.Param("id"), c.Get("userID").(string)); err != nil {
+		return savedSearchError(c, err, "error deleting saved search")
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "saved search deleted successfully"})
+}
+
+// RunSavedSearchHandler makes one of the user's saved searches due, so the runner executes
+// it on its next poll.
+func (app *Config) RunSavedSearchHandler(c echo.Context) error {
+	middleware.SetAudit(c, "saved_search.run", "saved_search:"+c.Param("id"), nil)
+	if err := models.ScheduleSavedSearchNow(c.Request().Context(), c.Param("id"), c.Get("userID").(string)); err != nil {
+		return savedSearchError(c, err, "error scheduling saved search")
+	}
+	return c.JSON(http.StatusAccepted, echo.Map{"message": "saved search scheduled"})
+}
+
+// ExportPagesHandler streams every indexed page matching an optional query as a file.
+// Query parameters: format (jsonl, csv or parquet; default jsonl), fields (comma-separated,
+// default all), q (full-text query), lang and gzip (true to compress).
+func (app *Config) ExportPagesHandler(c echo.Context) error {
+	opts := pkg.ExportOptions{
+		Format: c.QueryParam("format"),
+		Gzip:   c.QueryParam("gzip") == "true",
+		Filter: models.PageFilter{Query: c.QueryParam("q"), Language: strings.ToLower(c.QueryParam("lang"))},
+	}
+	if opts.Format == "" {
+		opts.Format = "jsonl"
+	}
+	if fields := c.QueryParam("fields"); fields != "" {
+		opts.Fields = strings.Split(fields, ",")
+	}
+	if opts.Filter.Language != "" && !slices.Contains(pkg.Languages(), opts.Filter.Language) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "unsupported language", "supported": pkg.Languages()})
+	}
+	exporter, err := pkg.NewExporter(opts)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error(), "formats": pkg.ExportFormats, "fields": pkg.ExportFields()})
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, exporter.ContentType())
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", exporter.FileName()))
+	res.WriteHeader(http.StatusOK)
+	count, err := exporter.Export(c.Request().Context(), res)
+	entry := middleware.Logger(c).WithFields(logrus.Fields{"format": opts.Format, "pages": count})
+	if err != nil {
+		// The status is already sent; the truncated file is the client's only sign of failure.
+		entry.WithError(err).Error("error exporting pages")
+		return nil
+	}
+	entry.Info("pages exported")
+	return nil
+}
+
+// SearchStructuredHandler finds pages by the schema.org items embedded in them, e.g.
+// {"type": "Product", "properties": {"brand.name": "acme", "offers.priceCurrency": "EUR"}}.
+// Every property must match within the same item; query and language optionally also
+// filter on the page text.
+func (app *Config) SearchStructuredHandler(c echo.Context) error {
+	var body models.StructuredQuery
+	if err := c.Bind(&body); err != nil {
+		middleware.Logger(c).WithError(err).Error("error binding structured search data")
+		return c.String(http.StatusBadRequest, "Invalid search data")
+	}
+	if body.Type == "" && len(body.Properties) == 0 {
+		return c.String(http.StatusBadRequest, "type or properties is required")
+	}
+	body.Language = strings.ToLower(body.Language)
+	if body.Language != "" && !slices.Contains(pkg.Languages(), body.Language) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "unsupported language", "supported": pkg.Languages()})
+	}
+
+	pages, err := models.SearchStructured(c.Request().Context(), body)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error searching structured data")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, pages)
+}
+
+// eventStreamBuffer is how many events an event stream client may fall behind before its
+// stream is closed; it then reconnects with Last-Event-ID to catch up.
+const eventStreamBuffer = 256
+
+// EventStreamHandler streams crawl lifecycle events as Server-Sent Events. job_id limits
+// the stream to one crawl job, which ends after the job's job_completed event, and types
+// (comma-separated) to some event types. A client reconnecting with Last-Event-ID first
+// receives the events it missed that are still in the history.
+func (app *Config) EventStreamHandler(c echo.Context) error {
+	jobID := c.QueryParam("job_id")
+	var types []pkg.EventType
+	if v := c.QueryParam("types"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			if !slices.Contains(pkg.EventTypes, pkg.EventType(t)) {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": "unknown event type", "types": pkg.EventTypes})
+			}
+			types = append(types, pkg.EventType(t))
+		}
+	}
+	var since uint64
+	if v := c.Request().Header.Get("Last-Event-ID"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "Last-Event-ID must be an event id")
+		}
+		since = n
+	}
+
+	sub := app.Events.Subscribe(since, eventStreamBuffer, func(e pkg.Event) bool {
+		return (jobID == "" || e.JobID == jobID) && (len(types) == 0 || slices.Contains(types, e.Type))
+	})
+	defer sub.Close()
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no") // keep proxies from buffering the stream
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepalive.C:
+			fmt.Fprint(res, ": keepalive\n\n")
+			res.Flush()
+		case e, ok := <-sub.C:
+			if !ok {
+				middleware.Logger(c).Warn("event stream fell behind, closing it")
+				return nil
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(res, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			res.Flush()
+			if jobID != "" && e.Type == pkg.EventJobCompleted {
+				return nil
+			}
+		}
+	}
+}
+
+// CreateWebhookHandler registers a URL to receive crawl lifecycle events, each POSTed as
+// JSON and signed with a secret that is only returned here. events limits the deliveries
+// to some event types and job_id to one crawl job.
+func (app *Config) CreateWebhookHandler(c echo.Context) error {
+	type Body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		JobID  string   `json:"job_id"`
+	}
+	var body Body
+	if err := c.Bind(&body); err != nil {
+		middleware.Logger(c).WithError(err).Error("error binding webhook data")
+		return c.String(http.StatusBadRequest, "Invalid webhook data")
+	}
+	if body.URL == "" {
+		return c.String(http.StatusBadRequest, "URL is required")
+	}
+	for _, t := range body.Events {
+		if !slices.Contains(pkg.EventTypes, pkg.EventType(t)) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "unknown event type", "types": pkg.EventTypes})
+		}
+	}
+	ctx := c.Request().Context()
+	// The webhook is called from the crawler, so it must not reach internal services
+	if err := pkg.CheckFetchURL(ctx, body.URL); err != nil {
+		return c.String(http.StatusBadRequest, "Webhook URL not allowed: "+err.Error())
+	}
+	secret, err := utils.NewSecret()
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error generating webhook secret")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	hook := models.EventWebhook{
+		UserID: c.Get("userID").(string),
+		URL:    body.URL,
+		Secret: secret,
+		Events: body.Events,
+		JobID:  body.JobID,
+	}
+	if err := models.CreateEventWebhook(ctx, &hook); err != nil {
+		middleware.Logger(c).WithError(err).Error("error creating webhook")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	app.Webhooks.Refresh()
+	middleware.Logger(c).WithField("webhook_id", hook.ID.Hex()).Info("webhook created")
+	middleware.SetAudit(c, "webhook.create", "webhook:"+hook.ID.Hex(), []string{
+		fmt.Sprintf("url: %q", hook.URL),
+		fmt.Sprintf("events: %q", strings.Join(hook.Events, ", ")),
+		fmt.Sprintf("job_id: %q", hook.JobID),
+	})
+	return c.JSON(http.StatusCreated, struct {
+		models.EventWebhook
+		Secret string `json:"secret"`
+	}{hook, hook.Secret})
+}
+
+// ListWebhooksHandler returns the user's webhooks, newest first.
+func (app *Config) ListWebhooksHandler(c echo.Context) error {
+	hooks, err := models.ListEventWebhooks(c.Request().Context(), c.Get("userID").(string))
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error listing webhooks")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, hooks)
+}
+
+// DeleteWebhookHandler deletes one of the user's webhooks. Events already queued for it
+// are dropped.
+func (app *Config) DeleteWebhookHandler(c echo.Context) error {
+	middleware.SetAudit(c, "webhook.delete", "webhook:"+c.Param("id"), nil)
+	err := models.DeleteEventWebhook(c.Request().Context(), c.Param("id"), c.Get("userID").(string))
+	if errors.Is(err, models.ErrEventWebhookNotFound) {
+		return c.String(http.StatusNotFound, "Webhook not found")
+	}
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error deleting webhook")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	app.Webhooks.Refresh()
+	return c.String(http.StatusOK, "Webhook deleted successfully")
+}
+
+// ListAuditHandler returns a page of the audit log, newest first, with the total number of
+// matching entries. Optional query parameters: actor (a user ID), action, target, since and
+// until (RFC 3339 times), limit (1..1000, default 100) and offset.
+func (app *Config) ListAuditHandler(c echo.Context) error {
+	filter := models.AuditFilter{
+		ActorID: c.QueryParam("actor"),
+		Action:  c.QueryParam("action"),
+		Target:  c.QueryParam("target"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		if v := c.QueryParam(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return c.String(http.StatusBadRequest, p.name+" must be an RFC 3339 time")
+			}
+			*p.dst = t
+		}
+	}
+	limit := int64(100)
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > 1000 {
+			return c.String(http.StatusBadRequest, "limit must be between 1 and 1000")
+		}
+		limit = n
+	}
+	var offset int64
+	if v := c.QueryParam("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return c.String(http.StatusBadRequest, "offset must not be negative")
+		}
+		offset = n
+	}
+
+	entries, total, err := models.ListAuditEntries(c.Request().Context(), filter, limit, offset)
+	if err != nil {
+		middleware.Logger(c).WithError(err).Error("error listing audit entries")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"total": total, "entries": entries})
+}
@@ -3,12 +3,17 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
 	"os"
-	"sync"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"web_crawler/config"
 	"web_crawler/models"
 	"web_crawler/pkg"
 	"web_crawler/utils"
@@ -26,108 +31,373 @@ import (
 type Config struct {
 	Model     *models.Models
 	Logger    *logrus.Logger
-	Scheduler *pkg.Scheduler
+	Scheduler *pkg.Scheduler[string]
+	Mailer    utils.Mailer
+	Settings  *config.Config
+	Health    *pkg.HealthChecker
+	Cluster   *pkg.Cluster // nil when the node crawls alone
+	Suggester *pkg.Suggester
+	Events    *pkg.EventBus
+	Jobs      *pkg.CrawlJobs
+	Webhooks  *pkg.EventWebhooks
+	Audit     *pkg.AuditWriter
+	History   *pkg.PageHistory
 }
 
-var initialUrls []string
-
-//Defining a channel for seed urls
-
-var seedUrls = make(chan string, 5000)
-
-func init() {
-	file, err := os.Open("/app/Seed.txt")
+func main() {
+	settings, err := config.Load(os.Args[1:], os.LookupEnv)
 	if err != nil {
-		fmt.Printf("error opening file: %s", err)
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
 	}
-	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		initialUrls = append(initialUrls, scanner.Text())
-	}
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("error reading file: %s", err)
-	}
-	for _, url := range initialUrls { // Assuming initialUrls is a slice of your seed URLs
-		seedUrls <- url
-	}
-}
-
-func main() {
-	// Load the .env file
-	// if err := godotenv.Load("../../.env"); err != nil {
-	// 	fmt.Printf("Error loading .env file: %v", err)
-	// 	os.Exit(1)
-	// }
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	// exit lives until the process is told to stop; the crawl itself ends earlier, after
+	// the crawler timeout, while the API and its background jobs keep running.
+	exit, stopExit := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopExit()
+	ctx, cancel := context.WithTimeout(exit, settings.Crawler.Timeout.Duration)
 	defer cancel()
 
-	esClient, err := initESClient()
+	logger, err := utils.NewLogger(utils.LogOptions{
+		Level:      settings.Log.Level,
+		Output:     settings.Log.Output,
+		MaxSizeMB:  settings.Log.MaxSizeMB,
+		MaxBackups: settings.Log.MaxBackups,
+	})
+	if err != nil {
+		fmt.Printf("Error initializing logger: %v", err)
+		os.Exit(1)
+	}
+
+	esClient, err := initESClient(settings.Elasticsearch)
 	if err != nil {
 		fmt.Printf("Error initializing ES client: %v", err)
 		os.Exit(1)
 	}
-	mongClient, err := connectToMongo()
+	mongClient, err := connectToMongo(settings.Mongo)
 	if err != nil {
 		fmt.Printf("Error initializing mongo client: %v", err)
 		os.Exit(1)
 	}
 
-	models := models.NewModels(esClient, mongClient)
-	logger := utils.NewLogger()
+	appModels := models.NewModels(esClient, mongClient)
+	if err := modelsMigrate(ctx); err != nil {
+		fmt.Printf("Error preparing collections and indexes: %v", err)
+		os.Exit(1)
+	}
+	mailer, err := newMailer(settings.Mail)
+	if err != nil {
+		fmt.Printf("Error initializing mailer: %v", err)
+		os.Exit(1)
+	}
+	if settings.Archive.Dir != "" {
+		archive, err := pkg.NewWARCWriter(settings.Archive.Dir, "crawl", int64(settings.Archive.MaxSizeMB)<<20)
+		if err != nil {
+			fmt.Printf("Error initializing WARC archive: %v", err)
+			os.Exit(1)
+		}
+		defer archive.Close()
+		pkg.SetArchive(archive)
+		logger.WithField("dir", settings.Archive.Dir).Info("archiving fetches to WARC files")
+	}
+	if settings.Archive.RawDir != "" {
+		store, err := pkg.NewRawStore(settings.Archive.RawDir)
+		if err != nil {
+			fmt.Printf("Error initializing raw page store: %v", err)
+			os.Exit(1)
+		}
+		pkg.SetRawStore(store)
+	}
+	limits := pkg.FetchLimits{
+		ConnectTimeout:       settings.Fetch.ConnectTimeout.Duration,
+		HeaderTimeout:        settings.Fetch.HeaderTimeout.Duration,
+		TotalTimeout:         settings.Fetch.TotalTimeout.Duration,
+		MaxBodySize:          int64(settings.Fetch.MaxBodySizeMB) << 20,
+		MaxRedirects:         settings.Fetch.MaxRedirects,
+		AllowedTypes:         settings.Fetch.AllowedContentTypes,
+		BlockPrivateNetworks: !settings.Fetch.AllowPrivateNetworks,
+		AllowedNetworks:      settings.Fetch.Networks(),
+	}
+	if len(limits.AllowedTypes) == 0 {
+		limits.AllowedTypes = pkg.SupportedTypes()
+	}
+	pkg.SetFetchLimits(limits)
+	pkg.SetPageVersionErrorHandler(func(pageID, url string, err error) {
+		logger.WithError(err).WithFields(logrus.Fields{"page_id": pageID, "url": url}).Error("error saving page version")
+	})
+
+	// Channel of URLs waiting to be crawled, starting with the seed file.
+	seedUrls := make(chan string, settings.Crawler.QueueSize)
+	initialUrls, err := loadSeeds(settings.Crawler.SeedFile)
+	if err != nil {
+		logger.WithError(err).WithField("seed_file", settings.Crawler.SeedFile).Error("error reading seed file")
+	}
+	for _, url := range initialUrls {
+		select {
+		case seedUrls <- url:
+		default:
+			logger.WithField("url", url).Warn("seed queue full, dropping url")
+		}
+	}
+
 	e := echo.New()
 	// Configure CORS middleware
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},                                        // Allows all origins
 		AllowMethods: []string{echo.GET, echo.PUT, echo.POST, echo.DELETE}, // Specify allowed methods
 	}))
+	// pendingIndex counts pages fetched and parsed but not yet written to Elasticsearch.
+	var pendingIndex atomic.Int64
+	health := pkg.NewHealthChecker(settings.Health.Timeout.Duration)
+	health.AddCheck("elasticsearch", models.PingElasticsearch)
+	health.AddCheck("mongo", models.PingMongo)
+	health.AddQueue("frontier", func() int { return len(seedUrls) }, settings.Health.FrontierThreshold)
+	health.AddQueue("indexer", func() int { return int(pendingIndex.Load()) }, settings.Health.IndexerThreshold)
+
+	// enqueue adds URLs to the frontier. A full frontier drops them rather than stall the
+	// caller; links are still in the link graph.
+	enqueue := func(urls []string) {
+		for _, u := range urls {
+			select {
+			case seedUrls <- u:
+			default:
+				logger.WithField("url", u).Debug("frontier full, dropping url")
+			}
+		}
+	}
+
 	app := &Config{
-		Model:  models,
-		Logger: logger,
+		Model:    appModels,
+		Logger:   logger,
+		Mailer:   mailer,
+		Settings: settings,
+		Health:   health,
+		Suggester: pkg.NewSuggester(settings.Suggest.Budget.Duration, settings.Suggest.CacheTTL.Duration,
+			settings.Suggest.CacheSize),
+		Events:  pkg.NewEventBus(settings.Events.History),
+		Jobs:    pkg.NewCrawlJobs(),
+		History: pkg.NewPageHistory(),
+	}
+	webhookRetry := pkg.RetryPolicy{
+		MaxAttempts: settings.Events.WebhookMaxAttempts,
+		BaseDelay:   settings.Retry.BaseDelay.Duration,
+		MaxDelay:    settings.Retry.MaxDelay.Duration,
+		Jitter:      settings.Retry.Jitter,
+	}
+	app.Webhooks = pkg.NewEventWebhooks(app.Events, webhookRetry, settings.Events.WebhookTimeout.Duration, settings.Events.WebhookQueueSize)
+	app.Webhooks.OnError = func(hook *models.EventWebhook, e pkg.Event, err error) {
+		entry := app.Logger.WithError(err)
+		if hook != nil {
+			entry = entry.WithFields(logrus.Fields{"webhook_id": hook.ID.Hex(), "event_id": e.ID})
+		}
+		entry.Error("error delivering event to webhook")
+	}
+	app.Audit = pkg.NewAuditWriter(settings.Audit.Buffer, settings.Audit.BatchSize, settings.Audit.FlushInterval.Duration)
+	app.Audit.Retry = pkg.RetryPolicy{
+		BaseDelay: settings.Retry.BaseDelay.Duration,
+		MaxDelay:  settings.Retry.MaxDelay.Duration,
+		Jitter:    settings.Retry.Jitter,
+	}
+	app.Audit.OnError = func(err error, entries int) {
+		app.Logger.WithError(err).WithField("entries", entries).Warn("error writing audit entries, retrying")
+	}
+	app.Audit.Fallback = func(entries []models.AuditEntry, err error) {
+		// The log is the last place these entries are kept, so write them out in full.
+		for _, entry := range entries {
+			app.Logger.WithError(err).WithField("audit", entry).Error("audit entry not written")
+		}
+	}
+	app.Audit.Start()
+	if settings.Cluster.Self != "" {
+		app.Cluster = pkg.NewCluster(pkg.ClusterOptions{
+			Self:              settings.Cluster.Self,
+			Seeds:             settings.Cluster.Seeds,
+			Secret:            settings.Cluster.Secret,
+			Replicas:          settings.Cluster.Replicas,
+			HeartbeatInterval: settings.Cluster.HeartbeatInterval.Duration,
+			FailureThreshold:  settings.Cluster.FailureThreshold,
+		})
+		app.Cluster.Deliver = enqueue
+		app.Cluster.OnChange = func(members []string) {
+			logger.WithField("members", members).Info("cluster membership changed")
+		}
+		go app.Cluster.Run(ctx)
 	}
 	app.routes(e)
 
-	// Initialize the scheduler with 10 workers
-	sched := pkg.NewScheduler(10)
+	// Initialize the scheduler with the configured number of workers. Its queue only buffers
+	// a little ahead of the workers; the frontier holds the backlog.
+	sched := pkg.NewScheduler[string](settings.Crawler.Workers, settings.Crawler.Workers)
 	app.Scheduler = sched
+	sched.OnError = func(url string, err error) {
+		entry := app.Logger.WithError(err).WithField("url", url)
+		var panicErr *pkg.PanicError
+		if errors.As(err, &panicErr) {
+			entry = entry.WithField("stack", string(panicErr.Stack))
+		}
+		entry.Error("crawl job failed")
+	}
 
-	// Initialize a map to keep track of URLs and a mutex for synchronization
-	var urlsSeen = make(map[string]bool)
-	var mutex sync.Mutex
+	retryPolicy := pkg.RetryPolicy{
+		MaxAttempts: settings.Retry.MaxAttempts,
+		BaseDelay:   settings.Retry.BaseDelay.Duration,
+		MaxDelay:    settings.Retry.MaxDelay.Duration,
+		Jitter:      settings.Retry.Jitter,
+	}
+	// URLs of hosts whose breaker is open are parked and submitted again once it half-opens.
+	// URLs beyond MaxParked fail with ErrParkingFull and are dead-lettered below.
+	breakers := pkg.NewHostBreakers(pkg.BreakerOptions{
+		ConsecutiveFailures: settings.Breaker.ConsecutiveFailures,
+		FailureRate:         settings.Breaker.FailureRate,
+		Window:              settings.Breaker.Window,
+		MinRequests:         settings.Breaker.MinRequests,
+		OpenTimeout:         settings.Breaker.OpenTimeout.Duration,
+		HalfOpenProbes:      settings.Breaker.HalfOpenProbes,
+		MaxParked:           settings.Breaker.MaxParked,
+	}, func(url string) { sched.Submit(ctx, url) })
+	breakers.OnStateChange = func(host string, from, to pkg.BreakerState) {
+		app.Logger.WithFields(logrus.Fields{
+			"host": host,
+			"from": from.String(),
+			"to":   to.String(),
+		}).Warn("host circuit breaker changed state")
+	}
+	fetch := breakers.Wrap(pkg.FetchDocument)
 
 	// Define the worker function
-	workerFunc := func(job interface{}) {
-		Url, ok := job.(string)
-		if !ok {
-			fmt.Println("Invalid job type")
-			return
+	workerFunc := func(ctx context.Context, Url string) error {
+		// URLs submitted without a job, such as parked URLs of a job that already ended,
+		// start one here.
+		jobID, started := app.Jobs.Start(Url, utils.NewID)
+		if started {
+			app.Events.Publish(pkg.Event{Type: pkg.EventURLEnqueued, JobID: jobID, URL: Url})
+		}
+		jobLog := app.Logger.WithFields(logrus.Fields{
+			"url":    Url,
+			"job_id": jobID,
+		})
+		if u, err := url.Parse(Url); err == nil {
+			jobLog = jobLog.WithField("host", u.Hostname())
+		}
+		start := time.Now()
+		// complete ends the job with its last event.
+		complete := func(outcome pkg.JobOutcome, contentType string, err error) {
+			e := pkg.Event{
+				Type:        pkg.EventJobCompleted,
+				JobID:       app.Jobs.Finish(Url),
+				URL:         Url,
+				ContentType: contentType,
+				Outcome:     outcome,
+				DurationMS:  time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				e.Error = err.Error()
+			}
+			app.Events.Publish(e)
 		}
 		// Fetch the content
-		htmlContent, err := pkg.Fetch(Url)
-		if err != nil {
-			app.Logger.Error(fmt.Sprintf("Error fetching content from %s: %v", Url, err))
-			return
+		doc, err := pkg.FetchWithRetry(ctx, Url, retryPolicy, fetch)
+		if errors.Is(err, pkg.ErrCircuitOpen) {
+			// The job goes on when the URL is submitted again.
+			jobLog.Debug("host circuit open, url parked")
+			return nil
+		}
+		// Responses of a type that is not allowed come back without a body
+		var unsupported *pkg.UnsupportedTypeError
+		if errors.As(err, &unsupported) {
+			recordSkippedPage(ctx, jobLog, Url, unsupported.ContentType, doc.StatusCode)
+			complete(pkg.JobSkipped, unsupported.ContentType, nil)
+			return nil
+		}
+		var fetchErr *pkg.FetchError
+		if errors.As(err, &fetchErr) {
+			jobLog.WithError(err).WithFields(logrus.Fields{
+				"error_class": fetchErr.Class,
+				"attempts":    fetchErr.Attempts,
+			}).Error("error fetching content")
+			app.Events.Publish(pkg.Event{
+				Type:       pkg.EventFetchFailed,
+				JobID:      jobID,
+				URL:        Url,
+				StatusCode: fetchErr.StatusCode,
+				ErrorClass: fetchErr.Class,
+				Attempts:   fetchErr.Attempts,
+				Error:      fetchErr.Error(),
+			})
+			complete(pkg.JobFailed, "", fetchErr)
+			if ctx.Err() != nil {
+				return nil // shutting down, not a failure of the URL
+			}
+			err := models.RecordDeadLetter(ctx, models.DeadLetter{
+				URL:        Url,
+				Class:      string(fetchErr.Class),
+				StatusCode: fetchErr.StatusCode,
+				Error:      fetchErr.Error(),
+				Attempts:   fetchErr.Attempts,
+			})
+			if err != nil {
+				jobLog.WithError(err).Error("error recording dead letter")
+			}
+			return nil
+		}
+		jobLog = jobLog.WithField("content_type", doc.ContentType)
+		app.Events.Publish(pkg.Event{
+			Type:        pkg.EventPageFetched,
+			JobID:       jobID,
+			URL:         Url,
+			StatusCode:  doc.StatusCode,
+			ContentType: doc.ContentType,
+		})
+		if err := pkg.RecordRawPage(ctx, doc); err != nil {
+			jobLog.WithError(err).Error("error recording raw page")
+		}
+		// Extract the content with the extractor for its media type
+		result, err := pkg.Extract(doc)
+		if errors.As(err, &unsupported) {
+			recordSkippedPage(ctx, jobLog, Url, unsupported.ContentType, doc.StatusCode)
+			complete(pkg.JobSkipped, unsupported.ContentType, nil)
+			return nil
 		}
-		// Parse the content
-		urls, contents, title, description, keywords, err := pkg.Parse(htmlContent)
 		if err != nil {
-			app.Logger.Error(fmt.Sprintf("Error parsing content from %s: %v", Url, err))
-			return
+			jobLog.WithError(err).Error("error extracting content")
+			complete(pkg.JobFailed, doc.ContentType, err)
+			return nil
+		}
+		urls := result.Links
+		// Record the outbound edges in the link graph, from the URL the page is indexed
+		// under, which is where any redirects led
+		if err := pkg.StoreLinks(ctx, doc.URL, urls); err != nil {
+			jobLog.WithError(err).Error("error storing links")
 		}
-		// Submit new URLs to the scheduler
-		for _, newURL := range urls {
-			u, err := url.Parse(newURL)
+		// Queue the new URLs, handing those of other nodes' hosts to their owners
+		var discovered []string
+		for _, link := range urls {
+			u, err := url.Parse(link.URL)
 			if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
-				seedUrls <- newURL
+				discovered = append(discovered, link.URL)
 			}
 		}
+		if app.Cluster == nil {
+			enqueue(discovered)
+		} else if err := app.Cluster.Route(ctx, discovered); err != nil {
+			jobLog.WithError(err).Warn("error forwarding links")
+		}
 		// Store the parsed data
-		_, err = pkg.InsertCombinedContent(ctx, Url, 200, contents, title, description, keywords)
+		pendingIndex.Add(1)
+		pageID, err := pkg.InsertPageResult(ctx, doc, result)
+		pendingIndex.Add(-1)
 		if err != nil {
-			app.Logger.Error(fmt.Sprintf("Error inserting content from %s: %v", Url, err))
-			return
+			jobLog.WithError(err).Error("error inserting content")
+			complete(pkg.JobFailed, doc.ContentType, err)
+			return nil
 		}
+		app.Events.Publish(pkg.Event{Type: pkg.EventPageIndexed, JobID: jobID, URL: Url, PageID: pageID, Links: len(urls)})
+		complete(pkg.JobIndexed, doc.ContentType, nil)
+		jobLog.WithFields(logrus.Fields{
+			"links":       len(urls),
+			"duration_ms": time.Since(start).Milliseconds(),
+		}).Info("page crawled")
+		return nil
 	}
 	go func() {
 		initialWaitTime := 1 * time.Second
@@ -135,7 +405,7 @@ func main() {
 		factor := 2
 
 		for attempt := 1; attempt <= maxRetries; attempt++ {
-			err := e.Start(":8081")
+			err := e.Start(fmt.Sprintf(":%d", settings.Server.Port))
 			if err != nil {
 				log.Printf("Attempt %d: server failed to start: %v", attempt, err)
 				if attempt == maxRetries {
@@ -148,33 +418,89 @@ func main() {
 			}
 		}
 	}()
+	go app.runPageRank(exit)
+	go app.runSavedSearches(exit)
+	go app.Webhooks.Run(exit)
 	// Start the scheduler
 	sched.Start(ctx, workerFunc)
-	mutex.Lock()
-	for url := range seedUrls {
-
-		if _, seen := urlsSeen[url]; !seen {
+	// Feed the frontier to the workers, skipping URLs that were already submitted.
+	urlsSeen := make(map[string]bool)
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case url := <-seedUrls:
+			// After a membership change the frontier may hold hosts that moved to another node.
+			if app.Cluster != nil && !app.Cluster.Owns(url) {
+				if err := app.Cluster.Route(ctx, []string{url}); err != nil {
+					app.Logger.WithError(err).WithField("url", url).Warn("error forwarding url")
+				}
+				continue
+			}
+			if urlsSeen[url] {
+				continue
+			}
 			urlsSeen[url] = true
-			fmt.Println("Submitting URL: ", url)
+			app.Logger.WithField("url", url).Debug("submitting url")
+			if _, err := app.submit(ctx, url); err != nil && ctx.Err() == nil {
+				app.Logger.WithError(err).WithField("url", url).Error("error submitting url")
+			}
 		}
 	}
-	mutex.Unlock()
+	sched.Stop()
+	app.Logger.Info("crawl stopped")
 
-	go func() {
-		<-ctx.Done()
-		sched.Stop()
-		close(seedUrls)
-	}()
+	// Keep serving the API after the crawl until the process is told to exit.
+	<-exit.Done()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		app.Logger.WithError(err).Error("error shutting down server")
+	}
+	// The server no longer takes requests, so every entry is recorded by now.
+	app.Audit.Close(shutdownCtx)
 
 }
 
-func initESClient() (*elasticsearch.Client, error) {
-	esHost := os.Getenv("ELASTICSEARCH_HOST")
-	esPort := os.Getenv("ELASTICSEARCH_PORT")
-	esAddress := fmt.Sprintf("http://%s:%s", esHost, esPort)
+// submit queues url for the workers as a new crawl job, or as part of its job when it is
+// already queued, and returns the job ID. The job fails if the URL cannot be queued.
+func (app *Config) submit(ctx context.Context, url string) (string, error) {
+	jobID, started := app.Jobs.Start(url, utils.NewID)
+	if started {
+		// Published first, since a worker may take the URL as soon as it is submitted.
+		app.Events.Publish(pkg.Event{Type: pkg.EventURLEnqueued, JobID: jobID, URL: url})
+	}
+	if _, err := app.Scheduler.Submit(ctx, url); err != nil {
+		if started {
+			app.Events.Publish(pkg.Event{
+				Type:    pkg.EventJobCompleted,
+				JobID:   app.Jobs.Finish(url),
+				URL:     url,
+				Outcome: pkg.JobFailed,
+				Error:   err.Error(),
+			})
+		}
+		return "", err
+	}
+	return jobID, nil
+}
+
+// recordSkippedPage notes a URL whose content type is not crawled.
+func recordSkippedPage(ctx context.Context, jobLog *logrus.Entry, url, mimeType string, status int) {
+	jobLog.WithField("content_type", mimeType).Info("skipping unsupported content type")
+	err := models.RecordSkippedPage(ctx, models.SkippedPage{
+		URL:        url,
+		MimeType:   mimeType,
+		StatusCode: status,
+		SkippedAt:  time.Now(),
+	})
+	if err != nil {
+		jobLog.WithError(err).Error("error recording skipped page")
+	}
+}
 
+func initESClient(cfg config.ElasticsearchConfig) (*elasticsearch.Client, error) {
 	esConfig := elasticsearch.Config{
-		Addresses: []string{esAddress},
+		Addresses: []string{cfg.Address()},
 	}
 
 	esClient, err := elasticsearch.NewClient(esConfig)
@@ -186,28 +512,10 @@ func initESClient() (*elasticsearch.Client, error) {
 }
 
 // connectToMongo connects to the MongoDB instance and returns the client.
-func connectToMongo() (*mongo.Client, error) {
-	mongoURI := os.Getenv("MONGOURL")
-	mongoUser := os.Getenv("MONGOUSER")
-	mongoPassword := os.Getenv("MONGOPASSWORD")
-
-	// Check if the environment variables are loaded
-	if mongoURI == "" {
-		log.Panic("MONGOURL environment variable is not set")
-		return nil, fmt.Errorf("MONGOURL environment variable is not set")
-	}
-	if mongoUser == "" {
-		log.Panic("MONGOUSER environment variable is not set")
-		return nil, fmt.Errorf("MONGOUSER environment variable is not set")
-	}
-	if mongoPassword == "" {
-		log.Panic("MONGOPASSWORD environment variable is not set")
-		return nil, fmt.Errorf("MONGOPASSWORD environment variable is not set")
-	}
-
-	clientOptions := options.Client().ApplyURI(mongoURI).SetAuth(options.Credential{
-		Username: mongoUser,
-		Password: mongoPassword,
+func connectToMongo(cfg config.MongoConfig) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(cfg.URI).SetAuth(options.Credential{
+		Username: cfg.User,
+		Password: cfg.Password,
 	}).SetWriteConcern(writeconcern.New(writeconcern.WMajority()))
 
 	c, err := mongo.Connect(context.TODO(), clientOptions)
@@ -232,3 +540,116 @@ func connectToMongo() (*mongo.Client, error) {
 
 	return c, nil
 }
+
+// modelsMigrate prepares the user collections for email verification and password resets,
+// the link graph, raw page, dead letter, saved search, webhook, audit log and page version
+// indexes and the webpages index mapping.
+func modelsMigrate(ctx context.Context) error {
+	if err := models.MarkLegacyUsersVerified(); err != nil {
+		return err
+	}
+	if err := models.EnsurePasswordResetIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsureLinkIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsureRawPageIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsureDeadLetterIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsureSavedSearchIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsureEventWebhookIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsureAuditIndexes(ctx); err != nil {
+		return err
+	}
+	if err := models.EnsurePageVersionIndexes(ctx); err != nil {
+		return err
+	}
+	return models.EnsureWebPageIndex(ctx)
+}
+
+// runPageRank recomputes PageRank over the link graph every configured interval until ctx is done.
+func (app *Config) runPageRank(ctx context.Context) {
+	opts := pkg.PageRankOptions{
+		Damping:       app.Settings.PageRank.Damping,
+		MaxIterations: app.Settings.PageRank.Iterations,
+		Tolerance:     pkg.DefaultPageRankOptions().Tolerance,
+		Workers:       app.Settings.PageRank.Workers,
+	}
+	ticker := time.NewTicker(app.Settings.PageRank.Interval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			scored, updated, err := pkg.RunPageRank(ctx, opts)
+			entry := app.Logger.WithFields(logrus.Fields{
+				"scored":      scored,
+				"updated":     updated,
+				"duration_ms": time.Since(start).Milliseconds(),
+			})
+			if err != nil {
+				entry.WithError(err).Error("pagerank job failed")
+				continue
+			}
+			entry.Info("pagerank job completed")
+		}
+	}
+}
+
+// runSavedSearches executes due saved searches until ctx is done. Alerts go to the search's
+// webhook, or to the log when it has none.
+func (app *Config) runSavedSearches(ctx context.Context) {
+	alertLog := &pkg.LogNotifier{Logf: app.Logger.WithField("component", "saved_search").Infof}
+	runner := pkg.NewSavedSearchRunner(app.Settings.SavedSearches.PollInterval.Duration, func(s *models.SavedSearch) pkg.Notifier {
+		if s.WebhookURL == "" {
+			return alertLog
+		}
+		return &pkg.WebhookNotifier{URL: s.WebhookURL, Secret: s.WebhookSecret}
+	})
+	runner.OnError = func(s *models.SavedSearch, err error) {
+		app.Logger.WithError(err).WithField("search_id", s.ID.Hex()).Error("saved search run failed")
+	}
+	runner.Run(ctx)
+}
+
+// newMailer sends mail through SMTP when an SMTP address is configured and writes it to a directory otherwise.
+func newMailer(cfg config.MailConfig) (utils.Mailer, error) {
+	if cfg.SMTPAddr != "" {
+		return &utils.SMTPMailer{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUser,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	}
+	return utils.NewFileMailer(cfg.Dir, cfg.From)
+}
+
+// loadSeeds reads one seed URL per line from path, skipping blank lines.
+func loadSeeds(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			seeds = append(seeds, line)
+		}
+	}
+	return seeds, scanner.Err()
+}
@@ -8,20 +8,71 @@ import (
 
 // routes registers the API routes with the provided Echo instance.
 func (app *Config) routes(e *echo.Echo) {
+	e.Use(middleware.RequestLogger(app.Logger))                // request ID and request-scoped logging
+	e.Use(middleware.AuditLog(app.Audit.Record, auditSkipped)) // record mutating requests
 	g := e.Group("/account")
 	p := e.Group("/page")
+	d := e.Group("/deadletters")
+	s := e.Group("/searches")
+	ev := e.Group("/events")
+	w := e.Group("/webhooks")
+	a := e.Group("/admin")
 	p.Use(middleware.JWTAuthMiddleware)
+	d.Use(middleware.JWTAuthMiddleware)
+	s.Use(middleware.JWTAuthMiddleware)
+	ev.Use(middleware.JWTAuthMiddleware)
+	w.Use(middleware.JWTAuthMiddleware)
 	g.Use(middleware.JWTAuthMiddleware)
-	e.GET("/ping", app.pingHandler)                // health check
-	e.POST("/signup", app.signupHandler)           // user signup
-	e.POST("/login", app.loginHandler)             // user login
-	g.GET("/get", app.getUserHandler)              // get user by id
-	g.PUT("/edit", app.updateUserHandler)          // update user by id
-	g.DELETE("/delete", app.deleteUserHandler)     // delete user by id
-	p.GET("/:id", app.GetPageHandler)              // get page by id
-	p.PUT("/edit/:id", app.UpdatePageHandler)      // update page by id
-	p.DELETE("/delete/:id", app.DeletePageHandler) // delete page by id
-	p.POST("/add", app.AddUrlHandler)              // add page
-	p.POST("/search", app.SearchPageHandler)       // crawl page
+	a.Use(middleware.JWTAuthMiddleware, middleware.AdminOnly(app.Settings.Server.Admins))
+	e.GET("/ping", app.pingHandler)                         // health check
+	e.GET("/healthz", app.healthzHandler)                   // liveness probe with dependency status
+	e.GET("/readyz", app.readyzHandler)                     // readiness probe, 503 while not ready
+	e.POST("/signup", app.signupHandler)                    // user signup
+	e.POST("/login", app.loginHandler)                      // user login
+	e.GET("/verify", app.verifyEmailHandler)                // confirm email address
+	e.POST("/verify/resend", app.resendVerificationHandler) // resend verification link
+	e.POST("/password/forgot", app.forgotPasswordHandler)   // request a password reset
+	e.POST("/password/reset", app.resetPasswordHandler)     // set a new password
+	g.GET("/get", app.getUserHandler)                       // get user by id
+	g.PUT("/edit", app.updateUserHandler)                   // update user by id
+	g.DELETE("/delete", app.deleteUserHandler)              // delete user by id
+	p.GET("/:id/links", app.GetPageLinksHandler)            // inbound and outbound links of a page
+	p.GET("/:id", app.GetPageHandler)                       // get page by id
+	p.PUT("/edit/:id", app.UpdatePageHandler)               // update page by id
+	p.DELETE("/delete/:id", app.DeletePageHandler)          // delete page by id
+	p.POST("/add", app.AddUrlHandler)                       // add page
+	p.POST("/search", app.SearchPageHandler)                // crawl page
+	p.GET("/suggest", app.SuggestPageHandler)               // title completions and spelling corrections
 	p.GET("/", app.GetPagesHandler)
+	p.GET("/export", app.ExportPagesHandler)                                // stream matching pages as JSONL, CSV or Parquet
+	p.POST("/search/structured", app.SearchStructuredHandler)               // find pages by schema.org items
+	p.GET("/:id/versions", app.ListPageVersionsHandler)                     // list page versions
+	p.GET("/:id/versions/:version", app.GetPageVersionHandler)              // get page version
+	p.POST("/:id/versions/:version/restore", app.RestorePageVersionHandler) // restore page version
+	d.GET("", app.ListDeadLettersHandler)                                   // list permanently failed URLs
+	d.POST("/requeue", app.RequeueDeadLettersHandler)                       // crawl failed URLs again
+	s.POST("", app.CreateSavedSearchHandler)                                // save a search with change alerts
+	s.GET("", app.ListSavedSearchesHandler)                                 // list saved searches
+	s.GET("/:id", app.GetSavedSearchHandler)                                // get saved search by id
+	s.DELETE("/:id", app.DeleteSavedSearchHandler)                          // delete saved search by id
+	s.POST("/:id/run", app.RunSavedSearchHandler)                           // run saved search on the next poll
+	ev.GET("", app.EventStreamHandler)                                      // stream crawl events as Server-Sent Events
+	w.POST("", app.CreateWebhookHandler)                                    // register a webhook for crawl events
+	w.GET("", app.ListWebhooksHandler)                                      // list webhooks
+	w.DELETE("/:id", app.DeleteWebhookHandler)                              // delete webhook by id
+	a.GET("/audit", app.ListAuditHandler)                                   // query the audit log
+	if app.Cluster != nil {
+		// node to node requests, authenticated with the cluster secret
+		e.Any("/cluster/*", echo.WrapHandler(app.Cluster.Handler()))
+	}
+}
+
+// auditSkipped keeps requests that change nothing, such as searches sent as POST, and the
+// traffic between cluster nodes out of the audit log.
+func auditSkipped(c echo.Context) bool {
+	switch c.Path() {
+	case "/page/search", "/page/search/structured", "/cluster/*":
+		return true
+	}
+	return false
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"web_crawler/config"
+	"web_crawler/pkg"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestRouter registers the API routes of an app whose only dependency is health.
+func newTestRouter(health *pkg.HealthChecker) *echo.Echo {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	app := &Config{
+		Logger:   logger,
+		Settings: config.Default(),
+		Health:   health,
+		Audit:    pkg.NewAuditWriter(1, 1, time.Hour),
+	}
+	e := echo.New()
+	app.routes(e)
+	return e
+}
+
+func TestHealthRoutes(t *testing.T) {
+	health := pkg.NewHealthChecker(50 * time.Millisecond)
+	health.AddCheck("mongo", func(ctx context.Context) error { return nil })
+	depth := 0
+	health.AddQueue("frontier", func() int { return depth }, 10)
+	e := newTestRouter(health)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz = %d, want 200", code)
+	}
+	if code := get("/readyz"); code != http.StatusOK {
+		t.Errorf("GET /readyz = %d, want 200", code)
+	}
+
+	// A saturated frontier makes the node unready but not unhealthy.
+	depth = 11
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz with a full frontier = %d, want 503", code)
+	}
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("GET /healthz with a full frontier = %d, want 200", code)
+	}
+
+	health.AddCheck("elasticsearch", func(ctx context.Context) error { return errors.New("down") })
+	depth = 0
+	if code := get("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("GET /readyz with a dependency down = %d, want 503", code)
+	}
+}
+
+func TestPageRoutesResolve(t *testing.T) {
+	e := newTestRouter(pkg.NewHealthChecker(time.Second))
+	tests := map[string]string{
+		"/page/abc":            "/page/:id",
+		"/page/abc/links":      "/page/:id/links",
+		"/page/abc/versions":   "/page/:id/versions",
+		"/page/abc/versions/2": "/page/:id/versions/:version",
+		"/page/suggest":        "/page/suggest",
+	}
+	for path, want := range tests {
+		c := e.NewContext(nil, nil)
+		e.Router().Find(http.MethodGet, path, c)
+		if c.Path() != want {
+			t.Errorf("GET %s resolves to %q, want %q", path, c.Path(), want)
+		}
+	}
+}
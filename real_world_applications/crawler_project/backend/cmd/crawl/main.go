@@ -0,0 +1,197 @@
+// Command crawl runs a one-off crawl without the API server, Mongo or Elasticsearch.
+//
+// Usage:
+//
+//	crawl [-seed url]... [-seed-file file] [-depth n] [-scope host|domain|prefix|any]
+//	      [-max-pages n] [-workers n] [-attempts n] [-out file] [-format jsonl|csv] [-render]
+//	      [-allow-private]
+//
+// Every processed URL is written as one JSON line or CSV row. A progress line is shown
+// on stderr while the crawl runs, and the command exits when the frontier drains or on
+// interrupt, after flushing what has been written.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"web_crawler/pkg"
+)
+
+// stringList is a flag that can be repeated.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	var seeds stringList
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	fs.Var(&seeds, "seed", "seed URL, may be repeated")
+	seedFile := fs.String("seed-file", "", "file with one seed URL per line")
+	depth := fs.Int("depth", 2, "how many links away from a seed to follow")
+	scopeName := fs.String("scope", "host", "which links to follow: host, domain, prefix or any")
+	maxPages := fs.Int("max-pages", 1000, "stop after this many URLs, 0 for no limit")
+	workers := fs.Int("workers", 10, "number of concurrent fetches")
+	out := fs.String("out", "-", "output file, - for stdout")
+	format := fs.String("format", "", "jsonl or csv (default from the -out extension, else jsonl)")
+	render := fs.Bool("render", false, "render HTML in a headless browser before parsing")
+	allowPrivate := fs.Bool("allow-private", false, "allow fetching loopback, private and link-local addresses")
+	attempts := fs.Int("attempts", 3, "tries per URL for transient fetch failures")
+	progress := fs.Bool("progress", isTerminal(os.Stderr), "show a live progress line on stderr")
+	fs.Parse(os.Args[1:])
+
+	seeds = append(seeds, fs.Args()...)
+	if *seedFile != "" {
+		fileSeeds, err := readSeeds(*seedFile)
+		if err != nil {
+			fatal("error reading seed file: %v", err)
+		}
+		seeds = append(seeds, fileSeeds...)
+	}
+	if len(seeds) == 0 {
+		fatal("no seeds given, use -seed or -seed-file")
+	}
+	scope, err := pkg.ParseScope(*scopeName)
+	if err != nil {
+		fatal("%v", err)
+	}
+	if *format == "" {
+		*format = "jsonl"
+		if strings.EqualFold(filepath.Ext(*out), ".csv") {
+			*format = "csv"
+		}
+	}
+
+	var dst io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fatal("error creating output: %v", err)
+		}
+		defer f.Close()
+		dst = f
+	}
+	buffered := bufio.NewWriter(dst)
+	writer, err := newResultWriter(*format, buffered)
+	if err != nil {
+		fatal("%v", err)
+	}
+
+	limits := pkg.DefaultFetchLimits()
+	limits.BlockPrivateNetworks = !*allowPrivate
+	pkg.SetFetchLimits(limits)
+	pkg.SetRenderJavaScript(*render)
+	policy := pkg.DefaultRetryPolicy()
+	policy.MaxAttempts = *attempts
+	crawler := pkg.NewCrawler(pkg.CrawlOptions{
+		Workers:  *workers,
+		MaxDepth: *depth,
+		MaxPages: *maxPages,
+		Scope:    scope,
+		Fetch: func(ctx context.Context, url string) (*pkg.Document, error) {
+			return pkg.FetchWithRetry(ctx, url, policy, pkg.FetchDocument)
+		},
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	stopProgress := func() {}
+	if *progress {
+		stopProgress = showProgress(crawler, start)
+	}
+
+	var writeErr error
+	runErr := crawler.Run(ctx, seeds, func(result pkg.CrawlResult) {
+		if writeErr == nil {
+			writeErr = writer.Write(result)
+		}
+	})
+	stopProgress()
+
+	if err := writer.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if err := buffered.Flush(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+
+	stats := crawler.Stats()
+	fmt.Fprintf(os.Stderr, "crawled %d pages, %d failed in %s\n", stats.Done, stats.Failed, time.Since(start).Round(time.Millisecond))
+	if writeErr != nil {
+		fatal("error writing results: %v", writeErr)
+	}
+	if runErr != nil && ctx.Err() == nil {
+		fatal("%v", runErr)
+	}
+}
+
+// showProgress redraws a one-line summary on stderr until the returned function is called.
+func showProgress(crawler *pkg.Crawler, start time.Time) func() {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			s := crawler.Stats()
+			elapsed := time.Since(start)
+			rate := float64(s.Done+s.Failed) / elapsed.Seconds()
+			fmt.Fprintf(os.Stderr, "\r\033[K%s  done %d  failed %d  in flight %d  queued %d  %.1f pages/s",
+				elapsed.Round(time.Second), s.Done, s.Failed, s.InFlight, s.Queued, rate)
+			select {
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// readSeeds returns the non-empty lines of path that are not # comments.
+func readSeeds(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			seeds = append(seeds, line)
+		}
+	}
+	return seeds, scanner.Err()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func fatal(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "crawl: "+format+"\n", args...)
+	os.Exit(1)
+}
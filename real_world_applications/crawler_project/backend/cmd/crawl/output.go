@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"web_crawler/pkg"
+)
+
+// resultWriter writes crawl results in one output format.
+type resultWriter interface {
+	Write(pkg.CrawlResult) error
+	Close() error
+}
+
+func newResultWriter(format string, w io.Writer) (resultWriter, error) {
+	switch strings.ToLower(format) {
+	case "jsonl", "json":
+		return &jsonlWriter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, use jsonl or csv", format)
+}
+
+type jsonlWriter struct {
+	enc *json.Encoder
+}
+
+func (w *jsonlWriter) Write(r pkg.CrawlResult) error {
+	return w.enc.Encode(r)
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+// csvColumns are the columns of the CSV output. Links are reported as a count.
+var csvColumns = []string{
+	"url", "depth", "status_code", "content_type", "title", "description",
+	"keywords", "language", "links", "error", "fetched_at", "duration_ms", "content",
+}
+
+type csvWriter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) Write(r pkg.CrawlResult) error {
+	if !w.headerWritten {
+		if err := w.w.Write(csvColumns); err != nil {
+			return err
+		}
+		w.headerWritten = true
+	}
+	return w.w.Write([]string{
+		r.URL,
+		strconv.Itoa(r.Depth),
+		strconv.Itoa(r.StatusCode),
+		r.ContentType,
+		r.Title,
+		r.Description,
+		strings.Join(r.Keywords, ";"),
+		r.Language,
+		strconv.Itoa(len(r.Links)),
+		r.Error,
+		r.FetchedAt.Format(time.RFC3339),
+		strconv.FormatInt(r.DurationMS, 10),
+		r.Content,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
@@ -0,0 +1,118 @@
+// Command export writes every indexed page matching an optional query to a file.
+//
+// Usage:
+//
+//	export [-config file] [-format jsonl|csv|parquet] [-fields list] [-q query] [-lang code] [-gzip] [-o file]
+//
+// Pages are streamed from Elasticsearch in batches, so exports of any size run in constant
+// memory. Without -o the export is written to standard output.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	"web_crawler/config"
+	"web_crawler/models"
+	"web_crawler/pkg"
+	"web_crawler/utils"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a YAML or JSON config file")
+	format := fs.String("format", "jsonl", "output format: "+strings.Join(pkg.ExportFormats, ", "))
+	fields := fs.String("fields", "", "comma-separated fields to export (default all): "+strings.Join(pkg.ExportFields(), ","))
+	query := fs.String("q", "", "full-text query the pages must match")
+	language := fs.String("lang", "", "only export pages in this language")
+	compress := fs.Bool("gzip", false, "gzip the output")
+	output := fs.String("o", "", "output file (default standard output)")
+	fs.Parse(os.Args[1:])
+
+	opts := pkg.ExportOptions{
+		Format: *format,
+		Gzip:   *compress,
+		Filter: models.PageFilter{Query: *query, Language: strings.ToLower(*language)},
+	}
+	if *fields != "" {
+		opts.Fields = strings.Split(*fields, ",")
+	}
+	exporter, err := pkg.NewExporter(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	lookupEnv := func(key string) (string, bool) {
+		if key == "CRAWLER_CONFIG" && *configFile != "" {
+			return *configFile, true
+		}
+		return os.LookupEnv(key)
+	}
+	settings, err := config.Load(nil, lookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	// Log to standard error so the export can go to standard output.
+	logOutput := settings.Log.Output
+	if logOutput == "stdout" {
+		logOutput = "stderr"
+	}
+	logger, err := utils.NewLogger(utils.LogOptions{
+		Level:      settings.Log.Level,
+		Output:     logOutput,
+		MaxSizeMB:  settings.Log.MaxSizeMB,
+		MaxBackups: settings.Log.MaxBackups,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error initializing logger: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	esClient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{settings.Elasticsearch.Address()}})
+	if err != nil {
+		logger.WithError(err).Fatal("error creating elasticsearch client")
+	}
+	models.NewModels(esClient, nil)
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logger.WithError(err).Fatal("error creating output file")
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriterSize(out, 1<<20)
+
+	start := time.Now()
+	count, err := exporter.Export(ctx, buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	entry := logger.WithFields(logrus.Fields{
+		"pages":       count,
+		"format":      *format,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if err != nil {
+		entry.WithError(err).Error("export failed")
+		os.Exit(1)
+	}
+	entry.Info("export finished")
+}
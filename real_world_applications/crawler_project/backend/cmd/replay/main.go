@@ -0,0 +1,129 @@
+// Command replay re-parses and re-indexes stored raw pages without fetching them again.
+//
+// Usage:
+//
+//	replay [-config file] [-workers n] [-progress file] [-restart] [-dry-run]
+//
+// Raw pages are read from the raw store configured by archive.raw_dir. Progress is
+// checkpointed so an interrupted replay continues where it stopped; -restart discards
+// the checkpoint. With -dry-run nothing is written and the changes re-indexing would
+// make to each page are printed instead.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"web_crawler/config"
+	"web_crawler/models"
+	"web_crawler/pkg"
+	"web_crawler/utils"
+
+	elasticsearch "github.com/elastic/go-elasticsearch/v8"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func main() {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configFile := fs.String("config", "", "path to a YAML or JSON config file")
+	workers := fs.Int("workers", 0, "number of replay workers (default crawler.workers)")
+	progressFile := fs.String("progress", "replay.progress.json", "checkpoint file used to resume")
+	restart := fs.Bool("restart", false, "ignore the checkpoint and replay every page")
+	dryRun := fs.Bool("dry-run", false, "print what would change without indexing")
+	fs.Parse(os.Args[1:])
+
+	lookupEnv := func(key string) (string, bool) {
+		if key == "CRAWLER_CONFIG" && *configFile != "" {
+			return *configFile, true
+		}
+		return os.LookupEnv(key)
+	}
+	settings, err := config.Load(nil, lookupEnv)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	if settings.Archive.RawDir == "" {
+		fmt.Fprintln(os.Stderr, "archive.raw_dir is not set, there are no raw pages to replay")
+		os.Exit(2)
+	}
+	if *workers <= 0 {
+		*workers = settings.Crawler.Workers
+	}
+
+	logger, err := utils.NewLogger(utils.LogOptions{
+		Level:      settings.Log.Level,
+		Output:     settings.Log.Output,
+		MaxSizeMB:  settings.Log.MaxSizeMB,
+		MaxBackups: settings.Log.MaxBackups,
+	})
+	if err != nil {
+		fmt.Printf("Error initializing logger: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	esClient, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{settings.Elasticsearch.Address()}})
+	if err != nil {
+		logger.WithError(err).Fatal("error creating elasticsearch client")
+	}
+	mongoClient, err := mongo.Connect(ctx, options.Client().ApplyURI(settings.Mongo.URI).SetAuth(options.Credential{
+		Username: settings.Mongo.User,
+		Password: settings.Mongo.Password,
+	}))
+	if err != nil {
+		logger.WithError(err).Fatal("error connecting to mongo")
+	}
+	defer mongoClient.Disconnect(context.Background())
+	models.NewModels(esClient, mongoClient)
+
+	store, err := pkg.NewRawStore(settings.Archive.RawDir)
+	if err != nil {
+		logger.WithError(err).Fatal("error opening raw page store")
+	}
+	if *restart && !*dryRun {
+		if err := os.Remove(*progressFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.WithError(err).Fatal("error removing replay progress")
+		}
+	}
+
+	replayer := pkg.NewReplayer(store, *workers)
+	replayer.ProgressFile = *progressFile
+	replayer.DryRun = *dryRun
+	replayer.OnError = func(url string, err error) {
+		logger.WithError(err).WithField("url", url).Error("error replaying page")
+	}
+	pkg.SetPageVersionErrorHandler(func(pageID, url string, err error) {
+		logger.WithError(err).WithFields(logrus.Fields{"page_id": pageID, "url": url}).Error("error saving page version")
+	})
+
+	start := time.Now()
+	stats, err := replayer.Run(ctx)
+	entry := logger.WithFields(logrus.Fields{
+		"processed":   stats.Processed,
+		"indexed":     stats.Indexed,
+		"changed":     stats.Changed,
+		"unchanged":   stats.Unchanged,
+		"skipped":     stats.Skipped,
+		"failed":      stats.Failed,
+		"dry_run":     *dryRun,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	if err != nil {
+		entry.WithError(err).Error("replay stopped")
+		os.Exit(1)
+	}
+	entry.Info("replay finished")
+	if stats.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -1,43 +1,639 @@
-package main
+package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
-// Config struct to hold all application configurations
+// Config holds all application configuration.
+//
+// Values are layered, each source overriding the previous one:
+// 1. Defaults from Default().
+// 2. A YAML or JSON file named by the -config flag or the CRAWLER_CONFIG environment variable.
+// 3. Environment variables.
+// 4. Command line flags.
 type Config struct {
-	ElasticsearchURL string
-	// Add other configuration fields as needed
+	Env           string              `yaml:"env" json:"env"`
+	Server        ServerConfig        `yaml:"server" json:"server"`
+	Elasticsearch ElasticsearchConfig `yaml:"elasticsearch" json:"elasticsearch"`
+	Mongo         MongoConfig         `yaml:"mongo" json:"mongo"`
+	Crawler       CrawlerConfig       `yaml:"crawler" json:"crawler"`
+	Log           LogConfig           `yaml:"log" json:"log"`
+	Mail          MailConfig          `yaml:"mail" json:"mail"`
+	Health        HealthConfig        `yaml:"health" json:"health"`
+	PageRank      PageRankConfig      `yaml:"pagerank" json:"pagerank"`
+	Archive       ArchiveConfig       `yaml:"archive" json:"archive"`
+	Retry         RetryConfig         `yaml:"retry" json:"retry"`
+	Breaker       BreakerConfig       `yaml:"breaker" json:"breaker"`
+	Fetch         FetchConfig         `yaml:"fetch" json:"fetch"`
+	Cluster       ClusterConfig       `yaml:"cluster" json:"cluster"`
+	SavedSearches SavedSearchConfig   `yaml:"saved_searches" json:"saved_searches"`
+	Suggest       SuggestConfig       `yaml:"suggest" json:"suggest"`
+	Events        EventsConfig        `yaml:"events" json:"events"`
+	Audit         AuditConfig         `yaml:"audit" json:"audit"`
 }
 
-// InitializeConfig initializes application configuration from environment variables
-// InitializeConfig initializes application configuration from environment variables
-func InitializeConfig() *Config {
-	appEnv := getEnv("APP_ENV", "dev") // Default to 'dev' if not specified
+// ServerConfig configures the HTTP API.
+type ServerConfig struct {
+	Port int `yaml:"port" json:"port"`
+	// PublicURL is the externally reachable base URL used in links sent to users.
+	PublicURL string `yaml:"public_url" json:"public_url"`
+	// Admins are the IDs of the users allowed to use the admin endpoints, such as the audit log.
+	Admins []string `yaml:"admins" json:"admins"`
+}
 
-	var elasticsearchURL string
+// ElasticsearchConfig configures the page index.
+type ElasticsearchConfig struct {
+	Host string `yaml:"host" json:"host"`
+	Port int    `yaml:"port" json:"port"`
+}
 
-	switch appEnv {
-	case "dev":
-		elasticsearchURL = getEnv("ELASTICSEARCH_URL_DEV", "http://localhost:9200")
-	case "stage":
-		elasticsearchURL = getEnv("ELASTICSEARCH_URL_STAGE", "http://stage-elastic:9200")
-	case "prod":
-		elasticsearchURL = getEnv("ELASTICSEARCH_URL_PROD", "http://prod-elastic:9200")
-	default:
-		elasticsearchURL = getEnv("ELASTICSEARCH_URL", "http://localhost:9200")
+// Address returns the HTTP address of the Elasticsearch node.
+func (c ElasticsearchConfig) Address() string {
+	return fmt.Sprintf("http://%s:%d", c.Host, c.Port)
+}
+
+// MongoConfig configures the user store.
+type MongoConfig struct {
+	URI      string `yaml:"uri" json:"uri"`
+	User     string `yaml:"user" json:"user"`
+	Password string `yaml:"password" json:"password"`
+}
+
+// CrawlerConfig configures the crawl workers.
+type CrawlerConfig struct {
+	Workers   int      `yaml:"workers" json:"workers"`
+	SeedFile  string   `yaml:"seed_file" json:"seed_file"`
+	QueueSize int      `yaml:"queue_size" json:"queue_size"`
+	Timeout   Duration `yaml:"timeout" json:"timeout"`
+}
+
+// LogConfig configures the application logger.
+type LogConfig struct {
+	Level      string `yaml:"level" json:"level"`
+	Output     string `yaml:"output" json:"output"`
+	MaxSizeMB  int    `yaml:"max_size_mb" json:"max_size_mb"`
+	MaxBackups int    `yaml:"max_backups" json:"max_backups"`
+}
+
+// MailConfig configures outgoing email. Mail is written to Dir unless SMTPAddr is set.
+type MailConfig struct {
+	From         string `yaml:"from" json:"from"`
+	Dir          string `yaml:"dir" json:"dir"`
+	SMTPAddr     string `yaml:"smtp_addr" json:"smtp_addr"`
+	SMTPUser     string `yaml:"smtp_user" json:"smtp_user"`
+	SMTPPassword string `yaml:"smtp_password" json:"smtp_password"`
+}
+
+// HealthConfig configures the /healthz and /readyz probes.
+type HealthConfig struct {
+	// Timeout bounds each dependency check.
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+	// FrontierThreshold is the number of queued URLs above which the service is not ready.
+	// It must be less than crawler.queue_size.
+	FrontierThreshold int `yaml:"frontier_threshold" json:"frontier_threshold"`
+	// IndexerThreshold is the number of pending index writes above which the service is not ready.
+	IndexerThreshold int `yaml:"indexer_threshold" json:"indexer_threshold"`
+}
+
+// PageRankConfig configures the periodic PageRank job over the link graph.
+type PageRankConfig struct {
+	Interval   Duration `yaml:"interval" json:"interval"`
+	Damping    float64  `yaml:"damping" json:"damping"`
+	Iterations int      `yaml:"iterations" json:"iterations"`
+	Workers    int      `yaml:"workers" json:"workers"`
+}
+
+// ArchiveConfig configures what is kept of fetched pages: a WARC archive in Dir and
+// content-addressed raw bodies for replay in RawDir. Each is off when its directory is empty.
+type ArchiveConfig struct {
+	Dir string `yaml:"dir" json:"dir"`
+	// MaxSizeMB is the compressed size at which a WARC file is closed and a new one started.
+	MaxSizeMB int    `yaml:"max_size_mb" json:"max_size_mb"`
+	RawDir    string `yaml:"raw_dir" json:"raw_dir"`
+}
+
+// RetryConfig configures retries of transient fetch failures.
+type RetryConfig struct {
+	MaxAttempts int      `yaml:"max_attempts" json:"max_attempts"`
+	BaseDelay   Duration `yaml:"base_delay" json:"base_delay"`
+	MaxDelay    Duration `yaml:"max_delay" json:"max_delay"`
+	Jitter      float64  `yaml:"jitter" json:"jitter"`
+}
+
+// BreakerConfig configures the per-host circuit breakers around the fetcher.
+type BreakerConfig struct {
+	ConsecutiveFailures int     `yaml:"consecutive_failures" json:"consecutive_failures"`
+	FailureRate         float64 `yaml:"failure_rate" json:"failure_rate"`
+	Window              int     `yaml:"window" json:"window"`
+	MinRequests         int     `yaml:"min_requests" json:"min_requests"`
+	// OpenTimeout is how long a host is skipped after its breaker trips.
+	OpenTimeout    Duration `yaml:"open_timeout" json:"open_timeout"`
+	HalfOpenProbes int      `yaml:"half_open_probes" json:"half_open_probes"`
+	// MaxParked is how many URLs of a host with an open breaker wait for it. Further URLs
+	// are dead-lettered.
+	MaxParked int `yaml:"max_parked" json:"max_parked"`
+}
+
+// FetchConfig limits what a single fetch may cost and which addresses it may reach.
+type FetchConfig struct {
+	ConnectTimeout Duration `yaml:"connect_timeout" json:"connect_timeout"`
+	HeaderTimeout  Duration `yaml:"header_timeout" json:"header_timeout"`
+	TotalTimeout   Duration `yaml:"total_timeout" json:"total_timeout"`
+	MaxBodySizeMB  int      `yaml:"max_body_size_mb" json:"max_body_size_mb"`
+	MaxRedirects   int      `yaml:"max_redirects" json:"max_redirects"`
+	// AllowedContentTypes lists media type patterns to download. Empty means every type
+	// the extractors support.
+	AllowedContentTypes []string `yaml:"allowed_content_types" json:"allowed_content_types"`
+	// AllowPrivateNetworks turns off the guard against loopback, private and link-local
+	// addresses. AllowedNetworks opens individual CIDR ranges instead.
+	AllowPrivateNetworks bool     `yaml:"allow_private_networks" json:"allow_private_networks"`
+	AllowedNetworks      []string `yaml:"allowed_networks" json:"allowed_networks"`
+}
+
+// Networks parses AllowedNetworks. Entries that do not parse are skipped; Validate reports them.
+func (f FetchConfig) Networks() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, n := range f.AllowedNetworks {
+		if prefix, err := netip.ParsePrefix(n); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// ClusterConfig lets several crawler processes split the hosts between them. The node
+// crawls alone when Self is empty.
+type ClusterConfig struct {
+	// Self is the base URL the other nodes reach this node's API at.
+	Self  string   `yaml:"self" json:"self"`
+	Seeds []string `yaml:"seeds" json:"seeds"`
+	// Secret authenticates the requests between nodes and must be the same on all of them.
+	Secret            string   `yaml:"secret" json:"secret"`
+	Replicas          int      `yaml:"replicas" json:"replicas"`
+	HeartbeatInterval Duration `yaml:"heartbeat_interval" json:"heartbeat_interval"`
+	FailureThreshold  int      `yaml:"failure_threshold" json:"failure_threshold"`
+}
+
+// SavedSearchConfig configures the background runner of saved searches.
+type SavedSearchConfig struct {
+	// PollInterval is how often the runner looks for saved searches that are due.
+	PollInterval Duration `yaml:"poll_interval" json:"poll_interval"`
+	// MinSchedule is the shortest schedule a user may give a saved search.
+	MinSchedule Duration `yaml:"min_schedule" json:"min_schedule"`
+}
+
+// SuggestConfig configures search suggestions.
+type SuggestConfig struct {
+	// Budget is how long a suggestion lookup may take before an empty answer is returned.
+	Budget Duration `yaml:"budget" json:"budget"`
+	// CacheTTL is how long suggestions for a query are reused. Zero disables the cache.
+	CacheTTL  Duration `yaml:"cache_ttl" json:"cache_ttl"`
+	CacheSize int      `yaml:"cache_size" json:"cache_size"`
+}
+
+// EventsConfig configures the crawl lifecycle events and their webhooks. Deliveries are
+// retried with the delays of the retry section.
+type EventsConfig struct {
+	// History is how many of the latest events are kept for clients resuming a stream.
+	History            int      `yaml:"history" json:"history"`
+	WebhookMaxAttempts int      `yaml:"webhook_max_attempts" json:"webhook_max_attempts"`
+	WebhookTimeout     Duration `yaml:"webhook_timeout" json:"webhook_timeout"`
+	// WebhookQueueSize is how many events may wait for one webhook before new ones are dropped.
+	WebhookQueueSize int `yaml:"webhook_queue_size" json:"webhook_queue_size"`
+}
+
+// AuditConfig configures the audit log. Failed writes are retried with the delays of the
+// retry section.
+type AuditConfig struct {
+	// Buffer is how many entries may wait to be written before requests wait for them.
+	Buffer        int      `yaml:"buffer" json:"buffer"`
+	BatchSize     int      `yaml:"batch_size" json:"batch_size"`
+	FlushInterval Duration `yaml:"flush_interval" json:"flush_interval"`
+}
+
+// Duration is a time.Duration that reads and writes strings such as "30s" or "5m".
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration string.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
 	}
+	d.Duration = parsed
+	return nil
+}
 
+// MarshalText formats the duration as a string.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Default returns the configuration used when no other source sets a value.
+func Default() *Config {
 	return &Config{
-		ElasticsearchURL: elasticsearchURL,
-		// Initialize other configurations here based on appEnv if needed
+		Env: "dev",
+		Server: ServerConfig{
+			Port:      8081,
+			PublicURL: "http://localhost:8081",
+		},
+		Elasticsearch: ElasticsearchConfig{
+			Host: "localhost",
+			Port: 9200,
+		},
+		Mongo: MongoConfig{
+			URI: "mongodb://localhost:27017",
+		},
+		Crawler: CrawlerConfig{
+			Workers:   10,
+			SeedFile:  "/app/Seed.txt",
+			QueueSize: 5000,
+			Timeout:   Duration{30 * time.Minute},
+		},
+		Log: LogConfig{
+			Level:      "info",
+			Output:     "stdout",
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+		},
+		Mail: MailConfig{
+			From: "crawler@localhost",
+			Dir:  "/app/mail",
+		},
+		Health: HealthConfig{
+			Timeout:           Duration{2 * time.Second},
+			FrontierThreshold: 4500,
+			IndexerThreshold:  8,
+		},
+		PageRank: PageRankConfig{
+			Interval:   Duration{time.Hour},
+			Damping:    0.85,
+			Iterations: 50,
+			Workers:    4,
+		},
+		Archive: ArchiveConfig{
+			MaxSizeMB: 1024,
+		},
+		Retry: RetryConfig{
+			MaxAttempts: 4,
+			BaseDelay:   Duration{time.Second},
+			MaxDelay:    Duration{30 * time.Second},
+			Jitter:      0.5,
+		},
+		Breaker: BreakerConfig{
+			ConsecutiveFailures: 5,
+			FailureRate:         0.5,
+			Window:              20,
+			MinRequests:         10,
+			OpenTimeout:         Duration{30 * time.Second},
+			HalfOpenProbes:      1,
+			MaxParked:           1000,
+		},
+		Fetch: FetchConfig{
+			ConnectTimeout: Duration{10 * time.Second},
+			HeaderTimeout:  Duration{15 * time.Second},
+			TotalTimeout:   Duration{60 * time.Second},
+			MaxBodySizeMB:  32,
+			MaxRedirects:   10,
+		},
+		Cluster: ClusterConfig{
+			Replicas:          128,
+			HeartbeatInterval: Duration{2 * time.Second},
+			FailureThreshold:  3,
+		},
+		SavedSearches: SavedSearchConfig{
+			PollInterval: Duration{time.Minute},
+			MinSchedule:  Duration{5 * time.Minute},
+		},
+		Suggest: SuggestConfig{
+			Budget:    Duration{200 * time.Millisecond},
+			CacheTTL:  Duration{30 * time.Second},
+			CacheSize: 1000,
+		},
+		Events: EventsConfig{
+			History:            1000,
+			WebhookMaxAttempts: 5,
+			WebhookTimeout:     Duration{10 * time.Second},
+			WebhookQueueSize:   1000,
+		},
+		Audit: AuditConfig{
+			Buffer:        1000,
+			BatchSize:     100,
+			FlushInterval: Duration{time.Second},
+		},
 	}
 }
 
-// getEnv is a helper function to read an environment variable or return a default value
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// Load builds the configuration from defaults, an optional file, the environment and args.
+//
+// Parameters:
+// - args: Command line arguments without the program name.
+// - lookupEnv: Function used to read environment variables, usually os.LookupEnv.
+//
+// Returns:
+// - The validated configuration.
+// - An error listing every problem found, joined with errors.Join.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("crawler", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a YAML or JSON config file")
+	fs.String("env", "", "environment name (dev, stage, prod)")
+	fs.Int("port", 0, "HTTP port of the API")
+	fs.Int("workers", 0, "number of crawl workers")
+	fs.String("seed-file", "", "file with one seed URL per line")
+	fs.Duration("crawl-timeout", 0, "how long the crawl runs before stopping")
+	fs.String("log-level", "", "log level (debug, info, warn, error)")
+	fs.String("log-output", "", "stdout, stderr or a log file path")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CRAWLER_CONFIG")
 	}
-	return defaultValue
+	// A file that cannot be fully read still contributes what was decoded, so its
+	// problems are reported together with those of the other sources.
+	var errs []error
+	if path != "" {
+		errs = append(errs, loadFile(cfg, path)...)
+	}
+	errs = append(errs, applyEnv(cfg, lookupEnv)...)
+	applyFlags(cfg, fs)
+	errs = append(errs, cfg.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile merges a YAML or JSON file into cfg. The format is chosen by the file extension.
+// Every unknown field and mistyped value of a YAML file is reported; JSON decoding and
+// YAML syntax errors stop at the first problem.
+func loadFile(cfg *Config, path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("error reading config file: %v", err)}
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			errs := make([]error, len(typeErr.Errors))
+			for i, msg := range typeErr.Errors {
+				errs[i] = fmt.Errorf("error parsing config file %s: %s", path, msg)
+			}
+			return errs
+		}
+	default:
+		return []error{fmt.Errorf("unsupported config file type %q, use .yaml, .yml or .json", filepath.Ext(path))}
+	}
+	if err != nil {
+		return []error{fmt.Errorf("error parsing config file %s: %v", path, err)}
+	}
+	return nil
+}
+
+// applyEnv overrides cfg with any environment variables that are set.
+func applyEnv(cfg *Config, lookupEnv func(string) (string, bool)) []error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v, ok := lookupEnv(key); ok {
+			*dst = v
+		}
+	}
+	num := func(key string, dst *int) {
+		if v, ok := lookupEnv(key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not an integer", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v, ok := lookupEnv(key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	list := func(key string, dst *[]string) {
+		if v, ok := lookupEnv(key); ok {
+			*dst = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	dur := func(key string, dst *Duration) {
+		if v, ok := lookupEnv(key); ok {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration", key, v))
+			}
+		}
+	}
+
+	str("APP_ENV", &cfg.Env)
+	num("CRAWLER_PORT", &cfg.Server.Port)
+	str("APP_BASE_URL", &cfg.Server.PublicURL)
+	list("ADMIN_USERS", &cfg.Server.Admins)
+	str("ELASTICSEARCH_HOST", &cfg.Elasticsearch.Host)
+	num("ELASTICSEARCH_PORT", &cfg.Elasticsearch.Port)
+	str("MONGOURL", &cfg.Mongo.URI)
+	str("MONGOUSER", &cfg.Mongo.User)
+	str("MONGOPASSWORD", &cfg.Mongo.Password)
+	num("CRAWLER_WORKERS", &cfg.Crawler.Workers)
+	str("CRAWLER_SEED_FILE", &cfg.Crawler.SeedFile)
+	num("CRAWLER_QUEUE_SIZE", &cfg.Crawler.QueueSize)
+	dur("CRAWLER_TIMEOUT", &cfg.Crawler.Timeout)
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_OUTPUT", &cfg.Log.Output)
+	num("LOG_MAX_SIZE_MB", &cfg.Log.MaxSizeMB)
+	num("LOG_MAX_BACKUPS", &cfg.Log.MaxBackups)
+	str("MAIL_FROM", &cfg.Mail.From)
+	str("MAIL_DIR", &cfg.Mail.Dir)
+	str("SMTP_ADDR", &cfg.Mail.SMTPAddr)
+	str("SMTP_USER", &cfg.Mail.SMTPUser)
+	str("SMTP_PASSWORD", &cfg.Mail.SMTPPassword)
+	dur("HEALTH_TIMEOUT", &cfg.Health.Timeout)
+	num("HEALTH_FRONTIER_THRESHOLD", &cfg.Health.FrontierThreshold)
+	num("HEALTH_INDEXER_THRESHOLD", &cfg.Health.IndexerThreshold)
+	dur("PAGERANK_INTERVAL", &cfg.PageRank.Interval)
+	num("PAGERANK_WORKERS", &cfg.PageRank.Workers)
+	str("ARCHIVE_DIR", &cfg.Archive.Dir)
+	num("ARCHIVE_MAX_SIZE_MB", &cfg.Archive.MaxSizeMB)
+	str("ARCHIVE_RAW_DIR", &cfg.Archive.RawDir)
+	num("RETRY_MAX_ATTEMPTS", &cfg.Retry.MaxAttempts)
+	dur("RETRY_BASE_DELAY", &cfg.Retry.BaseDelay)
+	dur("RETRY_MAX_DELAY", &cfg.Retry.MaxDelay)
+	num("BREAKER_CONSECUTIVE_FAILURES", &cfg.Breaker.ConsecutiveFailures)
+	num("BREAKER_WINDOW", &cfg.Breaker.Window)
+	num("BREAKER_MIN_REQUESTS", &cfg.Breaker.MinRequests)
+	dur("BREAKER_OPEN_TIMEOUT", &cfg.Breaker.OpenTimeout)
+	num("BREAKER_MAX_PARKED", &cfg.Breaker.MaxParked)
+	dur("FETCH_CONNECT_TIMEOUT", &cfg.Fetch.ConnectTimeout)
+	dur("FETCH_HEADER_TIMEOUT", &cfg.Fetch.HeaderTimeout)
+	dur("FETCH_TOTAL_TIMEOUT", &cfg.Fetch.TotalTimeout)
+	num("FETCH_MAX_BODY_SIZE_MB", &cfg.Fetch.MaxBodySizeMB)
+	num("FETCH_MAX_REDIRECTS", &cfg.Fetch.MaxRedirects)
+	list("FETCH_ALLOWED_CONTENT_TYPES", &cfg.Fetch.AllowedContentTypes)
+	boolean("FETCH_ALLOW_PRIVATE_NETWORKS", &cfg.Fetch.AllowPrivateNetworks)
+	list("FETCH_ALLOWED_NETWORKS", &cfg.Fetch.AllowedNetworks)
+	str("CLUSTER_SELF", &cfg.Cluster.Self)
+	list("CLUSTER_SEEDS", &cfg.Cluster.Seeds)
+	str("CLUSTER_SECRET", &cfg.Cluster.Secret)
+	dur("CLUSTER_HEARTBEAT_INTERVAL", &cfg.Cluster.HeartbeatInterval)
+	dur("SAVED_SEARCH_POLL_INTERVAL", &cfg.SavedSearches.PollInterval)
+	dur("SAVED_SEARCH_MIN_SCHEDULE", &cfg.SavedSearches.MinSchedule)
+	dur("SUGGEST_BUDGET", &cfg.Suggest.Budget)
+	dur("SUGGEST_CACHE_TTL", &cfg.Suggest.CacheTTL)
+	num("SUGGEST_CACHE_SIZE", &cfg.Suggest.CacheSize)
+	num("EVENTS_HISTORY", &cfg.Events.History)
+	num("EVENT_WEBHOOK_MAX_ATTEMPTS", &cfg.Events.WebhookMaxAttempts)
+	dur("EVENT_WEBHOOK_TIMEOUT", &cfg.Events.WebhookTimeout)
+	num("EVENT_WEBHOOK_QUEUE_SIZE", &cfg.Events.WebhookQueueSize)
+	num("AUDIT_BUFFER", &cfg.Audit.Buffer)
+	num("AUDIT_BATCH_SIZE", &cfg.Audit.BatchSize)
+	dur("AUDIT_FLUSH_INTERVAL", &cfg.Audit.FlushInterval)
+	return errs
+}
+
+// applyFlags overrides cfg with the flags that were explicitly passed.
+func applyFlags(cfg *Config, fs *flag.FlagSet) {
+	fs.Visit(func(f *flag.Flag) {
+		getter := f.Value.(flag.Getter)
+		switch f.Name {
+		case "env":
+			cfg.Env = getter.Get().(string)
+		case "port":
+			cfg.Server.Port = getter.Get().(int)
+		case "workers":
+			cfg.Crawler.Workers = getter.Get().(int)
+		case "seed-file":
+			cfg.Crawler.SeedFile = getter.Get().(string)
+		case "crawl-timeout":
+			cfg.Crawler.Timeout = Duration{getter.Get().(time.Duration)}
+		case "log-level":
+			cfg.Log.Level = getter.Get().(string)
+		case "log-output":
+			cfg.Log.Output = getter.Get().(string)
+		}
+	})
+}
+
+// Validate checks the whole configuration and reports every problem at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == "dev" || c.Env == "stage" || c.Env == "prod", "env: %q must be dev, stage or prod", c.Env)
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port: %d is out of range", c.Server.Port)
+	if u, err := url.Parse(c.Server.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("server.public_url: %q must be an absolute URL", c.Server.PublicURL))
+	}
+	check(c.Elasticsearch.Host != "", "elasticsearch.host: must be set")
+	check(c.Elasticsearch.Port > 0 && c.Elasticsearch.Port < 65536, "elasticsearch.port: %d is out of range", c.Elasticsearch.Port)
+	check(c.Mongo.URI != "", "mongo.uri: must be set")
+	check(c.Mongo.User != "", "mongo.user: must be set")
+	check(c.Mongo.Password != "", "mongo.password: must be set")
+	check(c.Crawler.Workers > 0, "crawler.workers: must be at least 1, got %d", c.Crawler.Workers)
+	check(c.Crawler.QueueSize > 0, "crawler.queue_size: must be at least 1, got %d", c.Crawler.QueueSize)
+	check(c.Crawler.Timeout.Duration > 0, "crawler.timeout: must be positive")
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %q is not a valid level", c.Log.Level))
+	}
+	check(c.Log.MaxSizeMB >= 0, "log.max_size_mb: must not be negative")
+	check(c.Log.MaxBackups >= 0, "log.max_backups: must not be negative")
+	check(c.Mail.From != "", "mail.from: must be set")
+	check(c.Mail.SMTPAddr != "" || c.Mail.Dir != "", "mail: either smtp_addr or dir must be set")
+	check(c.Health.Timeout.Duration > 0, "health.timeout: must be positive")
+	check(c.Health.FrontierThreshold > 0, "health.frontier_threshold: must be at least 1, got %d", c.Health.FrontierThreshold)
+	// The frontier never holds more than queue_size URLs, so a threshold at or above it never trips.
+	check(c.Health.FrontierThreshold < c.Crawler.QueueSize, "health.frontier_threshold: %d must be less than crawler.queue_size %d", c.Health.FrontierThreshold, c.Crawler.QueueSize)
+	check(c.Health.IndexerThreshold > 0, "health.indexer_threshold: must be at least 1, got %d", c.Health.IndexerThreshold)
+	check(c.PageRank.Interval.Duration > 0, "pagerank.interval: must be positive")
+	check(c.PageRank.Damping > 0 && c.PageRank.Damping < 1, "pagerank.damping: %v must be between 0 and 1", c.PageRank.Damping)
+	check(c.PageRank.Iterations > 0, "pagerank.iterations: must be at least 1, got %d", c.PageRank.Iterations)
+	check(c.PageRank.Workers > 0, "pagerank.workers: must be at least 1, got %d", c.PageRank.Workers)
+	check(c.Archive.Dir == "" || c.Archive.MaxSizeMB > 0, "archive.max_size_mb: must be at least 1, got %d", c.Archive.MaxSizeMB)
+	check(c.Retry.MaxAttempts > 0, "retry.max_attempts: must be at least 1, got %d", c.Retry.MaxAttempts)
+	check(c.Retry.BaseDelay.Duration > 0, "retry.base_delay: must be positive")
+	check(c.Retry.MaxDelay.Duration >= c.Retry.BaseDelay.Duration, "retry.max_delay: must not be less than retry.base_delay")
+	check(c.Retry.Jitter >= 0 && c.Retry.Jitter <= 1, "retry.jitter: %v must be between 0 and 1", c.Retry.Jitter)
+	check(c.Breaker.ConsecutiveFailures >= 0, "breaker.consecutive_failures: must not be negative, got %d", c.Breaker.ConsecutiveFailures)
+	check(c.Breaker.FailureRate >= 0 && c.Breaker.FailureRate <= 1, "breaker.failure_rate: %v must be between 0 and 1", c.Breaker.FailureRate)
+	check(c.Breaker.Window > 0, "breaker.window: must be at least 1, got %d", c.Breaker.Window)
+	check(c.Breaker.MinRequests <= c.Breaker.Window, "breaker.min_requests: %d must not exceed breaker.window", c.Breaker.MinRequests)
+	check(c.Breaker.OpenTimeout.Duration > 0, "breaker.open_timeout: must be positive")
+	check(c.Breaker.HalfOpenProbes > 0, "breaker.half_open_probes: must be at least 1, got %d", c.Breaker.HalfOpenProbes)
+	check(c.Breaker.MaxParked > 0, "breaker.max_parked: must be at least 1, got %d", c.Breaker.MaxParked)
+	check(c.Fetch.ConnectTimeout.Duration > 0, "fetch.connect_timeout: must be positive")
+	check(c.Fetch.HeaderTimeout.Duration > 0, "fetch.header_timeout: must be positive")
+	check(c.Fetch.TotalTimeout.Duration >= c.Fetch.HeaderTimeout.Duration, "fetch.total_timeout: must not be less than fetch.header_timeout")
+	check(c.Fetch.MaxBodySizeMB > 0, "fetch.max_body_size_mb: must be at least 1, got %d", c.Fetch.MaxBodySizeMB)
+	check(c.Fetch.MaxRedirects >= 0, "fetch.max_redirects: must not be negative, got %d", c.Fetch.MaxRedirects)
+	for _, n := range c.Fetch.AllowedNetworks {
+		_, err := netip.ParsePrefix(n)
+		check(err == nil, "fetch.allowed_networks: %q is not a CIDR range", n)
+	}
+	if c.Cluster.Self != "" {
+		for _, node := range append([]string{c.Cluster.Self}, c.Cluster.Seeds...) {
+			u, err := url.Parse(node)
+			check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+				"cluster: %q is not an http or https base URL", node)
+		}
+		check(c.Cluster.Secret != "", "cluster.secret: must be set when cluster.self is")
+		check(c.Cluster.Replicas > 0, "cluster.replicas: must be at least 1, got %d", c.Cluster.Replicas)
+		check(c.Cluster.HeartbeatInterval.Duration > 0, "cluster.heartbeat_interval: must be positive")
+		check(c.Cluster.FailureThreshold > 0, "cluster.failure_threshold: must be at least 1, got %d", c.Cluster.FailureThreshold)
+	}
+	check(c.SavedSearches.PollInterval.Duration > 0, "saved_searches.poll_interval: must be positive")
+	check(c.SavedSearches.MinSchedule.Duration > 0, "saved_searches.min_schedule: must be positive")
+	check(c.Suggest.Budget.Duration > 0, "suggest.budget: must be positive")
+	check(c.Suggest.CacheTTL.Duration >= 0, "suggest.cache_ttl: must not be negative")
+	check(c.Suggest.CacheSize >= 0, "suggest.cache_size: must not be negative, got %d", c.Suggest.CacheSize)
+	check(c.Events.History >= 0, "events.history: must not be negative, got %d", c.Events.History)
+	check(c.Events.WebhookMaxAttempts > 0, "events.webhook_max_attempts: must be at least 1, got %d", c.Events.WebhookMaxAttempts)
+	check(c.Events.WebhookTimeout.Duration > 0, "events.webhook_timeout: must be positive")
+	check(c.Events.WebhookQueueSize > 0, "events.webhook_queue_size: must be at least 1, got %d", c.Events.WebhookQueueSize)
+	check(c.Audit.Buffer >= 0, "audit.buffer: must not be negative, got %d", c.Audit.Buffer)
+	check(c.Audit.BatchSize > 0, "audit.batch_size: must be at least 1, got %d", c.Audit.BatchSize)
+	check(c.Audit.FlushInterval.Duration > 0, "audit.flush_interval: must be positive")
+
+	return errors.Join(errs...)
 }
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"web_crawler/models"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const auditKey = "audit"
+
+// auditDetails is what a handler tells the audit log about its request.
+type auditDetails struct {
+	action  string
+	target  string
+	changes []string
+}
+
+// SetAudit describes the request being handled for the audit log: the action taken, its
+// target and how the target changed. Requests whose handler does not call it are recorded
+// with their method and route as the action.
+func SetAudit(c echo.Context, action, target string, changes []string) {
+	c.Set(auditKey, auditDetails{action: action, target: target, changes: changes})
+}
+
+// AuditLog creates a middleware that records every request that may change state, that is
+// every method but GET, HEAD and OPTIONS, through record once the handler returns.
+//
+// Parameters:
+// - record: Queues an entry for the audit log, e.g. pkg.AuditWriter.Record.
+// - skip: Optionally excludes requests, such as internal traffic between nodes.
+//
+// Returns:
+//   - An Echo middleware function. It must run inside RequestLogger to record request IDs.
+//
+// Rejected requests, such as those without a valid token, are recorded too.
+func AuditLog(record func(models.AuditEntry) error, skip func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			method := c.Request().Method
+			if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions ||
+				(skip != nil && skip(c)) {
+				return next(c)
+			}
+			start := time.Now()
+			err := next(c)
+
+			// An error is written by RequestLogger after this returns, so take its status.
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				var httpErr *echo.HTTPError
+				if errors.As(err, &httpErr) {
+					status = httpErr.Code
+				}
+			}
+			entry := models.AuditEntry{
+				ID:     primitive.NewObjectID(),
+				Action: strings.ToLower(method) + " " + c.Path(),
+				Time:   start,
+				Method: method,
+				Path:   c.Request().URL.Path,
+				Status: status,
+				IP:     c.RealIP(),
+			}
+			entry.ActorID, _ = c.Get("userID").(string)
+			entry.RequestID, _ = c.Get(requestIDKey).(string)
+			if details, ok := c.Get(auditKey).(auditDetails); ok {
+				entry.Action, entry.Target, entry.Changes = details.action, details.target, details.changes
+			}
+			if recordErr := record(entry); recordErr != nil {
+				Logger(c).WithError(recordErr).WithField("action", entry.Action).Error("error recording audit entry")
+			}
+			return err
+		}
+	}
+}
+
+// AdminOnly creates a middleware that only lets the given users through. It must run after
+// JWTAuthMiddleware; everyone else is refused with 403 Forbidden.
+func AdminOnly(admins []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, _ := c.Get("userID").(string)
+			if userID == "" || !slices.Contains(admins, userID) {
+				return echo.NewHTTPError(http.StatusForbidden, "admin access required")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+
+	"web_crawler/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RequestIDHeader is the header used to read and echo the request ID.
+	RequestIDHeader = "X-Request-ID"
+
+	requestIDKey = "requestID"
+	loggerKey    = "logger"
+)
+
+// validRequestID limits client supplied request IDs to something safe to log and echo back.
+var validRequestID = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+// RequestLogger creates a middleware that tags every request with an ID and a request-scoped logger.
+//
+// Parameters:
+// - logger: The application logger the request-scoped loggers are derived from.
+//
+// Returns:
+//   - An Echo middleware function.
+//
+// The middleware performs the following steps:
+// 1. Reuses a well formed X-Request-ID header from the client or generates a new ID, and echoes it in the response.
+// 2. Stores a *logrus.Entry carrying request_id, method and route in the context, retrievable with Logger(c).
+// 3. Writes one access log entry per request with the response status and latency once the handler returns.
+func RequestLogger(logger *logrus.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			requestID := c.Request().Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(requestID) {
+				requestID = utils.NewID()
+			}
+			c.Set(requestIDKey, requestID)
+			c.Response().Header().Set(RequestIDHeader, requestID)
+
+			entry := logger.WithFields(logrus.Fields{
+				"request_id": requestID,
+				"method":     c.Request().Method,
+				"route":      c.Path(),
+			})
+			c.Set(loggerKey, entry)
+
+			err := next(c)
+			if err != nil {
+				// Let Echo write the error response so the logged status matches what the client sees.
+				c.Error(err)
+			}
+
+			fields := logrus.Fields{
+				"status":     c.Response().Status,
+				"latency_ms": time.Since(start).Milliseconds(),
+				"remote_ip":  c.RealIP(),
+			}
+			access := Logger(c).WithFields(fields)
+			switch {
+			case c.Response().Status >= 500:
+				access.Error("request completed")
+			case c.Response().Status >= 400:
+				access.Warn("request completed")
+			default:
+				access.Info("request completed")
+			}
+			return nil
+		}
+	}
+}
+
+// Logger returns the request-scoped logger stored by RequestLogger.
+// If the request passed JWTAuthMiddleware the entry also carries user_id.
+// Outside of RequestLogger it falls back to the standard logrus logger.
+func Logger(c echo.Context) *logrus.Entry {
+	if entry, ok := c.Get(loggerKey).(*logrus.Entry); ok {
+		return entry
+	}
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// RequestID returns the ID assigned to the request by RequestLogger.
+func RequestID(c echo.Context) string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
@@ -78,6 +78,8 @@ func JWTAuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 			// Add the user ID to the Echo context for use in downstream handlers.
 			c.Set("userID", userID)
+			// Tag the request-scoped logger with the authenticated user.
+			c.Set(loggerKey, Logger(c).WithField("user_id", userID))
 			// Call the next handler in the middleware chain.
 			return next(c)
 		} else {
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditEntry records one mutating API request: who made it, what it changed and how it
+// ended. The audit log is append-only; nothing in the API updates or deletes entries.
+type AuditEntry struct {
+	// ID is assigned before the entry is written, so writing it again after a failure
+	// cannot store it twice.
+	ID primitive.ObjectID `bson:"_id" json:"id"`
+	// ActorID is the authenticated user, or empty for anonymous requests such as signups.
+	ActorID string    `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	Action  string    `bson:"action" json:"action"` // e.g. "page.update"
+	Target  string    `bson:"target,omitempty" json:"target,omitempty"`
+	Time    time.Time `bson:"time" json:"time"`
+	// Changes describes the target before and after the request, one line per field.
+	Changes   []string `bson:"changes,omitempty" json:"changes,omitempty"`
+	Method    string   `bson:"method" json:"method"`
+	Path      string   `bson:"path" json:"path"`
+	Status    int      `bson:"status" json:"status"`
+	IP        string   `bson:"ip" json:"ip"`
+	RequestID string   `bson:"request_id,omitempty" json:"request_id,omitempty"`
+}
+
+// AuditFilter selects audit entries. Empty fields match every entry.
+type AuditFilter struct {
+	ActorID string
+	Action  string
+	Target  string
+	Since   time.Time
+	Until   time.Time
+}
+
+func auditLog() *mongo.Collection {
+	return client.Database("crawler").Collection("audit_log")
+}
+
+// EnsureAuditIndexes creates the indexes used to page through the audit log by time, actor,
+// action and target.
+func EnsureAuditIndexes(ctx context.Context) error {
+	_, err := auditLog().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating audit log indexes: %v", err)
+	}
+	return nil
+}
+
+// InsertAuditEntries appends entries to the audit log. Entries that were already written
+// by an earlier attempt are skipped.
+func InsertAuditEntries(ctx context.Context, entries []AuditEntry) error {
+	docs := make([]interface{}, len(entries))
+	for i, e := range entries {
+		docs[i] = e
+	}
+	_, err := auditLog().InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicateKeys(err) {
+		return fmt.Errorf("error while writing audit entries: %v", err)
+	}
+	return nil
+}
+
+// onlyDuplicateKeys reports whether every write error of a bulk insert is a duplicate key.
+func onlyDuplicateKeys(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil || len(bulkErr.WriteErrors) == 0 {
+		return false
+	}
+	for _, we := range bulkErr.WriteErrors {
+		if we.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+func auditFilter(f AuditFilter) bson.M {
+	filter := bson.M{}
+	if f.ActorID != "" {
+		filter["actor_id"] = f.ActorID
+	}
+	if f.Action != "" {
+		filter["action"] = f.Action
+	}
+	if f.Target != "" {
+		filter["target"] = f.Target
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		between := bson.M{}
+		if !f.Since.IsZero() {
+			between["$gte"] = f.Since
+		}
+		if !f.Until.IsZero() {
+			between["$lt"] = f.Until
+		}
+		filter["time"] = between
+	}
+	return filter
+}
+
+// ListAuditEntries returns a page of the audit entries matching f, newest first, and the
+// total number of matching entries.
+func ListAuditEntries(ctx context.Context, f AuditFilter, limit, offset int64) ([]AuditEntry, int64, error) {
+	filter := auditFilter(f)
+	total, err := auditLog().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while counting audit entries: %v", err)
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := auditLog().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while finding audit entries: %v", err)
+	}
+	entries := []AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, fmt.Errorf("error while reading audit entries: %v", err)
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeadLetter is a URL whose fetch failed permanently, either with a non-transient error
+// or after exhausting its retries. Repeated failures of the same URL update one record.
+type DeadLetter struct {
+	URL           string    `bson:"url" json:"url"`
+	Class         string    `bson:"class" json:"class"`
+	StatusCode    int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error         string    `bson:"error" json:"error"`
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	Failures      int       `bson:"failures" json:"failures"`
+	FirstFailedAt time.Time `bson:"first_failed_at" json:"first_failed_at"`
+	LastFailedAt  time.Time `bson:"last_failed_at" json:"last_failed_at"`
+}
+
+func deadLetters() *mongo.Collection {
+	return client.Database("crawler").Collection("dead_letters")
+}
+
+// EnsureDeadLetterIndexes creates the unique URL index and the index used to list by class.
+func EnsureDeadLetterIndexes(ctx context.Context) error {
+	_, err := deadLetters().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "url", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "class", Value: 1}, {Key: "last_failed_at", Value: -1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating dead letter indexes: %v", err)
+	}
+	return nil
+}
+
+// RecordDeadLetter stores a permanent failure, counting repeated failures of the same URL.
+func RecordDeadLetter(ctx context.Context, dl DeadLetter) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"class":          dl.Class,
+			"status_code":    dl.StatusCode,
+			"error":          dl.Error,
+			"attempts":       dl.Attempts,
+			"last_failed_at": now,
+		},
+		"$inc":         bson.M{"failures": 1},
+		"$setOnInsert": bson.M{"first_failed_at": now},
+	}
+	_, err := deadLetters().UpdateOne(ctx, bson.M{"url": dl.URL}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error while recording dead letter: %v", err)
+	}
+	return nil
+}
+
+// deadLetterFilter selects every dead letter, or those of one class.
+func deadLetterFilter(class string) bson.M {
+	if class == "" {
+		return bson.M{}
+	}
+	return bson.M{"class": class}
+}
+
+// ListDeadLetters returns dead letters, most recent failure first, optionally of one class,
+// along with the total number matching.
+func ListDeadLetters(ctx context.Context, class string, limit, offset int64) ([]DeadLetter, int64, error) {
+	filter := deadLetterFilter(class)
+	total, err := deadLetters().CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while counting dead letters: %v", err)
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "last_failed_at", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := deadLetters().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error while finding dead letters: %v", err)
+	}
+	letters := []DeadLetter{}
+	if err := cursor.All(ctx, &letters); err != nil {
+		return nil, 0, fmt.Errorf("error while reading dead letters: %v", err)
+	}
+	return letters, total, nil
+}
+
+// TakeDeadLetters removes and returns the dead letters for urls, or for every URL of class
+// when urls is empty. At most limit records are taken.
+func TakeDeadLetters(ctx context.Context, urls []string, class string, limit int64) ([]DeadLetter, error) {
+	filter := deadLetterFilter(class)
+	if len(urls) > 0 {
+		filter = bson.M{"url": bson.M{"$in": urls}}
+	}
+	cursor, err := deadLetters().Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("error while finding dead letters: %v", err)
+	}
+	letters := []DeadLetter{}
+	if err := cursor.All(ctx, &letters); err != nil {
+		return nil, fmt.Errorf("error while reading dead letters: %v", err)
+	}
+	if len(letters) == 0 {
+		return letters, nil
+	}
+
+	taken := make([]string, len(letters))
+	for i, dl := range letters {
+		taken[i] = dl.URL
+	}
+	if _, err := deadLetters().DeleteMany(ctx, bson.M{"url": bson.M{"$in": taken}}); err != nil {
+		return nil, fmt.Errorf("error while removing dead letters: %v", err)
+	}
+	return letters, nil
+}
+
+// RestoreDeadLetters puts back dead letters taken with TakeDeadLetters that could not be
+// requeued after all, keeping their failure history.
+func RestoreDeadLetters(ctx context.Context, letters []DeadLetter) error {
+	if len(letters) == 0 {
+		return nil
+	}
+	writes := make([]mongo.WriteModel, len(letters))
+	for i, dl := range letters {
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"url": dl.URL}).
+			SetReplacement(dl).
+			SetUpsert(true)
+	}
+	if _, err := deadLetters().BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("error while restoring dead letters: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrEventWebhookNotFound is returned when a webhook does not exist or belongs to another user.
+var ErrEventWebhookNotFound = errors.New("webhook not found")
+
+// EventWebhook is a URL that receives crawl lifecycle events, signed with Secret.
+type EventWebhook struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID string             `bson:"user_id" json:"-"`
+	URL    string             `bson:"url" json:"url"`
+	Secret string             `bson:"secret" json:"-"`
+	// Events are the event types delivered; empty delivers every type.
+	Events []string `bson:"events,omitempty" json:"events,omitempty"`
+	// JobID restricts the deliveries to the events of one crawl job.
+	JobID     string    `bson:"job_id,omitempty" json:"job_id,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+func eventWebhooks() *mongo.Collection {
+	return client.Database("crawler").Collection("event_webhooks")
+}
+
+// EnsureEventWebhookIndexes creates the index used to list a user's webhooks.
+func EnsureEventWebhookIndexes(ctx context.Context) error {
+	_, err := eventWebhooks().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating webhook indexes: %v", err)
+	}
+	return nil
+}
+
+// CreateEventWebhook stores w and sets its ID.
+func CreateEventWebhook(ctx context.Context, w *EventWebhook) error {
+	w.CreatedAt = time.Now()
+	result, err := eventWebhooks().InsertOne(ctx, w)
+	if err != nil {
+		return fmt.Errorf("error while creating webhook: %v", err)
+	}
+	w.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListEventWebhooks returns the user's webhooks, newest first, or every webhook when
+// userID is empty.
+func ListEventWebhooks(ctx context.Context, userID string) ([]EventWebhook, error) {
+	filter := bson.M{}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := eventWebhooks().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding webhooks: %v", err)
+	}
+	hooks := []EventWebhook{}
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return nil, fmt.Errorf("error while reading webhooks: %v", err)
+	}
+	return hooks, nil
+}
+
+// DeleteEventWebhook removes the webhook id of userID.
+func DeleteEventWebhook(ctx context.Context, id, userID string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrEventWebhookNotFound
+	}
+	result, err := eventWebhooks().DeleteOne(ctx, bson.M{"_id": oid, "user_id": userID})
+	if err != nil {
+		return fmt.Errorf("error while deleting webhook: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrEventWebhookNotFound
+	}
+	return nil
+}
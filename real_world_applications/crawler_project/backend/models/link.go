@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Link is an edge of the crawled link graph.
+type Link struct {
+	From         string    `bson:"from" json:"from"`
+	To           string    `bson:"to" json:"to"`
+	Anchor       string    `bson:"anchor" json:"anchor"`
+	DiscoveredAt time.Time `bson:"discovered_at" json:"discovered_at"`
+}
+
+func linksCollection() *mongo.Collection {
+	return client.Database("crawler").Collection("links")
+}
+
+// EnsureLinkIndexes creates the indexes used to look up outlinks and inlinks of a page.
+func EnsureLinkIndexes(ctx context.Context) error {
+	_, err := linksCollection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "from", Value: 1}}},
+		{Keys: bson.D{{Key: "to", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating link indexes: %v", err)
+	}
+	return nil
+}
+
+// ReplaceOutlinks stores links as the complete set of outbound edges of from,
+// dropping the edges recorded by an earlier crawl of the same page.
+func ReplaceOutlinks(ctx context.Context, from string, links []Link) error {
+	collection := linksCollection()
+	if _, err := collection.DeleteMany(ctx, bson.M{"from": from}); err != nil {
+		return fmt.Errorf("error while removing old links: %v", err)
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(links))
+	for i, link := range links {
+		link.From = from
+		docs[i] = link
+	}
+	if _, err := collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil {
+		return fmt.Errorf("error while inserting links: %v", err)
+	}
+	return nil
+}
+
+// GetOutlinks returns up to limit edges leaving url.
+func GetOutlinks(ctx context.Context, url string, limit int64) ([]Link, error) {
+	return findLinks(ctx, bson.M{"from": url}, limit)
+}
+
+// GetInlinks returns up to limit edges pointing at url.
+func GetInlinks(ctx context.Context, url string, limit int64) ([]Link, error) {
+	return findLinks(ctx, bson.M{"to": url}, limit)
+}
+
+func findLinks(ctx context.Context, filter bson.M, limit int64) ([]Link, error) {
+	opts := options.Find().SetLimit(limit).SetSort(bson.D{{Key: "discovered_at", Value: -1}})
+	cursor, err := linksCollection().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding links: %v", err)
+	}
+	links := []Link{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, fmt.Errorf("error while reading links: %v", err)
+	}
+	return links, nil
+}
+
+// ForEachLink streams every stored edge to fn without loading the whole graph into memory.
+// Iteration stops at the first error returned by fn.
+func ForEachLink(ctx context.Context, fn func(Link) error) error {
+	opts := options.Find().SetProjection(bson.M{"from": 1, "to": 1})
+	cursor, err := linksCollection().Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return fmt.Errorf("error while reading link graph: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var link Link
+		if err := cursor.Decode(&link); err != nil {
+			return fmt.Errorf("error while decoding link: %v", err)
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
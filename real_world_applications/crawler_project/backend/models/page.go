@@ -1,10 +1,14 @@
 package models
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/url"
 	"strings"
 	"time"
 
@@ -24,6 +28,14 @@ type WebPage struct {
 	Title      string    `json:"title"`
 	Desription string    `json:"description"`
 	Keywords   []string  `json:"keywords"`
+	// ContentType is the media type the page was served with, e.g. "application/pdf".
+	ContentType string `json:"content_type,omitempty"`
+	// PageRank is the page's link-graph score, scaled so the average page scores 1.
+	PageRank float64 `json:"pagerank,omitempty"`
+	// Language is the detected ISO 639-1 code of the content, or "und" when unknown.
+	Language string `json:"language,omitempty"`
+	// Structured is the schema.org, OpenGraph and Twitter card metadata found in the page.
+	Structured *StructuredData `json:"structured,omitempty"`
 }
 
 type Models struct {
@@ -41,7 +53,7 @@ func NewModels(esClient *elasticsearch.Client, mongClient *mongo.Client) *Models
 }
 
 func CreateWebPage(ctx context.Context, page WebPage) (string, error) {
-	data, err := json.Marshal(page)
+	data, err := pageDocument(page, false)
 	if err != nil {
 		log.Printf("Error marshalling data: %v", err)
 		return "", err
@@ -138,13 +150,25 @@ func ReadWebPage(ctx context.Context, id string) (*WebPage, error) {
 		return nil, fmt.Errorf("error asserting title")
 	}
 
+	description, _ := doc["description"].(string)
+	keywords, _ := doc["keywords"].([]interface{})
+	contentType, _ := doc["content_type"].(string)
+	pageRank, _ := doc["pagerank"].(float64)
+	language, _ := doc["language"].(string)
+
 	page := WebPage{
-		ID:         id, // ID is passed as a parameter, no need to extract from doc
-		URL:        url,
-		StatusCode: int(statusCode),
-		Content:    content,
-		CrawledAt:  crawledAt,
-		Title:      title,
+		ID:          id, // ID is passed as a parameter, no need to extract from doc
+		URL:         url,
+		StatusCode:  int(statusCode),
+		Content:     content,
+		CrawledAt:   crawledAt,
+		Title:       title,
+		Desription:  description,
+		Keywords:    convertInterfaceToStringSlice(keywords),
+		ContentType: contentType,
+		PageRank:    pageRank,
+		Language:    language,
+		Structured:  decodeStructured(doc),
 	}
 
 	return &page, nil
@@ -154,12 +178,89 @@ func ReadWebPage(ctx context.Context, id string) (*WebPage, error) {
 func convertInterfaceToStringSlice(interfaceSlice []interface{}) []string {
 	var stringSlice []string
 	for _, v := range interfaceSlice {
-		stringSlice = append(stringSlice, v.(string))
+		if s, ok := v.(string); ok {
+			stringSlice = append(stringSlice, s)
+		}
 	}
 	return stringSlice
 }
+
+// FindWebPageByURL returns the indexed page for url, or nil if the URL has not been indexed.
+func FindWebPageByURL(ctx context.Context, url string) (*WebPage, error) {
+	ids, err := pageIDsByURL(ctx, []string{url})
+	if err != nil {
+		return nil, err
+	}
+	for id := range ids {
+		return ReadWebPage(ctx, id)
+	}
+	return nil, nil
+}
+
+// IndexWebPage writes page to the document of its URL, creating it when missing, and
+// returns the document ID. New pages get the ID PageIDForURL derives from their URL, so
+// concurrent writes of one URL land on the same document instead of creating duplicates;
+// pages indexed before that keep their generated ID. A zero PageRank is omitted from the
+// write, so re-indexing keeps the page's current score.
+func IndexWebPage(ctx context.Context, page WebPage) (string, error) {
+	id := PageIDForURL(page.URL)
+	ids, err := pageIDsByURL(ctx, []string{page.URL})
+	if err != nil {
+		return "", err
+	}
+	if _, ok := ids[id]; !ok {
+		for legacy := range ids {
+			id = legacy
+			break
+		}
+	}
+	return id, upsertWebPage(ctx, id, page)
+}
+
+// PageIDForURL returns the document ID of the page at rawURL: a hash of the URL with its
+// scheme and host lower cased, the default port, fragment and an empty path normalised.
+func PageIDForURL(rawURL string) string {
+	normalized := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+			u.Host = u.Hostname()
+		}
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.Fragment, u.RawFragment = "", ""
+		normalized = u.String()
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// upsertWebPage updates the document id with page, creating it when it does not exist.
+func upsertWebPage(ctx context.Context, id string, page WebPage) error {
+	data, err := pageDocument(page, true)
+	if err != nil {
+		return fmt.Errorf("error while marshalling page: %v", err)
+	}
+	req := esapi.UpdateRequest{
+		Index:      "webpages",
+		DocumentID: id,
+		Body:       strings.NewReader(fmt.Sprintf(`{"doc":%s,"doc_as_upsert":true}`, string(data))),
+	}
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return fmt.Errorf("error while indexing page: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error indexing document: %s", res.String())
+	}
+	return nil
+}
+
 func UpdateWebPage(ctx context.Context, id string, page WebPage) error {
-	data, err := json.Marshal(page)
+	data, err := pageDocument(page, true)
 	if err != nil {
 		log.Printf("Error marshalling data: %v", err)
 		return err
@@ -185,6 +286,30 @@ func UpdateWebPage(ctx context.Context, id string, page WebPage) error {
 	return nil
 }
 
+// ReplaceWebPage writes page as the whole document id, unlike UpdateWebPage, which leaves
+// the fields page omits as they were.
+func ReplaceWebPage(ctx context.Context, id string, page WebPage) error {
+	data, err := pageDocument(page, false)
+	if err != nil {
+		return fmt.Errorf("error while marshalling page: %v", err)
+	}
+	req := esapi.IndexRequest{
+		Index:      "webpages",
+		DocumentID: id,
+		Body:       strings.NewReader(string(data)),
+		Refresh:    "true",
+	}
+	res, err := req.Do(ctx, es)
+	if err != nil {
+		return fmt.Errorf("error while replacing page: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error replacing document: %s", res.String())
+	}
+	return nil
+}
+
 func DeleteWebPage(ctx context.Context, id string) error {
 	req := esapi.DeleteRequest{
 		Index:      "webpages",
@@ -205,12 +330,63 @@ func DeleteWebPage(ctx context.Context, id string) error {
 	return nil
 }
 
-func SearchWebPage(ctx context.Context, query string) ([]WebPage, error) {
+// pageQuery matches pages against a full-text query, restricted to a language when one is
+// given. An empty query matches every page.
+func pageQuery(query, language string) map[string]interface{} {
+	fields := append([]string{"content"}, contentFields()...)
+	if field := ContentField(language); field != "" {
+		fields = []string{"content", field}
+	}
+	match := map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"query":  query,
+			"fields": fields,
+			"type":   "most_fields",
+		},
+	}
+	if query == "" {
+		match = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	if language != "" {
+		match = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   match,
+				"filter": map[string]interface{}{"term": map[string]interface{}{"language": language}},
+			},
+		}
+	}
+	return match
+}
+
+// SearchWebPage runs a full-text query over indexed pages.
+// With a language, only pages detected in that language match and the query is also
+// analyzed with that language's analyzer; otherwise every language field is searched.
+func SearchWebPage(ctx context.Context, query, language string) ([]WebPage, error) {
 	var pages []WebPage
 
+	match := pageQuery(query, language)
+
+	// Text relevance is multiplied by ln(2 + pagerank) so well linked pages rank higher,
+	// while pages that have not been scored yet keep a neutral boost.
+	body, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{
+			"function_score": map[string]interface{}{
+				"query": match,
+				"field_value_factor": map[string]interface{}{
+					"field":    "pagerank",
+					"modifier": "ln2p",
+					"missing":  0,
+				},
+				"boost_mode": "multiply",
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
 	req := esapi.SearchRequest{
 		Index: []string{"webpages"},
-		Body:  strings.NewReader(fmt.Sprintf(`{"query": {"match": {"content": "%s"}}}`, query)),
+		Body:  strings.NewReader(string(body)),
 	}
 
 	res, err := req.Do(ctx, es)
@@ -288,6 +464,9 @@ func SearchWebPage(ctx context.Context, query string) ([]WebPage, error) {
 			return nil, fmt.Errorf("error asserting title")
 		}
 
+		pageRank, _ := source["pagerank"].(float64)
+		language, _ := source["language"].(string)
+
 		page := WebPage{
 			ID:         id,
 			URL:        url,
@@ -295,6 +474,9 @@ func SearchWebPage(ctx context.Context, query string) ([]WebPage, error) {
 			Content:    content,
 			CrawledAt:  crawledAt,
 			Title:      title,
+			PageRank:   pageRank,
+			Language:   language,
+			Structured: decodeStructured(source),
 		}
 		pages = append(pages, page)
 	}
@@ -344,3 +526,165 @@ func GetWebPages(ctx context.Context) ([]WebPage, error) {
 	}
 	return pages, nil
 }
+
+// PingElasticsearch checks that the Elasticsearch cluster answers.
+func PingElasticsearch(ctx context.Context) error {
+	res, err := esapi.PingRequest{}.Do(ctx, es)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("elasticsearch ping failed: %s", res.Status())
+	}
+	return nil
+}
+
+// UpdatePageRanks writes PageRank scores, keyed by URL, to every indexed page with that URL.
+// URLs are resolved to document IDs in batches and updated with the bulk API. It returns
+// the number of pages updated; pages whose update failed are not counted, and once every
+// batch was tried they are reported in the error.
+func UpdatePageRanks(ctx context.Context, scores map[string]float64) (int, error) {
+	const batchSize = 500
+
+	urls := make([]string, 0, len(scores))
+	for url := range scores {
+		urls = append(urls, url)
+	}
+
+	// Failed items are counted and reported at the end, so one bad page does not keep
+	// the rest of the index from being scored.
+	updated, failed, firstFailure := 0, 0, ""
+	for start := 0; start < len(urls); start += batchSize {
+		end := start + batchSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		ids, err := pageIDsByURL(ctx, urls[start:end])
+		if err != nil {
+			return updated, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		var buf bytes.Buffer
+		for id, url := range ids {
+			meta, _ := json.Marshal(map[string]interface{}{"update": map[string]string{"_index": "webpages", "_id": id}})
+			doc, _ := json.Marshal(map[string]interface{}{"doc": map[string]float64{"pagerank": scores[url]}})
+			buf.Write(meta)
+			buf.WriteByte('\n')
+			buf.Write(doc)
+			buf.WriteByte('\n')
+		}
+
+		res, err := esapi.BulkRequest{Body: &buf}.Do(ctx, es)
+		if err != nil {
+			return updated, err
+		}
+		if res.IsError() {
+			res.Body.Close()
+			return updated, fmt.Errorf("error updating pagerank: %s", res.String())
+		}
+		var r bulkResponse
+		err = json.NewDecoder(res.Body).Decode(&r)
+		res.Body.Close()
+		if err != nil {
+			return updated, err
+		}
+		ok, failures, reason := r.count()
+		updated += ok
+		failed += failures
+		if firstFailure == "" {
+			firstFailure = reason
+		}
+	}
+	if failed > 0 {
+		return updated, fmt.Errorf("error updating pagerank of %d pages: %s", failed, firstFailure)
+	}
+	return updated, nil
+}
+
+// bulkResponse is the part of a bulk API response that tells which items failed.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// count returns how many items of the bulk request succeeded and failed, with the reason
+// of the first failure.
+func (r bulkResponse) count() (ok, failed int, reason string) {
+	for _, item := range r.Items {
+		for _, result := range item {
+			if result.Error == nil && result.Status < 300 {
+				ok++
+				continue
+			}
+			failed++
+			if reason == "" && result.Error != nil {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			} else if reason == "" {
+				reason = fmt.Sprintf("status %d", result.Status)
+			}
+		}
+	}
+	return ok, failed, reason
+}
+
+// pageIDsByURL maps the document IDs of indexed pages to their URL. URLs are matched on
+// url.exact, which holds URLs of any length, and on url.keyword for pages indexed before
+// url.exact was mapped, which only holds URLs of up to 256 characters.
+func pageIDsByURL(ctx context.Context, urls []string) (map[string]string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"size":    10000,
+		"_source": []string{"url"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{"terms": map[string]interface{}{"url.exact": urls}},
+					map[string]interface{}{"terms": map[string]interface{}{"url.keyword": urls}},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := esapi.SearchRequest{
+		Index: []string{"webpages"},
+		Body:  bytes.NewReader(body),
+	}.Do(ctx, es)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("error searching document: %s", res.String())
+	}
+
+	var r struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					URL string `json:"url"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]string, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		ids[hit.ID] = hit.Source.URL
+	}
+	return ids, nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// DiffWebPages describes how the indexed fields of next differ from prev, one line per
+// changed field. Content is summarised by length rather than printed in full.
+func DiffWebPages(prev, next WebPage) []string {
+	var changes []string
+	field := func(name, a, b string) {
+		if a != b {
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", name, a, b))
+		}
+	}
+
+	if prev.StatusCode != next.StatusCode {
+		changes = append(changes, fmt.Sprintf("status_code: %d -> %d", prev.StatusCode, next.StatusCode))
+	}
+	field("title", prev.Title, next.Title)
+	field("description", prev.Desription, next.Desription)
+	field("keywords", strings.Join(prev.Keywords, ", "), strings.Join(next.Keywords, ", "))
+	field("content_type", prev.ContentType, next.ContentType)
+	field("language", prev.Language, next.Language)
+	if !reflect.DeepEqual(prev.Structured, next.Structured) {
+		changes = append(changes, fmt.Sprintf("structured: %q -> %q", structuredSummary(prev.Structured), structuredSummary(next.Structured)))
+	}
+	if prev.Content != next.Content {
+		changes = append(changes, fmt.Sprintf("content: %d -> %d chars", len(prev.Content), len(next.Content)))
+	}
+	return changes
+}
+
+// structuredSummary lists the item types and card kinds of s, e.g. "Product, Offer, og:product".
+func structuredSummary(s *StructuredData) string {
+	if s == nil {
+		return ""
+	}
+	var parts []string
+	for _, item := range s.Items {
+		parts = append(parts, item.Type)
+	}
+	if s.OpenGraph != nil {
+		parts = append(parts, "og:"+s.OpenGraph.Type)
+	}
+	if s.Twitter != nil {
+		parts = append(parts, "twitter:"+s.Twitter.Card)
+	}
+	return strings.Join(parts, ", ")
+}
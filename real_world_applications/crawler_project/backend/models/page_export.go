@@ -0,0 +1,121 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// exportBatchSize is the number of pages fetched per search request while exporting.
+const exportBatchSize = 500
+
+// PageFilter selects the pages to export. Empty fields match every page.
+type PageFilter struct {
+	Query    string
+	Language string
+}
+
+// ForEachWebPage calls fn for every indexed page that matches filter, in index order.
+//
+// Pages are read in batches from a point in time with search_after, so only one batch is
+// held in memory and pages indexed during the export do not shift the results. With
+// fields, only those source fields are loaded; the ID is always set.
+func ForEachWebPage(ctx context.Context, filter PageFilter, fields []string, fn func(WebPage) error) error {
+	pit, err := openPointInTime(ctx)
+	if err != nil {
+		return err
+	}
+	defer closePointInTime(pit)
+
+	var after json.RawMessage
+	for {
+		query := map[string]interface{}{
+			"size":  exportBatchSize,
+			"query": pageQuery(filter.Query, filter.Language),
+			"pit":   map[string]interface{}{"id": pit, "keep_alive": "1m"},
+			"sort":  []interface{}{map[string]interface{}{"_shard_doc": "asc"}},
+		}
+		if fields != nil {
+			query["_source"] = fields
+		}
+		if after != nil {
+			query["search_after"] = after
+		}
+		body, err := json.Marshal(query)
+		if err != nil {
+			return err
+		}
+		res, err := esapi.SearchRequest{Body: bytes.NewReader(body)}.Do(ctx, es)
+		if err != nil {
+			return fmt.Errorf("error while searching pages: %v", err)
+		}
+		var r struct {
+			PitID string `json:"pit_id"`
+			Hits  struct {
+				Hits []struct {
+					ID     string          `json:"_id"`
+					Source json.RawMessage `json:"_source"`
+					Sort   json.RawMessage `json:"sort"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if res.IsError() {
+			res.Body.Close()
+			return fmt.Errorf("error searching document: %s", res.String())
+		}
+		err = json.NewDecoder(res.Body).Decode(&r)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("error while decoding pages: %v", err)
+		}
+		if r.PitID != "" {
+			pit = r.PitID
+		}
+
+		for _, hit := range r.Hits.Hits {
+			var page WebPage
+			if err := json.Unmarshal(hit.Source, &page); err != nil {
+				return fmt.Errorf("error while decoding page %s: %v", hit.ID, err)
+			}
+			page.ID = hit.ID
+			if err := fn(page); err != nil {
+				return err
+			}
+			after = hit.Sort
+		}
+		if len(r.Hits.Hits) < exportBatchSize {
+			return nil
+		}
+	}
+}
+
+// openPointInTime freezes a view of the webpages index and returns its ID.
+func openPointInTime(ctx context.Context) (string, error) {
+	res, err := esapi.OpenPointInTimeRequest{Index: []string{"webpages"}, KeepAlive: "1m"}.Do(ctx, es)
+	if err != nil {
+		return "", fmt.Errorf("error while opening point in time: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return "", fmt.Errorf("error opening point in time: %s", res.String())
+	}
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return "", fmt.Errorf("error while decoding point in time: %v", err)
+	}
+	return r.ID, nil
+}
+
+// closePointInTime releases a point in time. Failures are ignored; it expires on its own.
+func closePointInTime(id string) {
+	body, _ := json.Marshal(map[string]string{"id": id})
+	res, err := esapi.ClosePointInTimeRequest{Body: bytes.NewReader(body)}.Do(context.Background(), es)
+	if err == nil {
+		res.Body.Close()
+	}
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// contentAnalyzers maps each detectable language to the built-in Elasticsearch analyzer
+// used for its content field. Chinese, Japanese and Korean share the cjk analyzer.
+var contentAnalyzers = map[string]string{
+	"ar": "arabic",
+	"de": "german",
+	"el": "greek",
+	"en": "english",
+	"es": "spanish",
+	"fr": "french",
+	"it": "italian",
+	"ja": "cjk",
+	"ko": "cjk",
+	"nl": "dutch",
+	"pt": "portuguese",
+	"ru": "russian",
+	"zh": "cjk",
+}
+
+// ContentField returns the language-specific field that holds the content of pages in
+// language, or "" if the language has no dedicated analyzer.
+func ContentField(language string) string {
+	analyzer, ok := contentAnalyzers[language]
+	if !ok {
+		return ""
+	}
+	return "content_" + analyzer
+}
+
+// contentFields returns every language-specific content field, sorted.
+func contentFields() []string {
+	seen := make(map[string]bool)
+	var fields []string
+	for language := range contentAnalyzers {
+		if field := ContentField(language); !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// webPageMapping describes the webpages index. The generic content field keeps the
+// standard analyzer so every page can be searched the same way, and each language-specific
+// field holds a copy of the content analyzed with that language's stemmer and stop words.
+func webPageMapping() map[string]interface{} {
+	keywordSubfield := map[string]interface{}{
+		"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256},
+	}
+	properties := map[string]interface{}{
+		"url":           urlMapping(),
+		"status_code":   map[string]interface{}{"type": "long"},
+		"content":       map[string]interface{}{"type": "text"},
+		"crawled_at":    map[string]interface{}{"type": "date"},
+		"title":         map[string]interface{}{"type": "text", "fields": keywordSubfield},
+		"description":   map[string]interface{}{"type": "text"},
+		"keywords":      map[string]interface{}{"type": "text", "fields": keywordSubfield},
+		"content_type":  map[string]interface{}{"type": "keyword"},
+		"pagerank":      map[string]interface{}{"type": "float"},
+		"language":      map[string]interface{}{"type": "keyword"},
+		"structured":    structuredMapping(),
+		"title_suggest": map[string]interface{}{"type": "completion"},
+	}
+	for language, analyzer := range contentAnalyzers {
+		properties[ContentField(language)] = map[string]interface{}{"type": "text", "analyzer": analyzer}
+	}
+	return map[string]interface{}{"properties": properties}
+}
+
+// urlMapping maps url as text with two keyword subfields: keyword, as dynamic mapping
+// creates it, and exact, which is not cut off after 256 characters so pages can be looked
+// up by URLs of any length.
+func urlMapping() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "text",
+		"fields": map[string]interface{}{
+			"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256},
+			"exact":   map[string]interface{}{"type": "keyword"},
+		},
+	}
+}
+
+// EnsureWebPageIndex creates the webpages index with its mapping, or adds any missing
+// fields to the mapping of an existing index. Fields that already exist are left alone,
+// apart from the url.exact subfield, so an index created by dynamic mapping keeps working.
+func EnsureWebPageIndex(ctx context.Context) error {
+	res, err := esapi.IndicesExistsRequest{Index: []string{"webpages"}}.Do(ctx, es)
+	if err != nil {
+		return fmt.Errorf("error while checking webpages index: %v", err)
+	}
+	res.Body.Close()
+	exists := res.StatusCode == 200
+
+	mapping := webPageMapping()
+	if !exists {
+		body, err := json.Marshal(map[string]interface{}{"mappings": mapping})
+		if err != nil {
+			return err
+		}
+		res, err := esapi.IndicesCreateRequest{Index: "webpages", Body: strings.NewReader(string(body))}.Do(ctx, es)
+		if err != nil {
+			return fmt.Errorf("error while creating webpages index: %v", err)
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			return fmt.Errorf("error while creating webpages index: %s", res.String())
+		}
+		return nil
+	}
+
+	// Only new fields can be added to an existing mapping.
+	properties := map[string]interface{}{
+		"language":      map[string]interface{}{"type": "keyword"},
+		"structured":    structuredMapping(),
+		"title_suggest": map[string]interface{}{"type": "completion"},
+	}
+	for _, field := range contentFields() {
+		properties[field] = mapping["properties"].(map[string]interface{})[field]
+	}
+	existing, err := mappedFields(ctx)
+	if err != nil {
+		return err
+	}
+	for field := range existing {
+		delete(properties, field)
+	}
+	// Subfields can be added to an existing field, so url always gets url.exact; pages
+	// indexed before then are found through url.keyword until they are written again.
+	properties["url"] = urlMapping()
+	body, err := json.Marshal(map[string]interface{}{"properties": properties})
+	if err != nil {
+		return err
+	}
+	res, err = esapi.IndicesPutMappingRequest{Index: []string{"webpages"}, Body: strings.NewReader(string(body))}.Do(ctx, es)
+	if err != nil {
+		return fmt.Errorf("error while updating webpages mapping: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("error while updating webpages mapping: %s", res.String())
+	}
+	return nil
+}
+
+// mappedFields returns the top-level fields already mapped in the webpages index.
+func mappedFields(ctx context.Context) (map[string]bool, error) {
+	res, err := esapi.IndicesGetMappingRequest{Index: []string{"webpages"}}.Do(ctx, es)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading webpages mapping: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("error while reading webpages mapping: %s", res.String())
+	}
+	var r map[string]struct {
+		Mappings struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]bool)
+	for _, index := range r {
+		for field := range index.Mappings.Properties {
+			fields[field] = true
+		}
+	}
+	return fields, nil
+}
+
+// pageDocument is the indexed form of page: its JSON fields plus a copy of the content
+// in the field for the page's language and the title completions. With clearOthers set,
+// the other language fields are nulled so an update that changes the language does not
+// leave stale copies behind.
+func pageDocument(page WebPage, clearOthers bool) ([]byte, error) {
+	data, err := json.Marshal(page)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	own := ContentField(page.Language)
+	if clearOthers {
+		for _, field := range contentFields() {
+			doc[field] = nil
+		}
+	}
+	if own != "" {
+		doc[own] = page.Content
+	}
+	doc["title_suggest"] = titleCompletions(page.Title)
+	return json.Marshal(doc)
+}
+
+// maxTitleCompletions bounds the inputs indexed for one title.
+const maxTitleCompletions = 10
+
+// titleCompletions returns the completion inputs for a title: the title itself and the
+// rest of it from each later word on, so typing any word of a title can complete it.
+// It returns nil for an empty title, which clears the field on update.
+func titleCompletions(title string) []string {
+	words := strings.Fields(title)
+	var inputs []string
+	for i := range words {
+		if i == maxTitleCompletions {
+			break
+		}
+		inputs = append(inputs, strings.Join(words[i:], " "))
+	}
+	return inputs
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// PageSuggestions are the suggestions for a partially typed query.
+type PageSuggestions struct {
+	// Completions are indexed pages whose title completes the query, best first.
+	Completions []PageCompletion `json:"completions"`
+	// Corrections are spelling corrections of the whole query ("did you mean"), best first.
+	Corrections []string `json:"corrections"`
+}
+
+// PageCompletion is a page whose title completes a query.
+type PageCompletion struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// SuggestWebPages returns up to size title completions of prefix and up to three spelling
+// corrections of it, drawn from the words of the indexed content. Both come from a single
+// suggest request so one round trip answers a keystroke.
+func SuggestWebPages(ctx context.Context, prefix string, size int) (PageSuggestions, error) {
+	suggestions := PageSuggestions{Completions: []PageCompletion{}, Corrections: []string{}}
+	body, err := json.Marshal(map[string]interface{}{
+		"_source": []string{"title", "url"},
+		"suggest": map[string]interface{}{
+			"titles": map[string]interface{}{
+				"prefix": prefix,
+				"completion": map[string]interface{}{
+					"field":           "title_suggest",
+					"size":            size,
+					"skip_duplicates": true,
+				},
+			},
+			"spelling": map[string]interface{}{
+				"text": prefix,
+				"phrase": map[string]interface{}{
+					"field":      "content",
+					"size":       3,
+					"max_errors": 2,
+					"direct_generator": []interface{}{
+						map[string]interface{}{"field": "content", "suggest_mode": "always"},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return suggestions, err
+	}
+	res, err := esapi.SearchRequest{Index: []string{"webpages"}, Body: bytes.NewReader(body)}.Do(ctx, es)
+	if err != nil {
+		return suggestions, fmt.Errorf("error while suggesting pages: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return suggestions, fmt.Errorf("error suggesting pages: %s", res.String())
+	}
+	var r struct {
+		Suggest struct {
+			Titles []struct {
+				Options []struct {
+					ID     string `json:"_id"`
+					Source struct {
+						Title string `json:"title"`
+						URL   string `json:"url"`
+					} `json:"_source"`
+				} `json:"options"`
+			} `json:"titles"`
+			Spelling []struct {
+				Options []struct {
+					Text string `json:"text"`
+				} `json:"options"`
+			} `json:"spelling"`
+		} `json:"suggest"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return suggestions, fmt.Errorf("error while decoding suggestions: %v", err)
+	}
+	for _, entry := range r.Suggest.Titles {
+		for _, option := range entry.Options {
+			suggestions.Completions = append(suggestions.Completions, PageCompletion{
+				ID:    option.ID,
+				Title: option.Source.Title,
+				URL:   option.Source.URL,
+			})
+		}
+	}
+	for _, entry := range r.Suggest.Spelling {
+		for _, option := range entry.Options {
+			if !strings.EqualFold(option.Text, prefix) {
+				suggestions.Corrections = append(suggestions.Corrections, option.Text)
+			}
+		}
+	}
+	return suggestions, nil
+}
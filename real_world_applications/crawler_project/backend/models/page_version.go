@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sources of a page version.
+const (
+	VersionCrawl   = "crawl"   // fetched by a crawl or a replay
+	VersionEdit    = "edit"    // edited through the API
+	VersionRestore = "restore" // an older version restored through the API
+)
+
+// MaxPageVersions is how many versions are kept per page; older ones are deleted.
+const MaxPageVersions = 20
+
+// ErrPageVersionNotFound is returned when a page has no version with the given number.
+var ErrPageVersionNotFound = errors.New("page version not found")
+
+// PageVersion is a snapshot of an indexed page, taken every time the page is written.
+type PageVersion struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	PageID  string             `bson:"page_id" json:"page_id"`
+	Version int                `bson:"version" json:"version"` // 1 for the oldest version ever saved
+	Source  string             `bson:"source" json:"source"`
+	// ActorID is the user who edited or restored the page; empty for crawls.
+	ActorID     string `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	ContentHash string `bson:"content_hash" json:"content_hash"` // SHA-256 of the content, hex encoded
+	// Changes describes how this version differs from the previous one, as DiffWebPages.
+	Changes []string `bson:"changes,omitempty" json:"changes,omitempty"`
+	// RestoredFrom is the version a restore copied.
+	RestoredFrom int       `bson:"restored_from,omitempty" json:"restored_from,omitempty"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	// Page is left out when versions are listed.
+	Page *WebPage `bson:"page,omitempty" json:"page,omitempty"`
+}
+
+func pageVersions() *mongo.Collection {
+	return client.Database("crawler").Collection("page_versions")
+}
+
+// EnsurePageVersionIndexes creates the unique index on page and version number, which also
+// serves listing a page's versions newest first.
+func EnsurePageVersionIndexes(ctx context.Context) error {
+	_, err := pageVersions().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "page_id", Value: 1}, {Key: "version", Value: -1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating page version indexes: %v", err)
+	}
+	return nil
+}
+
+// NextPageVersion completes v, a snapshot of its page, as the version following latest,
+// which is nil for a page without versions. It reports false when v does not change any
+// indexed field of latest, so a recrawl of an unchanged page adds no version.
+func NextPageVersion(latest *PageVersion, v PageVersion, now time.Time) (PageVersion, bool) {
+	page := *v.Page
+	page.ID = v.PageID
+	v.Page = &page
+	sum := sha256.Sum256([]byte(page.Content))
+	v.ContentHash = hex.EncodeToString(sum[:])
+	v.CreatedAt = now
+	v.Version = 1
+	v.Changes = nil
+	if latest != nil {
+		if latest.Page != nil {
+			v.Changes = DiffWebPages(*latest.Page, page)
+		}
+		if v.ContentHash == latest.ContentHash && len(v.Changes) == 0 {
+			return v, false
+		}
+		v.Version = latest.Version + 1
+	}
+	return v, true
+}
+
+// SavePageVersion stores v, whose PageID, Page, Source and ActorID are set by the caller,
+// as the newest version of its page and deletes the versions beyond MaxPageVersions.
+//
+// Returns:
+// - The saved version, or nil when the page did not change since its latest version.
+// - An error if the versions could not be read or written.
+func SavePageVersion(ctx context.Context, v PageVersion) (*PageVersion, error) {
+	// A concurrent save may take the next number first; reading the latest again resolves it.
+	for attempt := 0; ; attempt++ {
+		latest, err := latestPageVersion(ctx, v.PageID)
+		if err != nil {
+			return nil, err
+		}
+		next, changed := NextPageVersion(latest, v, time.Now())
+		if !changed {
+			return nil, nil
+		}
+		_, err = pageVersions().InsertOne(ctx, next)
+		if mongo.IsDuplicateKeyError(err) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error while saving page version: %v", err)
+		}
+		_, err = pageVersions().DeleteMany(ctx, bson.M{
+			"page_id": v.PageID,
+			"version": bson.M{"$lte": next.Version - MaxPageVersions},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error while deleting old page versions: %v", err)
+		}
+		return &next, nil
+	}
+}
+
+func latestPageVersion(ctx context.Context, pageID string) (*PageVersion, error) {
+	var v PageVersion
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+	err := pageVersions().FindOne(ctx, bson.M{"page_id": pageID}, opts).Decode(&v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while finding page version: %v", err)
+	}
+	return &v, nil
+}
+
+// ListPageVersions returns the versions of a page newest first, without their snapshots.
+func ListPageVersions(ctx context.Context, pageID string) ([]PageVersion, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "version", Value: -1}}).
+		SetProjection(bson.M{"page": 0})
+	cursor, err := pageVersions().Find(ctx, bson.M{"page_id": pageID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding page versions: %v", err)
+	}
+	versions := []PageVersion{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("error while reading page versions: %v", err)
+	}
+	return versions, nil
+}
+
+// GetPageVersion returns one version of a page with its snapshot.
+func GetPageVersion(ctx context.Context, pageID string, version int) (*PageVersion, error) {
+	var v PageVersion
+	err := pageVersions().FindOne(ctx, bson.M{"page_id": pageID, "version": version}).Decode(&v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrPageVersionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while finding page version: %v", err)
+	}
+	return &v, nil
+}
+
+// DeletePageVersions deletes the history of a page, e.g. when the page itself is deleted.
+func DeletePageVersions(ctx context.Context, pageID string) error {
+	if _, err := pageVersions().DeleteMany(ctx, bson.M{"page_id": pageID}); err != nil {
+		return fmt.Errorf("error while deleting page versions: %v", err)
+	}
+	return nil
+}
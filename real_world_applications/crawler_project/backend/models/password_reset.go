@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PasswordReset is a pending password reset request. Only the hash of the token is stored.
+type PasswordReset struct {
+	TokenHash string     `bson:"token_hash"`
+	UserID    string     `bson:"user_id"`
+	CreatedAt time.Time  `bson:"created_at"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
+
+func passwordResets() *mongo.Collection {
+	return client.Database("users").Collection("password_resets")
+}
+
+// EnsurePasswordResetIndexes creates a unique index on the token hash and a TTL index
+// so expired reset requests are removed by MongoDB.
+func EnsurePasswordResetIndexes(ctx context.Context) error {
+	_, err := passwordResets().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating password reset indexes: %v", err)
+	}
+	return nil
+}
+
+// CreatePasswordReset stores a new reset request for the user that expires after ttl.
+func CreatePasswordReset(ctx context.Context, userID string, tokenHash string, ttl time.Duration) error {
+	now := time.Now()
+	_, err := passwordResets().InsertOne(ctx, PasswordReset{
+		TokenHash: tokenHash,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating password reset: %v", err)
+	}
+	return nil
+}
+
+// ConsumePasswordReset atomically marks an unused, unexpired reset request as used
+// and returns the ID of the user it belongs to.
+func ConsumePasswordReset(ctx context.Context, tokenHash string) (string, error) {
+	now := time.Now()
+	filter := bson.M{
+		"token_hash": tokenHash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"used_at": now}}
+
+	var reset PasswordReset
+	err := passwordResets().FindOneAndUpdate(ctx, filter, update).Decode(&reset)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return "", fmt.Errorf("invalid or expired token")
+		}
+		return "", fmt.Errorf("error while consuming password reset: %v", err)
+	}
+	return reset.UserID, nil
+}
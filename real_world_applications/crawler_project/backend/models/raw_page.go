@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RawPage points from a fetched URL to its raw body in the content-addressed raw store,
+// together with the response metadata needed to process the body again.
+type RawPage struct {
+	URL        string              `bson:"url" json:"url"`
+	Hash       string              `bson:"hash" json:"hash"`
+	StatusCode int                 `bson:"status_code" json:"status_code"`
+	Header     map[string][]string `bson:"header" json:"header"`
+	FetchedAt  time.Time           `bson:"fetched_at" json:"fetched_at"`
+}
+
+func rawPagesCollection() *mongo.Collection {
+	return client.Database("crawler").Collection("raw_pages")
+}
+
+// EnsureRawPageIndexes creates the unique URL index that replay iterates over.
+func EnsureRawPageIndexes(ctx context.Context) error {
+	_, err := rawPagesCollection().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "url", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating raw page indexes: %v", err)
+	}
+	return nil
+}
+
+// SaveRawPage stores the latest fetch of a URL, replacing any earlier one.
+func SaveRawPage(ctx context.Context, page RawPage) error {
+	_, err := rawPagesCollection().ReplaceOne(ctx, bson.M{"url": page.URL}, page, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error while saving raw page: %v", err)
+	}
+	return nil
+}
+
+// ForEachRawPage streams the stored raw pages with a URL greater than after, in URL order,
+// so an interrupted pass can be resumed from the last URL it finished.
+// Iteration stops at the first error returned by fn.
+func ForEachRawPage(ctx context.Context, after string, fn func(RawPage) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "url", Value: 1}})
+	cursor, err := rawPagesCollection().Find(ctx, bson.M{"url": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return fmt.Errorf("error while reading raw pages: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var page RawPage
+		if err := cursor.Decode(&page); err != nil {
+			return fmt.Errorf("error while decoding raw page: %v", err)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrSavedSearchNotFound is returned when a saved search does not exist or belongs to another user.
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+// SavedSearch is a search a user wants re-run on a schedule, with alerts for pages that
+// are new to its results or changed since the previous run.
+type SavedSearch struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID   string             `bson:"user_id" json:"-"`
+	Name     string             `bson:"name" json:"name"`
+	Query    string             `bson:"query" json:"query"`
+	Language string             `bson:"language,omitempty" json:"language,omitempty"`
+	// Schedule is how often the search runs, as a Go duration such as "24h".
+	Schedule string `bson:"schedule" json:"schedule"`
+	// WebhookURL receives the alerts, signed with WebhookSecret. Without one, alerts are logged.
+	WebhookURL    string `bson:"webhook_url,omitempty" json:"webhook_url,omitempty"`
+	WebhookSecret string `bson:"webhook_secret,omitempty" json:"-"`
+	// Results holds every page in the last results with a fingerprint of its content. It is
+	// nil until the first successful run.
+	Results   []SavedSearchResult `bson:"results" json:"-"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+	LastRunAt time.Time           `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	NextRunAt time.Time           `bson:"next_run_at" json:"next_run_at"`
+	LastError string              `bson:"last_error,omitempty" json:"last_error,omitempty"`
+}
+
+// SavedSearchResult is one page of a saved search's results. They are kept in an array
+// rather than a map keyed by URL, as URLs contain dots, which field names may not.
+type SavedSearchResult struct {
+	URL         string `bson:"url"`
+	Fingerprint string `bson:"fingerprint"`
+}
+
+func savedSearches() *mongo.Collection {
+	return client.Database("crawler").Collection("saved_searches")
+}
+
+// EnsureSavedSearchIndexes creates the indexes used to list a user's searches and find due ones.
+func EnsureSavedSearchIndexes(ctx context.Context) error {
+	_, err := savedSearches().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "next_run_at", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("error while creating saved search indexes: %v", err)
+	}
+	return nil
+}
+
+// CreateSavedSearch stores s and sets its ID. The first run is due immediately.
+func CreateSavedSearch(ctx context.Context, s *SavedSearch) error {
+	now := time.Now()
+	s.CreatedAt = now
+	s.NextRunAt = now
+	result, err := savedSearches().InsertOne(ctx, s)
+	if err != nil {
+		return fmt.Errorf("error while creating saved search: %v", err)
+	}
+	s.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+// ListSavedSearches returns the user's saved searches, newest first.
+func ListSavedSearches(ctx context.Context, userID string) ([]SavedSearch, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := savedSearches().Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error while finding saved searches: %v", err)
+	}
+	searches := []SavedSearch{}
+	if err := cursor.All(ctx, &searches); err != nil {
+		return nil, fmt.Errorf("error while reading saved searches: %v", err)
+	}
+	return searches, nil
+}
+
+// savedSearchFilter selects the saved search id of userID.
+func savedSearchFilter(id, userID string) (bson.M, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrSavedSearchNotFound
+	}
+	return bson.M{"_id": oid, "user_id": userID}, nil
+}
+
+// GetSavedSearch returns the saved search id of userID.
+func GetSavedSearch(ctx context.Context, id, userID string) (*SavedSearch, error) {
+	filter, err := savedSearchFilter(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	var s SavedSearch
+	err = savedSearches().FindOne(ctx, filter).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSavedSearchNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while finding saved search: %v", err)
+	}
+	return &s, nil
+}
+
+// DeleteSavedSearch removes the saved search id of userID.
+func DeleteSavedSearch(ctx context.Context, id, userID string) error {
+	filter, err := savedSearchFilter(id, userID)
+	if err != nil {
+		return err
+	}
+	result, err := savedSearches().DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("error while deleting saved search: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// ScheduleSavedSearchNow makes the saved search id of userID due immediately.
+func ScheduleSavedSearchNow(ctx context.Context, id, userID string) error {
+	filter, err := savedSearchFilter(id, userID)
+	if err != nil {
+		return err
+	}
+	result, err := savedSearches().UpdateOne(ctx, filter, bson.M{"$set": bson.M{"next_run_at": time.Now()}})
+	if err != nil {
+		return fmt.Errorf("error while scheduling saved search: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrSavedSearchNotFound
+	}
+	return nil
+}
+
+// ClaimDueSavedSearch takes one saved search whose next run is due at now and moves its
+// next run to now plus its schedule, so that several runners never run it twice. It
+// returns nil when nothing is due.
+func ClaimDueSavedSearch(ctx context.Context, now time.Time) (*SavedSearch, error) {
+	var s SavedSearch
+	err := savedSearches().FindOne(ctx, bson.M{"next_run_at": bson.M{"$lte": now}},
+		options.FindOne().SetSort(bson.D{{Key: "next_run_at", Value: 1}})).Decode(&s)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while finding due saved search: %v", err)
+	}
+	interval, err := time.ParseDuration(s.Schedule)
+	if err != nil || interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	// Only the runner that still sees the old next_run_at wins the claim.
+	filter := bson.M{"_id": s.ID, "next_run_at": s.NextRunAt}
+	update := bson.M{"$set": bson.M{"next_run_at": now.Add(interval)}}
+	err = savedSearches().FindOneAndUpdate(ctx, filter, update).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ClaimDueSavedSearch(ctx, now)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while claiming saved search: %v", err)
+	}
+	s.NextRunAt = now.Add(interval)
+	return &s, nil
+}
+
+// RecordSavedSearchRun stores the results of a run. runErr is empty for a successful run,
+// in which case results replace the previous ones.
+func RecordSavedSearchRun(ctx context.Context, id primitive.ObjectID, results []SavedSearchResult, runAt time.Time, runErr string) error {
+	set := bson.M{"last_run_at": runAt, "last_error": runErr}
+	if runErr == "" {
+		set["results"] = results
+	}
+	_, err := savedSearches().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("error while recording saved search run: %v", err)
+	}
+	return nil
+}
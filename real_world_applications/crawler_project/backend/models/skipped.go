@@ -0,0 +1,28 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SkippedPage records a fetched URL whose content type the crawler cannot extract.
+type SkippedPage struct {
+	URL        string    `bson:"url" json:"url"`
+	MimeType   string    `bson:"mime_type" json:"mime_type"`
+	StatusCode int       `bson:"status_code" json:"status_code"`
+	SkippedAt  time.Time `bson:"skipped_at" json:"skipped_at"`
+}
+
+// RecordSkippedPage stores or refreshes the skip record of a URL.
+func RecordSkippedPage(ctx context.Context, page SkippedPage) error {
+	collection := client.Database("crawler").Collection("skipped_pages")
+	_, err := collection.ReplaceOne(ctx, bson.M{"url": page.URL}, page, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error while recording skipped page: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// StructuredData is the machine-readable metadata embedded in a page: schema.org items
+// from JSON-LD and microdata, and the OpenGraph and Twitter card tags.
+type StructuredData struct {
+	Items     []StructuredItem `json:"items,omitempty"`
+	OpenGraph *OpenGraph       `json:"opengraph,omitempty"`
+	Twitter   *TwitterCard     `json:"twitter,omitempty"`
+}
+
+// StructuredItem is a schema.org item such as a Product, Article or Event.
+type StructuredItem struct {
+	// Type is the schema.org type without its vocabulary, e.g. "Product".
+	Type string `json:"type"`
+	// Source is where the item was found: "json-ld" or "microdata".
+	Source      string `json:"source"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Image       string `json:"image,omitempty"`
+	// Properties holds every property of the item, with nested items flattened into dotted
+	// names such as "offers.price". A property with several values appears several times.
+	Properties []StructuredProperty `json:"properties,omitempty"`
+}
+
+// StructuredProperty is a name and value of a StructuredItem.
+type StructuredProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// OpenGraph holds the og: meta tags of a page.
+type OpenGraph struct {
+	Type        string `json:"type,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// TwitterCard holds the twitter: meta tags of a page.
+type TwitterCard struct {
+	Card        string `json:"card,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Site        string `json:"site,omitempty"`
+	Creator     string `json:"creator,omitempty"`
+}
+
+// Property returns the first value of the named property, or "".
+func (i StructuredItem) Property(name string) string {
+	for _, p := range i.Properties {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return ""
+}
+
+// structuredMapping describes the structured field of the webpages index. Items and their
+// properties are nested so a query matches a property and its value within the same item.
+func structuredMapping() map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword", "ignore_above": 256}
+	text := map[string]interface{}{"type": "text", "fields": map[string]interface{}{"keyword": keyword}}
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"items": map[string]interface{}{
+				"type": "nested",
+				"properties": map[string]interface{}{
+					"type":        keyword,
+					"source":      keyword,
+					"name":        text,
+					"description": map[string]interface{}{"type": "text"},
+					"url":         keyword,
+					"image":       keyword,
+					"properties": map[string]interface{}{
+						"type": "nested",
+						"properties": map[string]interface{}{
+							"name":  keyword,
+							"value": text,
+						},
+					},
+				},
+			},
+			"opengraph": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"type":        keyword,
+					"title":       text,
+					"description": map[string]interface{}{"type": "text"},
+					"url":         keyword,
+					"image":       keyword,
+					"site_name":   text,
+				},
+			},
+			"twitter": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"card":        keyword,
+					"title":       text,
+					"description": map[string]interface{}{"type": "text"},
+					"image":       keyword,
+					"site":        keyword,
+					"creator":     keyword,
+				},
+			},
+		},
+	}
+}
+
+// StructuredQuery finds pages by the schema.org items they contain.
+type StructuredQuery struct {
+	// Type is the item type to find, e.g. "Product". Empty matches any type.
+	Type string `json:"type"`
+	// Properties are property names and values that must all match within the same item.
+	// Values are matched as full text, so "acme" matches "Acme Corporation".
+	Properties map[string]string `json:"properties"`
+	// Query optionally also requires a full-text match on the page content.
+	Query    string `json:"query"`
+	Language string `json:"language"`
+	Size     int    `json:"size"`
+}
+
+// SearchStructured returns the pages with an item matching q, best matches first.
+func SearchStructured(ctx context.Context, q StructuredQuery) ([]WebPage, error) {
+	var must []interface{}
+	if q.Type != "" {
+		must = append(must, map[string]interface{}{"term": map[string]interface{}{"structured.items.type": q.Type}})
+	}
+	for name, value := range q.Properties {
+		must = append(must, map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path": "structured.items.properties",
+				"query": map[string]interface{}{
+					"bool": map[string]interface{}{
+						"must": []interface{}{
+							map[string]interface{}{"term": map[string]interface{}{"structured.items.properties.name": name}},
+							map[string]interface{}{"match": map[string]interface{}{"structured.items.properties.value": value}},
+						},
+					},
+				},
+			},
+		})
+	}
+	if len(must) == 0 {
+		must = append(must, map[string]interface{}{"match_all": map[string]interface{}{}})
+	}
+	query := []interface{}{
+		map[string]interface{}{
+			"nested": map[string]interface{}{
+				"path":  "structured.items",
+				"query": map[string]interface{}{"bool": map[string]interface{}{"must": must}},
+			},
+		},
+	}
+	if q.Query != "" || q.Language != "" {
+		query = append(query, pageQuery(q.Query, q.Language))
+	}
+	size := q.Size
+	if size <= 0 || size > 100 {
+		size = 10
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"size":  size,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"must": query}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := esapi.SearchRequest{Index: []string{"webpages"}, Body: bytes.NewReader(body)}.Do(ctx, es)
+	if err != nil {
+		return nil, fmt.Errorf("error while searching structured data: %v", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("error searching document: %s", res.String())
+	}
+	var r struct {
+		Hits struct {
+			Hits []struct {
+				ID     string          `json:"_id"`
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("error while decoding pages: %v", err)
+	}
+	pages := []WebPage{}
+	for _, hit := range r.Hits.Hits {
+		var page WebPage
+		if err := json.Unmarshal(hit.Source, &page); err != nil {
+			return nil, fmt.Errorf("error while decoding page %s: %v", hit.ID, err)
+		}
+		page.ID = hit.ID
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// decodeStructured reads the structured field of a decoded _source document.
+func decodeStructured(source map[string]interface{}) *StructuredData {
+	raw, ok := source["structured"]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var s StructuredData
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil
+	}
+	return &s
+}
@@ -9,6 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 var client *mongo.Client
@@ -18,6 +19,7 @@ type User struct {
 	Username string `bson:"username" json:"username"`
 	Password string `bson:"password" json:"password"`
 	Email    string `bson:"email" json:"email"`
+	Verified bool   `bson:"verified" json:"verified"`
 }
 
 func EnsureUserEmailUnique() error {
@@ -42,15 +44,69 @@ func EnsureUserEmailUnique() error {
 
 func (u *User) Insert() error {
 	collection := client.Database("users").Collection("users")
-	_, err := collection.InsertOne(context.TODO(), User{
+	result, err := collection.InsertOne(context.TODO(), User{
 		Username: u.Username,
 		Password: u.Password,
 		Email:    u.Email,
+		Verified: false, // new accounts must confirm their email before logging in
 	})
 
 	if err != nil {
 		return fmt.Errorf("error while inserting user: %v", err)
 	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		u.ID = id.Hex()
+	}
+	u.Verified = false
+	return nil
+}
+
+// MarkVerified flags the user's email as confirmed.
+// The email must still match the one the verification token was issued for.
+func (u *User) MarkVerified(ID string, email string) error {
+	collection := client.Database("users").Collection("users")
+	userId, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("error while converting id: %v", err)
+	}
+	filter := bson.M{"_id": userId, "email": email}
+	result, err := collection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"verified": true}})
+	if err != nil {
+		return fmt.Errorf("error while verifying user: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// UpdatePassword replaces the stored password hash of the user.
+func (u *User) UpdatePassword(ID string, hashedPassword string) error {
+	collection := client.Database("users").Collection("users")
+	userId, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return fmt.Errorf("error while converting id: %v", err)
+	}
+	filter := bson.M{"_id": userId}
+	result, err := collection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"password": hashedPassword}})
+	if err != nil {
+		return fmt.Errorf("error while updating password: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// MarkLegacyUsersVerified flags accounts created before email verification existed as verified,
+// so they are not locked out of login.
+func MarkLegacyUsersVerified() error {
+	collection := client.Database("users").Collection("users")
+	filter := bson.M{"verified": bson.M{"$exists": false}}
+	_, err := collection.UpdateMany(context.TODO(), filter, bson.M{"$set": bson.M{"verified": true}})
+	if err != nil {
+		return fmt.Errorf("error while migrating users: %v", err)
+	}
 	return nil
 }
 
@@ -128,3 +184,8 @@ func (u *User) Delete(ID string) error {
 	}
 	return nil
 }
+
+// PingMongo checks that the MongoDB primary answers.
+func PingMongo(ctx context.Context) error {
+	return client.Ping(ctx, readpref.Primary())
+}
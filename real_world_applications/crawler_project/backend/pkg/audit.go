@@ -0,0 +1,160 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+	"web_crawler/models"
+)
+
+// ErrAuditWriterClosed is returned by AuditWriter.Record after Close.
+var ErrAuditWriterClosed = errors.New("audit writer closed")
+
+// AuditWriter writes audit entries in the background, in batches, so recording one does not
+// slow the request down. It does not drop recorded entries: Record waits while the buffer
+// is full, batches that fail are retried until they are written, and Close writes
+// everything still buffered. Only a batch that cannot be written before Close gives up is handed to Fallback.
+type AuditWriter struct {
+	// Insert writes a batch of entries; models.InsertAuditEntries by default. It must
+	// tolerate a batch that was partly written by a failed earlier attempt.
+	Insert        func(ctx context.Context, entries []models.AuditEntry) error
+	BatchSize     int
+	FlushInterval time.Duration
+	// Retry spaces the attempts of a failed batch; its MaxAttempts is ignored.
+	Retry RetryPolicy
+	// OnError, when set, is called for every failed attempt.
+	OnError func(err error, entries int)
+	// Fallback receives the batches still unwritten when Close gives up, e.g. to log them.
+	Fallback func(entries []models.AuditEntry, err error)
+
+	mu       sync.RWMutex
+	closed   bool
+	entries  chan models.AuditEntry
+	stopOnce sync.Once
+	stopping chan struct{}
+	closeCtx context.Context // set before stopping is closed
+	done     chan struct{}
+}
+
+// NewAuditWriter returns a writer to the audit log in MongoDB that buffers up to buffer
+// entries and writes them in batches of up to batchSize, at least every flushInterval.
+func NewAuditWriter(buffer, batchSize int, flushInterval time.Duration) *AuditWriter {
+	return &AuditWriter{
+		Insert:        models.InsertAuditEntries,
+		BatchSize:     batchSize,
+		FlushInterval: flushInterval,
+		Retry:         DefaultRetryPolicy(),
+		entries:       make(chan models.AuditEntry, buffer),
+		stopping:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start begins writing recorded entries in the background.
+func (w *AuditWriter) Start() {
+	go w.run()
+}
+
+// Record queues e to be written, waiting while the buffer is full. A Record still waiting
+// when Close is called gives up with ErrAuditWriterClosed.
+func (w *AuditWriter) Record(e models.AuditEntry) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrAuditWriterClosed
+	}
+	select {
+	case w.entries <- e:
+		return nil
+	case <-w.stopping:
+		return ErrAuditWriterClosed
+	}
+}
+
+// Close stops accepting entries and waits until every recorded entry is written. Once ctx
+// is done, failing batches stop being retried and go to Fallback instead.
+func (w *AuditWriter) Close(ctx context.Context) {
+	// Closing stopping first releases any Record blocked on a full buffer, which would
+	// otherwise hold the read lock forever while the batches cannot be written.
+	w.stopOnce.Do(func() {
+		w.closeCtx = ctx
+		close(w.stopping)
+	})
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *AuditWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.AuditEntry, 0, w.BatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			w.write(batch)
+			batch = make([]models.AuditEntry, 0, w.BatchSize)
+		}
+	}
+	for {
+		select {
+		case e, ok := <-w.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= w.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// write inserts batch, retrying until it succeeds or, once the writer is closing, until
+// the close context is done.
+func (w *AuditWriter) write(batch []models.AuditEntry) {
+	for attempt := 1; ; attempt++ {
+		ctx, closing := context.Background(), false
+		select {
+		case <-w.stopping:
+			ctx, closing = w.closeCtx, true
+		default:
+		}
+		err := w.Insert(ctx, batch)
+		if err == nil {
+			return
+		}
+		if w.OnError != nil {
+			w.OnError(err, len(batch))
+		}
+		if closing && ctx.Err() != nil {
+			if w.Fallback != nil {
+				w.Fallback(batch, err)
+			}
+			return
+		}
+
+		// Closing cuts the wait short; from then on the close context bounds the retries.
+		stop := w.stopping
+		if closing {
+			stop = nil
+		}
+		timer := time.NewTimer(w.Retry.Backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+		}
+	}
+}
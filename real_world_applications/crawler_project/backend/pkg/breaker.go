@@ -0,0 +1,319 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a host's circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets every request through and counts failures.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects requests until the open timeout elapses.
+	BreakerOpen
+	// BreakerHalfOpen lets a few probe requests through to test whether the host recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// ErrCircuitOpen is returned for URLs whose host has an open circuit. The URL has been
+// parked and will be handed back once the breaker half-opens.
+var ErrCircuitOpen = errors.New("host circuit open")
+
+// ErrParkingFull is returned for URLs whose host has an open circuit and already has
+// MaxParked URLs parked. The URL is not parked and will not be handed back.
+var ErrParkingFull = errors.New("host circuit open and too many urls parked")
+
+// BreakerOptions configures HostBreakers.
+type BreakerOptions struct {
+	ConsecutiveFailures int           // trip after this many failures in a row
+	FailureRate         float64       // or when this fraction of the recent requests failed
+	Window              int           // number of recent requests the failure rate is computed over
+	MinRequests         int           // the failure rate only counts once the window holds this many requests
+	OpenTimeout         time.Duration // how long a tripped breaker stays open
+	HalfOpenProbes      int           // successful probes needed to close a half-open breaker
+	MaxParked           int           // URLs parked per host before new ones are rejected, 0 for no limit
+}
+
+// DefaultBreakerOptions returns the options used when none are configured.
+func DefaultBreakerOptions() BreakerOptions {
+	return BreakerOptions{
+		ConsecutiveFailures: 5,
+		FailureRate:         0.5,
+		Window:              20,
+		MinRequests:         10,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenProbes:      1,
+		MaxParked:           1000,
+	}
+}
+
+// hostBreaker is the breaker of one host. All fields are guarded by HostBreakers.mu.
+type hostBreaker struct {
+	state       BreakerState
+	consecutive int
+	window      []bool // ring buffer of recent outcomes, true for failure
+	next        int
+	filled      int
+	probes      int // probes in flight while half-open
+	successes   int // successful probes while half-open
+	parked      []string
+}
+
+// HostBreakers keeps one circuit breaker per host.
+//
+// A closed breaker trips to open after ConsecutiveFailures failures in a row, or when
+// the failure rate over the last Window requests reaches FailureRate. While open, URLs
+// for the host are parked instead of fetched. After OpenTimeout the breaker half-opens
+// and the first parked URL is resumed as a probe; once HalfOpenProbes probes succeed
+// the breaker closes and the remaining parked URLs are resumed, while a failed probe
+// opens it again. A host holds at most MaxParked URLs; further URLs are rejected with
+// ErrParkingFull.
+//
+// Only failures that say something about the host count: DNS, connection, TLS and
+// timeout errors and 5xx responses. Client errors such as 404 count as successes.
+type HostBreakers struct {
+	mu     sync.Mutex
+	opts   BreakerOptions
+	hosts  map[string]*hostBreaker
+	resume func(url string)
+
+	// OnStateChange, if set, is called after a host's breaker changes state.
+	OnStateChange func(host string, from, to BreakerState)
+}
+
+// NewHostBreakers returns breakers that hand parked URLs back through resume.
+// resume is called from its own goroutine and may block.
+func NewHostBreakers(opts BreakerOptions, resume func(url string)) *HostBreakers {
+	if opts.Window < 1 {
+		opts.Window = 1
+	}
+	if opts.HalfOpenProbes < 1 {
+		opts.HalfOpenProbes = 1
+	}
+	return &HostBreakers{opts: opts, hosts: make(map[string]*hostBreaker), resume: resume}
+}
+
+// Wrap returns a fetch function guarded by the breakers. It returns an error wrapping
+// ErrCircuitOpen, without calling fetch, for URLs it parks, and one wrapping
+// ErrParkingFull for URLs it cannot park.
+func (b *HostBreakers) Wrap(fetch func(context.Context, string) (*Document, error)) func(context.Context, string) (*Document, error) {
+	return func(ctx context.Context, rawURL string) (*Document, error) {
+		host := breakerHost(rawURL)
+		if err := b.allow(host, rawURL); err != nil {
+			return nil, fmt.Errorf("%s: %w", host, err)
+		}
+		doc, err := fetch(ctx, rawURL)
+		switch {
+		case ctx.Err() != nil:
+			b.release(host) // cancelled, says nothing about the host
+		case err != nil:
+			switch ClassifyError(err) {
+			case ClassDNS, ClassConnect, ClassTLS, ClassTimeout:
+				b.record(host, true)
+			default:
+				b.record(host, false)
+			}
+		default:
+			b.record(host, doc.StatusCode >= 500)
+		}
+		return doc, err
+	}
+}
+
+// State returns the breaker state of host. Hosts that were never seen are closed.
+func (b *HostBreakers) State(host string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if hb, ok := b.hosts[strings.ToLower(host)]; ok {
+		return hb.state
+	}
+	return BreakerClosed
+}
+
+// Parked returns the number of URLs waiting for their host's breaker.
+func (b *HostBreakers) Parked() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, hb := range b.hosts {
+		n += len(hb.parked)
+	}
+	return n
+}
+
+func breakerHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+func (b *HostBreakers) host(host string) *hostBreaker {
+	hb, ok := b.hosts[host]
+	if !ok {
+		hb = &hostBreaker{window: make([]bool, b.opts.Window)}
+		b.hosts[host] = hb
+	}
+	return hb
+}
+
+// allow returns nil if rawURL may be fetched now. Otherwise it parks the URL and returns
+// ErrCircuitOpen, or returns ErrParkingFull if the host has no room left.
+func (b *HostBreakers) allow(host, rawURL string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	hb := b.host(host)
+	switch hb.state {
+	case BreakerOpen:
+		return b.park(hb, rawURL)
+	case BreakerHalfOpen:
+		if hb.probes+hb.successes >= b.opts.HalfOpenProbes {
+			return b.park(hb, rawURL)
+		}
+		hb.probes++
+	}
+	return nil
+}
+
+// park queues rawURL until the breaker lets it through. b.mu must be held.
+func (b *HostBreakers) park(hb *hostBreaker, rawURL string) error {
+	if b.opts.MaxParked > 0 && len(hb.parked) >= b.opts.MaxParked {
+		return ErrParkingFull
+	}
+	hb.parked = append(hb.parked, rawURL)
+	return ErrCircuitOpen
+}
+
+// release gives back a half-open probe slot without recording an outcome.
+func (b *HostBreakers) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if hb := b.host(host); hb.state == BreakerHalfOpen && hb.probes > 0 {
+		hb.probes--
+	}
+}
+
+// record counts the outcome of a request to host and moves the breaker between states.
+func (b *HostBreakers) record(host string, failed bool) {
+	b.mu.Lock()
+	hb := b.host(host)
+	from := hb.state
+	var resumed []string
+
+	switch hb.state {
+	case BreakerClosed:
+		hb.window[hb.next] = failed
+		hb.next = (hb.next + 1) % len(hb.window)
+		if hb.filled < len(hb.window) {
+			hb.filled++
+		}
+		if failed {
+			hb.consecutive++
+		} else {
+			hb.consecutive = 0
+		}
+		if b.shouldTrip(hb) {
+			b.open(host, hb)
+		}
+	case BreakerHalfOpen:
+		if hb.probes > 0 {
+			hb.probes--
+		}
+		if failed {
+			b.open(host, hb)
+			break
+		}
+		hb.successes++
+		if hb.successes >= b.opts.HalfOpenProbes {
+			hb.state = BreakerClosed
+			hb.consecutive, hb.filled, hb.next = 0, 0, 0
+			resumed, hb.parked = hb.parked, nil
+		}
+	case BreakerOpen:
+		// A request that started before the breaker tripped; nothing to learn from it.
+	}
+	to := hb.state
+	b.mu.Unlock()
+
+	b.notify(host, from, to)
+	b.resumeAll(resumed)
+}
+
+func (b *HostBreakers) shouldTrip(hb *hostBreaker) bool {
+	if b.opts.ConsecutiveFailures > 0 && hb.consecutive >= b.opts.ConsecutiveFailures {
+		return true
+	}
+	if b.opts.FailureRate <= 0 || hb.filled < b.opts.MinRequests || hb.filled == 0 {
+		return false
+	}
+	failures := 0
+	for i := 0; i < hb.filled; i++ {
+		if hb.window[i] {
+			failures++
+		}
+	}
+	return float64(failures)/float64(hb.filled) >= b.opts.FailureRate
+}
+
+// open trips the breaker and schedules the move to half-open. b.mu must be held.
+func (b *HostBreakers) open(host string, hb *hostBreaker) {
+	hb.state = BreakerOpen
+	hb.probes, hb.successes = 0, 0
+	time.AfterFunc(b.opts.OpenTimeout, func() { b.halfOpen(host) })
+}
+
+// halfOpen moves an open breaker to half-open and resumes the first parked URL as a probe.
+func (b *HostBreakers) halfOpen(host string) {
+	b.mu.Lock()
+	hb := b.host(host)
+	if hb.state != BreakerOpen {
+		b.mu.Unlock()
+		return
+	}
+	hb.state = BreakerHalfOpen
+	var probe []string
+	if len(hb.parked) > 0 {
+		probe, hb.parked = hb.parked[:1], hb.parked[1:]
+	}
+	b.mu.Unlock()
+
+	b.notify(host, BreakerOpen, BreakerHalfOpen)
+	b.resumeAll(probe)
+}
+
+func (b *HostBreakers) notify(host string, from, to BreakerState) {
+	if from != to && b.OnStateChange != nil {
+		b.OnStateChange(host, from, to)
+	}
+}
+
+func (b *HostBreakers) resumeAll(urls []string) {
+	if len(urls) == 0 || b.resume == nil {
+		return
+	}
+	go func() {
+		for _, u := range urls {
+			b.resume(u)
+		}
+	}()
+}
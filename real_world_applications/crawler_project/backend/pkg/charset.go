@@ -0,0 +1,180 @@
+package pkg
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+)
+
+// prescanLimit is how far into a document we look for a <meta> or XML encoding declaration.
+const prescanLimit = 1024
+
+var (
+	metaCharset = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)`)
+	xmlEncoding = regexp.MustCompile(`(?i)^\s*<\?xml[^>]+encoding\s*=\s*["']([a-z0-9_:.\-]+)["']`)
+)
+
+// DetectCharset works out the character encoding of body. The sources are tried in order:
+//  1. A byte order mark.
+//  2. The charset parameter of the Content-Type header.
+//  3. A <meta charset> or http-equiv declaration, or the XML declaration, near the start of the document.
+//  4. Sniffing: valid UTF-8 is UTF-8, otherwise the CJK encoding that decodes most plausibly,
+//     otherwise windows-1252, which is what browsers assume for unlabelled Western pages.
+//
+// It returns the encoding and its canonical name.
+func DetectCharset(body []byte, contentType string) (encoding.Encoding, string) {
+	if enc, name := bomCharset(body); enc != nil {
+		return enc, name
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if enc, name := charset.Lookup(params["charset"]); enc != nil {
+			return enc, name
+		}
+	}
+
+	head := body
+	if len(head) > prescanLimit {
+		head = head[:prescanLimit]
+	}
+	for _, pattern := range []*regexp.Regexp{xmlEncoding, metaCharset} {
+		if m := pattern.FindSubmatch(head); m != nil {
+			if enc, name := charset.Lookup(string(m[1])); enc != nil {
+				return enc, name
+			}
+		}
+	}
+
+	return sniffCharset(body)
+}
+
+// DecodeToUTF8 transcodes body from the encoding reported by DetectCharset to UTF-8.
+// It returns the UTF-8 body and the name of the source encoding.
+func DecodeToUTF8(body []byte, contentType string) ([]byte, string, error) {
+	enc, name := DetectCharset(body, contentType)
+	if name == "utf-8" {
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), name, nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, name, err
+	}
+	return bytes.TrimPrefix(decoded, []byte("\xef\xbb\xbf")), name, nil
+}
+
+// isTextual reports whether a media type carries text that should be transcoded.
+func isTextual(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/xml" ||
+		mediaType == "application/json"
+}
+
+func bomCharset(body []byte) (encoding.Encoding, string) {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		return xunicode.UTF8, "utf-8"
+	case bytes.HasPrefix(body, []byte("\xfe\xff")):
+		return xunicode.UTF16(xunicode.BigEndian, xunicode.ExpectBOM), "utf-16be"
+	case bytes.HasPrefix(body, []byte("\xff\xfe")):
+		return xunicode.UTF16(xunicode.LittleEndian, xunicode.ExpectBOM), "utf-16le"
+	}
+	return nil, ""
+}
+
+// sniffCandidates are the multi-byte encodings considered when a page is not labelled.
+var sniffCandidates = []struct {
+	name string
+	enc  encoding.Encoding
+}{
+	{"shift_jis", japanese.ShiftJIS},
+	{"euc-jp", japanese.EUCJP},
+	{"gbk", simplifiedchinese.GBK},
+	{"euc-kr", korean.EUCKR},
+}
+
+// sniffCharset guesses the encoding of unlabelled bytes.
+// Each CJK candidate is decoded and scored by its runs of CJK characters: real CJK text
+// produces long runs, while Western text forced through a CJK decoder produces isolated
+// characters between Latin letters, which count against the candidate. Any decoding error
+// disqualifies a candidate. Kana only scores for the Japanese encodings and Hangul only for
+// EUC-KR, so Japanese text is not mistaken for GBK.
+func sniffCharset(body []byte) (encoding.Encoding, string) {
+	if utf8.Valid(body) {
+		return xunicode.UTF8, "utf-8"
+	}
+
+	bestScore, bestIndex := 0, -1
+	for i, candidate := range sniffCandidates {
+		decoded, err := candidate.enc.NewDecoder().Bytes(body)
+		if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+			continue
+		}
+
+		score, runLen, runWeight := 0, 0, 0
+		flush := func() {
+			if runLen >= 2 {
+				score += runWeight
+			} else if runLen == 1 {
+				score--
+			}
+			runLen, runWeight = 0, 0
+		}
+		for _, r := range string(decoded) {
+			w := cjkWeight(candidate.name, r)
+			if w > 0 {
+				runLen++
+				runWeight += w
+				continue
+			}
+			flush()
+			score += w
+		}
+		flush()
+
+		if score > bestScore {
+			bestScore, bestIndex = score, i
+		}
+	}
+	if bestIndex >= 0 {
+		return sniffCandidates[bestIndex].enc, sniffCandidates[bestIndex].name
+	}
+	return charmap.Windows1252, "windows-1252"
+}
+
+// cjkWeight rates how typical r is of text in the named encoding.
+// Positive weights extend a run of CJK text, negative weights are penalties.
+func cjkWeight(encodingName string, r rune) int {
+	japanese := encodingName == "shift_jis" || encodingName == "euc-jp"
+	switch {
+	case r >= 0xff61 && r <= 0xff9f:
+		// Half-width katakana is legal Shift_JIS but rare, so it usually signals a misdecode.
+		return -2
+	case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+		if japanese {
+			return 3
+		}
+		return 0
+	case unicode.Is(unicode.Hangul, r):
+		if encodingName == "euc-kr" {
+			return 3
+		}
+		return 0
+	case unicode.Is(unicode.Han, r),
+		r >= 0x3000 && r <= 0x303f, // CJK punctuation
+		r >= 0xff01 && r <= 0xff5e: // full-width forms
+		return 1
+	}
+	return 0
+}
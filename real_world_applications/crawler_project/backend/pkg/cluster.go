@@ -0,0 +1,404 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClusterSecretHeader carries the shared secret on every request between nodes.
+const ClusterSecretHeader = "X-Cluster-Secret"
+
+// ClusterOptions configures a Cluster.
+type ClusterOptions struct {
+	Self              string        // base URL other nodes reach this node at, e.g. http://10.0.0.5:8080
+	Seeds             []string      // base URLs of nodes to contact when starting
+	Secret            string        // shared by every node of the cluster
+	Replicas          int           // points per node on the hash ring
+	HeartbeatInterval time.Duration // how often every known node is pinged
+	FailureThreshold  int           // missed pings before a node is dropped
+	Client            *http.Client  // defaults to a client with a 5 second timeout
+}
+
+// Cluster splits the crawl between several crawler nodes by hashing hostnames onto a
+// ring of the live nodes. Every host has exactly one owner, which keeps the frontier
+// and the seen set of that host; URLs found for other hosts are forwarded to their
+// owner over HTTP.
+//
+// Membership is kept with heartbeats. Every HeartbeatInterval each node pings the nodes
+// it knows and its seeds; a ping tells the receiver about the sender and answers with
+// the receiver's member list, so a new node only needs one seed to be found by all.
+// Nodes learned second hand are added once they answer a ping themselves. A node that
+// misses FailureThreshold pings in a row is dropped, and a node shutting down announces
+// it. Whenever the membership changes the ring is rebuilt and OnChange is called; URLs
+// already queued for hosts that moved are forwarded when they are taken from the frontier.
+type Cluster struct {
+	opts ClusterOptions
+
+	mu         sync.Mutex
+	ring       *HashRing
+	members    map[string]int // node -> consecutive missed pings
+	candidates map[string]bool
+	left       bool
+
+	// Deliver receives the URLs this node owns, both its own and forwarded ones.
+	Deliver func(urls []string)
+	// OnChange, if set, is called with the new member list after membership changes.
+	OnChange func(members []string)
+}
+
+// NewCluster returns a cluster whose only member is this node. Call Run to join the others.
+func NewCluster(opts ClusterOptions) *Cluster {
+	opts.Self = normalizeNode(opts.Self)
+	if opts.Replicas <= 0 {
+		opts.Replicas = 128
+	}
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = 2 * time.Second
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 5 * time.Second}
+	}
+	c := &Cluster{
+		opts:       opts,
+		ring:       NewHashRing(opts.Replicas),
+		members:    map[string]int{opts.Self: 0},
+		candidates: make(map[string]bool),
+	}
+	c.ring.Set([]string{opts.Self})
+	return c
+}
+
+// Self returns this node's address.
+func (c *Cluster) Self() string {
+	return c.opts.Self
+}
+
+// Members returns the live nodes, this one included, in sorted order.
+func (c *Cluster) Members() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ring.Nodes()
+}
+
+// Owner returns the node that crawls rawURL's host. URLs that do not parse belong to this node.
+func (c *Cluster) Owner(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return c.opts.Self
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ring.Owner(strings.ToLower(u.Hostname()))
+}
+
+// Owns reports whether this node crawls rawURL's host.
+func (c *Cluster) Owns(rawURL string) bool {
+	return c.Owner(rawURL) == c.opts.Self
+}
+
+// Route hands every URL to its owner: this node's through Deliver, the others' in one
+// request per owner. URLs that cannot be forwarded are delivered here instead, so none
+// are lost while the membership catches up, and the forwarding errors are returned.
+func (c *Cluster) Route(ctx context.Context, urls []string) error {
+	byOwner := make(map[string][]string)
+	for _, u := range urls {
+		owner := c.Owner(u)
+		byOwner[owner] = append(byOwner[owner], u)
+	}
+	local := byOwner[c.opts.Self]
+	delete(byOwner, c.opts.Self)
+
+	var errs []error
+	for node, batch := range byOwner {
+		if err := c.call(ctx, node, "/cluster/urls", urlsMessage{URLs: batch}, nil); err != nil {
+			errs = append(errs, fmt.Errorf("error forwarding %d urls to %s: %v", len(batch), node, err))
+			local = append(local, batch...)
+		}
+	}
+	if len(local) > 0 && c.Deliver != nil {
+		c.Deliver(local)
+	}
+	return errors.Join(errs...)
+}
+
+// Run joins the cluster and keeps the membership current until ctx is done, then tells
+// the other nodes this one is leaving.
+func (c *Cluster) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		c.heartbeat(ctx)
+		select {
+		case <-ctx.Done():
+			c.leave()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type pingMessage struct {
+	From    string   `json:"from"`
+	Members []string `json:"members,omitempty"`
+}
+
+type urlsMessage struct {
+	URLs []string `json:"urls"`
+}
+
+// heartbeat pings every known node, seed and candidate once.
+func (c *Cluster) heartbeat(ctx context.Context) {
+	c.mu.Lock()
+	targets := make(map[string]bool)
+	for node := range c.members {
+		targets[node] = true
+	}
+	for node := range c.candidates {
+		targets[node] = true
+	}
+	c.mu.Unlock()
+	for _, seed := range c.opts.Seeds {
+		targets[normalizeNode(seed)] = true
+	}
+	delete(targets, c.opts.Self)
+
+	var wg sync.WaitGroup
+	for node := range targets {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			var reply pingMessage
+			err := c.call(ctx, node, "/cluster/ping", pingMessage{From: c.opts.Self}, &reply)
+			if ctx.Err() != nil {
+				return
+			}
+			c.pinged(node, reply.Members, err)
+		}(node)
+	}
+	wg.Wait()
+}
+
+// pinged records the outcome of pinging node.
+func (c *Cluster) pinged(node string, theirMembers []string, err error) {
+	c.mu.Lock()
+	changed := false
+	if err != nil {
+		if misses, ok := c.members[node]; ok {
+			if misses+1 >= c.opts.FailureThreshold {
+				delete(c.members, node)
+				changed = true
+			} else {
+				c.members[node] = misses + 1
+			}
+		}
+		delete(c.candidates, node)
+	} else {
+		if _, ok := c.members[node]; !ok {
+			changed = true
+		}
+		c.members[node] = 0
+		delete(c.candidates, node)
+		for _, m := range theirMembers {
+			if m = normalizeNode(m); m != c.opts.Self {
+				if _, ok := c.members[m]; !ok {
+					c.candidates[m] = true
+				}
+			}
+		}
+	}
+	c.mu.Unlock()
+	if changed {
+		c.membershipChanged()
+	}
+}
+
+// join adds a node that contacted this one.
+func (c *Cluster) join(node string) {
+	c.mu.Lock()
+	_, known := c.members[node]
+	if !known {
+		c.members[node] = 0
+		delete(c.candidates, node)
+	}
+	c.mu.Unlock()
+	if !known {
+		c.membershipChanged()
+	}
+}
+
+// drop removes a node that announced it is leaving.
+func (c *Cluster) drop(node string) {
+	c.mu.Lock()
+	_, known := c.members[node]
+	if known && node != c.opts.Self {
+		delete(c.members, node)
+	}
+	delete(c.candidates, node)
+	c.mu.Unlock()
+	if known && node != c.opts.Self {
+		c.membershipChanged()
+	}
+}
+
+func (c *Cluster) membershipChanged() {
+	c.mu.Lock()
+	nodes := make([]string, 0, len(c.members))
+	for node := range c.members {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	c.ring.Set(nodes)
+	c.mu.Unlock()
+	if c.OnChange != nil {
+		c.OnChange(nodes)
+	}
+}
+
+// leave tells every other member this node is going away and stops answering pings.
+func (c *Cluster) leave() {
+	c.mu.Lock()
+	c.left = true
+	var others []string
+	for node := range c.members {
+		if node != c.opts.Self {
+			others = append(others, node)
+		}
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Client.Timeout+time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, node := range others {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			c.call(ctx, node, "/cluster/leave", pingMessage{From: c.opts.Self}, nil)
+		}(node)
+	}
+	wg.Wait()
+}
+
+// call posts msg as JSON to path on node and decodes the reply into reply, if not nil.
+func (c *Cluster) call(ctx context.Context, node, path string, msg, reply interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, node+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(ClusterSecretHeader, c.opts.Secret)
+	res, err := c.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return fmt.Errorf("%s%s: HTTP %d", node, path, res.StatusCode)
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(reply)
+}
+
+// Handler serves the requests other nodes send: POST /cluster/ping, /cluster/urls and
+// /cluster/leave, plus GET /cluster/members. Every request must carry the shared secret.
+func (c *Cluster) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/cluster/ping", func(w http.ResponseWriter, r *http.Request) {
+		var msg pingMessage
+		if !c.decode(w, r, &msg) {
+			return
+		}
+		c.mu.Lock()
+		left := c.left
+		c.mu.Unlock()
+		if left {
+			http.Error(w, "node is leaving", http.StatusServiceUnavailable)
+			return
+		}
+		if from := normalizeNode(msg.From); from != "" && from != c.opts.Self {
+			c.join(from)
+		}
+		writeClusterJSON(w, pingMessage{From: c.opts.Self, Members: c.Members()})
+	})
+	mux.HandleFunc("/cluster/urls", func(w http.ResponseWriter, r *http.Request) {
+		var msg urlsMessage
+		if !c.decode(w, r, &msg) {
+			return
+		}
+		// Forwarded URLs are taken as they are, even if this node's ring disagrees; the
+		// frontier checks ownership again once the membership has settled.
+		if c.Deliver != nil && len(msg.URLs) > 0 {
+			c.Deliver(msg.URLs)
+		}
+		writeClusterJSON(w, struct{}{})
+	})
+	mux.HandleFunc("/cluster/leave", func(w http.ResponseWriter, r *http.Request) {
+		var msg pingMessage
+		if !c.decode(w, r, &msg) {
+			return
+		}
+		c.drop(normalizeNode(msg.From))
+		writeClusterJSON(w, struct{}{})
+	})
+	mux.HandleFunc("/cluster/members", func(w http.ResponseWriter, r *http.Request) {
+		if !c.authorized(r) {
+			http.Error(w, "invalid cluster secret", http.StatusUnauthorized)
+			return
+		}
+		writeClusterJSON(w, pingMessage{From: c.opts.Self, Members: c.Members()})
+	})
+	return mux
+}
+
+func (c *Cluster) authorized(r *http.Request) bool {
+	got := r.Header.Get(ClusterSecretHeader)
+	return c.opts.Secret != "" && subtle.ConstantTimeCompare([]byte(got), []byte(c.opts.Secret)) == 1
+}
+
+// decode checks the method and secret of a node request and decodes its JSON body.
+func (c *Cluster) decode(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !c.authorized(r) {
+		http.Error(w, "invalid cluster secret", http.StatusUnauthorized)
+		return false
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 8<<20)).Decode(dst); err != nil {
+		http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeClusterJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// normalizeNode trims a node address so the same node is always spelled the same way.
+func normalizeNode(node string) string {
+	return strings.TrimRight(strings.TrimSpace(node), "/")
+}
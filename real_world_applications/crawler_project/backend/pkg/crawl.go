@@ -0,0 +1,305 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"web_crawler/models"
+)
+
+// Scope decides which discovered links a crawl follows, relative to the seed they came from.
+type Scope string
+
+const (
+	ScopeHost   Scope = "host"   // same host as the seed
+	ScopeDomain Scope = "domain" // the seed's host or any of its subdomains
+	ScopePrefix Scope = "prefix" // URLs under the seed's path
+	ScopeAny    Scope = "any"    // every http(s) URL
+)
+
+// ParseScope validates a scope name.
+func ParseScope(s string) (Scope, error) {
+	switch scope := Scope(strings.ToLower(s)); scope {
+	case ScopeHost, ScopeDomain, ScopePrefix, ScopeAny:
+		return scope, nil
+	}
+	return "", fmt.Errorf("unknown scope %q, use host, domain, prefix or any", s)
+}
+
+// Allows reports whether target is in scope for a crawl started at seed.
+func (s Scope) Allows(seed, target *url.URL) bool {
+	seedHost, targetHost := strings.ToLower(seed.Hostname()), strings.ToLower(target.Hostname())
+	switch s {
+	case ScopeHost:
+		return seedHost == targetHost
+	case ScopeDomain:
+		seedHost = strings.TrimPrefix(seedHost, "www.")
+		return targetHost == seedHost || strings.HasSuffix(targetHost, "."+seedHost)
+	case ScopePrefix:
+		prefix := seed.Path[:strings.LastIndex(seed.Path, "/")+1]
+		return seedHost == targetHost && strings.HasPrefix(target.Path, prefix)
+	case ScopeAny:
+		return true
+	}
+	return false
+}
+
+// CrawlOptions configures a Crawler.
+type CrawlOptions struct {
+	Workers  int
+	MaxDepth int   // links are followed up to this many hops from a seed; 0 fetches only the seeds
+	MaxPages int   // stop admitting new URLs after this many; 0 means no limit
+	Scope    Scope // defaults to ScopeHost
+	// Fetch downloads a URL. It defaults to FetchDocument.
+	Fetch func(ctx context.Context, url string) (*Document, error)
+}
+
+// CrawlResult is what a Crawler reports for every URL it processed.
+type CrawlResult struct {
+	URL         string   `json:"url"`
+	Depth       int      `json:"depth"`
+	StatusCode  int      `json:"status_code,omitempty"`
+	ContentType string   `json:"content_type,omitempty"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	Content     string   `json:"content,omitempty"`
+	Links       []string `json:"links,omitempty"`
+	// Structured is the schema.org, OpenGraph and Twitter card metadata of the page.
+	Structured *models.StructuredData `json:"structured,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	FetchedAt  time.Time              `json:"fetched_at"`
+	DurationMS int64                  `json:"duration_ms"`
+}
+
+// CrawlStats is a snapshot of a running crawl.
+type CrawlStats struct {
+	Queued   int64 // admitted URLs waiting for a worker
+	InFlight int64 // URLs being fetched and parsed
+	Done     int64 // URLs processed successfully
+	Failed   int64 // URLs that could not be fetched or extracted
+}
+
+// Crawler runs a self-contained crawl: it feeds a frontier of URLs through the Scheduler,
+// fetches and extracts each page, and follows in-scope links until the frontier drains.
+// Nothing is stored; every processed URL is reported to the emit callback of Run.
+type Crawler struct {
+	opts CrawlOptions
+
+	queued, inFlight, done, failed atomic.Int64
+}
+
+// crawlJob is a URL in the frontier with the seed whose scope applies to it.
+type crawlJob struct {
+	url   string
+	seed  *url.URL
+	depth int
+}
+
+// NewCrawler returns a Crawler with defaults filled in.
+func NewCrawler(opts CrawlOptions) *Crawler {
+	if opts.Workers < 1 {
+		opts.Workers = 1
+	}
+	if opts.Scope == "" {
+		opts.Scope = ScopeHost
+	}
+	if opts.Fetch == nil {
+		opts.Fetch = FetchDocument
+	}
+	return &Crawler{opts: opts}
+}
+
+// Stats returns the current progress counters. It is safe to call while Run is running.
+func (c *Crawler) Stats() CrawlStats {
+	return CrawlStats{
+		Queued:   c.queued.Load(),
+		InFlight: c.inFlight.Load(),
+		Done:     c.done.Load(),
+		Failed:   c.failed.Load(),
+	}
+}
+
+// Run crawls from seeds and returns once every admitted URL has been processed or ctx is done.
+// emit is called once per processed URL, never concurrently.
+func (c *Crawler) Run(ctx context.Context, seeds []string, emit func(CrawlResult)) error {
+	var (
+		mu       sync.Mutex
+		queue    []crawlJob
+		seen     = make(map[string]bool)
+		pending  int // admitted URLs not yet processed
+		drained  bool
+		wake     = make(chan struct{}, 1)
+		emitMu   sync.Mutex
+		admitted int
+	)
+	signal := func() {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	// admit adds a URL to the frontier unless it was seen before or the page budget is spent.
+	// mu must be held.
+	admit := func(job crawlJob) {
+		if seen[job.url] || (c.opts.MaxPages > 0 && admitted >= c.opts.MaxPages) {
+			return
+		}
+		seen[job.url] = true
+		admitted++
+		pending++
+		queue = append(queue, job)
+		c.queued.Add(1)
+		signal()
+	}
+	// finish marks one admitted URL as processed and detects when the frontier has drained.
+	finish := func() {
+		mu.Lock()
+		pending--
+		if pending == 0 {
+			drained = true
+		}
+		mu.Unlock()
+		signal()
+	}
+
+	mu.Lock()
+	var seedErrs []error
+	for _, s := range seeds {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			seedErrs = append(seedErrs, fmt.Errorf("invalid seed %q", s))
+			continue
+		}
+		u.Fragment = ""
+		admit(crawlJob{url: u.String(), seed: u})
+	}
+	if pending == 0 {
+		mu.Unlock()
+		return errors.Join(append(seedErrs, errors.New("no valid seeds"))...)
+	}
+	mu.Unlock()
+
+	worker := func(_ context.Context, job crawlJob) error {
+		c.queued.Add(-1)
+		c.inFlight.Add(1)
+		defer func() {
+			c.inFlight.Add(-1)
+			finish()
+		}()
+		// Jobs handed out after cancellation are drained without fetching.
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		result, links := c.process(ctx, job)
+		if result.Error != "" {
+			c.failed.Add(1)
+		} else {
+			c.done.Add(1)
+		}
+		if job.depth < c.opts.MaxDepth {
+			mu.Lock()
+			for _, link := range links {
+				if c.opts.Scope.Allows(job.seed, link) {
+					admit(crawlJob{url: link.String(), seed: job.seed, depth: job.depth + 1})
+				}
+			}
+			mu.Unlock()
+		}
+
+		emitMu.Lock()
+		emit(result)
+		emitMu.Unlock()
+		return nil
+	}
+
+	// Workers ignore ctx so the dispatcher below can never block on a pool that has exited.
+	sched := NewScheduler[crawlJob](c.opts.Workers, c.opts.Workers)
+	sched.Start(context.Background(), worker)
+	defer sched.Stop()
+
+	for {
+		mu.Lock()
+		if drained {
+			mu.Unlock()
+			return ctx.Err()
+		}
+		var next *crawlJob
+		if len(queue) > 0 && ctx.Err() == nil {
+			next = &queue[0]
+			queue = queue[1:]
+		}
+		mu.Unlock()
+
+		if next != nil {
+			sched.Submit(context.Background(), *next)
+			continue
+		}
+		if ctx.Err() != nil {
+			// Drop what is still queued; in-flight pages finish on their own.
+			mu.Lock()
+			pending -= len(queue)
+			c.queued.Add(-int64(len(queue)))
+			queue = nil
+			drained = pending == 0
+			mu.Unlock()
+			if drained {
+				return ctx.Err()
+			}
+			<-wake
+			continue
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// process fetches and extracts one URL and returns its result and resolved outbound links.
+func (c *Crawler) process(ctx context.Context, job crawlJob) (result CrawlResult, links []*url.URL) {
+	start := time.Now()
+	result = CrawlResult{URL: job.url, Depth: job.depth, FetchedAt: start}
+	defer func() { result.DurationMS = time.Since(start).Milliseconds() }()
+
+	doc, err := c.opts.Fetch(ctx, job.url)
+	if doc != nil {
+		result.StatusCode = doc.StatusCode
+		result.ContentType = doc.ContentType
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	page, err := Extract(doc)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Title = page.Title
+	result.Description = page.Description
+	result.Keywords = page.Keywords
+	result.Language = page.Language
+	result.Content = CombineStrings(page.Contents)
+	result.Structured = page.Structured
+
+	base, err := url.Parse(doc.URL)
+	if err != nil {
+		return result, nil
+	}
+	for _, link := range page.Links {
+		if target, ok := resolveLink(base, link.URL); ok {
+			links = append(links, target)
+			result.Links = append(result.Links, target.String())
+		}
+	}
+	return result, links
+}
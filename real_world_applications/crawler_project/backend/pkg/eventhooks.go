@@ -0,0 +1,241 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"web_crawler/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Headers of an event webhook delivery, besides the timestamp and signature. The event ID
+// lets receivers ignore a delivery they already processed when a retry repeats it.
+const (
+	WebhookEventHeader   = "X-Crawler-Event"
+	WebhookEventIDHeader = "X-Crawler-Event-ID"
+)
+
+// EventWebhooks delivers crawl events from a bus to the registered webhooks, one signed
+// POST per event. Every webhook has its own queue, so a slow or failing endpoint only
+// delays its own deliveries. Failed deliveries are retried with backoff; events that do
+// not fit in a full queue, or still fail after the last attempt, are reported to OnError
+// and dropped.
+type EventWebhooks struct {
+	Bus *EventBus
+	// Hooks loads the registered webhooks.
+	Hooks func(ctx context.Context) ([]models.EventWebhook, error)
+	// Retry spaces the attempts of a delivery. Network errors, 5xx, 408 and 429 responses
+	// are retried; other responses are final.
+	Retry RetryPolicy
+	// Timeout bounds each delivery attempt.
+	Timeout time.Duration
+	// QueueSize is how many events may wait for each webhook.
+	QueueSize int
+	// RefreshInterval is how often the webhooks are reloaded; Refresh reloads them sooner.
+	RefreshInterval time.Duration
+	// Client sends the deliveries; nil uses the fetch client.
+	Client *http.Client
+	// OnError, when set, is called for every event that is dropped, and with a nil hook
+	// when the webhooks cannot be loaded.
+	OnError func(hook *models.EventWebhook, e Event, err error)
+
+	mu     sync.Mutex
+	stale  bool
+	queues map[primitive.ObjectID]*hookQueue
+}
+
+// hookQueue holds the events waiting for one webhook.
+type hookQueue struct {
+	hook   models.EventWebhook
+	events chan Event
+	cancel context.CancelFunc
+}
+
+// NewEventWebhooks returns a dispatcher of the events on bus to the webhooks stored in MongoDB.
+func NewEventWebhooks(bus *EventBus, retry RetryPolicy, timeout time.Duration, queueSize int) *EventWebhooks {
+	return &EventWebhooks{
+		Bus:             bus,
+		Hooks:           func(ctx context.Context) ([]models.EventWebhook, error) { return models.ListEventWebhooks(ctx, "") },
+		Retry:           retry,
+		Timeout:         timeout,
+		QueueSize:       queueSize,
+		RefreshInterval: 30 * time.Second,
+		stale:           true,
+	}
+}
+
+// Refresh reloads the webhooks before the next event is dispatched, e.g. after one is
+// registered or deleted.
+func (w *EventWebhooks) Refresh() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stale = true
+}
+
+// Run dispatches events until ctx is done. When it falls behind the bus it resumes from
+// the bus history, so only events older than the history are lost.
+func (w *EventWebhooks) Run(ctx context.Context) {
+	defer w.stopQueues()
+	ticker := time.NewTicker(w.RefreshInterval)
+	defer ticker.Stop()
+
+	last := w.Bus.LastID()
+	for ctx.Err() == nil {
+		sub := w.Bus.Subscribe(last, w.QueueSize, nil)
+		w.consume(ctx, sub, ticker.C, &last)
+		sub.Close()
+	}
+}
+
+// consume dispatches the events of sub until it is closed or ctx is done.
+func (w *EventWebhooks) consume(ctx context.Context, sub *Subscription, refresh <-chan time.Time, last *uint64) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refresh:
+			w.Refresh()
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			w.Dispatch(ctx, e)
+			*last = e.ID
+		}
+	}
+}
+
+// Dispatch queues e for every webhook it matches, reloading the webhooks first when they
+// are stale.
+func (w *EventWebhooks) Dispatch(ctx context.Context, e Event) {
+	w.mu.Lock()
+	stale := w.stale
+	w.mu.Unlock()
+	if stale {
+		w.reload(ctx)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, q := range w.queues {
+		if !EventMatches(q.hook, e) {
+			continue
+		}
+		select {
+		case q.events <- e:
+		default:
+			if w.OnError != nil {
+				hook := q.hook
+				w.OnError(&hook, e, fmt.Errorf("webhook queue full, event %d dropped", e.ID))
+			}
+		}
+	}
+}
+
+// EventMatches reports whether hook subscribes to e.
+func EventMatches(hook models.EventWebhook, e Event) bool {
+	if hook.JobID != "" && hook.JobID != e.JobID {
+		return false
+	}
+	return len(hook.Events) == 0 || slices.Contains(hook.Events, string(e.Type))
+}
+
+// reload loads the webhooks, starting a queue for each new one and stopping the queues of
+// those that were deleted. The current queues are kept when loading fails.
+func (w *EventWebhooks) reload(ctx context.Context) {
+	hooks, err := w.Hooks(ctx)
+	if err != nil {
+		if w.OnError != nil {
+			w.OnError(nil, Event{}, err)
+		}
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stale = false
+	if w.queues == nil {
+		w.queues = make(map[primitive.ObjectID]*hookQueue)
+	}
+	current := make(map[primitive.ObjectID]bool)
+	for _, hook := range hooks {
+		current[hook.ID] = true
+		if _, ok := w.queues[hook.ID]; ok {
+			continue
+		}
+		qctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		q := &hookQueue{hook: hook, events: make(chan Event, w.QueueSize), cancel: cancel}
+		w.queues[hook.ID] = q
+		go w.deliverQueue(qctx, q)
+	}
+	for id, q := range w.queues {
+		if !current[id] {
+			q.cancel()
+			delete(w.queues, id)
+		}
+	}
+}
+
+func (w *EventWebhooks) stopQueues() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, q := range w.queues {
+		q.cancel()
+		delete(w.queues, id)
+	}
+}
+
+// deliverQueue delivers the events of q in order until ctx is cancelled.
+func (w *EventWebhooks) deliverQueue(ctx context.Context, q *hookQueue) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-q.events:
+			if err := w.deliver(ctx, q.hook, e); err != nil && ctx.Err() == nil && w.OnError != nil {
+				hook := q.hook
+				w.OnError(&hook, e, err)
+			}
+		}
+	}
+}
+
+// deliver POSTs e to hook, retrying transient failures.
+func (w *EventWebhooks) deliver(ctx context.Context, hook models.EventWebhook, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("error while encoding event: %v", err)
+	}
+	header := http.Header{}
+	header.Set(WebhookEventHeader, string(e.Type))
+	header.Set(WebhookEventIDHeader, strconv.FormatUint(e.ID, 10))
+	for attempt := 1; ; attempt++ {
+		actx, cancel := context.WithTimeout(ctx, w.Timeout)
+		err = postWebhook(actx, w.Client, hook.URL, hook.Secret, body, time.Now(), header)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		var status *webhookStatusError
+		if errors.As(err, &status) && status.StatusCode < 500 &&
+			status.StatusCode != http.StatusRequestTimeout && status.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+		if attempt >= w.Retry.MaxAttempts {
+			return fmt.Errorf("%v, after %d attempts", err, attempt)
+		}
+		timer := time.NewTimer(w.Retry.Backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType names a crawl lifecycle event.
+type EventType string
+
+const (
+	// EventURLEnqueued: a URL was queued for the workers and given a job ID.
+	EventURLEnqueued EventType = "url_enqueued"
+	// EventPageFetched: the page of a job was downloaded.
+	EventPageFetched EventType = "page_fetched"
+	// EventPageIndexed: the page of a job was stored in the index.
+	EventPageIndexed EventType = "page_indexed"
+	// EventFetchFailed: the page of a job could not be downloaded, after any retries.
+	EventFetchFailed EventType = "fetch_failed"
+	// EventJobCompleted: a job ended, with its outcome. It is the last event of every job.
+	EventJobCompleted EventType = "job_completed"
+)
+
+// EventTypes lists every event type in lifecycle order.
+var EventTypes = []EventType{EventURLEnqueued, EventPageFetched, EventPageIndexed, EventFetchFailed, EventJobCompleted}
+
+// JobOutcome is how a crawl job ended.
+type JobOutcome string
+
+const (
+	JobIndexed JobOutcome = "indexed"
+	JobSkipped JobOutcome = "skipped" // the content type is not crawled
+	JobFailed  JobOutcome = "failed"
+)
+
+// Event is a crawl lifecycle event. Which of the optional fields are set depends on Type.
+type Event struct {
+	// ID increases with every event published by this process, so a client can resume a
+	// stream after the last event it saw.
+	ID    uint64    `json:"id"`
+	Type  EventType `json:"type"`
+	JobID string    `json:"job_id"`
+	URL   string    `json:"url"`
+	Time  time.Time `json:"time"`
+
+	StatusCode  int        `json:"status_code,omitempty"`  // page_fetched, fetch_failed
+	ContentType string     `json:"content_type,omitempty"` // page_fetched, job_completed
+	PageID      string     `json:"page_id,omitempty"`      // page_indexed
+	Links       int        `json:"links,omitempty"`        // page_indexed
+	ErrorClass  ErrorClass `json:"error_class,omitempty"`  // fetch_failed
+	Attempts    int        `json:"attempts,omitempty"`     // fetch_failed
+	Error       string     `json:"error,omitempty"`        // fetch_failed, job_completed
+	Outcome     JobOutcome `json:"outcome,omitempty"`      // job_completed
+	DurationMS  int64      `json:"duration_ms,omitempty"`  // job_completed
+}
+
+// EventBus fans crawl events out to subscribers. Publishing never blocks the crawl: a
+// subscriber that falls a whole buffer behind is closed, and can subscribe again from the
+// last event it received to catch up from the bus's history.
+type EventBus struct {
+	// Now timestamps published events; nil uses time.Now.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	seq     uint64
+	history []Event // ring of the latest events, oldest at next once full
+	next    int
+	subs    map[*Subscription]struct{}
+}
+
+// Subscription receives the events of an EventBus that pass its filter.
+type Subscription struct {
+	// C delivers the events in order. It is closed by Close, or by the bus when the
+	// subscriber falls behind.
+	C <-chan Event
+
+	bus        *EventBus
+	ch         chan Event
+	filter     func(Event) bool
+	closed     bool
+	overflowed bool
+}
+
+// NewEventBus returns a bus that keeps the latest history events for subscribers resuming
+// a stream.
+func NewEventBus(history int) *EventBus {
+	return &EventBus{
+		history: make([]Event, 0, history),
+		subs:    make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns e its ID and time and delivers it to the subscribers. It returns the
+// published event.
+func (b *EventBus) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e.ID = b.seq
+	if b.Now != nil {
+		e.Time = b.Now()
+	} else {
+		e.Time = time.Now()
+	}
+	if cap(b.history) > 0 {
+		if len(b.history) < cap(b.history) {
+			b.history = append(b.history, e)
+		} else {
+			b.history[b.next] = e
+			b.next = (b.next + 1) % len(b.history)
+		}
+	}
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+			s.overflowed = true
+			b.close(s)
+		}
+	}
+	return e
+}
+
+// Subscribe returns a subscription to the events that pass filter, or to every event when
+// filter is nil. Events after the one with ID since that are still in the history are
+// delivered first; since 0 starts with the next event published. buffer is how many
+// events the subscriber may fall behind before it is closed.
+func (b *EventBus) Subscribe(since uint64, buffer int, filter func(Event) bool) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var replay []Event
+	if since > 0 {
+		for i := range b.history {
+			e := b.history[(b.next+i)%len(b.history)]
+			if e.ID > since && (filter == nil || filter(e)) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	ch := make(chan Event, len(replay)+buffer)
+	for _, e := range replay {
+		ch <- e
+	}
+	s := &Subscription{C: ch, bus: b, ch: ch, filter: filter}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// LastID returns the ID of the latest published event, or 0 before the first.
+func (b *EventBus) LastID() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// close ends s; b.mu must be held.
+func (b *EventBus) close(s *Subscription) {
+	if !s.closed {
+		s.closed = true
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
+
+// Close ends the subscription and closes C.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.close(s)
+}
+
+// Overflowed reports whether the bus closed the subscription because it fell behind.
+func (s *Subscription) Overflowed() bool {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	return s.overflowed
+}
+
+// CrawlJobs tracks the job ID of every queued URL until its crawl ends, so the events of
+// one crawl can be told apart and followed by clients.
+type CrawlJobs struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// NewCrawlJobs returns an empty job tracker.
+func NewCrawlJobs() *CrawlJobs {
+	return &CrawlJobs{ids: make(map[string]string)}
+}
+
+// Start returns the job ID of url, starting a job with newID when url has none. started
+// reports whether the job is new.
+func (j *CrawlJobs) Start(url string, newID func() string) (id string, started bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if id, ok := j.ids[url]; ok {
+		return id, false
+	}
+	id = newID()
+	j.ids[url] = id
+	return id, true
+}
+
+// Finish ends the job of url and returns its ID, or "" when url has no job.
+func (j *CrawlJobs) Finish(url string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	id := j.ids[url]
+	delete(j.ids, url)
+	return id
+}
+
+// ID returns the job ID of url, or "" when url has no job.
+func (j *CrawlJobs) ID(url string) string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.ids[url]
+}
+
+// Len returns the number of jobs in progress.
+func (j *CrawlJobs) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.ids)
+}
@@ -0,0 +1,278 @@
+package pkg
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web_crawler/models"
+)
+
+// ExportFormats are the formats pages can be exported in.
+var ExportFormats = []string{"jsonl", "csv", "parquet"}
+
+// exportField is a WebPage field that can be exported.
+type exportField struct {
+	name  string
+	typ   ParquetType
+	value func(p models.WebPage) interface{}
+}
+
+// exportFields lists the exportable fields in their default order. Their names are the
+// JSON names of the WebPage fields, which are also the indexed source fields.
+var exportFields = []exportField{
+	{"id", ParquetString, func(p models.WebPage) interface{} { return p.ID }},
+	{"url", ParquetString, func(p models.WebPage) interface{} { return p.URL }},
+	{"status_code", ParquetInt64, func(p models.WebPage) interface{} { return p.StatusCode }},
+	{"title", ParquetString, func(p models.WebPage) interface{} { return p.Title }},
+	{"description", ParquetString, func(p models.WebPage) interface{} { return p.Desription }},
+	{"keywords", ParquetString, func(p models.WebPage) interface{} { return p.Keywords }},
+	{"content_type", ParquetString, func(p models.WebPage) interface{} { return p.ContentType }},
+	{"language", ParquetString, func(p models.WebPage) interface{} { return p.Language }},
+	{"pagerank", ParquetDouble, func(p models.WebPage) interface{} { return p.PageRank }},
+	{"crawled_at", ParquetTimestamp, func(p models.WebPage) interface{} { return p.CrawledAt }},
+	{"structured", ParquetString, func(p models.WebPage) interface{} { return p.Structured }},
+	{"content", ParquetString, func(p models.WebPage) interface{} { return p.Content }},
+}
+
+// ExportFields returns the names of the fields that can be exported, in default order.
+func ExportFields() []string {
+	names := make([]string, len(exportFields))
+	for i, f := range exportFields {
+		names[i] = f.name
+	}
+	return names
+}
+
+// ExportOptions configures an export of indexed pages.
+type ExportOptions struct {
+	Format string   // jsonl, csv or parquet
+	Fields []string // fields to export in this order; empty exports every field
+	Gzip   bool     // compress the output
+	Filter models.PageFilter
+}
+
+// Exporter streams indexed pages to a writer.
+type Exporter struct {
+	Options ExportOptions
+
+	// Pages calls fn for every page matching the filter, loading only the given source
+	// fields, or all of them when fields is nil.
+	Pages func(ctx context.Context, filter models.PageFilter, fields []string, fn func(models.WebPage) error) error
+
+	fields []exportField
+}
+
+// NewExporter validates opts and returns an exporter of the pages in the index.
+func NewExporter(opts ExportOptions) (*Exporter, error) {
+	if !slices.Contains(ExportFormats, opts.Format) {
+		return nil, fmt.Errorf("unknown export format %q, want one of %s", opts.Format, strings.Join(ExportFormats, ", "))
+	}
+	e := &Exporter{Options: opts, Pages: models.ForEachWebPage}
+	if len(opts.Fields) == 0 {
+		e.fields = exportFields
+	}
+	for _, name := range opts.Fields {
+		i := slices.IndexFunc(exportFields, func(f exportField) bool { return f.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown export field %q, want some of %s", name, strings.Join(ExportFields(), ", "))
+		}
+		if slices.ContainsFunc(e.fields, func(f exportField) bool { return f.name == name }) {
+			return nil, fmt.Errorf("export field %q given twice", name)
+		}
+		e.fields = append(e.fields, exportFields[i])
+	}
+	return e, nil
+}
+
+// FileName returns the name of the export file, e.g. "pages.csv.gz".
+func (e *Exporter) FileName() string {
+	name := "pages." + e.Options.Format
+	if e.Options.Gzip {
+		name += ".gz"
+	}
+	return name
+}
+
+// ContentType returns the media type of the export file.
+func (e *Exporter) ContentType() string {
+	switch {
+	case e.Options.Gzip:
+		return "application/gzip"
+	case e.Options.Format == "csv":
+		return "text/csv; charset=utf-8"
+	case e.Options.Format == "parquet":
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Export writes every matching page to w and returns how many were written. Pages are
+// encoded as they are read, so memory use does not grow with the number of pages.
+func (e *Exporter) Export(ctx context.Context, w io.Writer) (int, error) {
+	var zw *gzip.Writer
+	if e.Options.Gzip {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	enc, err := e.encoder(w)
+	if err != nil {
+		return 0, err
+	}
+
+	// The ID comes with every hit, so it is never requested as a source field.
+	var source []string
+	if len(e.Options.Fields) > 0 {
+		source = []string{}
+		for _, f := range e.fields {
+			if f.name != "id" {
+				source = append(source, f.name)
+			}
+		}
+	}
+	count := 0
+	err = e.Pages(ctx, e.Options.Filter, source, func(page models.WebPage) error {
+		values := make([]interface{}, len(e.fields))
+		for i, f := range e.fields {
+			values[i] = f.value(page)
+		}
+		count++
+		return enc.write(values)
+	})
+	if err != nil {
+		return count, err
+	}
+	if err := enc.close(); err != nil {
+		return count, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// exportEncoder writes rows of field values in one format.
+type exportEncoder interface {
+	write(values []interface{}) error
+	close() error
+}
+
+func (e *Exporter) encoder(w io.Writer) (exportEncoder, error) {
+	switch e.Options.Format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := make([]string, len(e.fields))
+		for i, f := range e.fields {
+			header[i] = f.name
+		}
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{w: cw}, nil
+	case "parquet":
+		columns := make([]ParquetColumn, len(e.fields))
+		for i, f := range e.fields {
+			columns[i] = ParquetColumn{Name: f.name, Type: f.typ}
+		}
+		return &parquetEncoder{w: NewParquetWriter(w, columns)}, nil
+	default:
+		return &jsonlEncoder{w: w, fields: e.fields}, nil
+	}
+}
+
+// jsonlEncoder writes one JSON object per line, with the fields in export order.
+type jsonlEncoder struct {
+	w      io.Writer
+	fields []exportField
+	buf    []byte
+}
+
+func (j *jsonlEncoder) write(values []interface{}) error {
+	j.buf = append(j.buf[:0], '{')
+	for i, v := range values {
+		if i > 0 {
+			j.buf = append(j.buf, ',')
+		}
+		j.buf = strconv.AppendQuote(j.buf, j.fields[i].name)
+		j.buf = append(j.buf, ':')
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		j.buf = append(j.buf, data...)
+	}
+	j.buf = append(j.buf, '}', '\n')
+	_, err := j.w.Write(j.buf)
+	return err
+}
+
+func (j *jsonlEncoder) close() error { return nil }
+
+// csvEncoder writes a header row and one row per page. Keywords are joined with "; ",
+// structured data is JSON and times are RFC 3339.
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (c *csvEncoder) write(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = exportString(v)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvEncoder) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// parquetEncoder writes a Parquet file. Keywords are joined with "; " and structured data
+// is a JSON string.
+type parquetEncoder struct {
+	w *ParquetWriter
+}
+
+func (p *parquetEncoder) write(values []interface{}) error {
+	for i, v := range values {
+		switch v.(type) {
+		case []string, *models.StructuredData:
+			values[i] = exportString(v)
+		}
+	}
+	return p.w.WriteRow(values...)
+}
+
+func (p *parquetEncoder) close() error { return p.w.Close() }
+
+func exportString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, "; ")
+	case *models.StructuredData:
+		if v == nil {
+			return ""
+		}
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"web_crawler/models"
+
+	"golang.org/x/net/html"
+)
+
+// PageResult is the structured content extracted from a fetched document, whatever its format.
+type PageResult struct {
+	ContentType string
+	Title       string
+	Description string
+	Keywords    []string
+	Contents    []string
+	Links       []Link
+	// Language is the ISO 639-1 code detected from the text, or LanguageUnknown.
+	Language string
+	// Structured is the schema.org, OpenGraph and Twitter card metadata of HTML pages.
+	Structured *models.StructuredData
+}
+
+// Extractor turns the body of a document into a PageResult.
+type Extractor interface {
+	Extract(body []byte) (*PageResult, error)
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(body []byte) (*PageResult, error)
+
+// Extract calls f(body).
+func (f ExtractorFunc) Extract(body []byte) (*PageResult, error) {
+	return f(body)
+}
+
+// UnsupportedTypeError is returned by Extract when no extractor handles a media type.
+type UnsupportedTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported content type %q", e.ContentType)
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   = map[string]Extractor{
+		"text/html":             ExtractorFunc(extractHTML),
+		"application/xhtml+xml": ExtractorFunc(extractHTML),
+		"text/plain":            ExtractorFunc(extractText),
+		"text/xml":              ExtractorFunc(extractXML),
+		"application/xml":       ExtractorFunc(extractXML),
+		"application/rss+xml":   ExtractorFunc(extractXML),
+		"application/atom+xml":  ExtractorFunc(extractXML),
+		"application/json":      ExtractorFunc(extractJSON),
+		"application/pdf":       ExtractorFunc(extractPDF),
+	}
+)
+
+// RegisterExtractor adds or replaces the extractor used for a media type.
+func RegisterExtractor(mediaType string, e Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors[strings.ToLower(mediaType)] = e
+}
+
+// Extract dispatches doc to the extractor registered for its media type.
+// Types ending in +xml or +json fall back to the generic XML and JSON extractors.
+// It returns an *UnsupportedTypeError when no extractor applies.
+func Extract(doc *Document) (*PageResult, error) {
+	extractorsMu.RLock()
+	e, ok := extractors[doc.ContentType]
+	if !ok {
+		switch {
+		case strings.HasSuffix(doc.ContentType, "+xml"):
+			e, ok = extractors["application/xml"]
+		case strings.HasSuffix(doc.ContentType, "+json"):
+			e, ok = extractors["application/json"]
+		}
+	}
+	extractorsMu.RUnlock()
+	if !ok {
+		return nil, &UnsupportedTypeError{ContentType: doc.ContentType}
+	}
+
+	result, err := e.Extract(doc.Body)
+	if err != nil {
+		return nil, err
+	}
+	result.ContentType = doc.ContentType
+	result.Language = DetectLanguage(result.Title + "\n" + result.Description + "\n" + strings.Join(result.Contents, "\n"))
+	return result, nil
+}
+
+func extractHTML(body []byte) (*PageResult, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	links, contents, title, description, keywords := parseDocument(doc)
+	structured := extractStructuredData(doc)
+	if description == "" && structured != nil {
+		// Pages often only describe themselves for link previews.
+		if structured.OpenGraph != nil {
+			description = structured.OpenGraph.Description
+		}
+		if description == "" && structured.Twitter != nil {
+			description = structured.Twitter.Description
+		}
+	}
+	return &PageResult{
+		Title:       title,
+		Description: description,
+		Keywords:    keywords,
+		Contents:    contents,
+		Links:       links,
+		Structured:  structured,
+	}, nil
+}
+
+// urlPattern finds absolute http(s) URLs in free text.
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'()\[\]{}]+`)
+
+// textLinks returns every URL mentioned in text, without trailing punctuation.
+func textLinks(text string) []Link {
+	var links []Link
+	for _, u := range urlPattern.FindAllString(text, -1) {
+		links = append(links, Link{URL: strings.TrimRight(u, ".,;:!?")})
+	}
+	return links
+}
+
+// paragraphs splits text on blank lines and collapses whitespace inside each paragraph.
+func paragraphs(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var out []string
+	for _, block := range strings.Split(text, "\n\n") {
+		if p := strings.Join(strings.Fields(block), " "); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// extractText treats the first non-empty line as the title and blank-line separated blocks as paragraphs.
+func extractText(body []byte) (*PageResult, error) {
+	text := string(body)
+	result := &PageResult{
+		Contents: paragraphs(text),
+		Links:    textLinks(text),
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result.Title = truncate(line, 200)
+			break
+		}
+	}
+	return result, nil
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// extractJSON walks a JSON document. Well known keys fill the title, description and keywords,
+// string values that are URLs become links (named after their key) and other strings become content.
+func extractJSON(body []byte) (*PageResult, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	result := &PageResult{}
+	walkJSON(result, "", value)
+	result.Keywords = uniqueAndTrim(result.Keywords)
+	return result, nil
+}
+
+func walkJSON(result *PageResult, key string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// Visit keys in order so the output does not depend on map iteration.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkJSON(result, strings.ToLower(k), v[k])
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkJSON(result, key, item)
+		}
+	case string:
+		text := strings.TrimSpace(v)
+		if text == "" {
+			return
+		}
+		switch {
+		case (key == "title" || key == "name" || key == "headline") && result.Title == "":
+			result.Title = text
+		case (key == "description" || key == "summary") && result.Description == "":
+			result.Description = text
+		case key == "keywords" || key == "tags":
+			result.Keywords = append(result.Keywords, strings.Split(text, ",")...)
+		case urlPattern.FindString(text) == text:
+			result.Links = append(result.Links, Link{URL: text, Text: key})
+		default:
+			result.Contents = append(result.Contents, text)
+		}
+	}
+}
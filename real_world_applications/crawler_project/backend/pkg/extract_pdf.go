@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// extractPDF extracts the plain text of every page and the title from the document info dictionary.
+// The PDF reader panics on some malformed files, so panics are turned into errors.
+func extractPDF(body []byte) (result *PageResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("malformed pdf: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return nil, err
+	}
+	text, err := io.ReadAll(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	info := reader.Trailer().Key("Info")
+	result = &PageResult{
+		Title:       strings.TrimSpace(info.Key("Title").Text()),
+		Description: strings.TrimSpace(info.Key("Subject").Text()),
+		Keywords:    uniqueAndTrim(strings.Split(info.Key("Keywords").Text(), ",")),
+		Contents:    paragraphs(string(text)),
+		Links:       textLinks(string(text)),
+	}
+	if result.Title == "" && len(result.Contents) > 0 {
+		result.Title = truncate(result.Contents[0], 200)
+	}
+	return result, nil
+}
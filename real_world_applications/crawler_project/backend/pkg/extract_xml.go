@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+)
+
+// extractXML handles RSS, Atom and generic XML documents.
+// The first <title> becomes the page title and the first <description> or <subtitle> the description.
+// <link> elements and href attributes become links, and all other text becomes content.
+func extractXML(body []byte) (*PageResult, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		return input, nil // NormalizeCharset has already transcoded the body to UTF-8
+	}
+
+	result := &PageResult{}
+	var stack []string
+	var lastTitle string
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, strings.ToLower(t.Name.Local))
+			for _, attr := range t.Attr {
+				if attr.Name.Local == "href" && attr.Value != "" {
+					result.Links = append(result.Links, Link{URL: attr.Value, Text: lastTitle})
+				}
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			text := strings.Join(strings.Fields(string(t)), " ")
+			if text == "" || len(stack) == 0 {
+				continue
+			}
+			switch stack[len(stack)-1] {
+			case "title":
+				lastTitle = text
+				if result.Title == "" {
+					result.Title = text
+				} else {
+					result.Contents = append(result.Contents, text)
+				}
+			case "description", "subtitle":
+				if result.Description == "" {
+					result.Description = text
+				} else {
+					result.Contents = append(result.Contents, text)
+				}
+			case "link", "guid", "loc":
+				if urlPattern.MatchString(text) {
+					result.Links = append(result.Links, Link{URL: text, Text: lastTitle})
+				}
+			case "category", "keywords":
+				result.Keywords = append(result.Keywords, text)
+			default:
+				result.Contents = append(result.Contents, text)
+			}
+		}
+	}
+
+	result.Keywords = uniqueAndTrim(result.Keywords)
+	return result, nil
+}
@@ -2,31 +2,246 @@ package pkg
 
 import (
 	"context"
-	"time"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
 
+	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 )
 
-func Fetch(url string) (string, error) {
-	// Create a context with a timeout to ensure a maximum amount of time spent fetching
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
-	// Create a new chromedp context
-	ctx, cancel = chromedp.NewContext(ctx)
+// render loads an already fetched HTML body into a headless browser and returns the
+// HTML after JavaScript ran. The page is not fetched again, and a <base> element pointing
+// at pageURL lets relative scripts and links resolve as they would on the real page.
+// Every request the browser makes goes through a RenderProxy applying l.
+func render(ctx context.Context, l FetchLimits, pageURL string, body []byte) (string, error) {
+	proxy, err := StartRenderProxy(l)
+	if err != nil {
+		return "", err
+	}
+	defer proxy.Close()
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ProxyServer(proxy.URL()),
+		// Chrome sends loopback requests around a proxy unless told not to.
+		chromedp.Flag("proxy-bypass-list", "<-loopback>"),
+		// WebRTC would otherwise open UDP connections of its own.
+		chromedp.Flag("force-webrtc-ip-handling-policy", "disable_non_proxied_udp"),
+	)
+	ctx, cancelAlloc := chromedp.NewExecAllocator(ctx, opts...)
+	defer cancelAlloc()
+	ctx, cancel := chromedp.NewContext(ctx)
 	defer cancel()
 
+	content := `<base href="` + html.EscapeString(pageURL) + `">` + string(body)
 	var htmlContent string
-
-	// Run tasks
-	// Navigate to the site and get the rendered HTML after JavaScript execution
-	err := chromedp.Run(ctx,
-		chromedp.Navigate(url),
+	err = chromedp.Run(ctx,
+		chromedp.Navigate("about:blank"),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			tree, err := page.GetFrameTree().Do(ctx)
+			if err != nil {
+				return err
+			}
+			return page.SetDocumentContent(tree.Frame.ID, content).Do(ctx)
+		}),
 		chromedp.OuterHTML("html", &htmlContent, chromedp.ByQuery),
 	)
 	if err != nil {
 		return "", err
 	}
-
 	return htmlContent, nil
 }
+
+// Document is a fetched resource together with the metadata needed to extract it.
+type Document struct {
+	// URL is where the document was fetched from, after following any redirects.
+	URL string
+	// Redirects lists the URLs that redirected to URL, starting with the one requested.
+	Redirects   []string
+	StatusCode  int
+	ContentType string // media type without parameters, e.g. "text/html"
+	Charset     string // encoding the body was transcoded from, empty for binary types
+	Header      http.Header
+	Body        []byte
+	// RawHash is the raw store hash of the body as received, empty when no raw store is set.
+	RawHash string
+}
+
+// ErrBodyTooLarge is returned when a response body exceeds FetchLimits.MaxBodySize.
+var ErrBodyTooLarge = errors.New("response body too large")
+
+var (
+	archiveMu        sync.RWMutex
+	archive          *WARCWriter
+	rawStore         *RawStore
+	renderJavaScript = true
+)
+
+// SetRenderJavaScript controls whether FetchDocument renders HTML pages in a headless browser.
+// Rendering is on by default; without it the HTML is used as served.
+func SetRenderJavaScript(enabled bool) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	renderJavaScript = enabled
+}
+
+// SetArchive makes FetchDocument record every HTTP exchange in w. Pass nil to stop archiving.
+func SetArchive(w *WARCWriter) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	archive = w
+}
+
+// SetRawStore makes FetchDocument keep every raw body in s so pages can be replayed later.
+// Pass nil to stop storing bodies.
+func SetRawStore(s *RawStore) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	rawStore = s
+}
+
+// FetchDocument downloads url with a plain HTTP GET and records its media type.
+// When the server sends no usable Content-Type the type is sniffed from the body.
+// The request is bounded by the limits set with SetFetchLimits; responses of a type
+// that is not allowed are returned without a body along with an *UnsupportedTypeError.
+// If an archive or raw store is set, the raw response is written to it before any
+// decoding. Unless disabled with SetRenderJavaScript, HTML documents are then rendered
+// in a headless browser so JavaScript generated content is captured; the browser's own
+// requests are held to the same limits through a RenderProxy.
+func FetchDocument(ctx context.Context, url string) (*Document, error) {
+	limits, client := currentFetchLimits()
+	if limits.TotalTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.TotalTimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	// res.Request is the last request made, after any redirects.
+	finalURL, redirects := res.Request.URL.String(), redirectChain(res)
+
+	if mt := headerMediaType(res.Header.Get("Content-Type")); mt != "" && !limits.allowsType(mt) {
+		doc := &Document{URL: finalURL, Redirects: redirects, StatusCode: res.StatusCode, ContentType: mt, Header: res.Header}
+		return doc, &UnsupportedTypeError{ContentType: mt}
+	}
+
+	var reader io.Reader = res.Body
+	if limits.MaxBodySize > 0 {
+		reader = io.LimitReader(res.Body, limits.MaxBodySize+1)
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxBodySize > 0 && int64(len(body)) > limits.MaxBodySize {
+		return nil, fmt.Errorf("%s: %w", url, ErrBodyTooLarge)
+	}
+
+	archiveMu.RLock()
+	w, store, renderJS := archive, rawStore, renderJavaScript
+	archiveMu.RUnlock()
+	if w != nil {
+		if err := w.WriteExchange(res.Request, res, body); err != nil {
+			return nil, fmt.Errorf("error archiving %s: %v", url, err)
+		}
+	}
+	var rawHash string
+	if store != nil {
+		if rawHash, err = store.Put(body); err != nil {
+			return nil, fmt.Errorf("error storing raw body of %s: %v", url, err)
+		}
+	}
+
+	doc, err := newDocument(finalURL, res.StatusCode, res.Header, body)
+	if err != nil {
+		return nil, err
+	}
+	doc.Redirects = redirects
+	doc.RawHash = rawHash
+	if !limits.allowsType(doc.ContentType) {
+		doc.Body = nil
+		return doc, &UnsupportedTypeError{ContentType: doc.ContentType}
+	}
+
+	if renderJS && doc.ContentType == "text/html" {
+		if rendered, err := render(ctx, limits, doc.URL, doc.Body); err == nil {
+			doc.Body = []byte(rendered)
+		}
+	}
+	return doc, nil
+}
+
+// redirectChain returns the URLs that redirected to the final request of res, oldest first,
+// or nil when the first request was answered directly.
+func redirectChain(res *http.Response) []string {
+	var chain []string
+	for prev := res.Request.Response; prev != nil; prev = prev.Request.Response {
+		chain = append([]string{prev.Request.URL.String()}, chain...)
+	}
+	return chain
+}
+
+// newDocument builds a Document from a raw response, working out its media type
+// and transcoding textual bodies to UTF-8.
+func newDocument(url string, status int, header http.Header, body []byte) (*Document, error) {
+	doc := &Document{
+		URL:         url,
+		StatusCode:  status,
+		ContentType: mediaType(header.Get("Content-Type"), body),
+		Header:      header,
+		Body:        body,
+	}
+	if err := NormalizeCharset(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// mediaType returns the lower case media type from a Content-Type header,
+// falling back to content sniffing when the header is missing or generic.
+func mediaType(header string, body []byte) string {
+	if mt := headerMediaType(header); mt != "" {
+		return mt
+	}
+	mt, _, _ := mime.ParseMediaType(http.DetectContentType(body))
+	return mt
+}
+
+// headerMediaType returns the lower case media type from a Content-Type header, or ""
+// when the header is missing, malformed or generic and the body has to be sniffed.
+func headerMediaType(header string) string {
+	if header == "" {
+		return ""
+	}
+	if mt, _, err := mime.ParseMediaType(header); err == nil && mt != "application/octet-stream" {
+		return strings.ToLower(mt)
+	}
+	return ""
+}
+
+// NormalizeCharset transcodes the body of a textual document to UTF-8 in place
+// and records the encoding it was detected as. Binary documents are left untouched.
+func NormalizeCharset(doc *Document) error {
+	if !isTextual(doc.ContentType) {
+		return nil
+	}
+	body, name, err := DecodeToUTF8(doc.Body, doc.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("error decoding %s body: %v", name, err)
+	}
+	doc.Body = body
+	doc.Charset = name
+	return nil
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// HashRing assigns keys to nodes with consistent hashing. Every node is placed on the
+// ring at several points (virtual nodes) so keys spread evenly, and adding or removing
+// a node only moves the keys between it and its neighbours.
+//
+// A HashRing is not safe for concurrent use; Cluster guards its ring with a mutex.
+type HashRing struct {
+	replicas int
+	points   []uint64
+	owners   map[uint64]string
+	nodes    []string
+}
+
+// NewHashRing returns an empty ring that places each node at replicas points.
+func NewHashRing(replicas int) *HashRing {
+	return &HashRing{replicas: max(replicas, 1), owners: make(map[uint64]string)}
+}
+
+// Set replaces the nodes on the ring.
+func (r *HashRing) Set(nodes []string) {
+	r.nodes = slices.Clone(nodes)
+	sort.Strings(r.nodes)
+	r.nodes = slices.Compact(r.nodes)
+	r.points = r.points[:0]
+	clear(r.owners)
+	for _, node := range r.nodes {
+		for i := 0; i < r.replicas; i++ {
+			p := ringHash(node + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[p]; taken {
+				continue // astronomically unlikely; the first node keeps the point
+			}
+			r.owners[p] = node
+			r.points = append(r.points, p)
+		}
+	}
+	slices.Sort(r.points)
+}
+
+// Nodes returns the nodes on the ring in sorted order.
+func (r *HashRing) Nodes() []string {
+	return slices.Clone(r.nodes)
+}
+
+// Owner returns the node responsible for key, or "" when the ring is empty.
+func (r *HashRing) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
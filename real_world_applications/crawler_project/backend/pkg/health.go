@@ -0,0 +1,155 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Check probes a single dependency and returns an error if it is unavailable.
+type Check func(ctx context.Context) error
+
+// ComponentStatus is the result of probing one dependency or queue.
+type ComponentStatus struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	Depth     *int   `json:"depth,omitempty"`
+	Threshold *int   `json:"threshold,omitempty"`
+}
+
+// HealthReport is the combined status of every registered component.
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	CheckedAt  time.Time                  `json:"checked_at"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// Healthy reports whether every component is up.
+func (r HealthReport) Healthy() bool {
+	return r.Status == StatusUp
+}
+
+type queueProbe struct {
+	depth     func() int
+	threshold int
+}
+
+// HealthChecker runs dependency checks concurrently, each bounded by a timeout,
+// and compares queue depths against their thresholds.
+type HealthChecker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks map[string]Check
+	queues map[string]queueProbe
+}
+
+// NewHealthChecker creates a HealthChecker that gives each check at most timeout to answer.
+func NewHealthChecker(timeout time.Duration) *HealthChecker {
+	return &HealthChecker{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+		queues:  make(map[string]queueProbe),
+	}
+}
+
+// AddCheck registers a dependency check under name.
+func (h *HealthChecker) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// AddQueue registers a queue that counts as down once depth() exceeds threshold.
+func (h *HealthChecker) AddQueue(name string, depth func() int, threshold int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.queues[name] = queueProbe{depth: depth, threshold: threshold}
+}
+
+// Dependencies probes only the registered dependency checks.
+func (h *HealthChecker) Dependencies(ctx context.Context) HealthReport {
+	return h.run(ctx, false)
+}
+
+// Readiness probes the dependencies and the queue thresholds.
+func (h *HealthChecker) Readiness(ctx context.Context) HealthReport {
+	return h.run(ctx, true)
+}
+
+func (h *HealthChecker) run(ctx context.Context, withQueues bool) HealthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	report := HealthReport{
+		Status:     StatusUp,
+		CheckedAt:  time.Now(),
+		Components: make(map[string]ComponentStatus, len(h.checks)+len(h.queues)),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range h.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			status := h.probe(ctx, check)
+			mu.Lock()
+			report.Components[name] = status
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	if withQueues {
+		for name, queue := range h.queues {
+			depth, threshold := queue.depth(), queue.threshold
+			status := ComponentStatus{Status: StatusUp, Depth: &depth, Threshold: &threshold}
+			if depth > threshold {
+				status.Status = StatusDown
+				status.Error = "queue is backed up past its threshold"
+			}
+			report.Components[name] = status
+		}
+	}
+
+	for _, status := range report.Components {
+		if status.Status != StatusUp {
+			report.Status = StatusDown
+			break
+		}
+	}
+	return report
+}
+
+// probe runs a single check with the configured timeout. A check that ignores its context
+// is abandoned once the timeout passes so one hung dependency cannot block the report.
+func (h *HealthChecker) probe(ctx context.Context, check Check) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	status := ComponentStatus{Status: StatusUp, LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+	}
+	return status
+}
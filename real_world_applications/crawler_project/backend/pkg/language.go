@@ -0,0 +1,192 @@
+package pkg
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// LanguageUnknown is reported when a text is too short or too ambiguous to classify.
+const LanguageUnknown = "und"
+
+const (
+	// profileSize is the number of ranked n-grams kept per language profile.
+	profileSize = 400
+	// minLanguageLetters is the least number of letters DetectLanguage will classify.
+	minLanguageLetters = 20
+	// maxLanguageRunes bounds how much of a page is examined.
+	maxLanguageRunes = 4096
+)
+
+//go:embed langdata/*.txt
+var languageSamples embed.FS
+
+// languageProfiles holds the ranked n-gram profile of each Latin-script language,
+// built once from the training samples in langdata.
+var languageProfiles = loadLanguageProfiles()
+
+func loadLanguageProfiles() map[string]map[string]int {
+	entries, err := languageSamples.ReadDir("langdata")
+	if err != nil {
+		panic(err)
+	}
+	profiles := make(map[string]map[string]int, len(entries))
+	for _, entry := range entries {
+		sample, err := languageSamples.ReadFile(path.Join("langdata", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		code := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+		profiles[code] = rankNgrams(string(sample))
+	}
+	return profiles
+}
+
+// Languages returns the codes DetectLanguage can report, in sorted order.
+func Languages() []string {
+	codes := []string{"ar", "el", "ja", "ko", "ru", "zh"}
+	for code := range languageProfiles {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// DetectLanguage returns the ISO 639-1 code of the language text is written in,
+// or LanguageUnknown. Scripts used by a single supported language (kana, Hangul,
+// Cyrillic, Greek, Arabic, Han) decide directly; Latin-script text is classified by
+// comparing its 1-3 character n-gram ranking with each language profile using the
+// Cavnar-Trenkle out-of-place distance.
+func DetectLanguage(text string) string {
+	runes := []rune(text)
+	if len(runes) > maxLanguageRunes {
+		runes = runes[:maxLanguageRunes]
+	}
+
+	var letters, latin, kana, hangul, han, cyrillic, greek, arabic int
+	for _, r := range runes {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Greek, r):
+			greek++
+		case unicode.Is(unicode.Arabic, r):
+			arabic++
+		}
+	}
+
+	// CJK scripts carry far more information per character than alphabets.
+	cjk := kana + hangul + han
+	if cjk*4 >= letters && cjk >= minLanguageLetters/4 {
+		switch {
+		case kana > 0 && kana*10 >= cjk:
+			return "ja"
+		case hangul >= han:
+			return "ko"
+		default:
+			return "zh"
+		}
+	}
+	if letters < minLanguageLetters {
+		return LanguageUnknown
+	}
+	switch {
+	case cyrillic*2 > letters:
+		return "ru"
+	case greek*2 > letters:
+		return "el"
+	case arabic*2 > letters:
+		return "ar"
+	case latin*2 <= letters:
+		return LanguageUnknown
+	}
+
+	ranks := rankNgrams(string(runes))
+	best, bestDistance, secondDistance := LanguageUnknown, -1, -1
+	for code, profile := range languageProfiles {
+		d := outOfPlace(ranks, profile)
+		switch {
+		case bestDistance < 0 || d < bestDistance:
+			best, bestDistance, secondDistance = code, d, bestDistance
+		case secondDistance < 0 || d < secondDistance:
+			secondDistance = d
+		}
+	}
+	// Two profiles at the same distance means the text gave no usable signal.
+	if bestDistance == secondDistance {
+		return LanguageUnknown
+	}
+	return best
+}
+
+// rankNgrams counts the 1-3 letter n-grams of each lowercased word, padded with
+// spaces so word starts and ends are captured, and ranks the profileSize most frequent.
+func rankNgrams(text string) map[string]int {
+	counts := make(map[string]int)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	for _, word := range words {
+		padded := []rune(" " + word + " ")
+		for n := 1; n <= 3; n++ {
+			for i := 0; i+n <= len(padded); i++ {
+				gram := string(padded[i : i+n])
+				if gram != " " {
+					counts[gram]++
+				}
+			}
+		}
+	}
+
+	grams := make([]string, 0, len(counts))
+	for gram := range counts {
+		grams = append(grams, gram)
+	}
+	sort.Slice(grams, func(i, j int) bool {
+		if counts[grams[i]] != counts[grams[j]] {
+			return counts[grams[i]] > counts[grams[j]]
+		}
+		return grams[i] < grams[j]
+	})
+	if len(grams) > profileSize {
+		grams = grams[:profileSize]
+	}
+
+	ranks := make(map[string]int, len(grams))
+	for i, gram := range grams {
+		ranks[gram] = i
+	}
+	return ranks
+}
+
+// outOfPlace sums how far each n-gram of doc is from its rank in profile.
+// N-grams missing from the profile cost the maximum penalty.
+func outOfPlace(doc, profile map[string]int) int {
+	distance := 0
+	for gram, rank := range doc {
+		if p, ok := profile[gram]; ok {
+			if p > rank {
+				distance += p - rank
+			} else {
+				distance += rank - p
+			}
+		} else {
+			distance += profileSize
+		}
+	}
+	return distance
+}
@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultMaxBodySize is the largest response body FetchDocument reads unless configured otherwise.
+const DefaultMaxBodySize = 32 << 20
+
+// ErrBlockedAddress is returned when a URL resolves to a network the fetcher may not reach.
+var ErrBlockedAddress = errors.New("address is in a blocked network")
+
+// ErrTooManyRedirects is returned when a fetch follows more than MaxRedirects redirects.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+// FetchLimits bounds what FetchDocument is willing to do for a single URL.
+// Zero durations and sizes mean no limit.
+type FetchLimits struct {
+	ConnectTimeout time.Duration // establishing the TCP and TLS connection
+	HeaderTimeout  time.Duration // waiting for the response headers once the request is sent
+	TotalTimeout   time.Duration // the whole fetch, including reading and rendering the body
+	MaxBodySize    int64
+	MaxRedirects   int // redirects followed before giving up, 0 refuses every redirect
+	// AllowedTypes lists the media types worth downloading. Entries may use path.Match
+	// patterns such as "text/*" or "*/*+xml". Responses of other types are not read and
+	// FetchDocument returns an *UnsupportedTypeError. Empty allows every type.
+	AllowedTypes []string
+	// BlockPrivateNetworks refuses connections to loopback, private, link-local and
+	// unspecified addresses, except those in AllowedNetworks. The check is made on the
+	// address actually dialled, so redirects and DNS answers cannot get around it.
+	BlockPrivateNetworks bool
+	AllowedNetworks      []netip.Prefix
+}
+
+// DefaultFetchLimits returns the limits FetchDocument applies until SetFetchLimits is
+// called, which are also the ones the API server starts from.
+func DefaultFetchLimits() FetchLimits {
+	return FetchLimits{
+		ConnectTimeout:       10 * time.Second,
+		HeaderTimeout:        15 * time.Second,
+		TotalTimeout:         60 * time.Second,
+		MaxBodySize:          DefaultMaxBodySize,
+		MaxRedirects:         10,
+		AllowedTypes:         SupportedTypes(),
+		BlockPrivateNetworks: true,
+	}
+}
+
+var (
+	fetchLimits = DefaultFetchLimits()
+	fetchClient = newFetchClient(fetchLimits)
+)
+
+// SetFetchLimits replaces the limits FetchDocument applies. Until it is called the
+// DefaultFetchLimits apply, so private networks are blocked.
+func SetFetchLimits(l FetchLimits) {
+	client := newFetchClient(l)
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	fetchLimits, fetchClient = l, client
+}
+
+func currentFetchLimits() (FetchLimits, *http.Client) {
+	archiveMu.RLock()
+	defer archiveMu.RUnlock()
+	return fetchLimits, fetchClient
+}
+
+func newFetchClient(l FetchLimits) *http.Client {
+	return &http.Client{
+		Transport: newFetchTransport(l),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > l.MaxRedirects {
+				return fmt.Errorf("after %d redirects: %w", l.MaxRedirects, ErrTooManyRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// newFetchTransport returns a transport that connects through newFetchDialer and applies
+// the connect and header timeouts of l.
+func newFetchTransport(l FetchLimits) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // a proxy would be dialled instead of the target, defeating the guard
+	transport.DialContext = newFetchDialer(l).DialContext
+	transport.TLSHandshakeTimeout = l.ConnectTimeout
+	transport.ResponseHeaderTimeout = l.HeaderTimeout
+	return transport
+}
+
+// newFetchDialer returns a dialer that, when l blocks private networks, refuses to connect
+// to a blocked address.
+func newFetchDialer(l FetchLimits) *net.Dialer {
+	dialer := &net.Dialer{Timeout: l.ConnectTimeout, KeepAlive: 30 * time.Second}
+	if l.BlockPrivateNetworks {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return err
+			}
+			if l.blocked(addr) {
+				return fmt.Errorf("dial %s: %w", addr, ErrBlockedAddress)
+			}
+			return nil
+		}
+	}
+	return dialer
+}
+
+// blocked reports whether addr is in a private network that is not explicitly allowed.
+func (l FetchLimits) blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsLoopback() && !addr.IsPrivate() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range l.AllowedNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// allowsType reports whether a response of the given media type should be downloaded.
+func (l FetchLimits) allowsType(mediaType string) bool {
+	if len(l.AllowedTypes) == 0 {
+		return true
+	}
+	for _, pattern := range l.AllowedTypes {
+		if ok, _ := path.Match(strings.ToLower(pattern), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFetchURL reports whether rawURL may be fetched under the current limits: it must
+// be an absolute http or https URL, and with BlockPrivateNetworks none of the addresses
+// its host resolves to may be blocked. A host that does not resolve is not an error here;
+// the fetch itself will fail and be classified.
+func CheckFetchURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	limits, _ := currentFetchLimits()
+	if !limits.BlockPrivateNetworks {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if limits.blocked(addr) {
+			return fmt.Errorf("%s: %w", u.Hostname(), ErrBlockedAddress)
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if limits.blocked(addr) {
+			return fmt.Errorf("%s resolves to %s: %w", u.Hostname(), addr, ErrBlockedAddress)
+		}
+	}
+	return nil
+}
+
+// SupportedTypes returns the media type patterns Extract can handle, for use as
+// FetchLimits.AllowedTypes.
+func SupportedTypes() []string {
+	extractorsMu.RLock()
+	types := make([]string, 0, len(extractors)+2)
+	for mt := range extractors {
+		types = append(types, mt)
+	}
+	extractorsMu.RUnlock()
+	sort.Strings(types)
+	return append(types, "*/*+xml", "*/*+json")
+}
@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of a webhook delivery. The signature is "sha256=" followed by the hex HMAC-SHA256
+// of the timestamp, a dot and the body, keyed with the webhook secret.
+const (
+	WebhookTimestampHeader = "X-Crawler-Timestamp"
+	WebhookSignatureHeader = "X-Crawler-Signature"
+)
+
+// ErrBadSignature is returned by VerifyWebhookSignature for a delivery that was not signed
+// with the secret or is too old.
+var ErrBadSignature = errors.New("invalid webhook signature")
+
+// AlertPage is a page reported by a saved search alert.
+type AlertPage struct {
+	URL         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+// SearchAlert reports the pages that are new to a saved search's results or changed since
+// its previous run.
+type SearchAlert struct {
+	SearchID string      `json:"search_id"`
+	Name     string      `json:"name"`
+	Query    string      `json:"query"`
+	RunAt    time.Time   `json:"run_at"`
+	New      []AlertPage `json:"new"`
+	Changed  []AlertPage `json:"changed"`
+}
+
+// Notifier delivers saved search alerts.
+type Notifier interface {
+	Notify(ctx context.Context, alert SearchAlert) error
+}
+
+// WebhookNotifier POSTs alerts as JSON to URL, signed with Secret.
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	// Client sends the request; nil uses the fetch client, which refuses private networks
+	// when the fetch limits do.
+	Client *http.Client
+	// Now returns the delivery timestamp; nil uses time.Now.
+	Now func() time.Time
+}
+
+// Notify sends alert to the webhook. Any response other than 2xx is an error.
+func (w *WebhookNotifier) Notify(ctx context.Context, alert SearchAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error while encoding alert: %v", err)
+	}
+	now := time.Now
+	if w.Now != nil {
+		now = w.Now
+	}
+	return postWebhook(ctx, w.Client, w.URL, w.Secret, body, now(), nil)
+}
+
+// webhookStatusError is a webhook response other than 2xx.
+type webhookStatusError struct {
+	StatusCode int
+}
+
+func (e *webhookStatusError) Error() string {
+	return fmt.Sprintf("webhook responded with status %d", e.StatusCode)
+}
+
+// postWebhook POSTs a JSON body to url, signed with secret and timestamped with now, adding
+// any extra headers. A nil client uses the fetch client, which refuses private networks when
+// the fetch limits do. Responses other than 2xx are returned as a *webhookStatusError.
+func postWebhook(ctx context.Context, client *http.Client, url, secret string, body []byte, now time.Time, extra http.Header) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error while creating webhook request: %v", err)
+	}
+	for key, values := range extra {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, signWebhook(secret, timestamp, body))
+
+	if client == nil {
+		_, client = currentFetchLimits()
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error while calling webhook: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &webhookStatusError{StatusCode: res.StatusCode}
+	}
+	return nil
+}
+
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhookSignature checks the signature of a webhook delivery and that its timestamp
+// is no further than tolerance from now. Receivers use it to authenticate alerts.
+func VerifyWebhookSignature(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp := header.Get(WebhookTimestampHeader)
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return ErrBadSignature
+	}
+	want := signWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get(WebhookSignatureHeader)), []byte(want)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// logNotifierKeep is how many of the latest alerts a LogNotifier keeps.
+const logNotifierKeep = 100
+
+// LogNotifier writes alerts through Logf, one line per page, and keeps the latest ones for
+// inspection.
+type LogNotifier struct {
+	Logf func(format string, args ...interface{})
+
+	mu     sync.Mutex
+	alerts []SearchAlert
+}
+
+// Notify logs alert and records it.
+func (l *LogNotifier) Notify(ctx context.Context, alert SearchAlert) error {
+	if l.Logf != nil {
+		for _, p := range alert.New {
+			l.Logf("saved search %q: new page %s %q", alert.Name, p.URL, p.Title)
+		}
+		for _, p := range alert.Changed {
+			l.Logf("saved search %q: changed page %s %q", alert.Name, p.URL, p.Title)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.alerts = append(l.alerts, alert)
+	if len(l.alerts) > logNotifierKeep {
+		l.alerts = l.alerts[len(l.alerts)-logNotifierKeep:]
+	}
+	return nil
+}
+
+// Alerts returns the latest alerts, oldest first.
+func (l *LogNotifier) Alerts() []SearchAlert {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]SearchAlert(nil), l.alerts...)
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"context"
+	"web_crawler/models"
+)
+
+// PageHistory records edits and restores of indexed pages as page versions.
+type PageHistory struct {
+	// Read returns the page as currently indexed.
+	Read func(ctx context.Context, id string) (*models.WebPage, error)
+	// Replace writes a page as the whole indexed document.
+	Replace func(ctx context.Context, id string, page models.WebPage) error
+	// Get returns one version of a page.
+	Get func(ctx context.Context, pageID string, version int) (*models.PageVersion, error)
+	// Save stores a version, returning nil when the page did not change since its latest one.
+	Save func(ctx context.Context, v models.PageVersion) (*models.PageVersion, error)
+}
+
+// NewPageHistory returns a history over the pages in Elasticsearch and their versions in MongoDB.
+func NewPageHistory() *PageHistory {
+	return &PageHistory{
+		Read:    models.ReadWebPage,
+		Replace: models.ReplaceWebPage,
+		Get:     models.GetPageVersion,
+		Save:    models.SavePageVersion,
+	}
+}
+
+// Record adds v, an edit or restore of a page, to the page's history. before is the page
+// as it was, saved first when the history lacks it: only crawls went unrecorded, before
+// versions were kept, so it is saved as a crawl.
+//
+// Returns:
+// - The saved version, or nil when the page did not change since its latest version.
+// - An error if a version could not be saved.
+func (h *PageHistory) Record(ctx context.Context, v models.PageVersion, before *models.WebPage) (*models.PageVersion, error) {
+	if before != nil {
+		if _, err := h.Save(ctx, models.PageVersion{PageID: v.PageID, Page: before, Source: models.VersionCrawl}); err != nil {
+			return nil, err
+		}
+	}
+	return h.Save(ctx, v)
+}
+
+// Restore writes version of the page id back to the index on behalf of actorID and
+// records the restore as the newest version. Every field is written, so fields that were
+// empty in the version are emptied, except the PageRank score, which is recomputed over
+// the link graph rather than restored.
+//
+// Returns:
+//   - The page before and after the restore.
+//   - The restore version, or nil when the page already matched the version.
+//   - models.ErrPageVersionNotFound if the page has no such version, or another error if
+//     the page could not be read or written.
+func (h *PageHistory) Restore(ctx context.Context, id string, version int, actorID string) (before, after *models.WebPage, saved *models.PageVersion, err error) {
+	v, err := h.Get(ctx, id, version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	before, err = h.Read(ctx, id)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	page := *v.Page
+	page.ID = id
+	page.PageRank = before.PageRank
+	if err := h.Replace(ctx, id, page); err != nil {
+		return before, nil, nil, err
+	}
+	saved, err = h.Record(ctx, models.PageVersion{
+		PageID:       id,
+		Page:         &page,
+		Source:       models.VersionRestore,
+		ActorID:      actorID,
+		RestoredFrom: version,
+	}, before)
+	return before, &page, saved, err
+}
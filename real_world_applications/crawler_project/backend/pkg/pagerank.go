@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"sync"
+	"web_crawler/models"
+)
+
+// PageRankOptions tunes the PageRank computation.
+type PageRankOptions struct {
+	Damping       float64 // probability of following a link, usually 0.85
+	MaxIterations int
+	Tolerance     float64 // stop once the L1 change between iterations drops below this
+	Workers       int     // goroutines sharing each iteration
+}
+
+// DefaultPageRankOptions returns the commonly used PageRank parameters.
+func DefaultPageRankOptions() PageRankOptions {
+	return PageRankOptions{
+		Damping:       0.85,
+		MaxIterations: 50,
+		Tolerance:     1e-6,
+		Workers:       4,
+	}
+}
+
+// LinkGraph is a directed graph of URLs. Parallel edges and self links are ignored.
+type LinkGraph struct {
+	ids   map[string]int
+	urls  []string
+	in    [][]int // in[i] lists the nodes linking to i
+	out   []int   // out[i] is the number of distinct links leaving i
+	edges map[[2]int]bool
+}
+
+// NewLinkGraph creates an empty graph.
+func NewLinkGraph() *LinkGraph {
+	return &LinkGraph{
+		ids:   make(map[string]int),
+		edges: make(map[[2]int]bool),
+	}
+}
+
+func (g *LinkGraph) node(url string) int {
+	if id, ok := g.ids[url]; ok {
+		return id
+	}
+	id := len(g.urls)
+	g.ids[url] = id
+	g.urls = append(g.urls, url)
+	g.in = append(g.in, nil)
+	g.out = append(g.out, 0)
+	return id
+}
+
+// AddEdge records a link from one URL to another.
+func (g *LinkGraph) AddEdge(from, to string) {
+	f, t := g.node(from), g.node(to)
+	if f == t || g.edges[[2]int{f, t}] {
+		return
+	}
+	g.edges[[2]int{f, t}] = true
+	g.in[t] = append(g.in[t], f)
+	g.out[f]++
+}
+
+// Len returns the number of URLs in the graph.
+func (g *LinkGraph) Len() int {
+	return len(g.urls)
+}
+
+// PageRank computes the score of every URL by power iteration.
+// Scores are multiplied by the number of nodes so the average page scores 1.
+// Each iteration splits the nodes between opts.Workers goroutines; every goroutine only
+// writes the scores of its own nodes, so no locking is needed inside an iteration.
+func (g *LinkGraph) PageRank(opts PageRankOptions) map[string]float64 {
+	n := len(g.urls)
+	scores := make(map[string]float64, n)
+	if n == 0 {
+		return scores
+	}
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+
+	rank := make([]float64, n)
+	next := make([]float64, n)
+	for i := range rank {
+		rank[i] = 1 / float64(n)
+	}
+
+	chunk := (n + workers - 1) / workers
+	diffs := make([]float64, workers)
+	for iter := 0; iter < opts.MaxIterations; iter++ {
+		// Rank held by pages without outlinks is spread evenly over all pages.
+		dangling := 0.0
+		for i, r := range rank {
+			if g.out[i] == 0 {
+				dangling += r
+			}
+		}
+		base := (1-opts.Damping)/float64(n) + opts.Damping*dangling/float64(n)
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			lo, hi := w*chunk, (w+1)*chunk
+			if hi > n {
+				hi = n
+			}
+			wg.Add(1)
+			go func(w, lo, hi int) {
+				defer wg.Done()
+				diff := 0.0
+				for i := lo; i < hi; i++ {
+					sum := 0.0
+					for _, j := range g.in[i] {
+						sum += rank[j] / float64(g.out[j])
+					}
+					next[i] = base + opts.Damping*sum
+					diff += math.Abs(next[i] - rank[i])
+				}
+				diffs[w] = diff
+			}(w, lo, hi)
+		}
+		wg.Wait()
+
+		rank, next = next, rank
+		total := 0.0
+		for _, d := range diffs {
+			total += d
+		}
+		if total < opts.Tolerance {
+			break
+		}
+	}
+
+	for i, url := range g.urls {
+		scores[url] = rank[i] * float64(n)
+	}
+	return scores
+}
+
+// RunPageRank loads the stored link graph, computes PageRank and writes the scores back to the index.
+// It returns the number of scored URLs and the number of indexed pages that were updated.
+func RunPageRank(ctx context.Context, opts PageRankOptions) (int, int, error) {
+	graph := NewLinkGraph()
+	err := models.ForEachLink(ctx, func(link models.Link) error {
+		graph.AddEdge(link.From, link.To)
+		return ctx.Err()
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	scores := graph.PageRank(opts)
+	updated, err := models.UpdatePageRanks(ctx, scores)
+	return len(scores), updated, err
+}
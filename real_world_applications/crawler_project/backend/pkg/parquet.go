@@ -0,0 +1,326 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ParquetType is the type of a Parquet column.
+type ParquetType int
+
+const (
+	ParquetString    ParquetType = iota // UTF-8 byte array
+	ParquetInt64                        // 64-bit integer
+	ParquetDouble                       // 64-bit float
+	ParquetTimestamp                    // milliseconds since the Unix epoch
+)
+
+// ParquetColumn describes a column of a Parquet file.
+type ParquetColumn struct {
+	Name string
+	Type ParquetType
+}
+
+// parquetRowGroupBytes is the encoded size at which a row group is written out.
+const parquetRowGroupBytes = 8 << 20
+
+// Parquet physical types, converted types, encodings and thrift compact protocol types
+// from the Parquet format specification.
+const (
+	parquetTypeInt64     = 2
+	parquetTypeDouble    = 5
+	parquetTypeByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetEncodingPlain = 0
+	parquetEncodingRLE   = 3
+
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// ParquetWriter writes rows to a Parquet file with flat, required columns.
+//
+// Rows are buffered per column and written as a row group, one plain-encoded,
+// uncompressed data page per column, whenever the buffered values reach a few megabytes,
+// so memory stays bounded however many rows are written. Close writes the footer.
+type ParquetWriter struct {
+	w         io.Writer
+	offset    int64
+	columns   []ParquetColumn
+	values    []bytes.Buffer
+	buffered  int
+	rows      int
+	totalRows int64
+	groups    []parquetRowGroup
+	err       error
+}
+
+type parquetRowGroup struct {
+	rows   int
+	chunks []parquetChunk
+}
+
+type parquetChunk struct {
+	offset int64
+	size   int64
+}
+
+// NewParquetWriter returns a writer of rows with the given columns to w.
+func NewParquetWriter(w io.Writer, columns []ParquetColumn) *ParquetWriter {
+	return &ParquetWriter{w: w, columns: columns, values: make([]bytes.Buffer, len(columns))}
+}
+
+// WriteRow appends a row with one value per column: a string, an int64 or int, a float64
+// or a time.Time, matching the column types.
+func (p *ParquetWriter) WriteRow(values ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(values) != len(p.columns) {
+		return fmt.Errorf("parquet row has %d values, want %d", len(values), len(p.columns))
+	}
+	if p.offset == 0 {
+		p.write([]byte("PAR1"))
+	}
+	for i, v := range values {
+		col, buf := p.columns[i], &p.values[i]
+		before := buf.Len()
+		switch col.Type {
+		case ParquetString:
+			s, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("parquet column %s: %T is not a string", col.Name, v)
+			}
+			binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+			buf.WriteString(s)
+		case ParquetInt64:
+			var n int64
+			switch v := v.(type) {
+			case int64:
+				n = v
+			case int:
+				n = int64(v)
+			default:
+				return fmt.Errorf("parquet column %s: %T is not an integer", col.Name, v)
+			}
+			binary.Write(buf, binary.LittleEndian, n)
+		case ParquetDouble:
+			f, ok := v.(float64)
+			if !ok {
+				return fmt.Errorf("parquet column %s: %T is not a float64", col.Name, v)
+			}
+			binary.Write(buf, binary.LittleEndian, math.Float64bits(f))
+		case ParquetTimestamp:
+			t, ok := v.(time.Time)
+			if !ok {
+				return fmt.Errorf("parquet column %s: %T is not a time", col.Name, v)
+			}
+			binary.Write(buf, binary.LittleEndian, t.UnixMilli())
+		}
+		p.buffered += buf.Len() - before
+	}
+	p.rows++
+	if p.buffered >= parquetRowGroupBytes {
+		p.flush()
+	}
+	return p.err
+}
+
+// Close writes the remaining rows and the footer. It does not close the underlying writer.
+func (p *ParquetWriter) Close() error {
+	if p.offset == 0 {
+		p.write([]byte("PAR1"))
+	}
+	p.flush()
+
+	t := newThriftWriter()
+	t.i32(1, 1) // version
+	t.list(2, thriftStruct, len(p.columns)+1)
+	t.begin()
+	t.str(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.end()
+	for _, col := range p.columns {
+		t.begin()
+		t.i32(1, col.physicalType())
+		t.i32(3, 0) // required
+		t.str(4, col.Name)
+		switch col.Type {
+		case ParquetString:
+			t.i32(6, parquetConvertedUTF8)
+		case ParquetTimestamp:
+			t.i32(6, parquetConvertedTimestampMillis)
+		}
+		t.end()
+	}
+	t.i64(3, p.totalRows)
+	t.list(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		var total int64
+		for i, c := range g.chunks {
+			col := p.columns[i]
+			t.begin()
+			t.i64(2, c.offset)
+			t.structField(3)
+			t.i32(1, col.physicalType())
+			t.list(2, thriftI32, 2)
+			t.varint(zigzag(parquetEncodingPlain))
+			t.varint(zigzag(parquetEncodingRLE))
+			t.list(3, thriftBinary, 1)
+			t.varint(uint64(len(col.Name)))
+			t.WriteString(col.Name)
+			t.i32(4, 0) // uncompressed
+			t.i64(5, int64(g.rows))
+			t.i64(6, c.size)
+			t.i64(7, c.size)
+			t.i64(9, c.offset)
+			t.end()
+			t.end()
+			total += c.size
+		}
+		t.i64(2, total)
+		t.i64(3, int64(g.rows))
+		t.end()
+	}
+	t.str(6, "web_crawler")
+	t.WriteByte(0)
+
+	p.write(t.Bytes())
+	p.write(binary.LittleEndian.AppendUint32(nil, uint32(t.Len())))
+	p.write([]byte("PAR1"))
+	return p.err
+}
+
+// flush writes the buffered rows as a row group.
+func (p *ParquetWriter) flush() {
+	if p.rows == 0 || p.err != nil {
+		return
+	}
+	group := parquetRowGroup{rows: p.rows}
+	for i := range p.columns {
+		data := p.values[i].Bytes()
+		header := newThriftWriter()
+		header.i32(1, 0) // data page
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.structField(5)
+		header.i32(1, int32(p.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.end()
+		header.WriteByte(0)
+
+		chunk := parquetChunk{offset: p.offset, size: int64(header.Len() + len(data))}
+		p.write(header.Bytes())
+		p.write(data)
+		group.chunks = append(group.chunks, chunk)
+		p.values[i].Reset()
+	}
+	p.groups = append(p.groups, group)
+	p.totalRows += int64(p.rows)
+	p.rows, p.buffered = 0, 0
+}
+
+// write writes b to the underlying writer, keeping the first error.
+func (p *ParquetWriter) write(b []byte) {
+	if p.err != nil {
+		return
+	}
+	n, err := p.w.Write(b)
+	p.offset += int64(n)
+	p.err = err
+}
+
+func (c ParquetColumn) physicalType() int32 {
+	switch c.Type {
+	case ParquetString:
+		return parquetTypeByteArray
+	case ParquetDouble:
+		return parquetTypeDouble
+	default:
+		return parquetTypeInt64
+	}
+}
+
+// thriftWriter encodes structs with the thrift compact protocol used by Parquet metadata.
+type thriftWriter struct {
+	bytes.Buffer
+	last []int16 // the last field ID written at each struct nesting level
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	top := len(t.last) - 1
+	if delta := id - t.last[top]; delta > 0 && delta <= 15 {
+		t.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.WriteByte(typ)
+		t.varint(zigzag(int64(id)))
+	}
+	t.last[top] = id
+}
+
+// begin starts a struct that is a list element or, after structField, a field.
+func (t *thriftWriter) begin() { t.last = append(t.last, 0) }
+
+// end finishes the struct started by begin.
+func (t *thriftWriter) end() {
+	t.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftWriter) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(zigzag(int64(v)))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(zigzag(v))
+}
+
+func (t *thriftWriter) str(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.varint(uint64(len(s)))
+	t.WriteString(s)
+}
+
+func (t *thriftWriter) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.WriteByte(0xf0 | elem)
+	t.varint(uint64(n))
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	t.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -6,17 +6,28 @@ import (
 	"golang.org/x/net/html"
 )
 
-// Parse now also returns the title, description, and keywords of the HTML content.
-func Parse(htmlContent string) ([]string, []string, string, string, []string, error) {
-	urls := []string{}
-	contents := []string{}
-	var title, description string
-	keywords := []string{} // Use a slice for keywords
+// Link is an outbound link found on a page.
+type Link struct {
+	URL  string // href as written in the page
+	Text string // anchor text with whitespace collapsed
+}
 
+// Parse now also returns the title, description, and keywords of the HTML content.
+func Parse(htmlContent string) ([]Link, []string, string, string, []string, error) {
 	doc, err := html.Parse(strings.NewReader(htmlContent))
 	if err != nil {
 		return nil, nil, "", "", nil, err
 	}
+	links, contents, title, description, keywords := parseDocument(doc)
+	return links, contents, title, description, keywords, nil
+}
+
+// parseDocument returns the links, text, title, description and keywords of a parsed page.
+func parseDocument(doc *html.Node) ([]Link, []string, string, string, []string) {
+	urls := []Link{}
+	contents := []string{}
+	var title, description string
+	keywords := []string{} // Use a slice for keywords
 
 	var f func(*html.Node)
 	f = func(n *html.Node) {
@@ -25,7 +36,7 @@ func Parse(htmlContent string) ([]string, []string, string, string, []string, er
 			case "a": // Handle both <a> and <link> tags for URLs
 				for _, a := range n.Attr {
 					if a.Key == "href" {
-						urls = append(urls, a.Val)
+						urls = append(urls, Link{URL: a.Val, Text: nodeText(n)})
 						break
 					}
 				}
@@ -60,7 +71,24 @@ func Parse(htmlContent string) ([]string, []string, string, string, []string, er
 	// Trim and remove duplicates from keywords
 	keywords = uniqueAndTrim(keywords)
 
-	return urls, contents, title, description, keywords, nil
+	return urls, contents, title, description, keywords
+}
+
+// nodeText returns the text inside n with runs of whitespace collapsed to single spaces.
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
 }
 
 // uniqueAndTrim cleans up the keywords slice by trimming spaces and removing duplicates.
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// RawStore keeps raw response bodies on disk, gzip-compressed and addressed by the
+// SHA-256 of the uncompressed bytes. Identical bodies fetched from different URLs or
+// crawls are stored once. Files live under dir/<first two hex digits>/<hash>.gz.
+type RawStore struct {
+	dir string
+}
+
+// NewRawStore creates dir if needed and returns a store rooted there.
+func NewRawStore(dir string) (*RawStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &RawStore{dir: dir}, nil
+}
+
+// Put stores body and returns its hash. Storing a body that is already present is a no-op.
+func (s *RawStore) Put(body []byte) (string, error) {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	path := s.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file and rename it so readers never see a partial body.
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	gz := gzip.NewWriter(tmp)
+	if _, err := gz.Write(body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
+// Get returns the body stored under hash and checks it still matches the hash.
+func (s *RawStore) Get(hash string) ([]byte, error) {
+	if len(hash) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid raw body hash %q", hash)
+	}
+	data, err := os.ReadFile(s.path(hash))
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading raw body %s: %v", hash, err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("error reading raw body %s: %v", hash, err)
+	}
+	if sum := sha256.Sum256(body); hex.EncodeToString(sum[:]) != hash {
+		return nil, fmt.Errorf("raw body %s is corrupt", hash)
+	}
+	return body, nil
+}
+
+func (s *RawStore) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash+".gz")
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RenderProxy is an HTTP proxy the headless browser sends all of its traffic through while
+// it renders a page. Requests for scripts, frames and other subresources are made with the
+// same dialer as FetchDocument, so they cannot reach networks the fetch limits block,
+// whichever address DNS gives the browser or a redirect points it at.
+type RenderProxy struct {
+	limits    FetchLimits
+	dialer    *net.Dialer
+	transport *http.Transport
+	listener  net.Listener
+	server    *http.Server
+
+	mu      sync.Mutex
+	tunnels map[net.Conn]struct{} // hijacked CONNECT connections, which the server does not track
+}
+
+// StartRenderProxy starts a proxy on a loopback port that connects according to l.
+func StartRenderProxy(l FetchLimits) (*RenderProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	p := &RenderProxy{
+		limits:    l,
+		dialer:    newFetchDialer(l),
+		transport: newFetchTransport(l),
+		listener:  listener,
+		tunnels:   make(map[net.Conn]struct{}),
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// URL returns the address to configure as the browser's proxy.
+func (p *RenderProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Close stops the proxy and drops every open connection.
+func (p *RenderProxy) Close() error {
+	err := p.server.Close()
+	p.mu.Lock()
+	for conn := range p.tunnels {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.transport.CloseIdleConnections()
+	return err
+}
+
+// ServeHTTP forwards plain HTTP requests and opens tunnels for CONNECT requests.
+func (p *RenderProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+		return
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+	res, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	var body io.Reader = res.Body
+	if p.limits.MaxBodySize > 0 {
+		body = io.LimitReader(res.Body, p.limits.MaxBodySize)
+	}
+	io.Copy(w, body)
+}
+
+// tunnel connects the browser to r.Host for TLS and WebSocket traffic.
+func (p *RenderProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	target, err := p.dialer.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		target.Close()
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		target.Close()
+		return
+	}
+	p.track(client, target)
+	defer p.untrack(client, target)
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		// Bytes the browser sent after the CONNECT line may already be buffered.
+		io.Copy(target, buffered)
+		target.Close()
+		close(done)
+	}()
+	io.Copy(client, target)
+	client.Close()
+	<-done
+}
+
+func (p *RenderProxy) track(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		p.tunnels[conn] = struct{}{}
+	}
+}
+
+func (p *RenderProxy) untrack(conns ...net.Conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+		delete(p.tunnels, conn)
+	}
+}
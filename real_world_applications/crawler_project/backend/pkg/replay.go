@@ -0,0 +1,285 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"web_crawler/models"
+)
+
+// ReplayProgress is the checkpoint a Replayer keeps in its progress file.
+// Every raw page up to and including LastURL has been replayed successfully.
+type ReplayProgress struct {
+	LastURL   string    `json:"last_url"`
+	Processed int       `json:"processed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReplayStats counts what happened to the pages of one replay run.
+type ReplayStats struct {
+	Processed int // pages read from the raw store
+	Indexed   int // pages written to the index
+	Changed   int // dry run: pages whose indexed fields would change
+	Unchanged int // dry run: pages that would be indexed as they are
+	Skipped   int // pages with a content type no extractor handles
+	Failed    int // pages that could not be loaded, extracted or indexed
+}
+
+// Replayer re-runs stored raw pages through extraction and indexing, without fetching.
+//
+// Pages are replayed in URL order by Workers goroutines. After each page the checkpoint
+// advances past every page that has finished, stopping at the first failure, so a rerun
+// resumes where the last one stopped and retries the pages that failed. In dry-run mode
+// nothing is indexed or checkpointed; instead the changes re-indexing would make are
+// written to Diff.
+type Replayer struct {
+	Store        *RawStore
+	Workers      int
+	ProgressFile string // checkpoint path; empty disables resuming
+	DryRun       bool
+	Diff         io.Writer
+
+	// Pages streams the raw pages after a URL in URL order.
+	Pages func(ctx context.Context, after string, fn func(models.RawPage) error) error
+	// Current returns the indexed page for a URL, or nil. Used by dry runs.
+	Current func(ctx context.Context, url string) (*models.WebPage, error)
+	// Index stores the result of a replayed page.
+	Index func(ctx context.Context, doc *Document, result *PageResult) error
+	// OnError is told about every page that fails.
+	OnError func(url string, err error)
+}
+
+// NewReplayer returns a Replayer over store backed by the raw page records, the page index
+// and the link graph.
+func NewReplayer(store *RawStore, workers int) *Replayer {
+	return &Replayer{
+		Store:   store,
+		Workers: workers,
+		Diff:    os.Stdout,
+		Pages:   models.ForEachRawPage,
+		Current: models.FindWebPageByURL,
+		Index:   indexReplayed,
+		OnError: func(string, error) {},
+	}
+}
+
+// indexReplayed updates the indexed page, its history and the outbound links of a replayed
+// document.
+func indexReplayed(ctx context.Context, doc *Document, result *PageResult) error {
+	if _, err := indexCrawledPage(ctx, pageFromResult(doc, result)); err != nil {
+		return err
+	}
+	return StoreLinks(ctx, doc.URL, result.Links)
+}
+
+type replayOutcome int
+
+const (
+	replayIndexed replayOutcome = iota
+	replayChanged
+	replayUnchanged
+	replaySkipped
+	replayFailed
+)
+
+// Run replays every raw page after the saved checkpoint and returns the counts.
+func (r *Replayer) Run(ctx context.Context) (ReplayStats, error) {
+	var stats ReplayStats
+	progress, err := r.loadProgress()
+	if err != nil {
+		return stats, err
+	}
+	workers := r.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	type job struct {
+		seq  int
+		page models.RawPage
+	}
+	type done struct {
+		seq     int
+		url     string
+		outcome replayOutcome
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan job)
+	results := make(chan done)
+
+	var pagesErr error
+	go func() {
+		defer close(jobs)
+		seq := 0
+		pagesErr = r.Pages(ctx, progress.LastURL, func(page models.RawPage) error {
+			select {
+			case jobs <- job{seq: seq, page: page}:
+				seq++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	var wg sync.WaitGroup
+	var diffMu sync.Mutex
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- done{seq: j.seq, url: j.page.URL, outcome: r.replay(ctx, j.page, &diffMu)}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Advance the checkpoint over the contiguous run of finished pages.
+	finished := make(map[int]string)
+	next, sinceSave := 0, 0
+	var saveErr error
+	for res := range results {
+		stats.Processed++
+		switch res.outcome {
+		case replayIndexed:
+			stats.Indexed++
+		case replayChanged:
+			stats.Changed++
+		case replayUnchanged:
+			stats.Unchanged++
+		case replaySkipped:
+			stats.Skipped++
+		case replayFailed:
+			stats.Failed++
+			continue
+		}
+
+		finished[res.seq] = res.url
+		for url, ok := finished[next]; ok; url, ok = finished[next] {
+			delete(finished, next)
+			progress.LastURL = url
+			progress.Processed++
+			next++
+			sinceSave++
+		}
+		if sinceSave >= 100 && saveErr == nil {
+			// Keep draining results after a failed save so the workers can exit.
+			if saveErr = r.saveProgress(progress); saveErr != nil {
+				cancel()
+			}
+			sinceSave = 0
+		}
+	}
+
+	if saveErr != nil {
+		return stats, saveErr
+	}
+	if err := r.saveProgress(progress); err != nil {
+		return stats, err
+	}
+	if pagesErr != nil && !errors.Is(pagesErr, context.Canceled) {
+		return stats, pagesErr
+	}
+	return stats, ctx.Err()
+}
+
+// replay loads, extracts and indexes or diffs one raw page.
+func (r *Replayer) replay(ctx context.Context, page models.RawPage, diffMu *sync.Mutex) replayOutcome {
+	fail := func(err error) replayOutcome {
+		r.OnError(page.URL, err)
+		return replayFailed
+	}
+
+	body, err := r.Store.Get(page.Hash)
+	if err != nil {
+		return fail(err)
+	}
+	doc, err := newDocument(page.URL, page.StatusCode, page.Header, body)
+	if err != nil {
+		return fail(err)
+	}
+	doc.RawHash = page.Hash
+	result, err := Extract(doc)
+	var unsupported *UnsupportedTypeError
+	if errors.As(err, &unsupported) {
+		return replaySkipped
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if !r.DryRun {
+		if err := r.Index(ctx, doc, result); err != nil {
+			return fail(err)
+		}
+		return replayIndexed
+	}
+
+	current, err := r.Current(ctx, page.URL)
+	if err != nil {
+		return fail(err)
+	}
+	next := pageFromResult(doc, result)
+	diffMu.Lock()
+	defer diffMu.Unlock()
+	if current == nil {
+		fmt.Fprintf(r.Diff, "+ %s\n", page.URL)
+		return replayChanged
+	}
+	changes := models.DiffWebPages(*current, next)
+	if len(changes) == 0 {
+		return replayUnchanged
+	}
+	fmt.Fprintf(r.Diff, "~ %s\n", page.URL)
+	for _, change := range changes {
+		fmt.Fprintf(r.Diff, "    %s\n", change)
+	}
+	return replayChanged
+}
+
+// loadProgress reads the checkpoint, returning an empty one for dry runs or a fresh start.
+func (r *Replayer) loadProgress() (ReplayProgress, error) {
+	var progress ReplayProgress
+	if r.DryRun || r.ProgressFile == "" {
+		return progress, nil
+	}
+	data, err := os.ReadFile(r.ProgressFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	}
+	if err != nil {
+		return progress, err
+	}
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return progress, fmt.Errorf("error parsing replay progress %s: %v", r.ProgressFile, err)
+	}
+	return progress, nil
+}
+
+// saveProgress atomically replaces the checkpoint file.
+func (r *Replayer) saveProgress(progress ReplayProgress) error {
+	if r.DryRun || r.ProgressFile == "" {
+		return nil
+	}
+	progress.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := r.ProgressFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.ProgressFile)
+}
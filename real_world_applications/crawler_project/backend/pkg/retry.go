@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrorClass groups fetch failures by cause.
+type ErrorClass string
+
+const (
+	ClassDNS      ErrorClass = "dns"
+	ClassConnect  ErrorClass = "connect"
+	ClassTLS      ErrorClass = "tls"
+	ClassTimeout  ErrorClass = "timeout"
+	ClassHTTP4xx  ErrorClass = "http_4xx"
+	ClassHTTP5xx  ErrorClass = "http_5xx"
+	ClassTooLarge ErrorClass = "too_large"
+	ClassBlocked  ErrorClass = "blocked"
+	ClassOther    ErrorClass = "other"
+)
+
+// ErrorClasses lists every class in a stable order.
+var ErrorClasses = []ErrorClass{ClassDNS, ClassConnect, ClassTLS, ClassTimeout, ClassHTTP4xx, ClassHTTP5xx, ClassTooLarge, ClassBlocked, ClassOther}
+
+// FetchError is a classified fetch failure.
+type FetchError struct {
+	URL        string
+	Class      ErrorClass
+	StatusCode int           // set for HTTP errors
+	RetryAfter time.Duration // delay requested by the server with Retry-After, if any
+	Attempts   int           // how many times the URL was tried
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("fetch %s: %s (HTTP %d)", e.URL, e.Class, e.StatusCode)
+	}
+	return fmt.Sprintf("fetch %s: %s: %v", e.URL, e.Class, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether trying again later may succeed. Timeouts, connection failures,
+// temporary DNS failures, server errors and the 408 and 429 statuses are transient; TLS
+// failures, missing hosts, blocked addresses, other client errors and oversized bodies are not.
+func (e *FetchError) Transient() bool {
+	switch e.Class {
+	case ClassTimeout, ClassConnect, ClassHTTP5xx:
+		return true
+	case ClassHTTP4xx:
+		return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+	case ClassDNS:
+		var dnsErr *net.DNSError
+		return errors.As(e.Err, &dnsErr) && !dnsErr.IsNotFound && (dnsErr.IsTemporary || dnsErr.IsTimeout)
+	}
+	return false
+}
+
+// ClassifyError returns the class of an error returned by FetchDocument.
+func ClassifyError(err error) ErrorClass {
+	var fetchErr *FetchError
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var netErr net.Error
+	var opErr *net.OpError
+
+	switch {
+	case errors.As(err, &fetchErr):
+		return fetchErr.Class
+	case errors.Is(err, ErrBodyTooLarge):
+		return ClassTooLarge
+	case errors.Is(err, ErrBlockedAddress):
+		return ClassBlocked
+	case errors.As(err, &dnsErr):
+		return ClassDNS
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &unknownAuthority),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidCert):
+		return ClassTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ClassTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return ClassConnect
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return ClassConnect
+	}
+	return ClassOther
+}
+
+// statusError returns a FetchError for HTTP error responses and nil for everything else.
+func statusError(doc *Document) *FetchError {
+	if doc.StatusCode < 400 {
+		return nil
+	}
+	fe := &FetchError{URL: doc.URL, Class: ClassHTTP4xx, StatusCode: doc.StatusCode}
+	if doc.StatusCode >= 500 {
+		fe.Class = ClassHTTP5xx
+	}
+	if secs, err := strconv.Atoi(doc.Header.Get("Retry-After")); err == nil && secs > 0 {
+		fe.RetryAfter = time.Duration(secs) * time.Second
+	}
+	return fe
+}
+
+// RetryPolicy controls how often and how quickly transient fetch failures are retried.
+type RetryPolicy struct {
+	MaxAttempts int           // total tries per URL, including the first
+	BaseDelay   time.Duration // delay before the first retry
+	MaxDelay    time.Duration // upper bound for any delay
+	Jitter      float64       // fraction of each delay that is randomised, between 0 and 1
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   time.Second,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.5,
+	}
+}
+
+// Backoff returns how long to wait after the given failed attempt (1 for the first).
+// The delay doubles with every attempt up to MaxDelay, and then up to Jitter of it is
+// randomly removed so that URLs failing together do not retry together.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// FetchWithRetry fetches url with fetch, treating HTTP error statuses as failures, and
+// retries transient failures according to policy. Failures are returned as a *FetchError
+// with the number of attempts made.
+func FetchWithRetry(ctx context.Context, url string, policy RetryPolicy, fetch func(context.Context, string) (*Document, error)) (*Document, error) {
+	for attempt := 1; ; attempt++ {
+		doc, err := fetch(ctx, url)
+		var fe *FetchError
+		if err != nil {
+			if !errors.As(err, &fe) {
+				fe = &FetchError{URL: url, Class: ClassifyError(err), Err: err}
+			}
+		} else {
+			fe = statusError(doc)
+		}
+		if fe == nil {
+			return doc, nil
+		}
+		fe.Attempts = attempt
+		if !fe.Transient() || attempt >= policy.MaxAttempts {
+			return doc, fe
+		}
+
+		delay := policy.Backoff(attempt)
+		if fe.RetryAfter > delay {
+			delay = min(fe.RetryAfter, policy.MaxDelay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return doc, fe
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+	"web_crawler/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SavedSearchRunner executes saved searches when they are due and alerts their owners about
+// pages that are new to the results or changed since the previous run.
+//
+// Searches are claimed one at a time, which moves their next run forward, so several
+// crawler nodes can run the same runner without running a search twice. The first run of a
+// search only records the baseline. A run whose search or notification fails keeps the
+// previous results, so the same changes are reported again by the next run.
+type SavedSearchRunner struct {
+	PollInterval time.Duration
+
+	// Claim takes one due saved search, or returns nil when none is due.
+	Claim func(ctx context.Context, now time.Time) (*models.SavedSearch, error)
+	// Search runs the query of a saved search.
+	Search func(ctx context.Context, query, language string) ([]models.WebPage, error)
+	// Record stores the results of a run, or its error.
+	Record func(ctx context.Context, id primitive.ObjectID, results []models.SavedSearchResult, runAt time.Time, runErr string) error
+	// Notifier returns where the alerts of a saved search are delivered.
+	Notifier func(s *models.SavedSearch) Notifier
+	// Now returns the current time; nil uses time.Now.
+	Now func() time.Time
+	// OnError, when set, is called for every run that fails.
+	OnError func(s *models.SavedSearch, err error)
+}
+
+// NewSavedSearchRunner returns a runner over the saved searches in MongoDB that polls every
+// pollInterval and notifies through notifier.
+func NewSavedSearchRunner(pollInterval time.Duration, notifier func(s *models.SavedSearch) Notifier) *SavedSearchRunner {
+	return &SavedSearchRunner{
+		PollInterval: pollInterval,
+		Claim:        models.ClaimDueSavedSearch,
+		Search:       models.SearchWebPage,
+		Record:       models.RecordSavedSearchRun,
+		Notifier:     notifier,
+	}
+}
+
+// Run executes due saved searches every PollInterval until ctx is done.
+func (r *SavedSearchRunner) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		r.RunDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDue executes every saved search that is due and returns how many ran. It stops early
+// when a search cannot be claimed.
+func (r *SavedSearchRunner) RunDue(ctx context.Context) (int, error) {
+	ran := 0
+	for ctx.Err() == nil {
+		s, err := r.Claim(ctx, r.now())
+		if err != nil {
+			return ran, err
+		}
+		if s == nil {
+			break
+		}
+		if err := r.run(ctx, s); err != nil && r.OnError != nil {
+			r.OnError(s, err)
+		}
+		ran++
+	}
+	return ran, ctx.Err()
+}
+
+// run executes one saved search, alerts on its changes and records the outcome.
+func (r *SavedSearchRunner) run(ctx context.Context, s *models.SavedSearch) error {
+	runAt := r.now()
+	pages, err := r.Search(ctx, s.Query, s.Language)
+	if err == nil {
+		results, added, changed := DiffSearchResults(s.Results, pages)
+		if s.Results != nil && len(added)+len(changed) > 0 {
+			err = r.Notifier(s).Notify(ctx, SearchAlert{
+				SearchID: s.ID.Hex(),
+				Name:     s.Name,
+				Query:    s.Query,
+				RunAt:    runAt,
+				New:      added,
+				Changed:  changed,
+			})
+		}
+		if err == nil {
+			return r.Record(ctx, s.ID, results, runAt, "")
+		}
+	}
+	if recordErr := r.Record(ctx, s.ID, nil, runAt, err.Error()); recordErr != nil {
+		return recordErr
+	}
+	return err
+}
+
+func (r *SavedSearchRunner) now() time.Time {
+	if r.Now != nil {
+		return r.Now()
+	}
+	return time.Now()
+}
+
+// DiffSearchResults compares search results with the fingerprints of the previous run. It
+// returns the fingerprints of pages, the pages whose URL was not in prev and the pages whose
+// title, description or content changed.
+func DiffSearchResults(prev []models.SavedSearchResult, pages []models.WebPage) (results []models.SavedSearchResult, added, changed []AlertPage) {
+	previous := make(map[string]string, len(prev))
+	for _, r := range prev {
+		previous[r.URL] = r.Fingerprint
+	}
+	results = make([]models.SavedSearchResult, 0, len(pages))
+	seen := make(map[string]bool, len(pages))
+	for _, p := range pages {
+		if seen[p.URL] {
+			continue
+		}
+		seen[p.URL] = true
+		fingerprint := pageFingerprint(p)
+		results = append(results, models.SavedSearchResult{URL: p.URL, Fingerprint: fingerprint})
+		alert := AlertPage{URL: p.URL, Title: p.Title, Description: p.Desription}
+		old, known := previous[p.URL]
+		switch {
+		case !known:
+			added = append(added, alert)
+		case old != fingerprint:
+			changed = append(changed, alert)
+		}
+	}
+	return results, added, changed
+}
+
+func pageFingerprint(p models.WebPage) string {
+	h := sha256.New()
+	for _, field := range []string{p.Title, p.Desription, p.Content} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
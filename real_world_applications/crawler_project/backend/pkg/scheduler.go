@@ -2,52 +2,246 @@ package pkg
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
 	"sync"
 )
 
-type Worker func(job interface{})
+// ErrSchedulerStopped is returned for jobs submitted to, or still queued in, a stopped scheduler.
+var ErrSchedulerStopped = errors.New("scheduler stopped")
 
-type Scheduler struct {
-	jobs    chan interface{}
+// ErrQueueFull is returned by TrySubmit when the queue has no room.
+var ErrQueueFull = errors.New("scheduler queue full")
+
+// Worker processes one job. The context is cancelled when the scheduler is stopped.
+type Worker[T any] func(ctx context.Context, job T) error
+
+// PanicError is the error of a job whose worker panicked.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("worker panic: %v", e.Value)
+}
+
+// Task tracks one submitted job.
+type Task[T any] struct {
+	Job  T
+	done chan struct{}
+	err  error
+}
+
+// Done is closed once the job has run or was discarded.
+func (t *Task[T]) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns the job's error once Done is closed: what the worker returned, a *PanicError,
+// or ErrSchedulerStopped if the job was discarded without running.
+func (t *Task[T]) Err() error {
+	<-t.done
+	return t.err
+}
+
+// Wait blocks until the job is done or ctx ends, and returns the job's error or ctx's.
+func (t *Task[T]) Wait(ctx context.Context) error {
+	select {
+	case <-t.done:
+		return t.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Task[T]) finish(err error) {
+	t.err = err
+	close(t.done)
+}
+
+// Scheduler runs jobs of type T on a fixed pool of workers fed from a bounded queue.
+//
+// Submit waits for room in the queue and TrySubmit fails fast when there is none.
+// Stop discards what is still queued and cancels running jobs; Drain stops taking
+// jobs but lets the queue empty first. Both may be called any number of times, from
+// any goroutine, and the scheduler also stops when the context given to Start ends.
+type Scheduler[T any] struct {
+	jobs    chan *Task[T]
 	workers int
+
+	mu      sync.RWMutex // held for reading while sending to jobs, for writing to close it
+	closing chan struct{}
+	closed  bool
+	once    sync.Once
+
+	startMu sync.Mutex // guards started and cancel
+	started bool
+	cancel  context.CancelFunc
 	wg      sync.WaitGroup
+
+	// OnError, if set before Start, is called with every job that fails or panics.
+	OnError func(job T, err error)
 }
 
-func NewScheduler(workers int) *Scheduler {
-	return &Scheduler{
-		jobs:    make(chan interface{}),
-		workers: workers,
+// NewScheduler returns a scheduler with workers goroutines and room for queueSize
+// waiting jobs. A queueSize of 0 makes Submit wait for an idle worker.
+func NewScheduler[T any](workers, queueSize int) *Scheduler[T] {
+	return &Scheduler[T]{
+		jobs:    make(chan *Task[T], max(queueSize, 0)),
+		workers: max(workers, 1),
+		closing: make(chan struct{}),
 	}
 }
 
-// Start initializes the worker pool and starts processing jobs.
-func (s *Scheduler) Start(ctx context.Context, worker Worker) {
+// Start launches the workers. It has no effect after the first call. Cancelling ctx
+// stops the scheduler as Stop does.
+func (s *Scheduler[T]) Start(ctx context.Context, worker Worker[T]) {
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+	select {
+	case <-s.closing:
+		return
+	default:
+	}
+	if s.started {
+		return
+	}
+	s.started = true
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.wg.Add(s.workers)
 	for i := 0; i < s.workers; i++ {
-		s.wg.Add(1)
 		go func() {
 			defer s.wg.Done()
-			for {
-				select {
-				case job, ok := <-s.jobs:
-					if !ok {
-						return // Channel closed, stop the worker.
-					}
-					worker(job)
-				case <-ctx.Done():
-					return // Context cancelled, stop the worker.
+			for task := range s.jobs {
+				if ctx.Err() != nil {
+					task.finish(ErrSchedulerStopped)
+					continue
 				}
+				s.run(ctx, worker, task)
 			}
 		}()
 	}
+	go func() {
+		<-ctx.Done()
+		s.Stop()
+	}()
+}
+
+// run executes one job, turning a panic into a *PanicError.
+func (s *Scheduler[T]) run(ctx context.Context, worker Worker[T], task *Task[T]) {
+	var err error
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+		if err != nil && s.OnError != nil {
+			s.OnError(task.Job, err)
+		}
+		task.finish(err)
+	}()
+	err = worker(ctx, task.Job)
+}
+
+// Submit queues job, waiting for room until ctx ends. It returns ErrSchedulerStopped
+// once the scheduler is stopping.
+func (s *Scheduler[T]) Submit(ctx context.Context, job T) (*Task[T], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrSchedulerStopped
+	}
+	task := &Task[T]{Job: job, done: make(chan struct{})}
+	select {
+	case s.jobs <- task:
+		return task, nil
+	case <-s.closing:
+		return nil, ErrSchedulerStopped
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TrySubmit queues job if there is room right now and returns ErrQueueFull otherwise.
+func (s *Scheduler[T]) TrySubmit(job T) (*Task[T], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil, ErrSchedulerStopped
+	}
+	task := &Task[T]{Job: job, done: make(chan struct{})}
+	select {
+	case s.jobs <- task:
+		return task, nil
+	default:
+		return nil, ErrQueueFull
+	}
 }
 
-// Submit adds a job to the queue to be processed by the workers.
-func (s *Scheduler) Submit(job interface{}) {
-	s.jobs <- job
+// Len returns the number of jobs waiting in the queue.
+func (s *Scheduler[T]) Len() int {
+	return len(s.jobs)
 }
 
-// Stop waits for all workers to finish processing and closes the job channel.
-func (s *Scheduler) Stop() {
-	close(s.jobs) // Close the jobs channel to signal workers to stop.
-	s.wg.Wait()   // Wait for all workers to finish.
+// Drain stops accepting jobs, lets the workers finish everything already queued and
+// waits for them, or until ctx ends, in which case the rest is stopped as by Stop.
+func (s *Scheduler[T]) Drain(ctx context.Context) error {
+	s.close()
+	finished := make(chan struct{})
+	go func() {
+		s.wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		s.cancelWorkers()
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// Stop stops accepting jobs, cancels the running ones, fails the queued ones with
+// ErrSchedulerStopped and waits for the workers to exit. It must not be called from a
+// worker, which would wait for itself.
+func (s *Scheduler[T]) Stop() {
+	s.close()
+	s.cancelWorkers()
+	s.wait()
+}
+
+func (s *Scheduler[T]) cancelWorkers() {
+	s.startMu.Lock()
+	defer s.startMu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// close refuses new jobs and closes the queue once no Submit is sending to it.
+func (s *Scheduler[T]) close() {
+	s.once.Do(func() {
+		close(s.closing) // releases Submits waiting for room, so the lock below is free
+		s.mu.Lock()
+		s.closed = true
+		close(s.jobs)
+		s.mu.Unlock()
+	})
+}
+
+// wait returns once every queued job is done. Without workers the queue is failed here.
+func (s *Scheduler[T]) wait() {
+	s.startMu.Lock()
+	started := s.started
+	s.startMu.Unlock()
+	if !started {
+		for task := range s.jobs {
+			task.finish(ErrSchedulerStopped)
+		}
+		return
+	}
+	s.wg.Wait()
 }
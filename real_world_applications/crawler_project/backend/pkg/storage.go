@@ -2,7 +2,9 @@ package pkg
 
 import (
 	"context"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 	"web_crawler/models"
 )
@@ -12,24 +14,108 @@ func CombineStrings(stringsArray []string) string {
 	return strings.Join(stringsArray, " ") // Combining with space as delimiter
 }
 
-// InsertCombinedContent creates a WebPage with combined content and inserts it into Elasticsearch.
-func InsertCombinedContent(ctx context.Context, url string, status int, content []string, title, description string, keywords []string) (string, error) {
-	combinedContent := CombineStrings(content) // Combine URLs or any strings array into a single string
+// InsertPageResult indexes the content extracted from doc, updating the page already
+// indexed for its URL so a recrawl adds a version to the page's history.
+func InsertPageResult(ctx context.Context, doc *Document, result *PageResult) (string, error) {
+	return indexCrawledPage(ctx, pageFromResult(doc, result))
+}
 
-	page := models.WebPage{
-		URL:        url,    // Not applicable or could be a representative URL
-		StatusCode: status, // Assuming a default status code
-		Content:    combinedContent,
-		CrawledAt:  time.Now(),
-		Title:      title,
-		Desription: description,
-		Keywords:   keywords,
-	}
+var (
+	versionErrorMu     sync.RWMutex
+	onPageVersionError func(pageID, url string, err error)
+)
+
+// SetPageVersionErrorHandler sets fn to be told when a crawled page was indexed but its
+// version could not be saved. The page still counts as indexed, so without a handler the
+// error goes unreported.
+func SetPageVersionErrorHandler(fn func(pageID, url string, err error)) {
+	versionErrorMu.Lock()
+	defer versionErrorMu.Unlock()
+	onPageVersionError = fn
+}
 
-	result, err := models.CreateWebPage(ctx, page)
+// indexCrawledPage indexes page and saves it as the newest version of the page. Once the
+// page is indexed the crawl of it succeeded, so a failure to save the version is only
+// reported to the SetPageVersionErrorHandler handler.
+func indexCrawledPage(ctx context.Context, page models.WebPage) (string, error) {
+	id, err := models.IndexWebPage(ctx, page)
 	if err != nil {
 		return "", err
 	}
-	return result, nil
+	if _, err := models.SavePageVersion(ctx, models.PageVersion{PageID: id, Page: &page, Source: models.VersionCrawl}); err != nil {
+		versionErrorMu.RLock()
+		fn := onPageVersionError
+		versionErrorMu.RUnlock()
+		if fn != nil {
+			fn(id, page.URL, err)
+		}
+	}
+	return id, nil
+}
+
+// pageFromResult builds the WebPage indexed for doc.
+func pageFromResult(doc *Document, result *PageResult) models.WebPage {
+	return models.WebPage{
+		URL:         doc.URL,
+		StatusCode:  doc.StatusCode,
+		Content:     CombineStrings(result.Contents),
+		CrawledAt:   time.Now(),
+		Title:       result.Title,
+		Desription:  result.Description,
+		Keywords:    result.Keywords,
+		ContentType: result.ContentType,
+		Language:    result.Language,
+		Structured:  result.Structured,
+	}
+}
+
+// RecordRawPage remembers which raw body was fetched for doc so it can be replayed.
+// It does nothing when the body was not kept in a raw store.
+func RecordRawPage(ctx context.Context, doc *Document) error {
+	if doc.RawHash == "" {
+		return nil
+	}
+	return models.SaveRawPage(ctx, models.RawPage{
+		URL:        doc.URL,
+		Hash:       doc.RawHash,
+		StatusCode: doc.StatusCode,
+		Header:     doc.Header,
+		FetchedAt:  time.Now(),
+	})
+}
+
+// StoreLinks records the outbound links of pageURL in the link graph.
+// Relative links are resolved against pageURL, fragments are dropped and only http(s) targets are kept.
+func StoreLinks(ctx context.Context, pageURL string, links []Link) error {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return err
+	}
 
+	now := time.Now()
+	edges := make([]models.Link, 0, len(links))
+	for _, link := range links {
+		target, ok := resolveLink(base, link.URL)
+		if !ok {
+			continue
+		}
+		edges = append(edges, models.Link{
+			From:         pageURL,
+			To:           target.String(),
+			Anchor:       link.Text,
+			DiscoveredAt: now,
+		})
+	}
+	return models.ReplaceOutlinks(ctx, pageURL, edges)
+}
+
+// resolveLink resolves href against base and drops its fragment.
+// It reports false for links that do not lead to an http(s) URL.
+func resolveLink(base *url.URL, href string) (*url.URL, bool) {
+	target, err := base.Parse(strings.TrimSpace(href))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return nil, false
+	}
+	target.Fragment = ""
+	return target, true
 }
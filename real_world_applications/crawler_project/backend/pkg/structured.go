@@ -0,0 +1,314 @@
+package pkg
+
+import (
+	"encoding/json"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"web_crawler/models"
+
+	"golang.org/x/net/html"
+)
+
+// Bounds on the structured data kept per page, so one page cannot bloat its document or
+// exceed the nested object limits of the index.
+const (
+	maxStructuredItems   = 50
+	maxItemProperties    = 100
+	maxPropertyValueSize = 1000
+)
+
+// extractStructuredData collects the JSON-LD and microdata items and the OpenGraph and
+// Twitter card tags of a parsed page. It returns nil when the page has none.
+func extractStructuredData(doc *html.Node) *models.StructuredData {
+	var data models.StructuredData
+	addItem := func(item models.StructuredItem) {
+		if item.Type == "" || len(data.Items) >= maxStructuredItems {
+			return
+		}
+		item.Name = item.Property("name")
+		item.Description = item.Property("description")
+		item.URL = item.Property("url")
+		if item.Image = item.Property("image"); item.Image == "" {
+			item.Image = item.Property("image.url")
+		}
+		data.Items = append(data.Items, item)
+	}
+
+	// inItem is set below a microdata item, whose nested items it reports itself.
+	var walk func(n *html.Node, inItem bool)
+	walk = func(n *html.Node, inItem bool) {
+		if n.Type == html.ElementNode {
+			switch {
+			case n.Data == "script" && isJSONLD(attr(n, "type")):
+				if n.FirstChild != nil {
+					var v interface{}
+					if json.Unmarshal([]byte(n.FirstChild.Data), &v) == nil {
+						jsonLDItems(v, addItem)
+					}
+				}
+			case n.Data == "meta":
+				cardTag(&data, n)
+			}
+			if hasAttr(n, "itemscope") && !inItem {
+				microdataItem(n, addItem)
+				inItem = true
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inItem)
+		}
+	}
+	walk(doc, false)
+
+	// Only tags such as og:locale that are not kept.
+	if data.OpenGraph != nil && *data.OpenGraph == (models.OpenGraph{}) {
+		data.OpenGraph = nil
+	}
+	if data.Twitter != nil && *data.Twitter == (models.TwitterCard{}) {
+		data.Twitter = nil
+	}
+	if len(data.Items) == 0 && data.OpenGraph == nil && data.Twitter == nil {
+		return nil
+	}
+	return &data
+}
+
+func isJSONLD(scriptType string) bool {
+	mt, _, err := mime.ParseMediaType(scriptType)
+	return err == nil && mt == "application/ld+json"
+}
+
+// jsonLDItems reports every typed top-level node of a JSON-LD document, including the
+// nodes of a @graph.
+func jsonLDItems(v interface{}, add func(models.StructuredItem)) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, e := range v {
+			jsonLDItems(e, add)
+		}
+	case map[string]interface{}:
+		if graph, ok := v["@graph"]; ok {
+			jsonLDItems(graph, add)
+		}
+		item := models.StructuredItem{Type: schemaType(v["@type"]), Source: "json-ld"}
+		if item.Type == "" {
+			return
+		}
+		for _, key := range sortedKeys(v) {
+			jsonLDProperties(&item, key, v[key])
+		}
+		add(item)
+	}
+}
+
+// jsonLDProperties flattens a JSON-LD property into item, naming the properties of nested
+// nodes with a dotted path.
+func jsonLDProperties(item *models.StructuredItem, name string, v interface{}) {
+	if strings.HasPrefix(name, "@") || strings.Contains(name, ".@") {
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		addProperty(item, name, v)
+	case float64:
+		addProperty(item, name, strconv.FormatFloat(v, 'f', -1, 64))
+	case bool:
+		addProperty(item, name, strconv.FormatBool(v))
+	case []interface{}:
+		for _, e := range v {
+			jsonLDProperties(item, name, e)
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			jsonLDProperties(item, name+"."+key, v[key])
+		}
+	}
+}
+
+// microdataItem reports the item whose itemscope is on n, with its properties.
+func microdataItem(n *html.Node, add func(models.StructuredItem)) {
+	types := strings.Fields(attr(n, "itemtype"))
+	item := models.StructuredItem{Source: "microdata"}
+	if len(types) > 0 {
+		item.Type = schemaType(types[0])
+	}
+	var standalone []*html.Node
+	microdataProperties(n, "", &item, &standalone)
+	add(item)
+	for _, c := range standalone {
+		microdataItem(c, add)
+	}
+}
+
+// microdataProperties adds the properties found below n to item. Properties that are
+// items themselves are flattened with a dotted path; items without itemprop stand alone
+// and are appended to standalone.
+func microdataProperties(n *html.Node, prefix string, item *models.StructuredItem, standalone *[]*html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		names := strings.Fields(attr(c, "itemprop"))
+		switch {
+		case hasAttr(c, "itemscope") && len(names) == 0:
+			*standalone = append(*standalone, c)
+		case hasAttr(c, "itemscope"):
+			for _, name := range names {
+				microdataProperties(c, prefix+name+".", item, standalone)
+			}
+		default:
+			if len(names) > 0 {
+				value := microdataValue(c)
+				for _, name := range names {
+					addProperty(item, prefix+name, value)
+				}
+			}
+			microdataProperties(c, prefix, item, standalone)
+		}
+	}
+}
+
+// microdataValue returns the value of a microdata property element as the HTML standard
+// defines it: an attribute for media, links and machine-readable elements, else the text.
+func microdataValue(n *html.Node) string {
+	switch n.Data {
+	case "meta":
+		return attr(n, "content")
+	case "audio", "embed", "iframe", "img", "source", "track", "video":
+		return attr(n, "src")
+	case "a", "area", "link":
+		return attr(n, "href")
+	case "object":
+		return attr(n, "data")
+	case "data", "meter":
+		return attr(n, "value")
+	case "time":
+		if hasAttr(n, "datetime") {
+			return attr(n, "datetime")
+		}
+	}
+	return nodeText(n)
+}
+
+// cardTag records an OpenGraph or Twitter card meta tag.
+func cardTag(data *models.StructuredData, n *html.Node) {
+	key := attr(n, "property")
+	if key == "" {
+		key = attr(n, "name")
+	}
+	value := strings.TrimSpace(attr(n, "content"))
+	if value == "" {
+		return
+	}
+	prefix, name, ok := strings.Cut(strings.ToLower(key), ":")
+	if !ok {
+		return
+	}
+	set := func(field *string) {
+		if *field == "" { // the first of repeated tags, such as og:image, is the main one
+			*field = value
+		}
+	}
+	switch prefix {
+	case "og":
+		if data.OpenGraph == nil {
+			data.OpenGraph = &models.OpenGraph{}
+		}
+		switch name {
+		case "type":
+			set(&data.OpenGraph.Type)
+		case "title":
+			set(&data.OpenGraph.Title)
+		case "description":
+			set(&data.OpenGraph.Description)
+		case "url":
+			set(&data.OpenGraph.URL)
+		case "image", "image:url":
+			set(&data.OpenGraph.Image)
+		case "site_name":
+			set(&data.OpenGraph.SiteName)
+		}
+	case "twitter":
+		if data.Twitter == nil {
+			data.Twitter = &models.TwitterCard{}
+		}
+		switch name {
+		case "card":
+			set(&data.Twitter.Card)
+		case "title":
+			set(&data.Twitter.Title)
+		case "description":
+			set(&data.Twitter.Description)
+		case "image", "image:src":
+			set(&data.Twitter.Image)
+		case "site":
+			set(&data.Twitter.Site)
+		case "creator":
+			set(&data.Twitter.Creator)
+		}
+	}
+}
+
+// schemaType returns a schema.org type name without its vocabulary URL. JSON-LD types may
+// be a list, of which the first is used.
+func schemaType(v interface{}) string {
+	var t string
+	switch v := v.(type) {
+	case string:
+		t = v
+	case []interface{}:
+		if len(v) > 0 {
+			t, _ = v[0].(string)
+		}
+	}
+	if i := strings.LastIndexAny(t, "/#:"); i >= 0 {
+		t = t[i+1:]
+	}
+	return strings.TrimSpace(t)
+}
+
+func addProperty(item *models.StructuredItem, name, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" || len(item.Properties) >= maxItemProperties {
+		return
+	}
+	if len(value) > maxPropertyValueSize {
+		value = value[:maxPropertyValueSize]
+		for !utf8.ValidString(value) {
+			value = value[:len(value)-1]
+		}
+	}
+	item.Properties = append(item.Properties, models.StructuredProperty{Name: name, Value: value})
+}
+
+// sortedKeys returns the keys of a JSON object in order, so properties are always
+// extracted in the same order and re-extracting a page does not look like a change.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
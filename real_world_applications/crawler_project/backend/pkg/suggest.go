@@ -0,0 +1,151 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"web_crawler/models"
+)
+
+// Suggester answers search suggestion lookups within a latency budget. Answers are cached
+// for a short time and identical lookups in flight share one request, so a client firing
+// a lookup per keystroke, or retyping a query, costs the index little.
+type Suggester struct {
+	// Suggest looks up the suggestions for a query; models.SuggestWebPages by default.
+	Suggest func(ctx context.Context, query string, size int) (models.PageSuggestions, error)
+	// Budget bounds each lookup. A lookup that runs over it fails with
+	// context.DeadlineExceeded, as an answer that late is of no use to someone typing.
+	Budget time.Duration
+	// TTL is how long an answer is reused; zero disables the cache.
+	TTL time.Duration
+	// MaxEntries bounds the cache. When it is full the entry stored first is evicted.
+	MaxEntries int
+	Now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[suggestKey]*suggestEntry
+}
+
+type suggestKey struct {
+	query string
+	size  int
+}
+
+// suggestEntry is a cached answer, or a lookup in flight until done is closed.
+type suggestEntry struct {
+	done     chan struct{}
+	result   models.PageSuggestions
+	err      error
+	storedAt time.Time
+}
+
+// NewSuggester returns a Suggester backed by the webpages index.
+func NewSuggester(budget, ttl time.Duration, maxEntries int) *Suggester {
+	return &Suggester{
+		Suggest:    models.SuggestWebPages,
+		Budget:     budget,
+		TTL:        ttl,
+		MaxEntries: maxEntries,
+		Now:        time.Now,
+		entries:    make(map[suggestKey]*suggestEntry),
+	}
+}
+
+// NormalizeSuggestQuery lowercases query and collapses its whitespace, so queries that
+// differ only in case or spacing share a cache entry. A trailing space is kept, since
+// "go " asks for the next word while "go" may still be completed.
+func NormalizeSuggestQuery(query string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	if normalized != "" && strings.TrimRight(query, " \t") != query {
+		normalized += " "
+	}
+	return normalized
+}
+
+// Get returns the suggestions for query, from the cache when a fresh answer is there. It
+// waits at most the budget, and at most as long as ctx allows.
+func (s *Suggester) Get(ctx context.Context, query string, size int) (models.PageSuggestions, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Budget)
+	defer cancel()
+
+	key := suggestKey{NormalizeSuggestQuery(query), size}
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	if ok && !e.storedAt.IsZero() && s.Now().Sub(e.storedAt) >= s.TTL {
+		delete(s.entries, key)
+		ok = false
+	}
+	if !ok {
+		e = &suggestEntry{done: make(chan struct{})}
+		s.entries[key] = e
+		// The lookup is detached from ctx, so a caller that gives up does not fail the
+		// others waiting on it, but it still ends with the budget.
+		lookup, cancelLookup := context.WithTimeout(context.WithoutCancel(ctx), s.Budget)
+		go func() {
+			defer cancelLookup()
+			s.lookup(lookup, key, e)
+		}()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-e.done:
+		return e.result, e.err
+	case <-ctx.Done():
+		return models.PageSuggestions{}, ctx.Err()
+	}
+}
+
+// lookup runs the lookup for key and stores its answer in e. Failed lookups are not
+// cached, so the next keystroke tries again.
+func (s *Suggester) lookup(ctx context.Context, key suggestKey, e *suggestEntry) {
+	result, err := s.Suggest(ctx, key.query, key.size)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.result, e.err = result, err
+	if err != nil || s.TTL <= 0 {
+		if s.entries[key] == e {
+			delete(s.entries, key)
+		}
+	} else {
+		e.storedAt = s.Now()
+		s.evict()
+	}
+	close(e.done)
+}
+
+// evict removes expired entries and then, while the cache is over its bound, the entry
+// stored first. Lookups in flight are never evicted.
+func (s *Suggester) evict() {
+	now := s.Now()
+	stored := 0
+	for key, e := range s.entries {
+		if e.storedAt.IsZero() {
+			continue
+		}
+		if now.Sub(e.storedAt) >= s.TTL {
+			delete(s.entries, key)
+			continue
+		}
+		stored++
+	}
+	for ; stored > s.MaxEntries; stored-- {
+		var oldest suggestKey
+		var oldestAt time.Time
+		for key, e := range s.entries {
+			if !e.storedAt.IsZero() && (oldestAt.IsZero() || e.storedAt.Before(oldestAt)) {
+				oldest, oldestAt = key, e.storedAt
+			}
+		}
+		delete(s.entries, oldest)
+	}
+}
+
+// Len returns the number of cached answers and lookups in flight.
+func (s *Suggester) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
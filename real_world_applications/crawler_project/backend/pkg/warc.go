@@ -0,0 +1,359 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WARCVersion is the version line written at the start of every record.
+const WARCVersion = "WARC/1.1"
+
+// WARCField is one named header field of a WARC record.
+type WARCField struct {
+	Name  string
+	Value string
+}
+
+// WARCRecord is a single record of a WARC file: its header fields and content block.
+type WARCRecord struct {
+	Fields []WARCField
+	Block  []byte
+}
+
+// Get returns the value of the named header field, matched case-insensitively, or "".
+func (r *WARCRecord) Get(name string) string {
+	for _, f := range r.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Set replaces the named header field, or appends it if the record does not have it yet.
+func (r *WARCRecord) Set(name, value string) {
+	for i, f := range r.Fields {
+		if strings.EqualFold(f.Name, name) {
+			r.Fields[i].Value = value
+			return
+		}
+	}
+	r.Fields = append(r.Fields, WARCField{Name: name, Value: value})
+}
+
+// Type returns the WARC-Type of the record, e.g. "response".
+func (r *WARCRecord) Type() string {
+	return r.Get("WARC-Type")
+}
+
+// TargetURI returns the URL the record was captured from.
+func (r *WARCRecord) TargetURI() string {
+	return r.Get("WARC-Target-URI")
+}
+
+// Document parses a response record back into the Document FetchDocument would have built
+// from it, without rendering. It fails for records that are not HTTP responses.
+func (r *WARCRecord) Document() (*Document, error) {
+	if r.Type() != "response" {
+		return nil, fmt.Errorf("warc record %s is a %q record, not a response", r.Get("WARC-Record-ID"), r.Type())
+	}
+	res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archived response for %s: %v", r.TargetURI(), err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return newDocument(r.TargetURI(), res.StatusCode, res.Header, body)
+}
+
+// WARCWriter appends records to gzip-compressed WARC files in a directory.
+// Each record is compressed as its own gzip member, so files can be read sequentially
+// by any WARC tool or split at record boundaries. Once a file reaches the size limit it
+// is closed and a new one is started with a fresh warcinfo record. Files are written
+// with an ".open" suffix that is removed when they are complete.
+// A WARCWriter is safe for concurrent use.
+type WARCWriter struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string
+	maxBytes int64
+	serial   int
+	file     *os.File
+	path     string
+	size     int64
+}
+
+// NewWARCWriter creates dir if needed and returns a writer that names its files
+// prefix-<timestamp>-<serial>.warc.gz and rotates them after maxBytes compressed bytes.
+func NewWARCWriter(dir, prefix string, maxBytes int64) (*WARCWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &WARCWriter{dir: dir, prefix: prefix, maxBytes: maxBytes}, nil
+}
+
+// WriteRecord appends rec to the current file. WARC-Record-ID, WARC-Date and
+// Content-Length are filled in when missing.
+func (w *WARCWriter) WriteRecord(rec *WARCRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.rotateIfNeeded(); err != nil {
+		return err
+	}
+	return w.write(rec)
+}
+
+// WriteExchange archives an HTTP exchange as a response record followed by the request
+// record that produced it, so after redirects req should be res.Request. body is the
+// response body exactly as it was read.
+// Both records go to the same file.
+func (w *WARCWriter) WriteExchange(req *http.Request, res *http.Response, body []byte) error {
+	now := time.Now().UTC()
+	target := req.URL.String()
+
+	var resBlock bytes.Buffer
+	fmt.Fprintf(&resBlock, "%s %s\r\n", res.Proto, res.Status)
+	res.Header.Write(&resBlock)
+	resBlock.WriteString("\r\n")
+	resBlock.Write(body)
+
+	var reqBlock bytes.Buffer
+	fmt.Fprintf(&reqBlock, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), req.URL.Host)
+	req.Header.Write(&reqBlock)
+	reqBlock.WriteString("\r\n")
+
+	responseID := newWARCRecordID()
+	response := &WARCRecord{
+		Fields: []WARCField{
+			{"WARC-Type", "response"},
+			{"WARC-Record-ID", responseID},
+			{"WARC-Date", now.Format(time.RFC3339)},
+			{"WARC-Target-URI", target},
+			{"WARC-Payload-Digest", warcDigest(body)},
+			{"Content-Type", "application/http;msgtype=response"},
+		},
+		Block: resBlock.Bytes(),
+	}
+	request := &WARCRecord{
+		Fields: []WARCField{
+			{"WARC-Type", "request"},
+			{"WARC-Record-ID", newWARCRecordID()},
+			{"WARC-Date", now.Format(time.RFC3339)},
+			{"WARC-Target-URI", target},
+			{"WARC-Concurrent-To", responseID},
+			{"Content-Type", "application/http;msgtype=request"},
+		},
+		Block: reqBlock.Bytes(),
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.rotateIfNeeded(); err != nil {
+		return err
+	}
+	if err := w.write(response); err != nil {
+		return err
+	}
+	return w.write(request)
+}
+
+// Close finishes the current file.
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+func (w *WARCWriter) rotateIfNeeded() error {
+	if w.file != nil && w.size < w.maxBytes {
+		return nil
+	}
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, time.Now().UTC().Format("20060102150405"), w.serial)
+	w.path = filepath.Join(w.dir, name)
+	file, err := os.OpenFile(w.path+".open", os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	w.file, w.size = file, 0
+
+	info := "software: web_crawler\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	return w.write(&WARCRecord{
+		Fields: []WARCField{
+			{"WARC-Type", "warcinfo"},
+			{"WARC-Filename", name},
+			{"Content-Type", "application/warc-fields"},
+		},
+		Block: []byte(info),
+	})
+}
+
+func (w *WARCWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+	return os.Rename(w.path+".open", w.path)
+}
+
+// write appends rec to the open file as one gzip member.
+func (w *WARCWriter) write(rec *WARCRecord) error {
+	if rec.Get("WARC-Record-ID") == "" {
+		rec.Set("WARC-Record-ID", newWARCRecordID())
+	}
+	if rec.Get("WARC-Date") == "" {
+		rec.Set("WARC-Date", time.Now().UTC().Format(time.RFC3339))
+	}
+	rec.Set("WARC-Block-Digest", warcDigest(rec.Block))
+	rec.Set("Content-Length", strconv.Itoa(len(rec.Block)))
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprintf(gz, "%s\r\n", WARCVersion)
+	for _, f := range rec.Fields {
+		fmt.Fprintf(gz, "%s: %s\r\n", f.Name, f.Value)
+	}
+	io.WriteString(gz, "\r\n")
+	gz.Write(rec.Block)
+	io.WriteString(gz, "\r\n\r\n")
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	n, err := w.file.Write(buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+// WARCReader iterates over the records of a WARC file, compressed or not.
+type WARCReader struct {
+	r *bufio.Reader
+}
+
+// NewWARCReader returns a reader for r. Gzip compression is detected automatically.
+func NewWARCReader(r io.Reader) (*WARCReader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	return &WARCReader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF when there are no more.
+func (r *WARCReader) Next() (*WARCRecord, error) {
+	var line string
+	for {
+		l, err := r.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(l) == "" {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("error reading warc record: %v", err)
+		}
+		if line = strings.TrimRight(l, "\r\n"); line != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid warc version line %q", line)
+	}
+
+	rec := &WARCRecord{}
+	for {
+		l, err := r.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("error reading warc header: %v", err)
+		}
+		l = strings.TrimRight(l, "\r\n")
+		if l == "" {
+			break
+		}
+		name, value, ok := strings.Cut(l, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid warc header line %q", l)
+		}
+		rec.Fields = append(rec.Fields, WARCField{Name: name, Value: strings.TrimSpace(value)})
+	}
+
+	length, err := strconv.ParseInt(rec.Get("Content-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid warc Content-Length %q", rec.Get("Content-Length"))
+	}
+	rec.Block = make([]byte, length)
+	if _, err := io.ReadFull(r.r, rec.Block); err != nil {
+		return nil, fmt.Errorf("error reading warc block: %v", err)
+	}
+	return rec, nil
+}
+
+// ReplayWARC reads every response record from r and passes the resulting Document to fn,
+// stopping at the first error. This feeds archived pages to Extract and the indexer
+// exactly as a live fetch would, without touching the network.
+func ReplayWARC(r io.Reader, fn func(*Document) error) error {
+	reader, err := NewWARCReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if rec.Type() != "response" {
+			continue
+		}
+		doc, err := rec.Document()
+		if err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+}
+
+// newWARCRecordID returns a random version 4 UUID URN in angle brackets.
+func newWARCRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcDigest returns the SHA-1 digest of data in the base32 form WARC tools expect.
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
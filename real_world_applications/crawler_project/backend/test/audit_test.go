@@ -0,0 +1,227 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"web_crawler/middleware"
+	"web_crawler/models"
+	"web_crawler/pkg"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// auditStore records the batches written by an AuditWriter, failing the first fail attempts.
+type auditStore struct {
+	mu       sync.Mutex
+	fail     int
+	attempts int
+	batches  [][]models.AuditEntry
+}
+
+func (s *auditStore) insert(ctx context.Context, entries []models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.attempts <= s.fail {
+		return errors.New("mongo unavailable")
+	}
+	s.batches = append(s.batches, append([]models.AuditEntry(nil), entries...))
+	return nil
+}
+
+func (s *auditStore) written() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, b := range s.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func newTestAuditWriter(store *auditStore, batchSize int) *pkg.AuditWriter {
+	w := pkg.NewAuditWriter(10, batchSize, time.Hour)
+	w.Insert = store.insert
+	w.Retry = pkg.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	return w
+}
+
+func TestAuditWriterBatchesAndDrainsOnClose(t *testing.T) {
+	store := &auditStore{}
+	w := newTestAuditWriter(store, 2)
+	w.Start()
+	for i := 0; i < 5; i++ {
+		if err := w.Record(models.AuditEntry{ID: primitive.NewObjectID(), Action: "page.update"}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	w.Close(context.Background())
+
+	if store.written() != 5 {
+		t.Errorf("%d entries written, want 5", store.written())
+	}
+	for _, b := range store.batches {
+		if len(b) > 2 {
+			t.Errorf("batch of %d entries, want at most 2", len(b))
+		}
+	}
+	if err := w.Record(models.AuditEntry{}); !errors.Is(err, pkg.ErrAuditWriterClosed) {
+		t.Errorf("Record() after Close error = %v, want ErrAuditWriterClosed", err)
+	}
+}
+
+func TestAuditWriterRetriesFailedBatches(t *testing.T) {
+	store := &auditStore{fail: 3}
+	w := newTestAuditWriter(store, 1)
+	var failures int
+	w.OnError = func(err error, entries int) { failures++ }
+	w.Start()
+	w.Record(models.AuditEntry{ID: primitive.NewObjectID()})
+	w.Close(context.Background())
+
+	if store.written() != 1 || failures != 3 {
+		t.Errorf("%d entries written after %d failures, want 1 after 3", store.written(), failures)
+	}
+}
+
+func TestAuditWriterFallsBackWhenCloseGivesUp(t *testing.T) {
+	store := &auditStore{fail: 1 << 30}
+	w := newTestAuditWriter(store, 10)
+	var lost []models.AuditEntry
+	w.Fallback = func(entries []models.AuditEntry, err error) { lost = append(lost, entries...) }
+	w.Start()
+	w.Record(models.AuditEntry{ID: primitive.NewObjectID()})
+	w.Record(models.AuditEntry{ID: primitive.NewObjectID()})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	w.Close(ctx)
+	if len(lost) != 2 {
+		t.Errorf("%d entries handed to Fallback, want 2", len(lost))
+	}
+}
+
+func TestAuditWriterCloseReleasesBlockedRecords(t *testing.T) {
+	store := &auditStore{fail: 1 << 30}
+	w := newTestAuditWriter(store, 1)
+	var mu sync.Mutex
+	var lost int
+	w.Fallback = func(entries []models.AuditEntry, err error) {
+		mu.Lock()
+		lost += len(entries)
+		mu.Unlock()
+	}
+	w.Start()
+
+	// With every insert failing, one entry is held by the retrying batch and ten fill the
+	// buffer, so the remaining Records block until Close.
+	errs := make(chan error, 15)
+	for i := 0; i < 15; i++ {
+		go func() { errs <- w.Record(models.AuditEntry{ID: primitive.NewObjectID()}) }()
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	closed := make(chan struct{})
+	go func() {
+		w.Close(ctx)
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return after its context expired")
+	}
+
+	recorded := 0
+	for i := 0; i < 15; i++ {
+		if err := <-errs; err == nil {
+			recorded++
+		} else if !errors.Is(err, pkg.ErrAuditWriterClosed) {
+			t.Errorf("Record() error = %v, want ErrAuditWriterClosed", err)
+		}
+	}
+	if recorded != 11 || lost != recorded {
+		t.Errorf("%d entries recorded and %d handed to Fallback, want 11 of each", recorded, lost)
+	}
+}
+
+func TestAuditLogMiddleware(t *testing.T) {
+	var entries []models.AuditEntry
+	record := func(e models.AuditEntry) error { entries = append(entries, e); return nil }
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	e := echo.New()
+	e.Use(middleware.RequestLogger(logger))
+	e.Use(middleware.AuditLog(record, func(c echo.Context) bool { return c.Path() == "/page/search" }))
+	e.GET("/page/:id", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	e.POST("/page/search", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	e.PUT("/page/edit/:id", func(c echo.Context) error {
+		c.Set("userID", "u1")
+		middleware.SetAudit(c, "page.update", "page:"+c.Param("id"), []string{`title: "a" -> "b"`})
+		return c.String(http.StatusOK, "ok")
+	})
+	e.DELETE("/page/delete/:id", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing token")
+	})
+
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, "/page/1"},
+		{http.MethodPost, "/page/search"},
+		{http.MethodPut, "/page/edit/1"},
+		{http.MethodDelete, "/page/delete/1"},
+	} {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		req.Header.Set(middleware.RequestIDHeader, "req-1")
+		req.Header.Set(echo.HeaderXRealIP, "203.0.113.7")
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("%d entries recorded, want the PUT and the DELETE: %+v", len(entries), entries)
+	}
+	update := entries[0]
+	if update.ActorID != "u1" || update.Action != "page.update" || update.Target != "page:1" ||
+		len(update.Changes) != 1 || update.Status != http.StatusOK {
+		t.Errorf("update entry = %+v", update)
+	}
+	if update.IP != "203.0.113.7" || update.RequestID != "req-1" || update.ID.IsZero() || update.Time.IsZero() {
+		t.Errorf("update entry is missing request fields: %+v", update)
+	}
+	rejected := entries[1]
+	if rejected.Action != "delete /page/delete/:id" || rejected.Status != http.StatusUnauthorized || rejected.ActorID != "" {
+		t.Errorf("rejected entry = %+v", rejected)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	e := echo.New()
+	g := e.Group("/admin", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("userID", c.Request().Header.Get("X-User"))
+			return next(c)
+		}
+	}, middleware.AdminOnly([]string{"admin1"}))
+	g.GET("/audit", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+
+	for user, want := range map[string]int{"admin1": http.StatusOK, "u2": http.StatusForbidden, "": http.StatusForbidden} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/audit", nil)
+		req.Header.Set("X-User", user)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("user %q got %d, want %d", user, rec.Code, want)
+		}
+	}
+}
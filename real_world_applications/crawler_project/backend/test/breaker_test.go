@@ -0,0 +1,238 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+// hostFetch answers every URL with status, or with a connection error when status is 0,
+// and counts the calls.
+type hostFetch struct {
+	mu     sync.Mutex
+	status map[string]int
+	calls  map[string]int
+}
+
+func newHostFetch() *hostFetch {
+	return &hostFetch{status: map[string]int{}, calls: map[string]int{}}
+}
+
+func (f *hostFetch) set(url string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status[url] = status
+}
+
+func (f *hostFetch) fetch(ctx context.Context, url string) (*pkg.Document, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[url]++
+	status := f.status[url]
+	if status == 0 {
+		return nil, syscall.ECONNREFUSED
+	}
+	return &pkg.Document{URL: url, StatusCode: status, Header: http.Header{}}, nil
+}
+
+// resumed collects the URLs handed back by the breakers.
+func resumed() (func(string), func(time.Duration) []string) {
+	ch := make(chan string, 100)
+	wait := func(d time.Duration) []string {
+		var urls []string
+		timeout := time.After(d)
+		for {
+			select {
+			case u := <-ch:
+				urls = append(urls, u)
+			case <-timeout:
+				return urls
+			}
+		}
+	}
+	return func(u string) { ch <- u }, wait
+}
+
+func TestBreakerTripsOnConsecutiveFailures(t *testing.T) {
+	opts := pkg.BreakerOptions{ConsecutiveFailures: 3, Window: 10, MinRequests: 10, OpenTimeout: time.Hour}
+	breakers := pkg.NewHostBreakers(opts, nil)
+	upstream := newHostFetch()
+	upstream.set("http://up.test/", 200)
+	fetch := breakers.Wrap(upstream.fetch)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := fetch(ctx, "http://down.test/"); errors.Is(err, pkg.ErrCircuitOpen) {
+			t.Fatalf("failure %d: circuit opened too early", i+1)
+		}
+	}
+	if got := breakers.State("down.test"); got != pkg.BreakerOpen {
+		t.Fatalf("state after 3 failures = %v, want open", got)
+	}
+	if _, err := fetch(ctx, "http://down.test/next"); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Errorf("fetch on open circuit: err %v, want ErrCircuitOpen", err)
+	}
+	if upstream.calls["http://down.test/next"] != 0 {
+		t.Error("open circuit still called the fetcher")
+	}
+	if breakers.Parked() != 1 {
+		t.Errorf("Parked() = %d, want 1", breakers.Parked())
+	}
+	if _, err := fetch(ctx, "http://up.test/"); err != nil {
+		t.Errorf("other host: %v, want it unaffected", err)
+	}
+}
+
+func TestBreakerTripsOnFailureRate(t *testing.T) {
+	opts := pkg.BreakerOptions{FailureRate: 0.5, Window: 10, MinRequests: 6, OpenTimeout: time.Hour}
+	breakers := pkg.NewHostBreakers(opts, nil)
+	upstream := newHostFetch()
+	upstream.set("http://flaky.test/ok", 200)
+	upstream.set("http://flaky.test/err", 503)
+	fetch := breakers.Wrap(upstream.fetch)
+
+	// Alternating results never fail twice in a row but fail half of the time.
+	for i := 0; i < 6; i++ {
+		url := "http://flaky.test/ok"
+		if i%2 == 1 {
+			url = "http://flaky.test/err"
+		}
+		fetch(context.Background(), url)
+		want := pkg.BreakerClosed
+		if i == 5 {
+			want = pkg.BreakerOpen
+		}
+		if got := breakers.State("flaky.test"); got != want {
+			t.Fatalf("after %d requests state = %v, want %v", i+1, got, want)
+		}
+	}
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	opts := pkg.BreakerOptions{ConsecutiveFailures: 2, FailureRate: 0.5, Window: 4, MinRequests: 2, OpenTimeout: time.Hour}
+	breakers := pkg.NewHostBreakers(opts, nil)
+	upstream := newHostFetch()
+	upstream.set("http://site.test/missing", 404)
+	fetch := breakers.Wrap(upstream.fetch)
+	for i := 0; i < 10; i++ {
+		fetch(context.Background(), "http://site.test/missing")
+	}
+	if got := breakers.State("site.test"); got != pkg.BreakerClosed {
+		t.Errorf("state after 404s = %v, want closed", got)
+	}
+}
+
+func TestBreakerHalfOpenResumesParkedURLs(t *testing.T) {
+	resume, wait := resumed()
+	opts := pkg.BreakerOptions{ConsecutiveFailures: 1, Window: 1, OpenTimeout: 20 * time.Millisecond, HalfOpenProbes: 1}
+	breakers := pkg.NewHostBreakers(opts, resume)
+	var mu sync.Mutex
+	var changes []string
+	breakers.OnStateChange = func(host string, from, to pkg.BreakerState) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, from.String()+">"+to.String())
+	}
+	upstream := newHostFetch()
+	fetch := breakers.Wrap(upstream.fetch)
+	ctx := context.Background()
+
+	fetch(ctx, "http://host.test/a")
+	for _, u := range []string{"http://host.test/b", "http://host.test/c", "http://host.test/d"} {
+		if _, err := fetch(ctx, u); !errors.Is(err, pkg.ErrCircuitOpen) {
+			t.Fatalf("%s: err %v, want ErrCircuitOpen", u, err)
+		}
+	}
+
+	// Half-opening hands back one parked URL as the probe; it fails and the breaker reopens.
+	probe := wait(50 * time.Millisecond)
+	if len(probe) != 1 || probe[0] != "http://host.test/b" {
+		t.Fatalf("first half-open resumed %v, want the first parked URL", probe)
+	}
+	if got := breakers.State("host.test"); got != pkg.BreakerHalfOpen {
+		t.Fatalf("state = %v, want half-open", got)
+	}
+	fetch(ctx, probe[0])
+	if got := breakers.State("host.test"); got != pkg.BreakerOpen {
+		t.Fatalf("state after failed probe = %v, want open", got)
+	}
+	if _, err := fetch(ctx, "http://host.test/e"); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Errorf("request after failed probe: err %v, want it parked", err)
+	}
+
+	// The host recovers: the next probe succeeds and everything parked is resumed.
+	for _, u := range []string{"http://host.test/b", "http://host.test/c", "http://host.test/d", "http://host.test/e"} {
+		upstream.set(u, 200)
+	}
+	probe = wait(50 * time.Millisecond)
+	if len(probe) != 1 {
+		t.Fatalf("second half-open resumed %v, want one probe", probe)
+	}
+	if _, err := fetch(ctx, probe[0]); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if got := breakers.State("host.test"); got != pkg.BreakerClosed {
+		t.Fatalf("state after successful probe = %v, want closed", got)
+	}
+	rest := wait(20 * time.Millisecond)
+	if len(rest) != 2 || breakers.Parked() != 0 {
+		t.Errorf("resumed %v after closing with %d still parked, want the 2 remaining URLs", rest, breakers.Parked())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"closed>open", "open>half-open", "half-open>open", "open>half-open", "half-open>closed"}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Errorf("state changes %v, want %v", changes, want)
+			break
+		}
+	}
+}
+
+func TestBreakerWithRetryStopsAtOpenCircuit(t *testing.T) {
+	opts := pkg.BreakerOptions{ConsecutiveFailures: 2, Window: 2, OpenTimeout: time.Hour}
+	breakers := pkg.NewHostBreakers(opts, nil)
+	fetch, calls := scriptedFetch(503)
+	policy := pkg.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	_, err := pkg.FetchWithRetry(context.Background(), "http://down.test/", policy, breakers.Wrap(fetch))
+	if !errors.Is(err, pkg.ErrCircuitOpen) || *calls != 2 {
+		t.Errorf("err %v after %d calls, want ErrCircuitOpen after the 2 failures that tripped it", err, *calls)
+	}
+}
+
+func TestBreakerRejectsURLsBeyondMaxParked(t *testing.T) {
+	opts := pkg.BreakerOptions{ConsecutiveFailures: 1, Window: 1, OpenTimeout: time.Hour, MaxParked: 2}
+	breakers := pkg.NewHostBreakers(opts, nil)
+	upstream := newHostFetch()
+	fetch := breakers.Wrap(upstream.fetch)
+	ctx := context.Background()
+
+	fetch(ctx, "http://host.test/a")
+	for _, u := range []string{"http://host.test/b", "http://host.test/c"} {
+		if _, err := fetch(ctx, u); !errors.Is(err, pkg.ErrCircuitOpen) {
+			t.Fatalf("%s: err %v, want ErrCircuitOpen", u, err)
+		}
+	}
+	_, err := pkg.FetchWithRetry(ctx, "http://host.test/d", pkg.DefaultRetryPolicy(), fetch)
+	if !errors.Is(err, pkg.ErrParkingFull) || errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Fatalf("fetch beyond MaxParked: err %v, want only ErrParkingFull", err)
+	}
+	var fetchErr *pkg.FetchError
+	if !errors.As(err, &fetchErr) || fetchErr.Attempts != 1 {
+		t.Errorf("fetch beyond MaxParked: err %#v, want a FetchError after one attempt", err)
+	}
+	if breakers.Parked() != 2 || upstream.calls["http://host.test/d"] != 0 {
+		t.Errorf("Parked() = %d, fetcher called %d times, want 2 parked and no call", breakers.Parked(), upstream.calls["http://host.test/d"])
+	}
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"web_crawler/pkg"
+)
+
+func TestNormalizeCharsetFixtures(t *testing.T) {
+	tests := []struct {
+		file        string
+		mediaType   string
+		header      string
+		wantCharset string
+		wantTitle   string
+		wantContent string
+	}{
+		{"shift_jis_meta.html", "text/html", "text/html", "shift_jis", "テスト", "日本語のページです。"},
+		{"shift_jis_unlabelled.html", "text/html", "", "shift_jis", "テスト", "クローラーのテスト"},
+		{"euc_jp_unlabelled.txt", "text/plain", "text/plain", "euc-jp", "お知らせ", "日本語のページです。"},
+		{"windows_1252_header.html", "text/html", "text/html; charset=windows-1252", "windows-1252", "Café menu", "“Crème brûlée” – €5"},
+		{"iso_8859_1_http_equiv.html", "text/html", "text/html", "windows-1252", "Grüße", "Grüße aus Köln"},
+		{"latin1_unlabelled.html", "text/html", "", "windows-1252", "Grüße", "schöne Straße"},
+		{"iso_8859_7_meta.html", "text/html", "text/html", "iso-8859-7", "Καλημέρα", "Καλημέρα κόσμε"},
+		{"utf8_bom.html", "text/html", "text/html; charset=iso-8859-1", "utf-8", "naïve", "naïve café"},
+		{"shift_jis_feed.xml", "application/rss+xml", "application/rss+xml", "shift_jis", "ニュース", "日本語のページです。"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			body, err := os.ReadFile(filepath.Join("testdata", "charset", tt.file))
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			doc := &pkg.Document{
+				ContentType: tt.mediaType,
+				Header:      http.Header{"Content-Type": []string{tt.header}},
+				Body:        body,
+			}
+			if err := pkg.NormalizeCharset(doc); err != nil {
+				t.Fatalf("NormalizeCharset() error = %v", err)
+			}
+			if doc.Charset != tt.wantCharset {
+				t.Errorf("Charset = %q, want %q", doc.Charset, tt.wantCharset)
+			}
+
+			result, err := pkg.Extract(doc)
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if result.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", result.Title, tt.wantTitle)
+			}
+			if content := strings.Join(result.Contents, " "); !strings.Contains(content, tt.wantContent) {
+				t.Errorf("Contents = %q, want it to contain %q", content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestNormalizeCharsetSkipsBinary(t *testing.T) {
+	body := []byte{0x89, 'P', 'N', 'G', 0xff, 0xfe}
+	doc := &pkg.Document{ContentType: "image/png", Body: body}
+	if err := pkg.NormalizeCharset(doc); err != nil {
+		t.Fatalf("NormalizeCharset() error = %v", err)
+	}
+	if doc.Charset != "" || string(doc.Body) != string(body) {
+		t.Errorf("binary body was modified: charset %q", doc.Charset)
+	}
+}
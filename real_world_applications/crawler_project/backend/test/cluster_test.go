@@ -0,0 +1,259 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+func TestHashRingSpreadsAndMovesFewKeys(t *testing.T) {
+	ring := pkg.NewHashRing(128)
+	ring.Set([]string{"a", "b", "c"})
+
+	hosts := make([]string, 3000)
+	before := make(map[string]string)
+	counts := make(map[string]int)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host%d.example", i)
+		before[hosts[i]] = ring.Owner(hosts[i])
+		counts[before[hosts[i]]]++
+	}
+	for node, n := range counts {
+		if n < 700 || n > 1300 {
+			t.Errorf("node %s owns %d of 3000 hosts, want roughly a third", node, n)
+		}
+	}
+
+	ring.Set([]string{"a", "b", "c", "d"})
+	moved := 0
+	for _, h := range hosts {
+		if owner := ring.Owner(h); owner != before[h] {
+			moved++
+			if owner != "d" {
+				t.Fatalf("%s moved from %s to %s, want only moves to the new node", h, before[h], owner)
+			}
+		}
+	}
+	if moved < 450 || moved > 1050 {
+		t.Errorf("%d hosts moved when adding a fourth node, want about a quarter", moved)
+	}
+
+	ring.Set([]string{"a", "b", "c"})
+	for _, h := range hosts {
+		if ring.Owner(h) != before[h] {
+			t.Fatalf("%s did not return to %s after the node left", h, before[h])
+		}
+	}
+	if got := pkg.NewHashRing(8).Owner("x"); got != "" {
+		t.Errorf("empty ring owner = %q, want empty", got)
+	}
+}
+
+// testNode is a cluster node served on localhost.
+type testNode struct {
+	cluster *pkg.Cluster
+	server  *httptest.Server
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu       sync.Mutex
+	received []string
+}
+
+func (n *testNode) urls() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.received)
+}
+
+// startNode serves a cluster node on localhost and joins it through seeds.
+func startNode(t *testing.T, secret string, seeds ...string) *testNode {
+	t.Helper()
+	server := httptest.NewUnstartedServer(nil)
+	node := &testNode{server: server, done: make(chan struct{})}
+	node.cluster = pkg.NewCluster(pkg.ClusterOptions{
+		Self:              "http://" + server.Listener.Addr().String(),
+		Seeds:             seeds,
+		Secret:            secret,
+		Replicas:          64,
+		HeartbeatInterval: 10 * time.Millisecond,
+		FailureThreshold:  2,
+		Client:            &http.Client{Timeout: time.Second},
+	})
+	node.cluster.Deliver = func(urls []string) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+		node.received = append(node.received, urls...)
+	}
+	server.Config.Handler = node.cluster.Handler()
+	server.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	node.cancel = cancel
+	go func() {
+		defer close(node.done)
+		node.cluster.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		node.stop()
+		server.Close()
+	})
+	return node
+}
+
+// stop leaves the cluster and waits for the node to finish.
+func (n *testNode) stop() {
+	n.cancel()
+	<-n.done
+}
+
+// waitForMembers waits until every node sees exactly want as the members.
+func waitForMembers(t *testing.T, nodes []*testNode, want []*testNode) {
+	t.Helper()
+	var addrs []string
+	for _, n := range want {
+		addrs = append(addrs, n.cluster.Self())
+	}
+	slices.Sort(addrs)
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		agreed := true
+		for _, n := range nodes {
+			if !slices.Equal(n.cluster.Members(), addrs) {
+				agreed = false
+			}
+		}
+		if agreed {
+			return
+		}
+		if time.Now().After(deadline) {
+			for _, n := range nodes {
+				t.Logf("%s sees %v", n.cluster.Self(), n.cluster.Members())
+			}
+			t.Fatalf("membership did not converge to %v", addrs)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClusterPartitionsHosts(t *testing.T) {
+	a := startNode(t, "s3cret")
+	b := startNode(t, "s3cret", a.server.URL)
+	c := startNode(t, "s3cret", a.server.URL)
+	all := []*testNode{a, b, c}
+	waitForMembers(t, all, all)
+
+	var urls []string
+	for i := 0; i < 60; i++ {
+		urls = append(urls, fmt.Sprintf("https://site%d.example/page", i))
+	}
+	if err := a.cluster.Route(context.Background(), urls); err != nil {
+		t.Fatalf("Route error = %v", err)
+	}
+
+	total := 0
+	for _, n := range all {
+		got := n.urls()
+		total += len(got)
+		if len(got) == 0 {
+			t.Errorf("%s received no URLs out of 60 hosts", n.cluster.Self())
+		}
+		for _, u := range got {
+			if !n.cluster.Owns(u) {
+				t.Errorf("%s received %s, owned by %s", n.cluster.Self(), u, n.cluster.Owner(u))
+			}
+			// Every node agrees on the owner.
+			for _, other := range all {
+				if other.cluster.Owner(u) != n.cluster.Self() {
+					t.Errorf("%s thinks %s belongs to %s", other.cluster.Self(), u, other.cluster.Owner(u))
+				}
+			}
+		}
+	}
+	if total != len(urls) {
+		t.Errorf("%d URLs delivered, want each of the %d exactly once", total, len(urls))
+	}
+}
+
+func TestClusterRebalancesOnLeaveAndFailure(t *testing.T) {
+	a := startNode(t, "s3cret")
+	b := startNode(t, "s3cret", a.server.URL)
+	c := startNode(t, "s3cret", a.server.URL)
+	waitForMembers(t, []*testNode{a, b, c}, []*testNode{a, b, c})
+
+	var changes sync.WaitGroup
+	changes.Add(1)
+	var once sync.Once
+	a.cluster.OnChange = func(members []string) { once.Do(changes.Done) }
+
+	// c leaves gracefully and its hosts move to a and b.
+	var cHost string
+	for i := 0; cHost == ""; i++ {
+		if u := fmt.Sprintf("https://site%d.example/", i); a.cluster.Owner(u) == c.cluster.Self() {
+			cHost = u
+		}
+	}
+	c.stop()
+	waitForMembers(t, []*testNode{a, b}, []*testNode{a, b})
+	changes.Wait()
+	if owner := a.cluster.Owner(cHost); owner == c.cluster.Self() || owner != b.cluster.Owner(cHost) {
+		t.Errorf("%s owned by %s after c left, want a or b agreed", cHost, owner)
+	}
+
+	// b disappears without a word and is dropped after the missed heartbeats.
+	b.server.CloseClientConnections()
+	b.server.Close()
+	waitForMembers(t, []*testNode{a}, []*testNode{a})
+	if !a.cluster.Owns(cHost) {
+		t.Errorf("the last node does not own %s", cHost)
+	}
+}
+
+func TestClusterRouteFallsBackLocally(t *testing.T) {
+	a := startNode(t, "s3cret")
+	b := startNode(t, "s3cret", a.server.URL)
+	waitForMembers(t, []*testNode{a, b}, []*testNode{a, b})
+
+	var bURL string
+	for i := 0; bURL == ""; i++ {
+		if u := fmt.Sprintf("https://site%d.example/", i); a.cluster.Owner(u) == b.cluster.Self() {
+			bURL = u
+		}
+	}
+	b.server.Close()
+	if err := a.cluster.Route(context.Background(), []string{bURL}); err == nil {
+		t.Error("Route to a closed node returned no error")
+	}
+	if got := a.urls(); !slices.Contains(got, bURL) {
+		t.Errorf("a received %v, want the URL it could not forward", got)
+	}
+}
+
+func TestClusterRequiresSecret(t *testing.T) {
+	a := startNode(t, "s3cret")
+	intruder := startNode(t, "wrong", a.server.URL)
+	time.Sleep(50 * time.Millisecond)
+	if got := a.cluster.Members(); len(got) != 1 {
+		t.Errorf("members %v, want the node with the wrong secret kept out", got)
+	}
+	if got := intruder.cluster.Members(); len(got) != 1 {
+		t.Errorf("intruder sees %v, want only itself", got)
+	}
+
+	res, err := http.Post(a.server.URL+"/cluster/urls", "application/json", strings.NewReader(`{"urls":["https://evil.example/"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized || len(a.urls()) != 0 {
+		t.Errorf("unauthenticated forward: status %d, delivered %v; want 401 and nothing", res.StatusCode, a.urls())
+	}
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"web_crawler/config"
+)
+
+// env builds a lookup function over a fixed set of variables.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+var mongoEnv = map[string]string{"MONGOUSER": "admin", "MONGOPASSWORD": "password"}
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	cfg, err := config.Load(nil, env(mongoEnv))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.Port != 8081 || cfg.Crawler.Workers != 10 || cfg.Crawler.Timeout.Duration != 30*time.Minute {
+		t.Errorf("Load() did not apply defaults: %+v", cfg)
+	}
+}
+
+func TestLoadLayering(t *testing.T) {
+	yamlPath := writeConfig(t, "crawler.yaml", `
+server:
+  port: 9000
+crawler:
+  workers: 4
+  timeout: 5m
+elasticsearch:
+  host: es.internal
+`)
+	vars := map[string]string{
+		"MONGOUSER":       "admin",
+		"MONGOPASSWORD":   "password",
+		"CRAWLER_CONFIG":  yamlPath,
+		"CRAWLER_WORKERS": "8",
+	}
+
+	cfg, err := config.Load([]string{"-port", "9100"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Elasticsearch.Host != "es.internal" {
+		t.Errorf("file value not applied, host = %q", cfg.Elasticsearch.Host)
+	}
+	if cfg.Crawler.Timeout.Duration != 5*time.Minute {
+		t.Errorf("file duration not applied, timeout = %v", cfg.Crawler.Timeout)
+	}
+	if cfg.Crawler.Workers != 8 {
+		t.Errorf("env should override file, workers = %d", cfg.Crawler.Workers)
+	}
+	if cfg.Server.Port != 9100 {
+		t.Errorf("flag should override file, port = %d", cfg.Server.Port)
+	}
+}
+
+func TestLoadJSONFile(t *testing.T) {
+	jsonPath := writeConfig(t, "crawler.json", `{"crawler": {"workers": 3, "timeout": "90s"}}`)
+
+	cfg, err := config.Load([]string{"-config", jsonPath}, env(mongoEnv))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Crawler.Workers != 3 || cfg.Crawler.Timeout.Duration != 90*time.Second {
+		t.Errorf("JSON file not applied: %+v", cfg.Crawler)
+	}
+}
+
+func TestLoadReportsAllFileErrors(t *testing.T) {
+	yamlPath := writeConfig(t, "crawler.yaml", "crawler:\n  wrokers: 4\n  queue_size: lots\nserver:\n  port: high\n")
+	vars := map[string]string{"MONGOUSER": "admin", "MONGOPASSWORD": "password", "CRAWLER_WORKERS": "many"}
+
+	_, err := config.Load([]string{"-config", yamlPath}, env(vars))
+	if err == nil {
+		t.Fatal("Load() accepted an invalid config file")
+	}
+	for _, want := range []string{"wrokers", "lots", "high", "CRAWLER_WORKERS"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %q, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadRejectsUnreachableFrontierThreshold(t *testing.T) {
+	vars := map[string]string{
+		"MONGOUSER":                 "admin",
+		"MONGOPASSWORD":             "password",
+		"CRAWLER_QUEUE_SIZE":        "100",
+		"HEALTH_FRONTIER_THRESHOLD": "100",
+	}
+
+	_, err := config.Load(nil, env(vars))
+	if err == nil || !strings.Contains(err.Error(), "health.frontier_threshold") {
+		t.Errorf("Load() error = %v, want a health.frontier_threshold error", err)
+	}
+}
+
+func TestLoadRejectsUnknownFileFields(t *testing.T) {
+	yamlPath := writeConfig(t, "crawler.yaml", "crawler:\n  wrokers: 4\n")
+	if _, err := config.Load([]string{"-config", yamlPath}, env(mongoEnv)); err == nil {
+		t.Errorf("Load() accepted a misspelled key")
+	}
+}
+
+func TestLoadReportsAllErrors(t *testing.T) {
+	vars := map[string]string{
+		"CRAWLER_WORKERS":    "0",
+		"ELASTICSEARCH_PORT": "not-a-port",
+		"LOG_LEVEL":          "loud",
+	}
+
+	_, err := config.Load([]string{"-port", "70000"}, env(vars))
+	if err == nil {
+		t.Fatalf("Load() accepted an invalid configuration")
+	}
+	for _, want := range []string{"ELASTICSEARCH_PORT", "server.port", "crawler.workers", "log.level", "mongo.user", "mongo.password"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s:\n%v", want, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+// siteServer serves HTML pages whose bodies are lists of links.
+func siteServer(t *testing.T, pages map[string][]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		links, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>", r.URL.Path)
+		for _, l := range links {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, l)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	t.Cleanup(server.Close)
+	allowLoopback(t)
+	pkg.SetRenderJavaScript(false)
+	t.Cleanup(func() { pkg.SetRenderJavaScript(true) })
+	return server
+}
+
+func crawlURLs(t *testing.T, opts pkg.CrawlOptions, seeds ...string) map[string]pkg.CrawlResult {
+	t.Helper()
+	results := make(map[string]pkg.CrawlResult)
+	crawler := pkg.NewCrawler(opts)
+	err := crawler.Run(context.Background(), seeds, func(r pkg.CrawlResult) {
+		if _, dup := results[r.URL]; dup {
+			t.Errorf("%s emitted twice", r.URL)
+		}
+		results[r.URL] = r
+	})
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if s := crawler.Stats(); s.Queued != 0 || s.InFlight != 0 {
+		t.Errorf("stats after Run = %+v, want an empty frontier", s)
+	}
+	return results
+}
+
+func keys(m map[string]pkg.CrawlResult, base string) []string {
+	var out []string
+	for k := range m {
+		out = append(out, k[len(base):])
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCrawlerFollowsLinksToMaxDepth(t *testing.T) {
+	server := siteServer(t, map[string][]string{
+		"/":       {"/a", "/b#section", "/a", "https://other.example/x", "mailto:me@example.com"},
+		"/a":      {"/a/deep", "/"},
+		"/a/deep": {"/a/deeper"},
+	})
+
+	results := crawlURLs(t, pkg.CrawlOptions{Workers: 3, MaxDepth: 2}, server.URL+"/")
+
+	got := keys(results, server.URL)
+	want := []string{"/", "/a", "/a/deep", "/b"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("crawled %v, want %v", got, want)
+	}
+	if r := results[server.URL+"/a/deep"]; r.Depth != 2 || r.Title != "/a/deep" {
+		t.Errorf("deep page result = %+v", r)
+	}
+	if r := results[server.URL+"/b"]; r.StatusCode != http.StatusNotFound {
+		t.Errorf("/b status = %d, want 404", r.StatusCode)
+	}
+}
+
+func TestCrawlerMaxPages(t *testing.T) {
+	pages := map[string][]string{"/": nil}
+	for i := 0; i < 20; i++ {
+		pages["/"] = append(pages["/"], fmt.Sprintf("/p%d", i))
+		pages[fmt.Sprintf("/p%d", i)] = nil
+	}
+	server := siteServer(t, pages)
+
+	results := crawlURLs(t, pkg.CrawlOptions{Workers: 4, MaxDepth: 5, MaxPages: 5}, server.URL+"/")
+	if len(results) != 5 {
+		t.Errorf("crawled %d pages, want 5", len(results))
+	}
+}
+
+func TestCrawlerStopsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	crawler := pkg.NewCrawler(pkg.CrawlOptions{
+		Workers:  2,
+		MaxDepth: 100,
+		Scope:    pkg.ScopeAny,
+		Fetch: func(ctx context.Context, u string) (*pkg.Document, error) {
+			<-release
+			body := fmt.Sprintf(`<a href="%s/next">next</a>`, u)
+			return &pkg.Document{URL: u, StatusCode: 200, ContentType: "text/html", Body: []byte(body)}, nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- crawler.Run(ctx, []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}, func(pkg.CrawlResult) {})
+	}()
+
+	cancel()
+	close(release)
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Run error = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestCrawlerRejectsInvalidSeeds(t *testing.T) {
+	err := pkg.NewCrawler(pkg.CrawlOptions{}).Run(context.Background(), []string{"ftp://example.com", "not a url"}, func(pkg.CrawlResult) {})
+	if err == nil {
+		t.Fatal("Run with no valid seeds succeeded")
+	}
+}
+
+func TestScopeAllows(t *testing.T) {
+	seed, _ := url.Parse("https://www.example.com/docs/index.html")
+	tests := []struct {
+		scope  pkg.Scope
+		target string
+		want   bool
+	}{
+		{pkg.ScopeHost, "https://www.example.com/blog", true},
+		{pkg.ScopeHost, "https://api.example.com/", false},
+		{pkg.ScopeDomain, "https://api.example.com/", true},
+		{pkg.ScopeDomain, "https://example.com/", true},
+		{pkg.ScopeDomain, "https://notexample.com/", false},
+		{pkg.ScopePrefix, "https://www.example.com/docs/guide", true},
+		{pkg.ScopePrefix, "https://www.example.com/blog", false},
+		{pkg.ScopeAny, "https://elsewhere.org/", true},
+	}
+	for _, tt := range tests {
+		target, _ := url.Parse(tt.target)
+		if got := tt.scope.Allows(seed, target); got != tt.want {
+			t.Errorf("%s.Allows(%s) = %v, want %v", tt.scope, tt.target, got, tt.want)
+		}
+	}
+}
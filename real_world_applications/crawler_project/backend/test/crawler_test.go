@@ -1 +1,78 @@
 package test
+
+import (
+	"math"
+	"testing"
+
+	"web_crawler/pkg"
+)
+
+func TestParseLinksWithAnchorText(t *testing.T) {
+	page := `<html><body>
+<a href="/about">About <b>us</b></a>
+<a href="https://example.org/docs">
+	Read   the docs
+</a>
+</body></html>`
+
+	links, _, _, _, _, err := pkg.Parse(page)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []pkg.Link{
+		{URL: "/about", Text: "About us"},
+		{URL: "https://example.org/docs", Text: "Read the docs"},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("Parse() returned %d links, want %d", len(links), len(want))
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+}
+
+func TestPageRankCycleIsUniform(t *testing.T) {
+	g := pkg.NewLinkGraph()
+	g.AddEdge("a", "b")
+	g.AddEdge("b", "c")
+	g.AddEdge("c", "a")
+
+	scores := g.PageRank(pkg.DefaultPageRankOptions())
+	for url, score := range scores {
+		if math.Abs(score-1) > 1e-4 {
+			t.Errorf("score[%s] = %v, want 1", url, score)
+		}
+	}
+}
+
+func TestPageRankFavoursLinkedPages(t *testing.T) {
+	g := pkg.NewLinkGraph()
+	for _, leaf := range []string{"a", "b", "c", "d"} {
+		g.AddEdge(leaf, "hub")
+		g.AddEdge(leaf, "hub") // parallel edges count once
+	}
+	g.AddEdge("hub", "a")
+	g.AddEdge("hub", "hub") // self links are ignored
+
+	for _, workers := range []int{1, 3, 8} {
+		opts := pkg.DefaultPageRankOptions()
+		opts.Workers = workers
+		scores := g.PageRank(opts)
+
+		if len(scores) != 5 {
+			t.Fatalf("got %d scores, want 5", len(scores))
+		}
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		if math.Abs(total-5) > 1e-3 {
+			t.Errorf("workers=%d: scores sum to %v, want 5", workers, total)
+		}
+		if scores["hub"] <= scores["a"] || scores["a"] <= scores["b"] {
+			t.Errorf("workers=%d: unexpected ordering %v", workers, scores)
+		}
+	}
+}
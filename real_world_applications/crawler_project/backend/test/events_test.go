@@ -0,0 +1,221 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"web_crawler/models"
+	"web_crawler/pkg"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEventBusFiltersAndOrders(t *testing.T) {
+	bus := pkg.NewEventBus(10)
+	all := bus.Subscribe(0, 10, nil)
+	job := bus.Subscribe(0, 10, func(e pkg.Event) bool { return e.JobID == "b" })
+
+	for _, id := range []string{"a", "b", "a", "b"} {
+		bus.Publish(pkg.Event{Type: pkg.EventURLEnqueued, JobID: id})
+	}
+	all.Close()
+	job.Close()
+
+	var ids []uint64
+	for e := range all.C {
+		ids = append(ids, e.ID)
+		if e.Time.IsZero() {
+			t.Errorf("event %d has no time", e.ID)
+		}
+	}
+	if fmt.Sprint(ids) != "[1 2 3 4]" {
+		t.Errorf("all events %v, want [1 2 3 4]", ids)
+	}
+	ids = nil
+	for e := range job.C {
+		ids = append(ids, e.ID)
+	}
+	if fmt.Sprint(ids) != "[2 4]" {
+		t.Errorf("job events %v, want [2 4]", ids)
+	}
+}
+
+func TestEventBusResumesFromHistory(t *testing.T) {
+	bus := pkg.NewEventBus(3)
+	for i := 0; i < 5; i++ {
+		bus.Publish(pkg.Event{Type: pkg.EventPageFetched})
+	}
+	sub := bus.Subscribe(2, 1, nil)
+	bus.Publish(pkg.Event{Type: pkg.EventPageIndexed})
+	sub.Close()
+
+	var ids []uint64
+	for e := range sub.C {
+		ids = append(ids, e.ID)
+	}
+	// Event 3 is the oldest still in the history of three.
+	if fmt.Sprint(ids) != "[3 4 5 6]" {
+		t.Errorf("resumed events %v, want [3 4 5 6]", ids)
+	}
+	if bus.LastID() != 6 {
+		t.Errorf("LastID = %d, want 6", bus.LastID())
+	}
+}
+
+func TestEventBusClosesSlowSubscribers(t *testing.T) {
+	bus := pkg.NewEventBus(0)
+	slow := bus.Subscribe(0, 2, nil)
+	for i := 0; i < 3; i++ {
+		bus.Publish(pkg.Event{Type: pkg.EventPageFetched})
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != 2 || !slow.Overflowed() {
+		t.Errorf("slow subscriber got %d events, overflowed %v; want 2 and closed", n, slow.Overflowed())
+	}
+	slow.Close() // closing again is harmless
+}
+
+func TestCrawlJobs(t *testing.T) {
+	jobs := pkg.NewCrawlJobs()
+	n := 0
+	newID := func() string { n++; return fmt.Sprintf("job%d", n) }
+
+	id, started := jobs.Start("https://a.example/", newID)
+	if id != "job1" || !started {
+		t.Fatalf("Start = %s, %v; want a new job", id, started)
+	}
+	if id, started := jobs.Start("https://a.example/", newID); id != "job1" || started {
+		t.Errorf("Start of a queued URL = %s, %v; want its job", id, started)
+	}
+	if jobs.ID("https://a.example/") != "job1" || jobs.Len() != 1 {
+		t.Errorf("ID = %q with %d jobs", jobs.ID("https://a.example/"), jobs.Len())
+	}
+	if jobs.Finish("https://a.example/") != "job1" || jobs.Len() != 0 || jobs.Finish("https://a.example/") != "" {
+		t.Error("Finish did not end the job once")
+	}
+	if id, _ := jobs.Start("https://a.example/", newID); id != "job2" {
+		t.Errorf("URL queued again got job %s, want a new one", id)
+	}
+}
+
+func TestEventMatches(t *testing.T) {
+	e := pkg.Event{Type: pkg.EventPageIndexed, JobID: "j1"}
+	tests := []struct {
+		hook models.EventWebhook
+		want bool
+	}{
+		{models.EventWebhook{}, true},
+		{models.EventWebhook{Events: []string{"page_indexed", "job_completed"}}, true},
+		{models.EventWebhook{Events: []string{"fetch_failed"}}, false},
+		{models.EventWebhook{JobID: "j1"}, true},
+		{models.EventWebhook{JobID: "j2", Events: []string{"page_indexed"}}, false},
+	}
+	for _, tt := range tests {
+		if got := pkg.EventMatches(tt.hook, e); got != tt.want {
+			t.Errorf("EventMatches(%+v) = %v, want %v", tt.hook, got, tt.want)
+		}
+	}
+}
+
+// webhookDispatcher returns a dispatcher over hooks that retries without delay.
+func webhookDispatcher(bus *pkg.EventBus, hooks []models.EventWebhook) *pkg.EventWebhooks {
+	w := pkg.NewEventWebhooks(bus, pkg.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, time.Second, 10)
+	w.Hooks = func(ctx context.Context) ([]models.EventWebhook, error) { return hooks, nil }
+	w.Client = http.DefaultClient
+	return w
+}
+
+func TestEventWebhooksDeliverSignedEvents(t *testing.T) {
+	type delivery struct {
+		event pkg.Event
+		err   error
+	}
+	deliveries := make(chan delivery, 10)
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails and is retried.
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var e pkg.Event
+		json.Unmarshal(body, &e)
+		err := pkg.VerifyWebhookSignature("s3cret", r.Header, body, time.Minute, time.Now())
+		if err == nil && r.Header.Get(pkg.WebhookEventHeader) != string(e.Type) {
+			err = fmt.Errorf("event header %q", r.Header.Get(pkg.WebhookEventHeader))
+		}
+		deliveries <- delivery{e, err}
+	}))
+	defer server.Close()
+
+	bus := pkg.NewEventBus(10)
+	hook := models.EventWebhook{ID: primitive.NewObjectID(), URL: server.URL, Secret: "s3cret", JobID: "j1"}
+	dispatcher := webhookDispatcher(bus, []models.EventWebhook{hook})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher.Dispatch(ctx, bus.Publish(pkg.Event{Type: pkg.EventPageIndexed, JobID: "j2", URL: "https://other.example/"}))
+	dispatcher.Dispatch(ctx, bus.Publish(pkg.Event{Type: pkg.EventPageIndexed, JobID: "j1", URL: "https://a.example/", PageID: "p1"}))
+	select {
+	case d := <-deliveries:
+		if d.err != nil {
+			t.Fatalf("delivery error = %v", d.err)
+		}
+		if d.event.JobID != "j1" || d.event.PageID != "p1" {
+			t.Errorf("delivered %+v, want the page_indexed event of job j1", d.event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+	}
+	if calls.Load() != 2 {
+		t.Errorf("%d attempts, want the failed one retried once", calls.Load())
+	}
+}
+
+func TestEventWebhooksStopOnClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	bus := pkg.NewEventBus(0)
+	dispatcher := webhookDispatcher(bus, []models.EventWebhook{{ID: primitive.NewObjectID(), URL: server.URL}})
+	var mu sync.Mutex
+	var errs []error
+	failed := make(chan struct{}, 1)
+	dispatcher.OnError = func(hook *models.EventWebhook, e pkg.Event, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+		failed <- struct{}{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dispatcher.Dispatch(ctx, pkg.Event{ID: 1, Type: pkg.EventFetchFailed})
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("failed delivery was not reported")
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d attempts for a 410 response, want 1", calls.Load())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 {
+		t.Errorf("errors %v", errs)
+	}
+}
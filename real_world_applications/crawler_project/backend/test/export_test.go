@@ -0,0 +1,310 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"web_crawler/models"
+	"web_crawler/pkg"
+)
+
+// exportPages is the index seen by the exporters under test.
+var exportPages = []models.WebPage{
+	{ID: "1", URL: "https://a.example/", StatusCode: 200, Title: "Alpha, \"quoted\"", Keywords: []string{"go", "crawler"},
+		Content: "alpha body", PageRank: 1.5, Language: "en", CrawledAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+	{ID: "2", URL: "https://b.example/", StatusCode: 404, Title: "Beta\nline", Content: "beta body",
+		CrawledAt: time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC)},
+}
+
+// fakeExporter returns an exporter over exportPages that records the requested source fields.
+func fakeExporter(t *testing.T, opts pkg.ExportOptions, source *[]string) *pkg.Exporter {
+	t.Helper()
+	exporter, err := pkg.NewExporter(opts)
+	if err != nil {
+		t.Fatalf("NewExporter error = %v", err)
+	}
+	exporter.Pages = func(ctx context.Context, filter models.PageFilter, fields []string, fn func(models.WebPage) error) error {
+		if source != nil {
+			*source = fields
+		}
+		for _, p := range exportPages {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return exporter
+}
+
+func TestExportJSONLWithFields(t *testing.T) {
+	var source []string
+	exporter := fakeExporter(t, pkg.ExportOptions{Format: "jsonl", Fields: []string{"url", "id", "keywords", "crawled_at"}}, &source)
+	var out bytes.Buffer
+	count, err := exporter.Export(context.Background(), &out)
+	if err != nil || count != 2 {
+		t.Fatalf("Export = %d, %v; want 2 pages", count, err)
+	}
+	if fmt.Sprint(source) != "[url keywords crawled_at]" {
+		t.Errorf("loaded source fields %v, want the selected fields without id", source)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := `{"url":"https://a.example/","id":"1","keywords":["go","crawler"],"crawled_at":"2024-05-01T12:00:00Z"}`
+	if len(lines) != 2 || lines[0] != want {
+		t.Fatalf("export:\n%s\nwant first line %s", out.String(), want)
+	}
+	var page map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &page); err != nil || len(page) != 4 || page["id"] != "2" {
+		t.Errorf("second line %s: %v", lines[1], err)
+	}
+	if exporter.FileName() != "pages.jsonl" || exporter.ContentType() != "application/x-ndjson" {
+		t.Errorf("file %s, type %s", exporter.FileName(), exporter.ContentType())
+	}
+}
+
+func TestExportCSVGzip(t *testing.T) {
+	var source []string
+	exporter := fakeExporter(t, pkg.ExportOptions{Format: "csv", Gzip: true}, &source)
+	var out bytes.Buffer
+	if _, err := exporter.Export(context.Background(), &out); err != nil {
+		t.Fatalf("Export error = %v", err)
+	}
+	if source != nil {
+		t.Errorf("loaded source fields %v, want every field", source)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("output is not gzip: %v", err)
+	}
+	records, err := csv.NewReader(zr).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not CSV: %v", err)
+	}
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(pkg.ExportFields(), ",") {
+		t.Fatalf("records %q, want a header of every field and two rows", records)
+	}
+	row := make(map[string]string)
+	for i, name := range records[0] {
+		row[name] = records[1][i]
+	}
+	if row["title"] != `Alpha, "quoted"` || row["keywords"] != "go; crawler" || row["status_code"] != "200" ||
+		row["pagerank"] != "1.5" || row["crawled_at"] != "2024-05-01T12:00:00Z" {
+		t.Errorf("first row %v", row)
+	}
+	if exporter.FileName() != "pages.csv.gz" || exporter.ContentType() != "application/gzip" {
+		t.Errorf("file %s, type %s", exporter.FileName(), exporter.ContentType())
+	}
+}
+
+func TestExportStreams(t *testing.T) {
+	exporter := fakeExporter(t, pkg.ExportOptions{Format: "jsonl", Fields: []string{"url"}}, nil)
+	var out bytes.Buffer
+	exporter.Pages = func(ctx context.Context, filter models.PageFilter, fields []string, fn func(models.WebPage) error) error {
+		for i := 0; i < 3; i++ {
+			before := out.Len()
+			if err := fn(models.WebPage{URL: fmt.Sprintf("https://%d.example/", i)}); err != nil {
+				return err
+			}
+			if out.Len() == before {
+				t.Fatalf("page %d was not written before the next one was read", i)
+			}
+		}
+		return nil
+	}
+	if count, err := exporter.Export(context.Background(), &out); err != nil || count != 3 {
+		t.Fatalf("Export = %d, %v", count, err)
+	}
+}
+
+func TestExportRejectsBadOptions(t *testing.T) {
+	tests := []pkg.ExportOptions{
+		{Format: "xml"},
+		{Format: "csv", Fields: []string{"url", "secret"}},
+		{Format: "csv", Fields: []string{"url", "url"}},
+	}
+	for _, opts := range tests {
+		if _, err := pkg.NewExporter(opts); err == nil {
+			t.Errorf("NewExporter(%+v) returned no error", opts)
+		}
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	exporter := fakeExporter(t, pkg.ExportOptions{Format: "parquet", Fields: []string{"url", "status_code", "keywords", "pagerank", "crawled_at"}}, nil)
+	var out bytes.Buffer
+	if _, err := exporter.Export(context.Background(), &out); err != nil {
+		t.Fatalf("Export error = %v", err)
+	}
+	file := out.Bytes()
+	if !bytes.HasPrefix(file, []byte("PAR1")) || !bytes.HasSuffix(file, []byte("PAR1")) {
+		t.Fatal("output does not start and end with the Parquet magic")
+	}
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta := readThrift(t, bytes.NewReader(file[len(file)-8-footerLen:len(file)-8]))
+
+	if meta[3] != int64(2) {
+		t.Errorf("num_rows = %v, want 2", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	var names []string
+	for _, el := range schema[1:] {
+		names = append(names, string(el.(map[int16]interface{})[4].([]byte)))
+	}
+	if fmt.Sprint(names) != "[url status_code keywords pagerank crawled_at]" {
+		t.Errorf("schema columns %v", names)
+	}
+
+	// Decode every column chunk from the offsets in the footer.
+	groups := meta[4].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("%d row groups, want 1", len(groups))
+	}
+	columns := groups[0].(map[int16]interface{})[1].([]interface{})
+	var got [][]interface{}
+	for _, c := range columns {
+		cm := c.(map[int16]interface{})[3].(map[int16]interface{})
+		r := bytes.NewReader(file[cm[9].(int64):])
+		header := readThrift(t, r)
+		data := make([]byte, header[3].(int64))
+		io.ReadFull(r, data)
+		if header[5].(map[int16]interface{})[1] != int64(2) {
+			t.Errorf("page of %v has %v values, want 2", cm[3], header[5])
+		}
+		got = append(got, decodePlain(cm[1].(int64), data))
+	}
+	want := [][]interface{}{
+		{"https://a.example/", "https://b.example/"},
+		{int64(200), int64(404)},
+		{"go; crawler", ""},
+		{1.5, 0.0},
+		{exportPages[0].CrawledAt.UnixMilli(), exportPages[1].CrawledAt.UnixMilli()},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("columns %v, want %v", got, want)
+	}
+}
+
+func TestParquetWriterSplitsRowGroups(t *testing.T) {
+	var out bytes.Buffer
+	w := pkg.NewParquetWriter(&out, []pkg.ParquetColumn{{Name: "body", Type: pkg.ParquetString}})
+	body := strings.Repeat("x", 1<<20)
+	for i := 0; i < 20; i++ {
+		if err := w.WriteRow(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := out.Bytes()
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta := readThrift(t, bytes.NewReader(file[len(file)-8-footerLen:len(file)-8]))
+	groups := meta[4].([]interface{})
+	rows := int64(0)
+	for _, g := range groups {
+		rows += g.(map[int16]interface{})[3].(int64)
+	}
+	if len(groups) < 2 || rows != 20 {
+		t.Errorf("%d row groups with %d rows, want several holding all 20", len(groups), rows)
+	}
+	if err := w.WriteRow(1); err == nil {
+		t.Error("WriteRow with an int in a string column returned no error")
+	}
+}
+
+// readThrift decodes a thrift compact protocol struct into its fields by ID. Integers are
+// int64, binaries []byte, lists []interface{} and structs map[int16]interface{}.
+func readThrift(t *testing.T, r *bytes.Reader) map[int16]interface{} {
+	t.Helper()
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("truncated thrift struct: %v", err)
+		}
+		if b == 0 {
+			return fields
+		}
+		typ := b & 0x0f
+		if delta := int16(b >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(readZigzag(t, r))
+		}
+		fields[last] = readThriftValue(t, r, typ)
+	}
+}
+
+func readThriftValue(t *testing.T, r *bytes.Reader, typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 5, 6:
+		return readZigzag(t, r)
+	case 7:
+		var f float64
+		binary.Read(r, binary.LittleEndian, &f)
+		return f
+	case 8:
+		n, _ := binary.ReadUvarint(r)
+		b := make([]byte, n)
+		io.ReadFull(r, b)
+		return b
+	case 9:
+		h, _ := r.ReadByte()
+		n := uint64(h >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = readThriftValue(t, r, h&0x0f)
+		}
+		return list
+	case 12:
+		return readThrift(t, r)
+	}
+	t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func readZigzag(t *testing.T, r *bytes.Reader) int64 {
+	u, err := binary.ReadUvarint(r)
+	if err != nil {
+		t.Fatalf("bad varint: %v", err)
+	}
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+// decodePlain decodes plain-encoded values of a Parquet physical type.
+func decodePlain(typ int64, data []byte) []interface{} {
+	var values []interface{}
+	for len(data) > 0 {
+		switch typ {
+		case 2: // INT64
+			values = append(values, int64(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case 5: // DOUBLE
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data)))
+			data = data[8:]
+		case 6: // BYTE_ARRAY
+			n := binary.LittleEndian.Uint32(data)
+			values = append(values, string(data[4:4+n]))
+			data = data[4+n:]
+		default:
+			return nil
+		}
+	}
+	return values
+}
@@ -0,0 +1,241 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"web_crawler/pkg"
+)
+
+func extract(t *testing.T, contentType, body string) *pkg.PageResult {
+	t.Helper()
+	result, err := pkg.Extract(&pkg.Document{ContentType: contentType, Body: []byte(body)})
+	if err != nil {
+		t.Fatalf("Extract(%s) error = %v", contentType, err)
+	}
+	if result.ContentType != contentType {
+		t.Errorf("ContentType = %q, want %q", result.ContentType, contentType)
+	}
+	return result
+}
+
+func hasLink(links []pkg.Link, url string) bool {
+	for _, l := range links {
+		if l.URL == url {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExtractHTML(t *testing.T) {
+	result := extract(t, "text/html", `<html><head><title>Home</title></head><body><p>Hello</p><a href="/a">A</a></body></html>`)
+	if result.Title != "Home" || len(result.Contents) != 1 || !hasLink(result.Links, "/a") {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestExtractPlainText(t *testing.T) {
+	result := extract(t, "text/plain", "\n  Release notes\n\nFixed   the crawler.\nSee https://example.com/changelog.\n\nThanks!")
+	if result.Title != "Release notes" {
+		t.Errorf("Title = %q", result.Title)
+	}
+	if len(result.Contents) != 3 || result.Contents[1] != "Fixed the crawler. See https://example.com/changelog." {
+		t.Errorf("Contents = %q", result.Contents)
+	}
+	if !hasLink(result.Links, "https://example.com/changelog") {
+		t.Errorf("Links = %+v", result.Links)
+	}
+}
+
+func TestExtractRSS(t *testing.T) {
+	feed := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0"><channel>
+  <title>Example feed</title>
+  <link>https://example.com/</link>
+  <description>News from example</description>
+  <item>
+    <title>First post</title>
+    <link>https://example.com/posts/1</link>
+    <description>Hello world</description>
+    <category>go</category>
+  </item>
+</channel></rss>`
+	result := extract(t, "application/rss+xml", feed)
+	if result.Title != "Example feed" || result.Description != "News from example" {
+		t.Errorf("Title/Description = %q / %q", result.Title, result.Description)
+	}
+	if !hasLink(result.Links, "https://example.com/posts/1") {
+		t.Errorf("Links = %+v", result.Links)
+	}
+	if strings.Join(result.Contents, "|") != "First post|Hello world" {
+		t.Errorf("Contents = %q", result.Contents)
+	}
+	if len(result.Keywords) != 1 || result.Keywords[0] != "go" {
+		t.Errorf("Keywords = %q", result.Keywords)
+	}
+}
+
+func TestExtractAtomFallsBackToXML(t *testing.T) {
+	feed := `<feed xmlns="http://www.w3.org/2005/Atom"><title>Atom</title><entry><title>Entry</title><link href="https://example.com/e"/></entry></feed>`
+	result := extract(t, "application/vnd.custom+xml", feed)
+	if result.Title != "Atom" || !hasLink(result.Links, "https://example.com/e") {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	body := `{"title": "API", "description": "An endpoint", "tags": ["a", "b"], "items": [{"url": "https://example.com/x", "text": "body"}]}`
+	result := extract(t, "application/json", body)
+	if result.Title != "API" || result.Description != "An endpoint" {
+		t.Errorf("Title/Description = %q / %q", result.Title, result.Description)
+	}
+	if len(result.Keywords) != 2 || !hasLink(result.Links, "https://example.com/x") {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(result.Contents) != 1 || result.Contents[0] != "body" {
+		t.Errorf("Contents = %q", result.Contents)
+	}
+}
+
+func TestExtractPDF(t *testing.T) {
+	result := extract(t, "application/pdf", string(minimalPDF("Crawler manual", "Hello PDF world")))
+	if result.Title != "Crawler manual" {
+		t.Errorf("Title = %q", result.Title)
+	}
+	if !strings.Contains(strings.Join(result.Contents, " "), "Hello PDF world") {
+		t.Errorf("Contents = %q", result.Contents)
+	}
+}
+
+func TestExtractMalformedPDF(t *testing.T) {
+	_, err := pkg.Extract(&pkg.Document{ContentType: "application/pdf", Body: []byte("%PDF-1.4 garbage")})
+	if err == nil {
+		t.Errorf("Extract() accepted a malformed PDF")
+	}
+}
+
+func TestExtractUnsupportedType(t *testing.T) {
+	_, err := pkg.Extract(&pkg.Document{ContentType: "image/png", Body: []byte{0x89, 'P', 'N', 'G'}})
+	var unsupported *pkg.UnsupportedTypeError
+	if !errors.As(err, &unsupported) || unsupported.ContentType != "image/png" {
+		t.Errorf("Extract() error = %v, want UnsupportedTypeError for image/png", err)
+	}
+}
+
+// minimalPDF builds a single page PDF showing text, with a correct cross-reference table.
+func minimalPDF(title, text string) []byte {
+	content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Title (%s) >>", title),
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestExtractStructuredData(t *testing.T) {
+	page := `<html itemscope itemtype="https://schema.org/WebPage"><head>
+<title>Acme anvil</title>
+<meta property="og:type" content="product">
+<meta property="og:title" content="Acme Anvil">
+<meta property="og:description" content="The heaviest anvil we make.">
+<meta property="og:image" content="https://shop.example/anvil.jpg">
+<meta property="og:image" content="https://shop.example/anvil-2.jpg">
+<meta property="og:locale" content="en_US">
+<meta name="twitter:card" content="summary_large_image">
+<meta name="twitter:site" content="@acme">
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "Product", "name": "Acme Anvil", "sku": 1234, "image": {"@type": "ImageObject", "url": "https://shop.example/anvil.jpg"},
+   "brand": {"@type": "Brand", "name": "Acme"},
+   "offers": [{"@type": "Offer", "price": 99.5, "priceCurrency": "EUR"}, {"@type": "Offer", "price": 120, "priceCurrency": "USD"}]},
+  {"@type": ["NewsArticle", "Article"], "headline": "Anvils are back"}
+]}
+</script>
+<script type="application/ld+json">{not json</script>
+</head><body>
+<div itemscope itemtype="http://schema.org/Event">
+  <h2 itemprop="name">Anvil launch party</h2>
+  <time itemprop="startDate" datetime="2024-06-01T19:00">June 1st</time>
+  <div itemprop="location" itemscope itemtype="http://schema.org/Place">
+    <span itemprop="name">Acme HQ</span>
+    <a itemprop="url" href="https://acme.example/hq">HQ</a>
+  </div>
+  <div itemscope itemtype="http://schema.org/Person"><span itemprop="name">Wile E.</span></div>
+</div>
+</body></html>`
+	result := extract(t, "text/html", page)
+	s := result.Structured
+	if s == nil {
+		t.Fatal("no structured data extracted")
+	}
+	if result.Description != "The heaviest anvil we make." {
+		t.Errorf("Description = %q, want the og:description", result.Description)
+	}
+	if s.OpenGraph == nil || s.OpenGraph.Type != "product" || s.OpenGraph.Image != "https://shop.example/anvil.jpg" {
+		t.Errorf("OpenGraph = %+v", s.OpenGraph)
+	}
+	if s.Twitter == nil || s.Twitter.Card != "summary_large_image" || s.Twitter.Site != "@acme" {
+		t.Errorf("Twitter = %+v", s.Twitter)
+	}
+
+	var types []string
+	for _, item := range s.Items {
+		types = append(types, item.Source+":"+item.Type)
+	}
+	want := "[microdata:WebPage microdata:Event microdata:Person json-ld:Product json-ld:NewsArticle]"
+	if fmt.Sprint(types) != want {
+		t.Fatalf("items %v, want %s", types, want)
+	}
+
+	product := s.Items[3]
+	if product.Name != "Acme Anvil" || product.Image != "https://shop.example/anvil.jpg" {
+		t.Errorf("product = %+v", product)
+	}
+	props := fmt.Sprint(product.Properties)
+	for _, p := range []string{"{brand.name Acme}", "{offers.price 99.5}", "{offers.price 120}", "{offers.priceCurrency EUR}", "{sku 1234}"} {
+		if !strings.Contains(props, p) {
+			t.Errorf("product properties %s lack %s", props, p)
+		}
+	}
+	if strings.Contains(props, "@") {
+		t.Errorf("product properties %s include JSON-LD keywords", props)
+	}
+
+	event := s.Items[1]
+	if event.Name != "Anvil launch party" || event.Property("startDate") != "2024-06-01T19:00" ||
+		event.Property("location.name") != "Acme HQ" || event.Property("location.url") != "https://acme.example/hq" {
+		t.Errorf("event = %+v", event)
+	}
+	if event.Property("name") == "Wile E." {
+		t.Error("the nested item without itemprop leaked into the event")
+	}
+}
+
+func TestExtractStructuredDataAbsent(t *testing.T) {
+	result := extract(t, "text/html", `<html><head><meta property="og:locale" content="en_US"></head><body><p>Plain</p></body></html>`)
+	if result.Structured != nil {
+		t.Errorf("Structured = %+v, want nil for a page without structured data", result.Structured)
+	}
+}
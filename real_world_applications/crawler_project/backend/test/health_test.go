@@ -0,0 +1,71 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+func TestHealthCheckerReportsComponents(t *testing.T) {
+	h := pkg.NewHealthChecker(50 * time.Millisecond)
+	h.AddCheck("elasticsearch", func(ctx context.Context) error { return nil })
+	h.AddCheck("mongo", func(ctx context.Context) error { return errors.New("connection refused") })
+
+	report := h.Dependencies(context.Background())
+	if report.Healthy() {
+		t.Errorf("report is healthy with mongo down")
+	}
+	if got := report.Components["elasticsearch"].Status; got != pkg.StatusUp {
+		t.Errorf("elasticsearch status = %s, want up", got)
+	}
+	mongo := report.Components["mongo"]
+	if mongo.Status != pkg.StatusDown || mongo.Error != "connection refused" {
+		t.Errorf("mongo status = %+v, want down with error", mongo)
+	}
+}
+
+func TestHealthCheckerTimesOutHungChecks(t *testing.T) {
+	h := pkg.NewHealthChecker(20 * time.Millisecond)
+	block := make(chan struct{})
+	defer close(block)
+	h.AddCheck("hung", func(ctx context.Context) error {
+		<-block // ignores its context on purpose
+		return nil
+	})
+
+	start := time.Now()
+	report := h.Dependencies(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Dependencies() took %v, the timeout was not applied", elapsed)
+	}
+	if report.Components["hung"].Status != pkg.StatusDown {
+		t.Errorf("hung check reported %+v, want down", report.Components["hung"])
+	}
+}
+
+func TestHealthCheckerQueueThresholds(t *testing.T) {
+	depth := 5
+	h := pkg.NewHealthChecker(time.Second)
+	h.AddCheck("elasticsearch", func(ctx context.Context) error { return nil })
+	h.AddQueue("frontier", func() int { return depth }, 10)
+
+	if report := h.Readiness(context.Background()); !report.Healthy() {
+		t.Errorf("Readiness() not healthy below threshold: %+v", report)
+	}
+
+	depth = 11
+	report := h.Readiness(context.Background())
+	if report.Healthy() {
+		t.Errorf("Readiness() healthy with frontier past its threshold")
+	}
+	if got := *report.Components["frontier"].Depth; got != 11 {
+		t.Errorf("frontier depth = %d, want 11", got)
+	}
+
+	if report := h.Dependencies(context.Background()); !report.Healthy() {
+		t.Errorf("Dependencies() should ignore queue depth: %+v", report)
+	}
+}
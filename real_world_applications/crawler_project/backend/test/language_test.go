@@ -0,0 +1,58 @@
+package test
+
+import (
+	"testing"
+
+	"web_crawler/pkg"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", "Welcome to our online store. We sell books, music and films at the best prices, with free delivery on all orders.", "en"},
+		{"french", "Bienvenue dans notre boutique en ligne. Nous vendons des livres, de la musique et des films aux meilleurs prix.", "fr"},
+		{"german", "Willkommen in unserem Onlineshop. Wir verkaufen Bücher, Musik und Filme zu den besten Preisen.", "de"},
+		{"spanish", "Bienvenido a nuestra tienda en línea. Vendemos libros, música y películas a los mejores precios.", "es"},
+		{"italian", "Benvenuti nel nostro negozio online. Vendiamo libri, musica e film ai migliori prezzi.", "it"},
+		{"portuguese", "Bem-vindo à nossa loja online. Vendemos livros, música e filmes aos melhores preços.", "pt"},
+		{"dutch", "Welkom in onze webwinkel. Wij verkopen boeken, muziek en films tegen de beste prijzen.", "nl"},
+		{"russian", "Добро пожаловать в наш интернет-магазин. Мы продаём книги и музыку.", "ru"},
+		{"greek", "Καλώς ήρθατε στο ηλεκτρονικό μας κατάστημα. Πουλάμε βιβλία και μουσική.", "el"},
+		{"japanese", "ようこそ私たちのオンラインストアへ。本や音楽を販売しています。", "ja"},
+		{"chinese", "欢迎来到我们的网上商店。我们以最优惠的价格销售书籍、音乐和电影。", "zh"},
+		{"korean", "저희 온라인 상점에 오신 것을 환영합니다. 책과 음악을 판매합니다.", "ko"},
+		{"too short", "ok", pkg.LanguageUnknown},
+		{"no letters", "1234 5678 - 42", pkg.LanguageUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pkg.DetectLanguage(tt.text); got != tt.want {
+				t.Errorf("DetectLanguage(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguagesCoversDetectedCodes(t *testing.T) {
+	supported := make(map[string]bool)
+	for _, code := range pkg.Languages() {
+		supported[code] = true
+	}
+	for _, code := range []string{"en", "fr", "de", "es", "it", "pt", "nl", "ru", "el", "ar", "ja", "zh", "ko"} {
+		if !supported[code] {
+			t.Errorf("Languages() is missing %q", code)
+		}
+	}
+}
+
+func TestExtractDetectsLanguage(t *testing.T) {
+	result := extract(t, "text/html", `<html><head><title>Actualités</title></head><body>
+		<p>Le gouvernement a présenté mercredi un nouveau projet de loi sur les transports publics dans les grandes villes.</p>
+	</body></html>`)
+	if result.Language != "fr" {
+		t.Errorf("Language = %q, want %q", result.Language, "fr")
+	}
+}
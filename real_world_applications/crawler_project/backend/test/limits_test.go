@@ -0,0 +1,236 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	neturl "net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+// setFetchLimits applies l for the rest of the test and restores the package defaults after.
+func setFetchLimits(t *testing.T, l pkg.FetchLimits) {
+	t.Helper()
+	pkg.SetFetchLimits(l)
+	t.Cleanup(func() {
+		pkg.SetFetchLimits(pkg.DefaultFetchLimits())
+	})
+}
+
+// allowLoopback lets the rest of the test fetch from httptest servers, which the
+// default limits block like any other private address.
+func allowLoopback(t *testing.T) {
+	t.Helper()
+	limits := pkg.DefaultFetchLimits()
+	limits.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	setFetchLimits(t, limits)
+}
+
+func TestFetchBlocksPrivateNetworks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	limits := pkg.DefaultFetchLimits()
+	setFetchLimits(t, limits)
+	_, err := pkg.FetchDocument(context.Background(), server.URL)
+	if !errors.Is(err, pkg.ErrBlockedAddress) {
+		t.Fatalf("fetching loopback: err %v, want ErrBlockedAddress", err)
+	}
+	if got := pkg.ClassifyError(err); got != pkg.ClassBlocked {
+		t.Errorf("ClassifyError = %q, want %q", got, pkg.ClassBlocked)
+	}
+
+	limits.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	setFetchLimits(t, limits)
+	doc, err := pkg.FetchDocument(context.Background(), server.URL)
+	if err != nil || string(doc.Body) != "internal" {
+		t.Errorf("fetching an allowed network: doc %v, err %v", doc, err)
+	}
+}
+
+func TestFetchBlocksRedirectsToPrivateNetworks(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer internal.Close()
+	// The public side is also on loopback, so only its own port is allowed.
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(internal.URL, "127.0.0.1", "127.0.0.2", 1), http.StatusFound)
+	}))
+	defer public.Close()
+
+	limits := pkg.DefaultFetchLimits()
+	limits.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	setFetchLimits(t, limits)
+	if _, err := pkg.FetchDocument(context.Background(), public.URL); !errors.Is(err, pkg.ErrBlockedAddress) {
+		t.Errorf("redirect into a blocked network: err %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestCheckFetchURL(t *testing.T) {
+	setFetchLimits(t, pkg.DefaultFetchLimits())
+	tests := []struct {
+		url     string
+		blocked bool
+		invalid bool
+	}{
+		{url: "https://93.184.216.34/"},
+		{url: "http://[2606:2800:220:1::]/"},
+		{url: "http://127.0.0.1:8080/admin", blocked: true},
+		{url: "http://localhost/", blocked: true},
+		{url: "http://10.1.2.3/", blocked: true},
+		{url: "http://192.168.0.1/", blocked: true},
+		{url: "http://169.254.169.254/latest/meta-data/", blocked: true},
+		{url: "http://[::1]/", blocked: true},
+		{url: "http://[::ffff:10.0.0.1]/", blocked: true},
+		{url: "http://0.0.0.0/", blocked: true},
+		{url: "ftp://example.com/", invalid: true},
+		{url: "file:///etc/passwd", invalid: true},
+	}
+	for _, tt := range tests {
+		err := pkg.CheckFetchURL(context.Background(), tt.url)
+		switch {
+		case tt.blocked && !errors.Is(err, pkg.ErrBlockedAddress):
+			t.Errorf("CheckFetchURL(%q) = %v, want ErrBlockedAddress", tt.url, err)
+		case tt.invalid && (err == nil || errors.Is(err, pkg.ErrBlockedAddress)):
+			t.Errorf("CheckFetchURL(%q) = %v, want an invalid URL error", tt.url, err)
+		case !tt.blocked && !tt.invalid && err != nil:
+			t.Errorf("CheckFetchURL(%q) = %v, want nil", tt.url, err)
+		}
+	}
+}
+
+func TestFetchLimits(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	})
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Write([]byte("not really a video"))
+	})
+	mux.HandleFunc("/sniffed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"))
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write([]byte("<feed/>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("late"))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/hop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/feed", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	limits := pkg.DefaultFetchLimits()
+	limits.BlockPrivateNetworks = false
+	limits.MaxBodySize = 1024
+	limits.MaxRedirects = 2
+	limits.HeaderTimeout = 50 * time.Millisecond
+	setFetchLimits(t, limits)
+	ctx := context.Background()
+
+	if _, err := pkg.FetchDocument(ctx, server.URL+"/big"); !errors.Is(err, pkg.ErrBodyTooLarge) {
+		t.Errorf("/big: err %v, want ErrBodyTooLarge", err)
+	}
+
+	var unsupported *pkg.UnsupportedTypeError
+	doc, err := pkg.FetchDocument(ctx, server.URL+"/video")
+	if !errors.As(err, &unsupported) || unsupported.ContentType != "video/mp4" || doc == nil || doc.Body != nil || doc.StatusCode != 200 {
+		t.Errorf("/video: doc %+v, err %v; want a bodiless document and UnsupportedTypeError", doc, err)
+	}
+	if _, err := pkg.FetchDocument(ctx, server.URL+"/sniffed"); !errors.As(err, &unsupported) || unsupported.ContentType != "image/png" {
+		t.Errorf("/sniffed: err %v, want UnsupportedTypeError for the sniffed image/png", err)
+	}
+	if doc, err := pkg.FetchDocument(ctx, server.URL+"/feed"); err != nil || doc.ContentType != "application/atom+xml" {
+		t.Errorf("/feed: doc %v, err %v; want the +xml pattern to allow it", doc, err)
+	}
+
+	if _, err := pkg.FetchDocument(ctx, server.URL+"/slow"); pkg.ClassifyError(err) != pkg.ClassTimeout {
+		t.Errorf("/slow: err %v, want a header timeout", err)
+	}
+
+	if _, err := pkg.FetchDocument(ctx, server.URL+"/loop"); !errors.Is(err, pkg.ErrTooManyRedirects) {
+		t.Errorf("/loop: err %v, want ErrTooManyRedirects", err)
+	}
+	if _, err := pkg.FetchDocument(ctx, server.URL+"/hop"); err != nil {
+		t.Errorf("/hop: err %v, want one redirect to be followed", err)
+	}
+	limits.MaxRedirects = 0
+	setFetchLimits(t, limits)
+	if _, err := pkg.FetchDocument(ctx, server.URL+"/hop"); !errors.Is(err, pkg.ErrTooManyRedirects) {
+		t.Errorf("/hop with redirects off: err %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestRenderProxyBlocksPrivateNetworks(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer internal.Close()
+	internalTLS := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	}))
+	defer internalTLS.Close()
+
+	// get fetches url the way the browser does, through the proxy for every host.
+	get := func(proxy *pkg.RenderProxy, url string) (string, error) {
+		proxyURL, _ := neturl.Parse(proxy.URL())
+		transport := internalTLS.Client().Transport.(*http.Transport).Clone()
+		transport.Proxy = http.ProxyURL(proxyURL)
+		res, err := (&http.Client{Transport: transport}).Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if res.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("status %d: %s", res.StatusCode, body)
+		}
+		return string(body), nil
+	}
+
+	blocking, err := pkg.StartRenderProxy(pkg.DefaultFetchLimits())
+	if err != nil {
+		t.Fatalf("StartRenderProxy error = %v", err)
+	}
+	defer blocking.Close()
+	for _, url := range []string{internal.URL, internalTLS.URL} {
+		if body, err := get(blocking, url); err == nil {
+			t.Errorf("GET %s through the proxy = %q, want it blocked", url, body)
+		}
+	}
+
+	limits := pkg.DefaultFetchLimits()
+	limits.AllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	allowing, err := pkg.StartRenderProxy(limits)
+	if err != nil {
+		t.Fatalf("StartRenderProxy error = %v", err)
+	}
+	defer allowing.Close()
+	for _, url := range []string{internal.URL, internalTLS.URL} {
+		if body, err := get(allowing, url); err != nil || body != "secret" {
+			t.Errorf("GET %s through an allowing proxy = %q, %v", url, body, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"web_crawler/middleware"
+	"web_crawler/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := utils.NewLogger(utils.LogOptions{Level: "debug"})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	logger.SetOutput(&buf)
+
+	e := echo.New()
+	e.Use(middleware.RequestLogger(logger))
+	e.GET("/page/:id", func(c echo.Context) error {
+		middleware.Logger(c).Info("handler ran")
+		return c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/page/42", nil)
+	req.Header.Set(middleware.RequestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(middleware.RequestIDHeader); got != "abc-123" {
+		t.Errorf("response request ID = %q, want abc-123", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+	}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line is not JSON: %s", line)
+		}
+		if entry["request_id"] != "abc-123" || entry["route"] != "/page/:id" {
+			t.Errorf("log line is missing request fields: %s", line)
+		}
+	}
+	if !strings.Contains(lines[1], `"status":200`) {
+		t.Errorf("access log is missing the status: %s", lines[1])
+	}
+}
+
+func TestRequestLoggerGeneratesID(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	e := echo.New()
+	e.Use(middleware.RequestLogger(logger))
+	e.GET("/ping", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(middleware.RequestIDHeader, "bad id\nwith newline")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	got := rec.Header().Get(middleware.RequestIDHeader)
+	if got == "" || strings.Contains(got, " ") {
+		t.Errorf("request ID = %q, want a generated ID", got)
+	}
+}
+
+func TestNewLoggerRejectsBadLevel(t *testing.T) {
+	if _, err := utils.NewLogger(utils.LogOptions{Level: "loud"}); err == nil {
+		t.Errorf("NewLogger() accepted an invalid level")
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawler.log")
+	file, err := utils.NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingFile() error = %v", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", name, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", name, data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+}
@@ -1 +1,110 @@
 package test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"web_crawler/models"
+
+	"github.com/elastic/go-elasticsearch/v8"
+)
+
+// fakeES records the requests a fakeElasticsearch server received.
+type fakeES struct {
+	searches []string // bodies of search requests
+	updates  []string // paths and bodies of update requests
+}
+
+// fakeElasticsearch serves canned responses to search and bulk requests, accepts every
+// update and records the search and update requests it receives.
+func fakeElasticsearch(t *testing.T, search, bulk string) *fakeES {
+	t.Helper()
+	f := &fakeES{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_search"):
+			f.searches = append(f.searches, string(body))
+			io.WriteString(w, search)
+		case strings.HasSuffix(r.URL.Path, "/_bulk"):
+			io.WriteString(w, bulk)
+		case strings.Contains(r.URL.Path, "/_update/"):
+			f.updates = append(f.updates, r.URL.Path+" "+string(body))
+			io.WriteString(w, `{"result":"updated"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.NewModels(client, nil)
+	return f
+}
+
+func TestUpdatePageRanksCountsOnlyUpdatedPages(t *testing.T) {
+	long := "https://a.example/" + strings.Repeat("x", 300)
+	fake := fakeElasticsearch(t,
+		`{"hits":{"hits":[{"_id":"p1","_source":{"url":"https://a.example/"}},{"_id":"p2","_source":{"url":"`+long+`"}}]}}`,
+		`{"errors":true,"items":[{"update":{"_id":"p1","status":200}},{"update":{"_id":"p2","status":429,"error":{"type":"es_rejected_execution_exception","reason":"queue full"}}}]}`)
+
+	updated, err := models.UpdatePageRanks(context.Background(), map[string]float64{"https://a.example/": 1.5, long: 0.5})
+	if updated != 1 {
+		t.Errorf("UpdatePageRanks() updated %d pages, want 1", updated)
+	}
+	if err == nil || !strings.Contains(err.Error(), "queue full") {
+		t.Errorf("UpdatePageRanks() error = %v, want the failed item reported", err)
+	}
+	// URLs longer than url.keyword keeps must still be looked up.
+	if len(fake.searches) != 1 || !strings.Contains(fake.searches[0], "url.exact") {
+		t.Errorf("searches = %q, want one on url.exact", fake.searches)
+	}
+}
+
+func TestPageIDForURL(t *testing.T) {
+	id := models.PageIDForURL("https://a.example/docs?q=1")
+	for _, same := range []string{"HTTPS://A.Example/docs?q=1", "https://a.example:443/docs?q=1#intro"} {
+		if got := models.PageIDForURL(same); got != id {
+			t.Errorf("PageIDForURL(%q) = %s, want %s", same, got, id)
+		}
+	}
+	if models.PageIDForURL("https://a.example") != models.PageIDForURL("https://a.example/") {
+		t.Error("an empty path and / give different IDs")
+	}
+	for _, other := range []string{"http://a.example/docs?q=1", "https://a.example/Docs?q=1", "https://a.example/docs?q=2"} {
+		if models.PageIDForURL(other) == id {
+			t.Errorf("PageIDForURL(%q) = the ID of a different URL", other)
+		}
+	}
+}
+
+func TestIndexWebPageUpsertsByURL(t *testing.T) {
+	page := models.WebPage{URL: "https://a.example/", Title: "A"}
+
+	// Nothing is indexed yet, so the page is upserted under the ID of its URL.
+	fake := fakeElasticsearch(t, `{"hits":{"hits":[]}}`, `{}`)
+	id, err := models.IndexWebPage(context.Background(), page)
+	if err != nil || id != models.PageIDForURL(page.URL) {
+		t.Fatalf("IndexWebPage() = %q, %v; want the URL's ID", id, err)
+	}
+	if len(fake.updates) != 1 || !strings.Contains(fake.updates[0], "/_update/"+id) || !strings.Contains(fake.updates[0], `"doc_as_upsert":true`) {
+		t.Errorf("updates = %q, want one upsert of %s", fake.updates, id)
+	}
+
+	// A page indexed before IDs came from URLs keeps its generated ID.
+	fake = fakeElasticsearch(t, `{"hits":{"hits":[{"_id":"legacy","_source":{"url":"https://a.example/"}}]}}`, `{}`)
+	if id, err := models.IndexWebPage(context.Background(), page); err != nil || id != "legacy" {
+		t.Errorf("IndexWebPage() of a legacy page = %q, %v; want legacy", id, err)
+	}
+	if len(fake.updates) != 1 || !strings.Contains(fake.updates[0], "/_update/legacy") {
+		t.Errorf("updates = %q, want one of the legacy document", fake.updates)
+	}
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"web_crawler/models"
+	"web_crawler/pkg"
+)
+
+func TestNextPageVersion(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	page := models.WebPage{URL: "https://a.example/", Title: "Old title", Content: "body"}
+
+	first, changed := models.NextPageVersion(nil, models.PageVersion{PageID: "p1", Page: &page, Source: models.VersionCrawl}, now)
+	if !changed || first.Version != 1 || len(first.Changes) != 0 || !first.CreatedAt.Equal(now) {
+		t.Fatalf("first version = %+v, %v", first, changed)
+	}
+	if len(first.ContentHash) != 64 || first.Page.ID != "p1" {
+		t.Errorf("first version hash %q, page ID %q", first.ContentHash, first.Page.ID)
+	}
+	if page.ID != "" {
+		t.Error("NextPageVersion changed the caller's page")
+	}
+
+	// A recrawl that finds the same page adds no version.
+	same := page
+	if _, changed := models.NextPageVersion(&first, models.PageVersion{PageID: "p1", Page: &same, Source: models.VersionCrawl}, now); changed {
+		t.Error("unchanged page produced a new version")
+	}
+
+	edited := page
+	edited.Title = "New title"
+	second, changed := models.NextPageVersion(&first, models.PageVersion{PageID: "p1", Page: &edited, Source: models.VersionEdit, ActorID: "u1"}, now)
+	if !changed || second.Version != 2 || second.ActorID != "u1" || second.ContentHash != first.ContentHash {
+		t.Fatalf("second version = %+v, %v", second, changed)
+	}
+	if len(second.Changes) != 1 || !strings.HasPrefix(second.Changes[0], "title:") {
+		t.Errorf("second version changes = %q, want the title", second.Changes)
+	}
+
+	recrawled := edited
+	recrawled.Content = "new body"
+	third, _ := models.NextPageVersion(&second, models.PageVersion{PageID: "p1", Page: &recrawled, Source: models.VersionCrawl}, now)
+	if third.Version != 3 || third.ContentHash == second.ContentHash {
+		t.Errorf("third version = %d with hash %q, want 3 with a new hash", third.Version, third.ContentHash)
+	}
+}
+
+// fakePageHistory keeps pages and their versions in memory for a pkg.PageHistory.
+type fakePageHistory struct {
+	pages    map[string]models.WebPage
+	versions []models.PageVersion
+}
+
+func (f *fakePageHistory) history() *pkg.PageHistory {
+	return &pkg.PageHistory{
+		Read: func(ctx context.Context, id string) (*models.WebPage, error) {
+			page, ok := f.pages[id]
+			if !ok {
+				return nil, errors.New("page not found")
+			}
+			return &page, nil
+		},
+		Replace: func(ctx context.Context, id string, page models.WebPage) error {
+			f.pages[id] = page
+			return nil
+		},
+		Get: func(ctx context.Context, pageID string, version int) (*models.PageVersion, error) {
+			for _, v := range f.versions {
+				if v.PageID == pageID && v.Version == version {
+					return &v, nil
+				}
+			}
+			return nil, models.ErrPageVersionNotFound
+		},
+		Save: func(ctx context.Context, v models.PageVersion) (*models.PageVersion, error) {
+			var latest *models.PageVersion
+			if n := len(f.versions); n > 0 {
+				latest = &f.versions[n-1]
+			}
+			next, changed := models.NextPageVersion(latest, v, time.Now())
+			if !changed {
+				return nil, nil
+			}
+			f.versions = append(f.versions, next)
+			return &next, nil
+		},
+	}
+}
+
+func (f *fakePageHistory) sources() []string {
+	var sources []string
+	for _, v := range f.versions {
+		sources = append(sources, v.Source)
+	}
+	return sources
+}
+
+func TestPageHistoryRecordBackfillsUnrecordedPage(t *testing.T) {
+	store := &fakePageHistory{pages: map[string]models.WebPage{}}
+	h := store.history()
+	crawled := models.WebPage{URL: "https://a.example/", Title: "Crawled", Content: "body"}
+	edited := crawled
+	edited.Title = "Edited"
+
+	// The page was crawled before versions were kept, so its first edit saves it too.
+	saved, err := h.Record(context.Background(), models.PageVersion{PageID: "p1", Page: &edited, Source: models.VersionEdit}, &crawled)
+	if err != nil || saved == nil || saved.Version != 2 {
+		t.Fatalf("Record() = %+v, %v; want version 2", saved, err)
+	}
+	if got := store.sources(); strings.Join(got, ",") != "crawl,edit" || store.versions[0].Page.Title != "Crawled" {
+		t.Errorf("versions %v, first titled %q; want a crawl of the old page then the edit", got, store.versions[0].Page.Title)
+	}
+
+	// Once the history holds the page as it was, nothing is backfilled.
+	again := edited
+	again.Content = "new body"
+	if _, err := h.Record(context.Background(), models.PageVersion{PageID: "p1", Page: &again, Source: models.VersionEdit}, &edited); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.sources(); strings.Join(got, ",") != "crawl,edit,edit" {
+		t.Errorf("versions %v, want crawl,edit,edit", got)
+	}
+}
+
+func TestPageHistoryRestoreWritesEveryField(t *testing.T) {
+	old := models.WebPage{URL: "https://a.example/", Title: "Old", Content: "old body"}
+	current := models.WebPage{
+		ID: "p1", URL: "https://a.example/", Title: "New", Content: "new body",
+		ContentType: "text/html", Language: "en", PageRank: 2.5,
+		Structured: &models.StructuredData{OpenGraph: &models.OpenGraph{Title: "New"}},
+	}
+	store := &fakePageHistory{pages: map[string]models.WebPage{"p1": current}}
+	h := store.history()
+	ctx := context.Background()
+	if _, err := h.Save(ctx, models.PageVersion{PageID: "p1", Page: &old, Source: models.VersionCrawl}); err != nil {
+		t.Fatal(err)
+	}
+
+	before, after, saved, err := h.Restore(ctx, "p1", 1, "u1")
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if before.Title != "New" || after.Title != "Old" {
+		t.Errorf("before titled %q, after %q; want New, Old", before.Title, after.Title)
+	}
+	// Fields the old version did not have are cleared rather than kept; the score is kept.
+	page := store.pages["p1"]
+	if page.Content != "old body" || page.ContentType != "" || page.Language != "" || page.Structured != nil {
+		t.Errorf("restored page = %+v, want the old version's fields", page)
+	}
+	if page.PageRank != 2.5 {
+		t.Errorf("restored PageRank = %v, want the current 2.5", page.PageRank)
+	}
+
+	// The current page was backfilled as a crawl before the restore was recorded.
+	if got := store.sources(); strings.Join(got, ",") != "crawl,crawl,restore" {
+		t.Fatalf("versions %v, want crawl,crawl,restore", got)
+	}
+	if saved == nil || saved.Version != 3 || saved.RestoredFrom != 1 || saved.ActorID != "u1" {
+		t.Errorf("restore version = %+v, want version 3 restored from 1 by u1", saved)
+	}
+	if saved.Page.ContentType != "" || saved.Page.Structured != nil {
+		t.Errorf("restore version page = %+v, want it to match the restored page", saved.Page)
+	}
+
+	if _, _, _, err := h.Restore(ctx, "p1", 9, "u1"); !errors.Is(err, models.ErrPageVersionNotFound) {
+		t.Errorf("Restore() of a missing version error = %v, want ErrPageVersionNotFound", err)
+	}
+}
@@ -0,0 +1,178 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"web_crawler/models"
+	"web_crawler/pkg"
+)
+
+func TestRawStoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	store, err := pkg.NewRawStore(dir)
+	if err != nil {
+		t.Fatalf("NewRawStore error = %v", err)
+	}
+	body := []byte("<html><body>raw page</body></html>")
+
+	hash, err := store.Put(body)
+	if err != nil {
+		t.Fatalf("Put error = %v", err)
+	}
+	again, err := store.Put(body)
+	if err != nil || again != hash {
+		t.Fatalf("Put of the same body = %q, %v; want %q", again, err, hash)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*", "*.gz"))
+	if len(files) != 1 {
+		t.Errorf("got %d stored files, want identical bodies stored once", len(files))
+	}
+
+	got, err := store.Get(hash)
+	if err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("Get = %q, %v; want %q", got, err, body)
+	}
+	if _, err := store.Get("not-a-hash"); err == nil {
+		t.Errorf("Get with an invalid hash succeeded")
+	}
+}
+
+// fakeRawPages stores bodies in store and serves them the way models.ForEachRawPage does.
+func fakeRawPages(t *testing.T, store *pkg.RawStore, bodies map[string]string) func(context.Context, string, func(models.RawPage) error) error {
+	t.Helper()
+	var pages []models.RawPage
+	for url, body := range bodies {
+		hash, err := store.Put([]byte(body))
+		if err != nil {
+			t.Fatalf("Put error = %v", err)
+		}
+		pages = append(pages, models.RawPage{
+			URL:        url,
+			Hash:       hash,
+			StatusCode: 200,
+			Header:     map[string][]string{"Content-Type": {"text/plain; charset=utf-8"}},
+		})
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+
+	return func(ctx context.Context, after string, fn func(models.RawPage) error) error {
+		for _, page := range pages {
+			if page.URL <= after {
+				continue
+			}
+			if err := fn(page); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestReplayerResumesAfterFailure(t *testing.T) {
+	store, _ := pkg.NewRawStore(t.TempDir())
+	bodies := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		bodies[fmt.Sprintf("https://example.com/%02d", i)] = fmt.Sprintf("Page %d\n\nBody of page %d.", i, i)
+	}
+	progressFile := filepath.Join(t.TempDir(), "progress.json")
+
+	var mu sync.Mutex
+	indexed := make(map[string]string)
+	failing := "https://example.com/10"
+	replayer := pkg.NewReplayer(store, 4)
+	replayer.ProgressFile = progressFile
+	replayer.Pages = fakeRawPages(t, store, bodies)
+	replayer.Index = func(ctx context.Context, doc *pkg.Document, result *pkg.PageResult) error {
+		if doc.URL == failing {
+			return errors.New("index unavailable")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		indexed[doc.URL] = result.Title
+		return nil
+	}
+
+	stats, err := replayer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if stats.Processed != 20 || stats.Indexed != 19 || stats.Failed != 1 {
+		t.Errorf("first run stats = %+v", stats)
+	}
+	if indexed["https://example.com/03"] != "Page 3" {
+		t.Errorf("page 3 indexed with title %q", indexed["https://example.com/03"])
+	}
+
+	var progress pkg.ReplayProgress
+	data, err := os.ReadFile(progressFile)
+	if err != nil {
+		t.Fatalf("progress file not written: %v", err)
+	}
+	json.Unmarshal(data, &progress)
+	if progress.LastURL != "https://example.com/09" {
+		t.Errorf("checkpoint = %q, want it to stop before the failed page", progress.LastURL)
+	}
+
+	failing = ""
+	indexed = make(map[string]string)
+	stats, err = replayer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("second Run error = %v", err)
+	}
+	if stats.Processed != 10 || stats.Failed != 0 || indexed["https://example.com/10"] == "" {
+		t.Errorf("second run stats = %+v, indexed %v", stats, indexed)
+	}
+}
+
+func TestReplayerDryRunDiff(t *testing.T) {
+	store, _ := pkg.NewRawStore(t.TempDir())
+	var diff bytes.Buffer
+	replayer := pkg.NewReplayer(store, 2)
+	replayer.DryRun = true
+	replayer.Diff = &diff
+	replayer.Pages = fakeRawPages(t, store, map[string]string{
+		"https://example.com/same":    "Same\n\nUnchanged body.",
+		"https://example.com/changed": "New title\n\nRewritten body.",
+		"https://example.com/new":     "Fresh\n\nNever indexed.",
+	})
+	replayer.Current = func(ctx context.Context, url string) (*models.WebPage, error) {
+		switch url {
+		case "https://example.com/same":
+			return &models.WebPage{URL: url, StatusCode: 200, Title: "Same", Content: "Same Unchanged body.", ContentType: "text/plain", Language: "en"}, nil
+		case "https://example.com/changed":
+			return &models.WebPage{URL: url, StatusCode: 200, Title: "Old title", Content: "Old body.", ContentType: "text/plain"}, nil
+		}
+		return nil, nil
+	}
+	replayer.Index = func(context.Context, *pkg.Document, *pkg.PageResult) error {
+		t.Errorf("dry run indexed a page")
+		return nil
+	}
+
+	stats, err := replayer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run error = %v", err)
+	}
+	if stats.Changed != 2 || stats.Unchanged != 1 {
+		t.Errorf("stats = %+v, diff:\n%s", stats, diff.String())
+	}
+	out := diff.String()
+	for _, want := range []string{"+ https://example.com/new", "~ https://example.com/changed", `title: "Old title" -> "New title"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("diff is missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "example.com/same") {
+		t.Errorf("diff lists an unchanged page:\n%s", out)
+	}
+}
@@ -0,0 +1,152 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+func TestClassifyFetchErrors(t *testing.T) {
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer tlsServer.Close()
+	allowLoopback(t)
+
+	// A listener that is closed straight away leaves a port nothing listens on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closedAddr := ln.Addr().String()
+	ln.Close()
+
+	expired, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+
+	tests := []struct {
+		name string
+		err  func() error
+		want pkg.ErrorClass
+	}{
+		{"dns", func() error {
+			return &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}
+		}, pkg.ClassDNS},
+		{"connect", func() error {
+			_, err := pkg.FetchDocument(context.Background(), "http://"+closedAddr+"/")
+			return err
+		}, pkg.ClassConnect},
+		{"tls", func() error {
+			_, err := pkg.FetchDocument(context.Background(), tlsServer.URL)
+			return err
+		}, pkg.ClassTLS},
+		{"timeout", func() error {
+			_, err := pkg.FetchDocument(expired, tlsServer.URL)
+			return err
+		}, pkg.ClassTimeout},
+		{"too large", func() error {
+			return fmt.Errorf("fetching: %w", pkg.ErrBodyTooLarge)
+		}, pkg.ClassTooLarge},
+		{"other", func() error { return errors.New("boom") }, pkg.ClassOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.err()
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := pkg.ClassifyError(err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %q, want %q", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchErrorTransient(t *testing.T) {
+	tests := []struct {
+		err  pkg.FetchError
+		want bool
+	}{
+		{pkg.FetchError{Class: pkg.ClassTimeout}, true},
+		{pkg.FetchError{Class: pkg.ClassConnect}, true},
+		{pkg.FetchError{Class: pkg.ClassHTTP5xx, StatusCode: 503}, true},
+		{pkg.FetchError{Class: pkg.ClassHTTP4xx, StatusCode: 429}, true},
+		{pkg.FetchError{Class: pkg.ClassHTTP4xx, StatusCode: 404}, false},
+		{pkg.FetchError{Class: pkg.ClassTLS}, false},
+		{pkg.FetchError{Class: pkg.ClassTooLarge}, false},
+		{pkg.FetchError{Class: pkg.ClassDNS, Err: &net.DNSError{IsNotFound: true}}, false},
+		{pkg.FetchError{Class: pkg.ClassDNS, Err: &net.DNSError{IsTemporary: true}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Transient(); got != tt.want {
+			t.Errorf("%s/%d Transient() = %v, want %v", tt.err.Class, tt.err.StatusCode, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := pkg.RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+	for attempt, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 50; i++ {
+			d := policy.Backoff(attempt)
+			if d > ceiling || d < ceiling/2 {
+				t.Fatalf("Backoff(%d) = %v, want between %v and %v", attempt, d, ceiling/2, ceiling)
+			}
+		}
+	}
+}
+
+// scriptedFetch answers with the given status codes in turn and counts the calls.
+func scriptedFetch(statuses ...int) (func(context.Context, string) (*pkg.Document, error), *int) {
+	calls := 0
+	return func(ctx context.Context, url string) (*pkg.Document, error) {
+		status := statuses[min(calls, len(statuses)-1)]
+		calls++
+		return &pkg.Document{URL: url, StatusCode: status, Header: http.Header{}}, nil
+	}, &calls
+}
+
+func TestFetchWithRetry(t *testing.T) {
+	policy := pkg.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	fetch, calls := scriptedFetch(503, 502, 200)
+	doc, err := pkg.FetchWithRetry(context.Background(), "https://example.com/", policy, fetch)
+	if err != nil || doc.StatusCode != 200 || *calls != 3 {
+		t.Errorf("transient failures: doc %+v, err %v, %d calls; want success after 3", doc, err, *calls)
+	}
+
+	fetch, calls = scriptedFetch(404)
+	_, err = pkg.FetchWithRetry(context.Background(), "https://example.com/missing", policy, fetch)
+	var fe *pkg.FetchError
+	if !errors.As(err, &fe) || fe.Class != pkg.ClassHTTP4xx || fe.Attempts != 1 || *calls != 1 {
+		t.Errorf("404: err %v, %d calls; want one attempt classified http_4xx", err, *calls)
+	}
+
+	fetch, calls = scriptedFetch(500)
+	_, err = pkg.FetchWithRetry(context.Background(), "https://example.com/broken", policy, fetch)
+	if !errors.As(err, &fe) || fe.Class != pkg.ClassHTTP5xx || fe.Attempts != 4 || *calls != 4 {
+		t.Errorf("persistent 500: err %v, %d calls; want the attempt cap of 4", err, *calls)
+	}
+}
+
+func TestFetchWithRetryStopsOnCancel(t *testing.T) {
+	policy := pkg.RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	fetch, calls := scriptedFetch(503)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := pkg.FetchWithRetry(ctx, "https://example.com/", policy, fetch)
+	if err == nil || *calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("err %v after %d calls in %v; want a prompt failure after cancel", err, *calls, time.Since(start))
+	}
+}
@@ -0,0 +1,277 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"web_crawler/models"
+	"web_crawler/pkg"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiffSearchResults(t *testing.T) {
+	first := []models.WebPage{
+		{URL: "https://a.example/", Title: "A", Content: "alpha"},
+		{URL: "https://b.example/", Title: "B", Content: "beta"},
+	}
+	baseline, added, changed := pkg.DiffSearchResults(nil, first)
+	if len(baseline) != 2 || len(added) != 2 || len(changed) != 0 {
+		t.Fatalf("first diff: %d results, %d new, %d changed; want 2, 2, 0", len(baseline), len(added), len(changed))
+	}
+	if dup, _, _ := pkg.DiffSearchResults(nil, append(first, first[0])); len(dup) != 2 {
+		t.Errorf("a URL found twice gave %d results, want 2", len(dup))
+	}
+
+	tests := []struct {
+		name        string
+		pages       []models.WebPage
+		wantNew     []string
+		wantChanged []string
+	}{
+		{"unchanged", first, nil, nil},
+		{"content edited", []models.WebPage{first[0], {URL: "https://b.example/", Title: "B", Content: "beta v2"}}, nil, []string{"https://b.example/"}},
+		{"title edited", []models.WebPage{{URL: "https://a.example/", Title: "A!", Content: "alpha"}}, nil, []string{"https://a.example/"}},
+		{"new page", append([]models.WebPage{{URL: "https://c.example/", Title: "C"}}, first...), []string{"https://c.example/"}, nil},
+		{"page dropped out", first[:1], nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, added, changed := pkg.DiffSearchResults(baseline, tt.pages)
+			if len(results) != len(tt.pages) {
+				t.Errorf("%d results, want %d", len(results), len(tt.pages))
+			}
+			if got := alertURLs(added); fmt.Sprint(got) != fmt.Sprint(tt.wantNew) {
+				t.Errorf("new = %v, want %v", got, tt.wantNew)
+			}
+			if got := alertURLs(changed); fmt.Sprint(got) != fmt.Sprint(tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", got, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func alertURLs(pages []pkg.AlertPage) []string {
+	var urls []string
+	for _, p := range pages {
+		urls = append(urls, p.URL)
+	}
+	return urls
+}
+
+// fakeSavedSearches is an in-memory saved search store for a SavedSearchRunner.
+type fakeSavedSearches struct {
+	searches []*models.SavedSearch
+	errors   map[primitive.ObjectID]string
+}
+
+func (f *fakeSavedSearches) claim(ctx context.Context, now time.Time) (*models.SavedSearch, error) {
+	for _, s := range f.searches {
+		if !s.NextRunAt.After(now) {
+			interval, _ := time.ParseDuration(s.Schedule)
+			s.NextRunAt = now.Add(interval)
+			copied := *s
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeSavedSearches) record(ctx context.Context, id primitive.ObjectID, results []models.SavedSearchResult, runAt time.Time, runErr string) error {
+	for _, s := range f.searches {
+		if s.ID == id {
+			s.LastRunAt = runAt
+			f.errors[id] = runErr
+			if runErr == "" {
+				s.Results = results
+			}
+		}
+	}
+	return nil
+}
+
+func TestSavedSearchRunnerAlertsOnChanges(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := &fakeSavedSearches{errors: make(map[primitive.ObjectID]string)}
+	search := &models.SavedSearch{ID: primitive.NewObjectID(), Name: "go news", Query: "golang", Schedule: "1h", NextRunAt: now}
+	store.searches = append(store.searches, search)
+
+	pages := []models.WebPage{{URL: "https://a.example/", Title: "A", Content: "alpha"}}
+	var searchErr error
+	var notifyErr error
+	log := &pkg.LogNotifier{}
+	runner := &pkg.SavedSearchRunner{
+		Claim: store.claim,
+		Search: func(ctx context.Context, query, language string) ([]models.WebPage, error) {
+			return pages, searchErr
+		},
+		Record: store.record,
+		Notifier: func(s *models.SavedSearch) pkg.Notifier {
+			return notifierFunc(func(ctx context.Context, alert pkg.SearchAlert) error {
+				if notifyErr != nil {
+					return notifyErr
+				}
+				return log.Notify(ctx, alert)
+			})
+		},
+		Now: func() time.Time { return now },
+	}
+	run := func(advance time.Duration) int {
+		t.Helper()
+		now = now.Add(advance)
+		ran, err := runner.RunDue(context.Background())
+		if err != nil {
+			t.Fatalf("RunDue error = %v", err)
+		}
+		return ran
+	}
+
+	// The first run records the baseline without alerting.
+	if ran := run(0); ran != 1 || len(log.Alerts()) != 0 || len(search.Results) != 1 {
+		t.Fatalf("first run: ran %d, %d alerts, %d results; want 1, 0, 1", ran, len(log.Alerts()), len(search.Results))
+	}
+	// Not due again before the schedule.
+	if ran := run(30 * time.Minute); ran != 0 {
+		t.Fatalf("ran %d searches before they were due", ran)
+	}
+
+	pages = []models.WebPage{{URL: "https://a.example/", Title: "A", Content: "alpha v2"}, {URL: "https://b.example/", Title: "B"}}
+	run(30 * time.Minute)
+	alerts := log.Alerts()
+	if len(alerts) != 1 {
+		t.Fatalf("%d alerts after the results changed, want 1", len(alerts))
+	}
+	if a := alerts[0]; a.SearchID != search.ID.Hex() || a.Query != "golang" || !a.RunAt.Equal(now) ||
+		fmt.Sprint(alertURLs(a.New)) != "[https://b.example/]" || fmt.Sprint(alertURLs(a.Changed)) != "[https://a.example/]" {
+		t.Errorf("alert = %+v", a)
+	}
+
+	// Nothing changed: no alert.
+	run(time.Hour)
+	if len(log.Alerts()) != 1 {
+		t.Errorf("%d alerts after an unchanged run, want still 1", len(log.Alerts()))
+	}
+
+	// A failed delivery keeps the old results, so the change is reported again.
+	pages = append(pages, models.WebPage{URL: "https://c.example/", Title: "C"})
+	notifyErr = errors.New("webhook down")
+	var failures []error
+	runner.OnError = func(s *models.SavedSearch, err error) { failures = append(failures, err) }
+	run(time.Hour)
+	if len(failures) != 1 || store.errors[search.ID] != "webhook down" || len(search.Results) != 2 {
+		t.Fatalf("failed delivery: failures %v, recorded %q, %d results", failures, store.errors[search.ID], len(search.Results))
+	}
+	notifyErr = nil
+	run(time.Hour)
+	if alerts := log.Alerts(); len(alerts) != 2 || fmt.Sprint(alertURLs(alerts[1].New)) != "[https://c.example/]" {
+		t.Errorf("alerts after the webhook recovered: %+v", alerts)
+	}
+	if store.errors[search.ID] != "" {
+		t.Errorf("error %q still recorded after a successful run", store.errors[search.ID])
+	}
+
+	// A failed search is recorded and does not touch the results.
+	searchErr = errors.New("index unavailable")
+	run(time.Hour)
+	if store.errors[search.ID] != "index unavailable" || len(search.Results) != 3 {
+		t.Errorf("failed search: recorded %q, %d results", store.errors[search.ID], len(search.Results))
+	}
+}
+
+type notifierFunc func(ctx context.Context, alert pkg.SearchAlert) error
+
+func (f notifierFunc) Notify(ctx context.Context, alert pkg.SearchAlert) error { return f(ctx, alert) }
+
+func TestWebhookNotifierSignsAlerts(t *testing.T) {
+	sentAt := time.Unix(1714564800, 0)
+	received := make(chan error, 1)
+	var got pkg.SearchAlert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := pkg.VerifyWebhookSignature("s3cret", r.Header, body, 5*time.Minute, sentAt.Add(time.Minute))
+		if err == nil {
+			err = json.Unmarshal(body, &got)
+		}
+		received <- err
+	}))
+	defer server.Close()
+
+	notifier := &pkg.WebhookNotifier{URL: server.URL, Secret: "s3cret", Client: server.Client(), Now: func() time.Time { return sentAt }}
+	alert := pkg.SearchAlert{SearchID: "42", Name: "news", New: []pkg.AlertPage{{URL: "https://a.example/", Title: "A"}}}
+	if err := notifier.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify error = %v", err)
+	}
+	if err := <-received; err != nil {
+		t.Fatalf("receiver rejected the delivery: %v", err)
+	}
+	if got.SearchID != "42" || len(got.New) != 1 || got.New[0].URL != "https://a.example/" {
+		t.Errorf("received %+v", got)
+	}
+
+	// Tampered, wrongly keyed or stale deliveries are rejected.
+	body := []byte(`{"search_id":"42"}`)
+	header := http.Header{}
+	header.Set(pkg.WebhookTimestampHeader, fmt.Sprint(sentAt.Unix()))
+	header.Set(pkg.WebhookSignatureHeader, "sha256=00")
+	if err := pkg.VerifyWebhookSignature("s3cret", header, body, time.Minute, sentAt); !errors.Is(err, pkg.ErrBadSignature) {
+		t.Errorf("bad signature: err %v, want ErrBadSignature", err)
+	}
+	var captured http.Header
+	var capturedBody []byte
+	capture := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured = r.Header.Clone()
+		capturedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer capture.Close()
+	notifier.URL, notifier.Client = capture.URL, capture.Client()
+	notifier.Notify(context.Background(), alert)
+	if err := pkg.VerifyWebhookSignature("other", captured, capturedBody, time.Minute, sentAt); !errors.Is(err, pkg.ErrBadSignature) {
+		t.Errorf("wrong secret: err %v, want ErrBadSignature", err)
+	}
+	if err := pkg.VerifyWebhookSignature("s3cret", captured, capturedBody, time.Minute, sentAt.Add(time.Hour)); !errors.Is(err, pkg.ErrBadSignature) {
+		t.Errorf("stale delivery: err %v, want ErrBadSignature", err)
+	}
+	if err := pkg.VerifyWebhookSignature("s3cret", captured, append(capturedBody, ' '), time.Minute, sentAt); !errors.Is(err, pkg.ErrBadSignature) {
+		t.Errorf("tampered body: err %v, want ErrBadSignature", err)
+	}
+}
+
+func TestWebhookNotifierReportsFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	notifier := &pkg.WebhookNotifier{URL: server.URL, Secret: "s3cret", Client: server.Client()}
+	if err := notifier.Notify(context.Background(), pkg.SearchAlert{}); err == nil {
+		t.Error("Notify to a failing webhook returned no error")
+	}
+}
+
+func TestLogNotifier(t *testing.T) {
+	var lines []string
+	log := &pkg.LogNotifier{Logf: func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}}
+	log.Notify(context.Background(), pkg.SearchAlert{
+		Name:    "news",
+		New:     []pkg.AlertPage{{URL: "https://a.example/", Title: "A"}},
+		Changed: []pkg.AlertPage{{URL: "https://b.example/", Title: "B"}},
+	})
+	want := []string{
+		`saved search "news": new page https://a.example/ "A"`,
+		`saved search "news": changed page https://b.example/ "B"`,
+	}
+	if fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("logged %q, want %q", lines, want)
+	}
+	if alerts := log.Alerts(); len(alerts) != 1 || alerts[0].Name != "news" {
+		t.Errorf("Alerts() = %+v", alerts)
+	}
+}
@@ -0,0 +1,304 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"web_crawler/pkg"
+)
+
+func TestSchedulerRunsJobsAndReportsErrors(t *testing.T) {
+	sched := pkg.NewScheduler[int](4, 8)
+	var ran atomic.Int64
+	sched.Start(context.Background(), func(ctx context.Context, n int) error {
+		ran.Add(1)
+		if n%3 == 0 {
+			return fmt.Errorf("job %d failed", n)
+		}
+		return nil
+	})
+	defer sched.Stop()
+
+	var tasks []*pkg.Task[int]
+	for i := 1; i <= 30; i++ {
+		task, err := sched.Submit(context.Background(), i)
+		if err != nil {
+			t.Fatalf("Submit(%d) error = %v", i, err)
+		}
+		tasks = append(tasks, task)
+	}
+	for _, task := range tasks {
+		err := task.Err()
+		if wantErr := task.Job%3 == 0; (err != nil) != wantErr {
+			t.Errorf("job %d: err %v, want error %v", task.Job, err, wantErr)
+		}
+	}
+	if ran.Load() != 30 {
+		t.Errorf("ran %d jobs, want 30", ran.Load())
+	}
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	sched := pkg.NewScheduler[string](1, 1)
+	var mu sync.Mutex
+	var failed []string
+	sched.OnError = func(job string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, job)
+	}
+	sched.Start(context.Background(), func(ctx context.Context, job string) error {
+		if job == "boom" {
+			panic("kaboom")
+		}
+		return nil
+	})
+	defer sched.Stop()
+
+	boom, _ := sched.Submit(context.Background(), "boom")
+	var panicErr *pkg.PanicError
+	if err := boom.Err(); !errors.As(err, &panicErr) || panicErr.Value != "kaboom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("panicking job: err %v, want a PanicError with a stack", err)
+	}
+	// The only worker must have survived the panic.
+	fine, _ := sched.Submit(context.Background(), "fine")
+	if err := fine.Wait(context.Background()); err != nil {
+		t.Errorf("job after panic: err %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(failed) != 1 || failed[0] != "boom" {
+		t.Errorf("OnError saw %v, want [boom]", failed)
+	}
+}
+
+// blockingScheduler returns a started scheduler whose workers wait on release.
+func blockingScheduler(workers, queue int) (*pkg.Scheduler[int], chan struct{}, *atomic.Int64) {
+	sched := pkg.NewScheduler[int](workers, queue)
+	release := make(chan struct{})
+	var started atomic.Int64
+	sched.Start(context.Background(), func(ctx context.Context, n int) error {
+		started.Add(1)
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	return sched, release, &started
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulerBoundedQueue(t *testing.T) {
+	sched, release, started := blockingScheduler(1, 2)
+	defer sched.Stop()
+
+	if _, err := sched.Submit(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the worker to pick up the first job", func() bool { return started.Load() == 1 })
+	for i := 1; i <= 2; i++ {
+		if _, err := sched.TrySubmit(i); err != nil {
+			t.Fatalf("TrySubmit(%d) with room error = %v", i, err)
+		}
+	}
+	if _, err := sched.TrySubmit(3); !errors.Is(err, pkg.ErrQueueFull) {
+		t.Errorf("TrySubmit on a full queue: err %v, want ErrQueueFull", err)
+	}
+	if sched.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", sched.Len())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := sched.Submit(ctx, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit on a full queue: err %v, want the context deadline", err)
+	}
+
+	close(release)
+	task, err := sched.Submit(context.Background(), 4)
+	if err != nil || task.Err() != nil {
+		t.Errorf("Submit after release: err %v", err)
+	}
+}
+
+func TestSchedulerStop(t *testing.T) {
+	sched, _, started := blockingScheduler(1, 2)
+	running, _ := sched.Submit(context.Background(), 0)
+	waitFor(t, "the first job to start", func() bool { return started.Load() == 1 })
+	queued, _ := sched.Submit(context.Background(), 1)
+	sched.TrySubmit(2)
+
+	// A Submit waiting for room is released by Stop.
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := sched.Submit(context.Background(), 3)
+		blocked <- err
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sched.Stop()
+		}()
+	}
+	wg.Wait()
+	sched.Stop()
+
+	if err := running.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("running job: err %v, want its context cancelled", err)
+	}
+	if err := queued.Err(); !errors.Is(err, pkg.ErrSchedulerStopped) {
+		t.Errorf("queued job: err %v, want ErrSchedulerStopped", err)
+	}
+	if err := <-blocked; !errors.Is(err, pkg.ErrSchedulerStopped) {
+		t.Errorf("blocked Submit: err %v, want ErrSchedulerStopped", err)
+	}
+	if _, err := sched.Submit(context.Background(), 4); !errors.Is(err, pkg.ErrSchedulerStopped) {
+		t.Errorf("Submit after Stop: err %v, want ErrSchedulerStopped", err)
+	}
+	if _, err := sched.TrySubmit(4); !errors.Is(err, pkg.ErrSchedulerStopped) {
+		t.Errorf("TrySubmit after Stop: err %v, want ErrSchedulerStopped", err)
+	}
+	if started.Load() != 1 {
+		t.Errorf("%d jobs started, want only the one running before Stop", started.Load())
+	}
+}
+
+func TestSchedulerDrain(t *testing.T) {
+	sched := pkg.NewScheduler[int](2, 20)
+	var done atomic.Int64
+	sched.Start(context.Background(), func(ctx context.Context, n int) error {
+		time.Sleep(time.Millisecond)
+		done.Add(1)
+		return nil
+	})
+	for i := 0; i < 20; i++ {
+		sched.Submit(context.Background(), i)
+	}
+	if err := sched.Drain(context.Background()); err != nil {
+		t.Fatalf("Drain error = %v", err)
+	}
+	if done.Load() != 20 {
+		t.Errorf("%d jobs done after Drain, want all 20", done.Load())
+	}
+	if err := sched.Drain(context.Background()); err != nil {
+		t.Errorf("second Drain error = %v", err)
+	}
+	sched.Stop()
+	if _, err := sched.Submit(context.Background(), 0); !errors.Is(err, pkg.ErrSchedulerStopped) {
+		t.Errorf("Submit after Drain: err %v, want ErrSchedulerStopped", err)
+	}
+}
+
+func TestSchedulerDrainTimeout(t *testing.T) {
+	sched, _, started := blockingScheduler(1, 1)
+	running, _ := sched.Submit(context.Background(), 0)
+	waitFor(t, "the job to start", func() bool { return started.Load() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := sched.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Drain of a stuck job: err %v, want the context deadline", err)
+	}
+	if err := running.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("stuck job: err %v, want it cancelled once Drain gave up", err)
+	}
+}
+
+func TestSchedulerStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sched := pkg.NewScheduler[int](2, 0)
+	sched.Start(ctx, func(ctx context.Context, n int) error { return nil })
+	cancel()
+	waitFor(t, "the scheduler to stop", func() bool {
+		_, err := sched.TrySubmit(1)
+		return errors.Is(err, pkg.ErrSchedulerStopped)
+	})
+}
+
+func TestSchedulerStopWithoutStart(t *testing.T) {
+	sched := pkg.NewScheduler[int](1, 2)
+	task, _ := sched.Submit(context.Background(), 1)
+	sched.Stop()
+	if err := task.Err(); !errors.Is(err, pkg.ErrSchedulerStopped) {
+		t.Errorf("job queued before Start: err %v, want ErrSchedulerStopped", err)
+	}
+	sched.Start(context.Background(), func(ctx context.Context, n int) error {
+		t.Error("worker ran after Stop")
+		return nil
+	})
+}
+
+func TestSchedulerConcurrentSubmitAndStop(t *testing.T) {
+	sched := pkg.NewScheduler[int](4, 4)
+	var ran atomic.Int64
+	sched.Start(context.Background(), func(ctx context.Context, n int) error {
+		ran.Add(1)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int64
+	var mu sync.Mutex
+	var tasks []*pkg.Task[int]
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				task, err := sched.Submit(context.Background(), g*100+i)
+				if errors.Is(err, pkg.ErrSchedulerStopped) {
+					return
+				}
+				if err != nil {
+					t.Errorf("Submit error = %v", err)
+					return
+				}
+				accepted.Add(1)
+				mu.Lock()
+				tasks = append(tasks, task)
+				mu.Unlock()
+			}
+		}(g)
+	}
+	time.Sleep(5 * time.Millisecond)
+	sched.Stop()
+	wg.Wait()
+
+	// Every accepted job either ran or was discarded, and nothing ran after Stop returned.
+	after := ran.Load()
+	stopped := int64(0)
+	for _, task := range tasks {
+		select {
+		case <-task.Done():
+		default:
+			t.Fatalf("job %d never finished", task.Job)
+		}
+		if errors.Is(task.Err(), pkg.ErrSchedulerStopped) {
+			stopped++
+		}
+	}
+	if after+stopped != accepted.Load() {
+		t.Errorf("%d ran + %d discarded, want the %d accepted", after, stopped, accepted.Load())
+	}
+}
@@ -0,0 +1,156 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"web_crawler/models"
+	"web_crawler/pkg"
+)
+
+// fakeSuggester returns a Suggester whose lookups answer with the query as a completion
+// and count how often they ran.
+func fakeSuggester(calls *int32) *pkg.Suggester {
+	s := pkg.NewSuggester(time.Second, time.Minute, 10)
+	s.Suggest = func(ctx context.Context, query string, size int) (models.PageSuggestions, error) {
+		atomic.AddInt32(calls, 1)
+		return models.PageSuggestions{Completions: []models.PageCompletion{{Title: query}}}, nil
+	}
+	return s
+}
+
+func TestNormalizeSuggestQuery(t *testing.T) {
+	tests := map[string]string{
+		"Go":               "go",
+		"  Go   Crawler":   "go crawler",
+		"go ":              "go ",
+		"Go  Concurrency ": "go concurrency ",
+		"   ":              "",
+	}
+	for in, want := range tests {
+		if got := pkg.NormalizeSuggestQuery(in); got != want {
+			t.Errorf("NormalizeSuggestQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSuggesterCaches(t *testing.T) {
+	var calls int32
+	s := fakeSuggester(&calls)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+
+	for _, q := range []string{"Go Crawler", "go  crawler", "GO CRAWLER"} {
+		got, err := s.Get(context.Background(), q, 5)
+		if err != nil || len(got.Completions) != 1 || got.Completions[0].Title != "go crawler" {
+			t.Fatalf("Get(%q) = %+v, %v", q, got, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("%d lookups for one normalized query, want 1", calls)
+	}
+	s.Get(context.Background(), "go crawler", 3)
+	if calls != 2 {
+		t.Errorf("%d lookups after a different size, want 2", calls)
+	}
+
+	now = now.Add(time.Minute)
+	s.Get(context.Background(), "go crawler", 5)
+	if calls != 3 {
+		t.Errorf("%d lookups after the TTL, want 3", calls)
+	}
+}
+
+func TestSuggesterSharesLookupsInFlight(t *testing.T) {
+	var calls int32
+	s := fakeSuggester(&calls)
+	release := make(chan struct{})
+	suggest := s.Suggest
+	s.Suggest = func(ctx context.Context, query string, size int) (models.PageSuggestions, error) {
+		<-release
+		return suggest(ctx, query, size)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Get(context.Background(), "crawl", 5); err != nil {
+				t.Errorf("Get error = %v", err)
+			}
+		}()
+	}
+	for s.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("%d lookups for concurrent identical queries, want 1", calls)
+	}
+}
+
+func TestSuggesterBudget(t *testing.T) {
+	s := pkg.NewSuggester(20*time.Millisecond, time.Minute, 10)
+	s.Suggest = func(ctx context.Context, query string, size int) (models.PageSuggestions, error) {
+		<-ctx.Done()
+		return models.PageSuggestions{}, ctx.Err()
+	}
+	start := time.Now()
+	_, err := s.Get(context.Background(), "slow", 5)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get error = %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Get took %v with a 20ms budget", elapsed)
+	}
+	// The timed out lookup is not cached.
+	for deadline := time.Now().Add(time.Second); s.Len() > 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if s.Len() != 0 {
+		t.Errorf("%d entries cached after a timeout, want 0", s.Len())
+	}
+}
+
+func TestSuggesterDoesNotCacheErrors(t *testing.T) {
+	var calls int32
+	s := fakeSuggester(&calls)
+	s.Suggest = func(ctx context.Context, query string, size int) (models.PageSuggestions, error) {
+		atomic.AddInt32(&calls, 1)
+		return models.PageSuggestions{}, errors.New("index unavailable")
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.Get(context.Background(), "go", 5); err == nil {
+			t.Fatal("Get returned no error")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("%d lookups, want every failed lookup retried", calls)
+	}
+}
+
+func TestSuggesterEvictsOldest(t *testing.T) {
+	var calls int32
+	s := fakeSuggester(&calls)
+	s.MaxEntries = 2
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+	for _, q := range []string{"a", "b", "c"} {
+		now = now.Add(time.Second)
+		s.Get(context.Background(), q, 5)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("%d entries cached, want 2", s.Len())
+	}
+	s.Get(context.Background(), "c", 5)
+	s.Get(context.Background(), "a", 5)
+	if calls != 4 {
+		t.Errorf("%d lookups, want the oldest query looked up again and the newest cached", calls)
+	}
+}
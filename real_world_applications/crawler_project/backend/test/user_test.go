@@ -1 +1,111 @@
 package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"web_crawler/utils"
+)
+
+func TestVerificationTokenRoundTrip(t *testing.T) {
+	token, err := utils.GenerateVerificationToken("66900f1a2b3c4d5e6f708192", "jane@example.com")
+	if err != nil {
+		t.Fatalf("GenerateVerificationToken() error = %v", err)
+	}
+
+	userID, email, err := utils.ParseVerificationToken(token)
+	if err != nil {
+		t.Fatalf("ParseVerificationToken() error = %v", err)
+	}
+	if userID != "66900f1a2b3c4d5e6f708192" || email != "jane@example.com" {
+		t.Errorf("ParseVerificationToken() = %q, %q", userID, email)
+	}
+}
+
+func TestVerificationTokenRejectsOtherTokens(t *testing.T) {
+	loginToken, err := utils.GenerateJWT("66900f1a2b3c4d5e6f708192", "jane")
+	if err != nil {
+		t.Fatalf("GenerateJWT() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"Login token", loginToken},
+		{"Garbage", "not-a-token"},
+		{"Empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := utils.ParseVerificationToken(tt.token); err == nil {
+				t.Errorf("ParseVerificationToken() accepted %q", tt.token)
+			}
+		})
+	}
+}
+
+func TestResetTokenHash(t *testing.T) {
+	token, hash, err := utils.GenerateResetToken()
+	if err != nil {
+		t.Fatalf("GenerateResetToken() error = %v", err)
+	}
+	if token == hash {
+		t.Errorf("GenerateResetToken() returned the token as its own hash")
+	}
+	if utils.HashToken(token) != hash {
+		t.Errorf("HashToken() does not match the hash from GenerateResetToken()")
+	}
+
+	other, _, err := utils.GenerateResetToken()
+	if err != nil {
+		t.Fatalf("GenerateResetToken() error = %v", err)
+	}
+	if other == token {
+		t.Errorf("GenerateResetToken() returned the same token twice")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := utils.NewFileMailer(filepath.Join(dir, "mail"), "crawler@localhost")
+	if err != nil {
+		t.Fatalf("NewFileMailer() error = %v", err)
+	}
+
+	msg := utils.Message{
+		To:      "jane@example.com\r\nBcc: evil@example.com",
+		Subject: "Verify your email address",
+		Body:    "line one\nline two",
+	}
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	files, err := os.ReadDir(mailer.Dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d mail files, want 2", len(files))
+	}
+
+	data, err := os.ReadFile(filepath.Join(mailer.Dir, files[0].Name()))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	mail := string(data)
+	if !strings.Contains(mail, "Subject: Verify your email address\r\n") {
+		t.Errorf("mail is missing the subject header:\n%s", mail)
+	}
+	if strings.Contains(mail, "\r\nBcc:") {
+		t.Errorf("mail contains an injected header:\n%s", mail)
+	}
+	if !strings.HasSuffix(mail, "line one\r\nline two") {
+		t.Errorf("mail body was not normalised to CRLF:\n%s", mail)
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"web_crawler/pkg"
+)
+
+// readWARC returns every record in the file at path.
+func readWARC(t *testing.T, path string) []*pkg.WARCRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open %s: %v", path, err)
+	}
+	defer f.Close()
+	reader, err := pkg.NewWARCReader(f)
+	if err != nil {
+		t.Fatalf("NewWARCReader error = %v", err)
+	}
+	var records []*pkg.WARCRecord
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next error = %v", err)
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestFetchDocumentWritesWARC(t *testing.T) {
+	// "café" in ISO-8859-1, so the archive must hold the raw bytes rather than the transcoded body.
+	raw := []byte("Menu\n\ncaf\xe9 au lait")
+	// The menu is reached through two redirects, so only the final exchange is archived.
+	moves := map[string]string{"/lunch": "/today", "/today": "/menu.txt"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if to, ok := moves[r.URL.Path]; ok {
+			http.Redirect(w, r, to, http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=iso-8859-1")
+		w.Write(raw)
+	}))
+	defer server.Close()
+	allowLoopback(t)
+
+	dir := t.TempDir()
+	archive, err := pkg.NewWARCWriter(dir, "test", 1<<20)
+	if err != nil {
+		t.Fatalf("NewWARCWriter error = %v", err)
+	}
+	pkg.SetArchive(archive)
+	defer pkg.SetArchive(nil)
+
+	doc, err := pkg.FetchDocument(context.Background(), server.URL+"/lunch")
+	if err != nil {
+		t.Fatalf("FetchDocument error = %v", err)
+	}
+	if doc.URL != server.URL+"/menu.txt" {
+		t.Errorf("document URL = %q, want the redirect target", doc.URL)
+	}
+	if want := []string{server.URL + "/lunch", server.URL + "/today"}; fmt.Sprint(doc.Redirects) != fmt.Sprint(want) {
+		t.Errorf("redirects = %v, want %v", doc.Redirects, want)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if len(files) != 1 {
+		t.Fatalf("got %d finished WARC files, want 1", len(files))
+	}
+	records := readWARC(t, files[0])
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want warcinfo, response and request", len(records))
+	}
+	for i, want := range []string{"warcinfo", "response", "request"} {
+		if records[i].Type() != want {
+			t.Errorf("record %d type = %q, want %q", i, records[i].Type(), want)
+		}
+	}
+	response, request := records[1], records[2]
+	if response.TargetURI() != server.URL+"/menu.txt" {
+		t.Errorf("target URI = %q", response.TargetURI())
+	}
+	if request.Get("WARC-Concurrent-To") != response.Get("WARC-Record-ID") {
+		t.Errorf("request is not linked to its response")
+	}
+	if !bytes.HasSuffix(response.Block, raw) {
+		t.Errorf("response block does not end with the raw body: %q", response.Block)
+	}
+	if !strings.HasPrefix(string(request.Block), "GET /menu.txt HTTP/1.1\r\n") {
+		t.Errorf("unexpected request block %q", request.Block)
+	}
+
+	replayed, err := response.Document()
+	if err != nil {
+		t.Fatalf("Document error = %v", err)
+	}
+	if !bytes.Equal(replayed.Body, doc.Body) || replayed.ContentType != doc.ContentType || replayed.Charset != doc.Charset {
+		t.Errorf("replayed document %+v differs from fetched %+v", replayed, doc)
+	}
+}
+
+func TestWARCWriterRotates(t *testing.T) {
+	dir := t.TempDir()
+	archive, err := pkg.NewWARCWriter(dir, "rotate", 256)
+	if err != nil {
+		t.Fatalf("NewWARCWriter error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		err := archive.WriteRecord(&pkg.WARCRecord{
+			Fields: []pkg.WARCField{{Name: "WARC-Type", Value: "resource"}, {Name: "WARC-Target-URI", Value: fmt.Sprintf("urn:test:%d", i)}},
+			Block:  []byte(strings.Repeat("x", 100)),
+		})
+		if err != nil {
+			t.Fatalf("WriteRecord error = %v", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.warc.gz"))
+	if len(files) < 2 {
+		t.Fatalf("got %d files, want the writer to rotate", len(files))
+	}
+	if open, _ := filepath.Glob(filepath.Join(dir, "*.open")); len(open) != 0 {
+		t.Errorf("files left open after Close: %v", open)
+	}
+	resources := 0
+	for _, f := range files {
+		records := readWARC(t, f)
+		if records[0].Type() != "warcinfo" {
+			t.Errorf("%s starts with %q, want warcinfo", f, records[0].Type())
+		}
+		resources += len(records) - 1
+	}
+	if resources != 3 {
+		t.Errorf("got %d resource records across files, want 3", resources)
+	}
+}
+
+func TestReplayWARC(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("WARC/1.1\r\nWARC-Type: warcinfo\r\nContent-Length: 0\r\n\r\n\r\n\r\n")
+	block := "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{\"title\":\"Replayed\",\"url\":\"https://example.com/next\"}"
+	fmt.Fprintf(&buf, "WARC/1.1\r\nWARC-Type: response\r\nWARC-Target-URI: https://example.com/\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n", len(block), block)
+
+	var results []*pkg.PageResult
+	err := pkg.ReplayWARC(&buf, func(doc *pkg.Document) error {
+		result, err := pkg.Extract(doc)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayWARC error = %v", err)
+	}
+	if len(results) != 1 || results[0].Title != "Replayed" || !hasLink(results[0].Links, "https://example.com/next") {
+		t.Errorf("unexpected replay results %+v", results)
+	}
+}
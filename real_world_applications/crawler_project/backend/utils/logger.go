@@ -1,52 +1,71 @@
 package utils
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/sirupsen/logrus"
 )
 
-// CustomFormatter extends logrus to add your own prefix, for example
-type CustomFormatter struct {
-	logrus.Formatter
+// LogOptions controls where and how the application logs.
+type LogOptions struct {
+	// Level is a logrus level name such as "debug", "info" or "error".
+	Level string
+	// Output is "stdout", "stderr" or the path of a log file.
+	Output string
+	// MaxSizeMB rotates a log file once it grows past this size. Zero disables rotation.
+	MaxSizeMB int
+	// MaxBackups is the number of rotated files to keep.
+	MaxBackups int
 }
 
-// Format an entry
-func (f *CustomFormatter) Format(entry *logrus.Entry) ([]byte, error) {
-	entry.Message = "[MyApp] " + entry.Message
-	return f.Formatter.Format(entry)
-}
-
-func NewLogger() *logrus.Logger {
-	// Create a new instance of the logger
+// NewLogger creates a JSON logger configured by opts.
+// Every entry carries a timestamp, level and message plus whatever fields the caller attaches.
+func NewLogger(opts LogOptions) (*logrus.Logger, error) {
 	logger := logrus.New()
 
-	// Set the output (stdout, file, etc.)
-	logger.Out = os.Stdout
-
-	// Set the log level
-	logger.SetLevel(logrus.InfoLevel)
+	level := logrus.InfoLevel
+	if opts.Level != "" {
+		parsed, err := logrus.ParseLevel(opts.Level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %v", opts.Level, err)
+		}
+		level = parsed
+	}
+	logger.SetLevel(level)
 
-	// Set formatter
-	logger.SetFormatter(&CustomFormatter{
-		&logrus.TextFormatter{
-			FullTimestamp: true,
-			ForceColors:   true, // Enable colors in the terminal
+	logger.SetFormatter(&logrus.JSONFormatter{
+		TimestampFormat: "2006-01-02T15:04:05.000Z07:00",
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime: "ts",
+			logrus.FieldKeyMsg:  "msg",
 		},
 	})
 
-	// Example logging
-	logger.Info("This is an info message")
-	logger.Warn("This is a warning message")
-	logger.Error("This is an error message")
-
-	// If you want to log to a file instead of stdout
-	file, err := os.OpenFile("../../log.txt", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-	if err == nil {
-		logger.Out = file
-	} else {
-		logger.Info("Failed to log to file, using default stderr")
+	out, err := logOutput(opts)
+	if err != nil {
+		return nil, err
 	}
+	logger.SetOutput(out)
 
-	return logger
+	return logger, nil
+}
+
+// logOutput opens the writer named by opts.Output.
+func logOutput(opts LogOptions) (io.Writer, error) {
+	switch opts.Output {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	if opts.MaxSizeMB > 0 {
+		return NewRotatingFile(opts.Output, int64(opts.MaxSizeMB)*1024*1024, opts.MaxBackups)
+	}
+	file, err := os.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file: %v", err)
+	}
+	return file, nil
 }
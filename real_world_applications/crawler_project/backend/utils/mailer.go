@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails to users.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// FileMailer writes every message as an .eml file into a directory instead of sending it.
+// It is meant for local development and tests.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	mu  sync.Mutex
+	seq int
+}
+
+// NewFileMailer creates a FileMailer that stores messages in dir, creating it if needed.
+func NewFileMailer(dir string, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating mail directory: %v", err)
+	}
+	return &FileMailer{Dir: dir, From: from}, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// Send writes msg to a new file named after the time, a sequence number and the recipient.
+func (m *FileMailer) Send(msg Message) error {
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	name := fmt.Sprintf("%d-%04d-%s.eml", time.Now().UnixNano(), seq, unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	if err := os.WriteFile(filepath.Join(m.Dir, name), formatMessage(m.From, msg), 0644); err != nil {
+		return fmt.Errorf("error writing mail: %v", err)
+	}
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server using PLAIN authentication.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers msg through the configured SMTP server.
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := m.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	if err := smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, formatMessage(m.From, msg)); err != nil {
+		return fmt.Errorf("error sending mail: %v", err)
+	}
+	return nil
+}
+
+// formatMessage renders msg as a minimal RFC 5322 message.
+func formatMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// headerValue strips line breaks so user supplied values cannot inject extra headers.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
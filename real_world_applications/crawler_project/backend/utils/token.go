@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// EmailVerificationTTL is how long a signup verification link stays valid.
+	EmailVerificationTTL = 24 * time.Hour
+	// PasswordResetTTL is how long a password reset token stays valid.
+	PasswordResetTTL = time.Hour
+
+	emailVerificationPurpose = "email_verification"
+)
+
+// GenerateVerificationToken creates a signed token confirming ownership of an email address.
+// The token deliberately carries no "user_id" claim so it can never be used as a login token.
+//
+// Parameters:
+// - userID: The ID of the user who signed up.
+// - email: The email address being verified.
+//
+// Returns:
+// - A signed JWT string.
+// - An error if the signing process fails.
+func GenerateVerificationToken(userID string, email string) (string, error) {
+	var mySigningKey = []byte("secret")
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+
+	claims["sub"] = userID
+	claims["email"] = email
+	claims["purpose"] = emailVerificationPurpose
+	claims["exp"] = time.Now().Add(EmailVerificationTTL).Unix()
+
+	return token.SignedString(mySigningKey)
+}
+
+// ParseVerificationToken validates a token created by GenerateVerificationToken.
+//
+// Parameters:
+// - tokenString: The signed token taken from the verification link.
+//
+// Returns:
+// - The user ID and email address the token was issued for.
+// - An error if the token is malformed, expired, or was issued for another purpose.
+func ParseVerificationToken(tokenString string) (string, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte("secret"), nil
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", "", fmt.Errorf("invalid or expired token")
+	}
+	if purpose, _ := claims["purpose"].(string); purpose != emailVerificationPurpose {
+		return "", "", fmt.Errorf("invalid or expired token")
+	}
+	userID, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if userID == "" || email == "" {
+		return "", "", fmt.Errorf("invalid or expired token")
+	}
+	return userID, email, nil
+}
+
+// GenerateResetToken creates a random single-use password reset token.
+//
+// Returns:
+// - The token to send to the user.
+// - The hash of the token, which is the only form that should be stored.
+// - An error if the system random source fails.
+func GenerateResetToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the hex encoded SHA-256 digest of a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewID returns a random 16 character hex identifier for requests and crawl jobs.
+func NewID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// NewSecret returns a random 64 character hex secret, such as a webhook signing key.
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}